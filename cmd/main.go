@@ -13,6 +13,14 @@ import (
 )
 
 func main() {
+	// Dispatch subcommands before treating the first argument as a config path
+	if len(os.Args) > 1 && os.Args[1] == "search" {
+		os.Exit(runSearch(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "site" {
+		os.Exit(runSite(os.Args[2:]))
+	}
+
 	// Timestamp the start of runtime
 	startTime := time.Now()
 
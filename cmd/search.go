@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/search"
+)
+
+// runSearch implements the "search" subcommand, querying the index built by the "index" output mode.
+func runSearch(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.toml (used to locate the index)")
+	dbPath := fs.String("index", "", "path to the index database, overriding the config")
+	limit := fs.Int("limit", 20, "maximum number of results")
+	format := fs.String("format", "text", "output format: text, bibtex or ris")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: usptgo search [-config path] [-index path] [-limit n] [-format text|bibtex|ris] <query>")
+		fmt.Fprintln(fs.Output(), "Queries use SQLite FTS5 syntax; restrict a term to a field with e.g. title:widget")
+		fmt.Fprintln(fs.Output(), "Fields: doc_number, title, abstract, claims, description")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		fs.Usage()
+		return 2
+	}
+	if *format != "text" && *format != "bibtex" && *format != "ris" {
+		fmt.Fprintf(os.Stderr, "Unknown format %q\n", *format)
+		return 2
+	}
+
+	if *dbPath == "" {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+			return 1
+		}
+		*dbPath = filepath.Join(cfg.OutputDir, cfg.OutputConfig.IndexFileName)
+	}
+
+	results, err := search.Search(*dbPath, query, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Search failed: %s\n", err)
+		return 1
+	}
+
+	if *format != "text" {
+		entries, missing, err := search.Entries(*dbPath, results)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Export failed: %s\n", err)
+			return 1
+		}
+		if len(missing) > 0 && len(entries) == 0 {
+			fmt.Fprintln(os.Stderr, "The index has no citation entries for the matches, rebuild it with indexcitations = true")
+			return 1
+		}
+		for _, name := range missing {
+			fmt.Fprintf(os.Stderr, "No citation entry for %s\n", name)
+		}
+		for _, e := range entries {
+			if *format == "ris" {
+				fmt.Print(e.RIS())
+			} else {
+				fmt.Println(e.BibTeX())
+			}
+		}
+		if len(entries) == 0 {
+			fmt.Fprintln(os.Stderr, "No matches")
+		}
+		return 0
+	}
+
+	for i, r := range results {
+		fmt.Printf("%d. %s %s (%s) %s\n", i+1, r.DocNumber, r.KindCode, r.PubDate, r.Title)
+		fmt.Printf("   %s\n", strings.Join(strings.Fields(r.Snippet), " "))
+	}
+	if len(results) == 0 {
+		fmt.Println("No matches")
+	}
+	return 0
+}
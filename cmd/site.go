@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/site"
+)
+
+// runSite implements the "site" subcommand, generating a static website from the pages written by the "html" output mode.
+func runSite(args []string) int {
+	fs := flag.NewFlagSet("site", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.toml (used to locate the output directory)")
+	inDir := fs.String("in", "", "directory of the HTML pages and their manifests, overriding the config")
+	outDir := fs.String("out", "", "directory of the generated site (default <in>/site)")
+	title := fs.String("title", "Patent documents", "site title")
+	pageSize := fs.Int("pagesize", site.DefaultPageSize, "documents per listing page")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: usptgo site [-config path] [-in dir] [-out dir] [-title text] [-pagesize n]")
+		fmt.Fprintln(fs.Output(), "Lists the pages of the \"html\" output mode by week, year, CPC class and assignee, with a search page")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *inDir == "" {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+			return 1
+		}
+		*inDir = cfg.OutputDir
+	}
+	if *outDir == "" {
+		*outDir = filepath.Join(*inDir, "site")
+	}
+
+	summary, err := site.Generate(site.Options{InputDir: *inDir, OutputDir: *outDir, Title: *title, PageSize: *pageSize})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Generating site failed: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("Wrote %d documents to %s: %d weeks, %d years, %d CPC classes, %d assignees\n",
+		summary.Documents, *outDir, summary.Weeks, summary.Years, summary.CPC, summary.Assignees)
+	if summary.Missing > 0 {
+		fmt.Printf("Skipped %d pages listed in a manifest but missing from %s\n", summary.Missing, *inDir)
+	}
+	return 0
+}
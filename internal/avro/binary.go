@@ -0,0 +1,327 @@
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Encode appends the binary encoding of v to buf.
+func (s *Schema) Encode(buf []byte, v interface{}) ([]byte, error) {
+	switch s.Type {
+	case "null":
+		if v != nil {
+			return nil, fmt.Errorf("avro: expected null, got %T", v)
+		}
+		return buf, nil
+
+	case "boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("avro: expected boolean, got %T", v)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+
+	case "int", "long":
+		n, ok := toInt64(v)
+		if !ok {
+			return nil, fmt.Errorf("avro: expected %s, got %T", s.Type, v)
+		}
+		return binary.AppendVarint(buf, n), nil
+
+	case "float":
+		f, ok := toFloat64(v)
+		if !ok {
+			return nil, fmt.Errorf("avro: expected float, got %T", v)
+		}
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+
+	case "double":
+		f, ok := toFloat64(v)
+		if !ok {
+			return nil, fmt.Errorf("avro: expected double, got %T", v)
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+
+	case "bytes", "string":
+		var b []byte
+		switch v := v.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		default:
+			return nil, fmt.Errorf("avro: expected %s, got %T", s.Type, v)
+		}
+		buf = binary.AppendVarint(buf, int64(len(b)))
+		return append(buf, b...), nil
+
+	case "fixed":
+		b, ok := v.([]byte)
+		if !ok || len(b) != s.Size {
+			return nil, fmt.Errorf("avro: expected fixed of size %d for %s", s.Size, s.Name)
+		}
+		return append(buf, b...), nil
+
+	case "enum":
+		symbol, _ := v.(string)
+		for i, candidate := range s.Symbols {
+			if candidate == symbol {
+				return binary.AppendVarint(buf, int64(i)), nil
+			}
+		}
+		return nil, fmt.Errorf("avro: %q is not a symbol of enum %s", symbol, s.Name)
+
+	case "record":
+		record, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("avro: expected record %s, got %T", s.Name, v)
+		}
+		var err error
+		for _, field := range s.Fields {
+			if buf, err = field.Schema.Encode(buf, record[field.Name]); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", s.Name, field.Name, err)
+			}
+		}
+		return buf, nil
+
+	case "array":
+		items := reflect.ValueOf(v)
+		if v != nil && items.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("avro: expected array, got %T", v)
+		}
+		if v != nil && items.Len() > 0 {
+			buf = binary.AppendVarint(buf, int64(items.Len()))
+			var err error
+			for i := 0; i < items.Len(); i++ {
+				if buf, err = s.Items.Encode(buf, items.Index(i).Interface()); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return append(buf, 0), nil
+
+	case "map":
+		m, ok := v.(map[string]interface{})
+		if v != nil && !ok {
+			return nil, fmt.Errorf("avro: expected map, got %T", v)
+		}
+		if len(m) > 0 {
+			keys := make([]string, 0, len(m))
+			for key := range m {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys) // Deterministic output
+			buf = binary.AppendVarint(buf, int64(len(m)))
+			var err error
+			for _, key := range keys {
+				buf = binary.AppendVarint(buf, int64(len(key)))
+				buf = append(buf, key...)
+				if buf, err = s.Values.Encode(buf, m[key]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return append(buf, 0), nil
+
+	case "union":
+		for i, branch := range s.Branches {
+			if branch.accepts(v) {
+				buf = binary.AppendVarint(buf, int64(i))
+				return branch.Encode(buf, v)
+			}
+		}
+		return nil, fmt.Errorf("avro: no union branch accepts %T", v)
+	}
+	return nil, fmt.Errorf("avro: unsupported type %q", s.Type)
+}
+
+// accepts reports whether a union branch can encode v.
+func (s *Schema) accepts(v interface{}) bool {
+	switch v.(type) {
+	case nil:
+		return s.Type == "null"
+	case bool:
+		return s.Type == "boolean"
+	case int32:
+		return s.Type == "int" || s.Type == "long"
+	case int, int64:
+		return s.Type == "long" || s.Type == "int"
+	case float32, float64:
+		return s.Type == "float" || s.Type == "double"
+	case string:
+		return s.Type == "string" || s.Type == "enum"
+	case []byte:
+		return s.Type == "bytes" || (s.Type == "fixed" && len(v.([]byte)) == s.Size)
+	case map[string]interface{}:
+		return s.Type == "record" || s.Type == "map"
+	}
+	return s.Type == "array" && reflect.ValueOf(v).Kind() == reflect.Slice
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// byteReader is the input of Decode.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+var errNegativeLength = errors.New("avro: negative length")
+
+// Decode reads one value of the schema.
+func (s *Schema) Decode(r byteReader) (interface{}, error) {
+	switch s.Type {
+	case "null":
+		return nil, nil
+
+	case "boolean":
+		b, err := r.ReadByte()
+		return b != 0, err
+
+	case "int":
+		n, err := binary.ReadVarint(r)
+		return int32(n), err
+
+	case "long":
+		return binary.ReadVarint(r)
+
+	case "float":
+		var b [4]byte
+		_, err := io.ReadFull(r, b[:])
+		return math.Float32frombits(binary.LittleEndian.Uint32(b[:])), err
+
+	case "double":
+		var b [8]byte
+		_, err := io.ReadFull(r, b[:])
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[:])), err
+
+	case "bytes", "string":
+		n, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNegativeLength
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		if s.Type == "string" {
+			return string(b), nil
+		}
+		return b, nil
+
+	case "fixed":
+		b := make([]byte, s.Size)
+		_, err := io.ReadFull(r, b)
+		return b, err
+
+	case "enum":
+		n, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || int(n) >= len(s.Symbols) {
+			return nil, fmt.Errorf("avro: enum index %d out of range for %s", n, s.Name)
+		}
+		return s.Symbols[n], nil
+
+	case "record":
+		record := make(map[string]interface{}, len(s.Fields))
+		for _, field := range s.Fields {
+			v, err := field.Schema.Decode(r)
+			if err != nil {
+				return nil, err
+			}
+			record[field.Name] = v
+		}
+		return record, nil
+
+	case "array":
+		items := []interface{}{}
+		err := readBlocks(r, func() error {
+			v, err := s.Items.Decode(r)
+			items = append(items, v)
+			return err
+		})
+		return items, err
+
+	case "map":
+		m := map[string]interface{}{}
+		err := readBlocks(r, func() error {
+			key, err := (&Schema{Type: "string"}).Decode(r)
+			if err != nil {
+				return err
+			}
+			v, err := s.Values.Decode(r)
+			m[key.(string)] = v
+			return err
+		})
+		return m, err
+
+	case "union":
+		n, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || int(n) >= len(s.Branches) {
+			return nil, fmt.Errorf("avro: union index %d out of range", n)
+		}
+		return s.Branches[n].Decode(r)
+	}
+	return nil, fmt.Errorf("avro: unsupported type %q", s.Type)
+}
+
+// readBlocks reads the blocks of an array or map, calling item for each item.
+func readBlocks(r byteReader, item func() error) error {
+	for {
+		count, err := binary.ReadVarint(r)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if count < 0 {
+			// A negative count is followed by the size of the block in bytes
+			count = -count
+			if _, err := binary.ReadVarint(r); err != nil {
+				return err
+			}
+		}
+		for i := int64(0); i < count; i++ {
+			if err := item(); err != nil {
+				return err
+			}
+		}
+	}
+}
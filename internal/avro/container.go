@@ -0,0 +1,264 @@
+package avro
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// magic starts every object container file.
+var magic = []byte{'O', 'b', 'j', 1}
+
+// metadataSchema is the schema of the file header metadata.
+var metadataSchema = &Schema{Type: "map", Values: &Schema{Type: "bytes"}}
+
+// DefaultBlockSize is the uncompressed size at which Writer flushes a block.
+const DefaultBlockSize = 1024 * 1024
+
+// Writer writes an object container file.
+type Writer struct {
+	w         io.Writer
+	schema    *Schema
+	codec     string
+	sync      [16]byte
+	block     []byte
+	count     int64
+	BlockSize int
+}
+
+// NewWriter writes the header of an object container file with the given codec ("null", "deflate",
+// "snappy" or "zstandard") and additional metadata, such as the Iceberg table schema of a manifest.
+func NewWriter(w io.Writer, schema *Schema, codec string, metadata map[string][]byte) (*Writer, error) {
+	if codec == "" {
+		codec = "null"
+	}
+	if _, ok := codecs[codec]; !ok {
+		return nil, fmt.Errorf("avro: unsupported codec %q", codec)
+	}
+
+	aw := &Writer{w: w, schema: schema, codec: codec, BlockSize: DefaultBlockSize}
+	if _, err := rand.Read(aw.sync[:]); err != nil {
+		return nil, err
+	}
+
+	meta := map[string]interface{}{
+		"avro.schema": []byte(schema.String()),
+		"avro.codec":  []byte(codec),
+	}
+	for key, value := range metadata {
+		meta[key] = value
+	}
+
+	header := append([]byte{}, magic...)
+	header, err := metadataSchema.Encode(header, meta)
+	if err != nil {
+		return nil, err
+	}
+	header = append(header, aw.sync[:]...)
+	_, err = w.Write(header)
+	return aw, err
+}
+
+// Append encodes a value to the current block, flushing it once it reaches BlockSize.
+func (w *Writer) Append(v interface{}) error {
+	var err error
+	if w.block, err = w.schema.Encode(w.block, v); err != nil {
+		return err
+	}
+	w.count++
+	if len(w.block) >= w.BlockSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush writes the current block, if any.
+func (w *Writer) Flush() error {
+	if w.count == 0 {
+		return nil
+	}
+	data, err := codecs[w.codec].compress(w.block)
+	if err != nil {
+		return err
+	}
+
+	header := binary.AppendVarint(nil, w.count)
+	header = binary.AppendVarint(header, int64(len(data)))
+	for _, b := range [][]byte{header, data, w.sync[:]} {
+		if _, err := w.w.Write(b); err != nil {
+			return err
+		}
+	}
+	w.block, w.count = w.block[:0], 0
+	return nil
+}
+
+// Close flushes the final block. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.Flush()
+}
+
+// Reader reads an object container file.
+type Reader struct {
+	r        *bufio.Reader
+	Schema   *Schema
+	Metadata map[string][]byte
+	codec    string
+	sync     [16]byte
+	block    *bytes.Reader
+	count    int64
+	err      error
+}
+
+// NewReader reads the header of an object container file.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, head); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(head, magic) {
+		return nil, errors.New("avro: not an object container file")
+	}
+
+	meta, err := metadataSchema.Decode(br)
+	if err != nil {
+		return nil, err
+	}
+	ar := &Reader{r: br, Metadata: map[string][]byte{}}
+	for key, value := range meta.(map[string]interface{}) {
+		ar.Metadata[key] = value.([]byte)
+	}
+	if _, err := io.ReadFull(br, ar.sync[:]); err != nil {
+		return nil, err
+	}
+
+	if ar.Schema, err = ParseSchema(string(ar.Metadata["avro.schema"])); err != nil {
+		return nil, err
+	}
+	ar.codec = string(ar.Metadata["avro.codec"])
+	if ar.codec == "" {
+		ar.codec = "null"
+	}
+	if _, ok := codecs[ar.codec]; !ok {
+		return nil, fmt.Errorf("avro: unsupported codec %q", ar.codec)
+	}
+	return ar, nil
+}
+
+// Next decodes the next value, returning io.EOF at the end of the file.
+func (r *Reader) Next() (interface{}, error) {
+	for r.count == 0 {
+		if err := r.readBlock(); err != nil {
+			return nil, err
+		}
+	}
+	r.count--
+	return r.Schema.Decode(r.block)
+}
+
+func (r *Reader) readBlock() error {
+	count, err := binary.ReadVarint(r.r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		return err
+	}
+	size, err := binary.ReadVarint(r.r)
+	if err != nil {
+		return err
+	}
+	if count < 0 || size < 0 {
+		return errNegativeLength
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return err
+	}
+	var sync [16]byte
+	if _, err := io.ReadFull(r.r, sync[:]); err != nil {
+		return err
+	}
+	if sync != r.sync {
+		return errors.New("avro: invalid sync marker")
+	}
+
+	if data, err = codecs[r.codec].decompress(data); err != nil {
+		return err
+	}
+	r.block, r.count = bytes.NewReader(data), count
+	return nil
+}
+
+// codec compresses the data of blocks.
+type codec struct {
+	compress   func([]byte) ([]byte, error)
+	decompress func([]byte) ([]byte, error)
+}
+
+var codecs = map[string]codec{
+	"null": {
+		compress:   func(b []byte) ([]byte, error) { return b, nil },
+		decompress: func(b []byte) ([]byte, error) { return b, nil },
+	},
+	"deflate": {
+		compress: func(b []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := fw.Write(b); err != nil {
+				return nil, err
+			}
+			err = fw.Close()
+			return buf.Bytes(), err
+		},
+		decompress: func(b []byte) ([]byte, error) {
+			return io.ReadAll(flate.NewReader(bytes.NewReader(b)))
+		},
+	},
+	"snappy": {
+		// Each block is followed by the big-endian CRC32 of its uncompressed data
+		compress: func(b []byte) ([]byte, error) {
+			return binary.BigEndian.AppendUint32(snappy.Encode(nil, b), crc32.ChecksumIEEE(b)), nil
+		},
+		decompress: func(b []byte) ([]byte, error) {
+			if len(b) < 4 {
+				return nil, errors.New("avro: truncated snappy block")
+			}
+			data, err := snappy.Decode(nil, b[:len(b)-4])
+			if err != nil {
+				return nil, err
+			}
+			if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(b[len(b)-4:]) {
+				return nil, errors.New("avro: snappy block checksum mismatch")
+			}
+			return data, nil
+		},
+	},
+	"zstandard": {
+		compress: func(b []byte) ([]byte, error) {
+			return zstdEncoder.EncodeAll(b, nil), nil
+		},
+		decompress: func(b []byte) ([]byte, error) {
+			return zstdDecoder.DecodeAll(b, nil)
+		},
+	},
+}
+
+// The zstd encoder and decoder are safe for concurrent use of EncodeAll and DecodeAll.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
@@ -0,0 +1,234 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeSpecExamples(t *testing.T) {
+	// Encodings given in the Avro specification
+	tests := []struct {
+		schema string
+		value  interface{}
+		want   []byte
+	}{
+		{`"long"`, int64(0), []byte{0x00}},
+		{`"long"`, int64(-1), []byte{0x01}},
+		{`"long"`, int64(1), []byte{0x02}},
+		{`"long"`, int64(-64), []byte{0x7f}},
+		{`"long"`, int64(64), []byte{0x80, 0x01}},
+		{`"string"`, "foo", []byte{0x06, 0x66, 0x6f, 0x6f}},
+		{`{"type": "array", "items": "long"}`, []interface{}{int64(3), int64(27)}, []byte{0x04, 0x06, 0x36, 0x00}},
+		{`["null", "string"]`, nil, []byte{0x00}},
+		{`["null", "string"]`, "a", []byte{0x02, 0x02, 0x61}},
+		{`{"type": "record", "name": "test", "fields": [{"name": "a", "type": "long"}, {"name": "b", "type": "string"}]}`,
+			map[string]interface{}{"a": int64(27), "b": "foo"}, []byte{0x36, 0x06, 0x66, 0x6f, 0x6f}},
+	}
+	for _, tt := range tests {
+		schema := MustParseSchema(tt.schema)
+		got, err := schema.Encode(nil, tt.value)
+		if err != nil {
+			t.Errorf("Encode(%s, %v): %v", tt.schema, tt.value, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("Encode(%s, %v) = % x, want % x", tt.schema, tt.value, got, tt.want)
+		}
+		decoded, err := schema.Decode(bytes.NewReader(got))
+		if err != nil || !reflect.DeepEqual(decoded, tt.value) {
+			t.Errorf("Decode(%s, % x) = %#v, %v, want %#v", tt.schema, got, decoded, err, tt.value)
+		}
+	}
+}
+
+// testSchema covers every type the encoder supports.
+const testSchema = `{
+	"type": "record", "name": "Doc", "namespace": "test",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "claims", "type": "int"},
+		{"name": "title", "type": "string"},
+		{"name": "grant", "type": "boolean"},
+		{"name": "score", "type": "double"},
+		{"name": "ratio", "type": "float"},
+		{"name": "raw", "type": "bytes"},
+		{"name": "hash", "type": {"type": "fixed", "name": "Hash", "size": 4}},
+		{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A1", "B2"]}},
+		{"name": "cpc", "type": {"type": "array", "items": "string"}},
+		{"name": "counts", "type": {"type": "map", "values": "long"}},
+		{"name": "filed", "type": ["null", {"type": "int", "logicalType": "date"}]},
+		{"name": "parent", "type": ["null", {"type": "record", "name": "Parent", "fields": [{"name": "number", "type": "string"}]}]}
+	]
+}`
+
+// testRecords returns n records in the generic form Decode returns them.
+func testRecords(n int) []interface{} {
+	records := make([]interface{}, n)
+	for i := range records {
+		record := map[string]interface{}{
+			"id":     int64(i) * 1000003,
+			"claims": int32(i % 40),
+			"title":  strings.Repeat("battery ", i%7) + "électrode",
+			"grant":  i%2 == 0,
+			"score":  float64(i) / 3,
+			"ratio":  float32(i) / 4,
+			"raw":    []byte{byte(i), 0, 255},
+			"hash":   []byte{1, 2, 3, byte(i)},
+			"kind":   []string{"A1", "B2"}[i%2],
+			"cpc":    []interface{}{},
+			"counts": map[string]interface{}{},
+			"filed":  nil,
+			"parent": nil,
+		}
+		for j := 0; j < i%3; j++ {
+			record["cpc"] = append(record["cpc"].([]interface{}), "H01M 10/052")
+			record["counts"].(map[string]interface{})[string(rune('a'+j))] = int64(-j)
+		}
+		if i%5 != 0 {
+			record["filed"] = int32(19000 + i)
+			record["parent"] = map[string]interface{}{"number": "US16000000"}
+		}
+		records[i] = record
+	}
+	return records
+}
+
+func TestContainerRoundTrip(t *testing.T) {
+	schema := MustParseSchema(testSchema)
+	records := testRecords(200)
+	for _, codec := range []string{"null", "deflate", "snappy", "zstandard"} {
+		t.Run(codec, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, schema, codec, map[string][]byte{"iceberg.schema": []byte(`{"type":"struct"}`)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.BlockSize = 512 // Several blocks
+			for _, record := range records {
+				if err := w.Append(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(r.Metadata["avro.codec"]); got != codec {
+				t.Errorf("avro.codec = %q", got)
+			}
+			if got := string(r.Metadata["iceberg.schema"]); got != `{"type":"struct"}` {
+				t.Errorf("iceberg.schema = %q", got)
+			}
+			if r.Schema.String() != schema.String() {
+				t.Errorf("schema = %s", r.Schema)
+			}
+			for i, want := range records {
+				got, err := r.Next()
+				if err != nil {
+					t.Fatalf("record %d: %v", i, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("record %d = %#v, want %#v", i, got, want)
+				}
+			}
+			if _, err := r.Next(); err != io.EOF {
+				t.Errorf("Next after the last record = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+// TestReadSpecContainer reads a container file assembled by hand from the specification.
+func TestReadSpecContainer(t *testing.T) {
+	sync := bytes.Repeat([]byte{0xab}, 16)
+	schema := `"string"`
+
+	file := []byte{'O', 'b', 'j', 1}
+	file = binary.AppendVarint(file, 2) // Metadata map block of two entries
+	for _, kv := range [][2]string{{"avro.schema", schema}, {"avro.codec", "null"}} {
+		file = binary.AppendVarint(file, int64(len(kv[0])))
+		file = append(file, kv[0]...)
+		file = binary.AppendVarint(file, int64(len(kv[1])))
+		file = append(file, kv[1]...)
+	}
+	file = append(file, 0)
+	file = append(file, sync...)
+	for _, block := range [][]string{{"a", "bc"}, {"def"}} {
+		var data []byte
+		for _, s := range block {
+			data = binary.AppendVarint(data, int64(len(s)))
+			data = append(data, s...)
+		}
+		file = binary.AppendVarint(file, int64(len(block)))
+		file = binary.AppendVarint(file, int64(len(data)))
+		file = append(file, data...)
+		file = append(file, sync...)
+	}
+
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		v, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v.(string))
+	}
+	if strings.Join(got, ",") != "a,bc,def" {
+		t.Errorf("read %v", got)
+	}
+
+	// A wrong sync marker after a block is an error
+	file[len(file)-1] = 0
+	r, _ = NewReader(bytes.NewReader(file))
+	for err == nil {
+		_, err = r.Next()
+	}
+	if err == io.EOF {
+		t.Error("corrupt sync marker not detected")
+	}
+}
+
+func TestSnappyBlockChecksum(t *testing.T) {
+	data := []byte(strings.Repeat("snappy block ", 20))
+	block, err := codecs["snappy"].compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.BigEndian.Uint32(block[len(block)-4:]); got != crc32.ChecksumIEEE(data) {
+		t.Errorf("block ends with %08x, want the CRC32 of the uncompressed data %08x", got, crc32.ChecksumIEEE(data))
+	}
+	if got, err := codecs["snappy"].decompress(block); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("decompress = %q, %v", got, err)
+	}
+
+	block[len(block)-1] ^= 0xff
+	if _, err := codecs["snappy"].decompress(block); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("decompress with a corrupt checksum = %v, want a checksum error", err)
+	}
+}
+
+func TestZstandardBlockIsFrame(t *testing.T) {
+	block, err := codecs["zstandard"].compress([]byte("zstandard block"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(block, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		t.Errorf("block starts with % x, want the zstd frame magic number", block[:4])
+	}
+}
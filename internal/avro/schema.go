@@ -0,0 +1,187 @@
+// Package avro implements the subset of Apache Avro needed by the output modes: schema parsing,
+// generic binary encoding and decoding of Go values, and object container files.
+//
+// Values are represented generically: records and maps as map[string]interface{}, arrays as
+// []interface{}, int as int32, long as int64, bytes and fixed as []byte, enums as their symbol
+// and the null branch of a union as nil.
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Schema is a parsed Avro schema.
+type Schema struct {
+	Type        string // Primitive or complex type name, or "union"
+	Name        string // Full name of records, enums and fixed
+	LogicalType string
+	Fields      []*Field  // Record fields
+	Symbols     []string  // Enum symbols
+	Items       *Schema   // Array items
+	Values      *Schema   // Map values
+	Branches    []*Schema // Union branches
+	Size        int       // Fixed size
+
+	json string
+}
+
+// Field is a field of a record schema.
+type Field struct {
+	Name   string
+	Schema *Schema
+}
+
+// String returns the schema as JSON, as it was parsed.
+func (s *Schema) String() string {
+	return s.json
+}
+
+// Nullable reports whether nil is a valid value of the schema.
+func (s *Schema) Nullable() bool {
+	if s.Type == "null" {
+		return true
+	}
+	for _, branch := range s.Branches {
+		if branch.Type == "null" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSchema parses an Avro schema from its JSON form. Attributes that Avro does not define,
+// such as Iceberg field ids, are preserved in String but otherwise ignored.
+func ParseSchema(schemaJSON string) (*Schema, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(schemaJSON), &v); err != nil {
+		return nil, fmt.Errorf("avro: invalid schema JSON: %w", err)
+	}
+	s, err := parse(v, "", map[string]*Schema{})
+	if err != nil {
+		return nil, err
+	}
+	s.json = schemaJSON
+	return s, nil
+}
+
+// MustParseSchema is like ParseSchema but panics on error, for schemas declared as constants.
+func MustParseSchema(schemaJSON string) *Schema {
+	s, err := ParseSchema(schemaJSON)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func isPrimitive(name string) bool {
+	switch name {
+	case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+		return true
+	}
+	return false
+}
+
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func parse(v interface{}, namespace string, named map[string]*Schema) (*Schema, error) {
+	switch v := v.(type) {
+	case string:
+		if isPrimitive(v) {
+			return &Schema{Type: v}, nil
+		}
+		if s, ok := named[fullName(v, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := named[v]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("avro: unknown type %q", v)
+
+	case []interface{}:
+		s := &Schema{Type: "union"}
+		for _, branch := range v {
+			b, err := parse(branch, namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			s.Branches = append(s.Branches, b)
+		}
+		return s, nil
+
+	case map[string]interface{}:
+		typeName, _ := v["type"].(string)
+		logicalType, _ := v["logicalType"].(string)
+		if typeName == "" {
+			// e.g. {"type": {"type": "array", ...}}
+			return parse(v["type"], namespace, named)
+		}
+
+		if ns, ok := v["namespace"].(string); ok {
+			namespace = ns
+		}
+		name, _ := v["name"].(string)
+
+		switch typeName {
+		case "record", "error":
+			s := &Schema{Type: "record", Name: fullName(name, namespace), LogicalType: logicalType}
+			named[s.Name] = s // Registered before its fields, which may refer to it
+			fields, _ := v["fields"].([]interface{})
+			for _, f := range fields {
+				fm, ok := f.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("avro: invalid field in record %q", s.Name)
+				}
+				fieldName, _ := fm["name"].(string)
+				fs, err := parse(fm["type"], namespace, named)
+				if err != nil {
+					return nil, fmt.Errorf("avro: field %q of record %q: %w", fieldName, s.Name, err)
+				}
+				s.Fields = append(s.Fields, &Field{Name: fieldName, Schema: fs})
+			}
+			return s, nil
+
+		case "enum":
+			s := &Schema{Type: "enum", Name: fullName(name, namespace)}
+			symbols, _ := v["symbols"].([]interface{})
+			for _, symbol := range symbols {
+				str, _ := symbol.(string)
+				s.Symbols = append(s.Symbols, str)
+			}
+			named[s.Name] = s
+			return s, nil
+
+		case "fixed":
+			size, _ := v["size"].(float64)
+			s := &Schema{Type: "fixed", Name: fullName(name, namespace), Size: int(size), LogicalType: logicalType}
+			named[s.Name] = s
+			return s, nil
+
+		case "array":
+			items, err := parse(v["items"], namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			return &Schema{Type: "array", Items: items, LogicalType: logicalType}, nil
+
+		case "map":
+			values, err := parse(v["values"], namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			return &Schema{Type: "map", Values: values, LogicalType: logicalType}, nil
+		}
+
+		if isPrimitive(typeName) {
+			return &Schema{Type: typeName, LogicalType: logicalType}, nil
+		}
+		return parse(typeName, namespace, named)
+	}
+	return nil, fmt.Errorf("avro: invalid schema %v", v)
+}
@@ -0,0 +1,106 @@
+// Package bibliography formats patent documents as reference manager entries, in BibTeX and RIS.
+package bibliography
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// Name is an inventor, either a person or, rarely, an organization.
+type Name struct {
+	Family       string `json:"family,omitempty"`
+	Given        string `json:"given,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// Entry is the bibliographic data of a patent document needed to cite it. Dates are in YYYYMMDD form.
+type Entry struct {
+	Key               string   `json:"key"` // Citation key, e.g. "US11000000B2"
+	Grant             bool     `json:"grant"`
+	Title             string   `json:"title"`
+	Inventors         []Name   `json:"inventors,omitempty"`
+	Assignees         []string `json:"assignees,omitempty"`
+	Country           string   `json:"country"`
+	Number            string   `json:"number"` // Normalized number without country code, e.g. "11000000", "D912345", "20150012345"
+	Kind              string   `json:"kind,omitempty"`
+	PublicationDate   string   `json:"publicationDate,omitempty"`
+	ApplicationNumber string   `json:"applicationNumber,omitempty"` // Normalized, without country code
+	FilingDate        string   `json:"filingDate,omitempty"`
+	URL               string   `json:"url,omitempty"`
+}
+
+// Input is the content of a document to cite. Title is plain text as parsed from the bulk data; the remaining
+// bibliographic data is read from Raw, the raw split document.
+type Input struct {
+	Raw          []byte
+	DocumentType string // "grant" or "application"
+	Title        string
+}
+
+// New builds the entry of a document, linked with a URL built from the template (see ExpandURL).
+func New(in Input, urlTemplate string) (*Entry, error) {
+	biblio, err := patentxml.ParseBibliographic(in.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing bibliographic data: %w", err)
+	}
+	pub, app := biblio.Publication, biblio.Application
+	country, number := SplitNumber(patentxml.NormalizeDocNumber(pub.Country, pub.DocNumber))
+	if number == "" {
+		return nil, fmt.Errorf("document has no publication number")
+	}
+
+	e := &Entry{
+		Key:             country + number + pub.Kind,
+		Grant:           strings.EqualFold(in.DocumentType, "grant"),
+		Title:           patentxml.NormalizeSpace(in.Title),
+		Country:         country,
+		Number:          number,
+		Kind:            pub.Kind,
+		PublicationDate: pub.Date,
+		FilingDate:      app.Date,
+	}
+	_, e.ApplicationNumber = SplitNumber(patentxml.NormalizeDocNumber(app.Country, app.DocNumber))
+	for _, p := range biblio.Inventors {
+		if p.OrgName != "" {
+			e.Inventors = append(e.Inventors, Name{Organization: patentxml.NormalizeSpace(p.OrgName)})
+		} else {
+			e.Inventors = append(e.Inventors, Name{Family: patentxml.NormalizeSpace(p.LastName), Given: patentxml.NormalizeSpace(p.FirstName)})
+		}
+	}
+	for _, p := range biblio.Assignees {
+		if name := patentxml.NormalizeSpace(p.Name()); name != "" {
+			e.Assignees = append(e.Assignees, name)
+		}
+	}
+	e.URL = ExpandURL(urlTemplate, e)
+	return e, nil
+}
+
+// SplitNumber splits a normalized document number into its country code and number, e.g. "US", "11000000".
+func SplitNumber(normalized string) (country, number string) {
+	if len(normalized) < 2 {
+		return "", normalized
+	}
+	return normalized[:2], normalized[2:]
+}
+
+// ExpandURL replaces the placeholders of a URL template with the document's {country}, {number} (with
+// country code, e.g. US11000000), {docnumber} (without country code) and {kind}. An empty template gives no URL.
+func ExpandURL(template string, e *Entry) string {
+	return strings.NewReplacer(
+		"{country}", e.Country,
+		"{number}", e.Country+e.Number,
+		"{docnumber}", e.Number,
+		"{kind}", e.Kind,
+	).Replace(template)
+}
+
+// formatDate formats a YYYYMMDD date with a separator, e.g. "2024-01-02", or returns "" if it is not valid.
+func formatDate(date, sep string) string {
+	if len(date) != 8 || strings.Trim(date, "0123456789") != "" || date == "00000000" {
+		return ""
+	}
+	return date[:4] + sep + date[4:6] + sep + date[6:]
+}
@@ -0,0 +1,63 @@
+package bibliography
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+// fixtureEntry returns the entry of the fixture grant, linked to Google Patents.
+func fixtureEntry(t *testing.T) *Entry {
+	t.Helper()
+	doc := fixture.Doc(fixture.Grant)
+	e, err := New(Input{
+		Raw:          doc.RawSplitDoc,
+		DocumentType: doc.USPTGoMetadata.DocumentType,
+		Title:        doc.Patent.UsBibliographicData.InventionTitle.Text,
+	}, "https://patents.google.com/patent/{number}{kind}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestNew(t *testing.T) {
+	want := &Entry{
+		Key:               "US11000000B2",
+		Grant:             true,
+		Title:             "Solid electrolyte battery & method",
+		Inventors:         []Name{{Family: "Tanaka", Given: "Hiro"}, {Family: "Müller", Given: "Anna"}},
+		Assignees:         []string{"Acme Battery Co., Ltd."},
+		Country:           "US",
+		Number:            "11000000",
+		Kind:              "B2",
+		PublicationDate:   "20240102",
+		ApplicationNumber: "17123456",
+		FilingDate:        "20210315",
+		URL:               "https://patents.google.com/patent/US11000000B2",
+	}
+	if got := fixtureEntry(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("New =\n%+v\nwant\n%+v", got, want)
+	}
+	if _, err := New(Input{}, ""); err == nil {
+		t.Error("New without a raw document: no error")
+	}
+}
+
+func TestExpandURL(t *testing.T) {
+	e := &Entry{Country: "US", Number: "D912345", Kind: "S1"}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"https://patents.google.com/patent/{number}{kind}", "https://patents.google.com/patent/USD912345S1"},
+		{"https://example.org/{country}/{docnumber}", "https://example.org/US/D912345"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ExpandURL(tt.template, e); got != tt.want {
+			t.Errorf("ExpandURL(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
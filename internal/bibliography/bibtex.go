@@ -0,0 +1,110 @@
+package bibliography
+
+import (
+	"strconv"
+	"strings"
+)
+
+// latexEscaper escapes the characters BibTeX and LaTeX treat specially. Other characters are written as UTF-8,
+// which biber and LaTeX with a UTF-8 input encoding accept.
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`^`, `\^{}`,
+	`~`, `\~{}`,
+	`<`, `\textless{}`,
+	`>`, `\textgreater{}`,
+)
+
+func latex(s string) string {
+	return latexEscaper.Replace(strings.Join(strings.Fields(s), " "))
+}
+
+var bibtexMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+// bibtexName formats an inventor as "Family, Given". Organizations are braced so they are not split into name parts.
+func bibtexName(n Name) string {
+	switch {
+	case n.Organization != "":
+		return "{" + latex(n.Organization) + "}"
+	case n.Given == "":
+		return "{" + latex(n.Family) + "}"
+	}
+	family := latex(n.Family)
+	if strings.Contains(" "+strings.ToLower(family)+" ", " and ") {
+		family = "{" + family + "}"
+	}
+	return family + ", " + latex(n.Given)
+}
+
+// BibTeX formats the entry as a @patent entry. It carries both the biblatex fields (type, holder, date) and
+// those of BibTeX styles with patent support such as IEEEtran (nationality, assignee, year, month, day).
+func (e *Entry) BibTeX() string {
+	type field struct{ name, value string }
+	var fields []field
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, field{name, "{" + value + "}"})
+		}
+	}
+
+	var authors []string
+	for _, n := range e.Inventors {
+		authors = append(authors, bibtexName(n))
+	}
+	add("author", strings.Join(authors, " and "))
+	if e.Title != "" {
+		// Double braces keep the capitalization of the title
+		add("title", "{"+latex(e.Title)+"}")
+	}
+	add("number", latex(e.Number))
+	patentType := "patent"
+	if !e.Grant {
+		patentType = "patreq"
+	}
+	if e.Country != "" {
+		patentType += strings.ToLower(e.Country)
+	}
+	add("type", patentType)
+	add("nationality", latex(e.Country))
+	var holders []string
+	for _, a := range e.Assignees {
+		holders = append(holders, "{"+latex(a)+"}")
+	}
+	add("holder", strings.Join(holders, " and "))
+	add("assignee", strings.Join(holders, " and "))
+	if date := formatDate(e.PublicationDate, "-"); date != "" {
+		add("date", date)
+		add("year", date[:4])
+		month, _ := strconv.Atoi(date[5:7])
+		if month >= 1 && month <= 12 {
+			fields = append(fields, field{"month", bibtexMonths[month-1]})
+		}
+		day, _ := strconv.Atoi(date[8:])
+		add("day", strconv.Itoa(day))
+	}
+	var note []string
+	if e.ApplicationNumber != "" {
+		note = append(note, "Appl. No. "+latex(e.ApplicationNumber))
+	}
+	if filed := formatDate(e.FilingDate, "-"); filed != "" {
+		note = append(note, "filed "+filed)
+	}
+	add("note", strings.Join(note, ", "))
+	// URLs are read verbatim by the url package, only braces need escaping
+	add("url", strings.NewReplacer("{", "%7B", "}", "%7D").Replace(e.URL))
+
+	var b strings.Builder
+	b.WriteString("@patent{" + e.Key)
+	for _, f := range fields {
+		b.WriteString(",\n  " + f.name + strings.Repeat(" ", 11-len(f.name)) + " = " + f.value)
+	}
+	b.WriteString("\n}\n")
+	return b.String()
+}
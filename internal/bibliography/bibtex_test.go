@@ -0,0 +1,80 @@
+package bibliography
+
+import "testing"
+
+func TestBibTeX(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *Entry
+		want  string
+	}{
+		{
+			name: "fixture grant",
+			want: `@patent{US11000000B2,
+  author      = {Tanaka, Hiro and Müller, Anna},
+  title       = {{Solid electrolyte battery \& method}},
+  number      = {11000000},
+  type        = {patentus},
+  nationality = {US},
+  holder      = {{Acme Battery Co., Ltd.}},
+  assignee    = {{Acme Battery Co., Ltd.}},
+  date        = {2024-01-02},
+  year        = {2024},
+  month       = jan,
+  day         = {2},
+  note        = {Appl. No. 17123456, filed 2021-03-15},
+  url         = {https://patents.google.com/patent/US11000000B2}
+}
+`,
+		},
+		{
+			name: "special characters and names",
+			entry: &Entry{
+				Key:   "US20150012345A1",
+				Title: `100% & $5 #1 a_b {x} ~y ^z \w <t>`,
+				Inventors: []Name{
+					{Organization: "R&D Labs_Inc"},
+					{Family: "Smith and Jones", Given: "Ann"},
+					{Family: "Anderson", Given: "Bo"},
+					{Family: "Madonna"},
+				},
+				Assignees:       []string{"Acme & Sons", "Beta {Labs}"},
+				Country:         "US",
+				Number:          "20150012345",
+				Kind:            "A1",
+				PublicationDate: "20151231",
+				FilingDate:      "2015",
+				URL:             "https://example.org/{US}/20150012345",
+			},
+			want: `@patent{US20150012345A1,
+  author      = {{R\&D Labs\_Inc} and {Smith and Jones}, Ann and Anderson, Bo and {Madonna}},
+  title       = {{100\% \& \$5 \#1 a\_b \{x\} \~{}y \^{}z \textbackslash{}w \textless{}t\textgreater{}}},
+  number      = {20150012345},
+  type        = {patrequs},
+  nationality = {US},
+  holder      = {{Acme \& Sons} and {Beta \{Labs\}}},
+  assignee    = {{Acme \& Sons} and {Beta \{Labs\}}},
+  date        = {2015-12-31},
+  year        = {2015},
+  month       = dec,
+  day         = {31},
+  url         = {https://example.org/%7BUS%7D/20150012345}
+}
+`,
+		},
+		{
+			name:  "no data",
+			entry: &Entry{Key: "X1"},
+			want:  "@patent{X1,\n  type        = {patreq}\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		entry := tt.entry
+		if entry == nil {
+			entry = fixtureEntry(t)
+		}
+		if got := entry.BibTeX(); got != tt.want {
+			t.Errorf("%s: BibTeX =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package bibliography
+
+import (
+	"strings"
+)
+
+// risValue puts a value on a single line, as RIS has no continuation lines or escaping.
+func risValue(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// RIS formats the entry as a PAT record, with the tags reference managers read for patents: SN the patent
+// number, M1 the application number, M3 the patent type, PB the assignees and CY the issuing country.
+// Lines end with CRLF and the record ends with an empty line.
+func (e *Entry) RIS() string {
+	var b strings.Builder
+	add := func(tag, value string) {
+		if value = risValue(value); value != "" {
+			b.WriteString(tag + "  - " + value + "\r\n")
+		}
+	}
+
+	add("TY", "PAT")
+	add("ID", e.Key)
+	add("TI", e.Title)
+	for _, n := range e.Inventors {
+		if n.Organization != "" {
+			add("AU", n.Organization)
+		} else if n.Given == "" {
+			add("AU", n.Family)
+		} else {
+			add("AU", n.Family+", "+n.Given)
+		}
+	}
+	add("PB", strings.Join(e.Assignees, "; "))
+	add("CY", e.Country)
+	add("SN", e.Country+e.Number+e.Kind)
+	if e.Grant {
+		add("M3", "Patent")
+	} else {
+		add("M3", "Patent application")
+	}
+	add("M1", e.ApplicationNumber)
+	if date := formatDate(e.PublicationDate, "/"); date != "" {
+		add("PY", date[:4])
+		add("DA", date+"/")
+	}
+	if filed := formatDate(e.FilingDate, "-"); filed != "" {
+		add("N1", "Filed "+filed)
+	}
+	add("UR", e.URL)
+	b.WriteString("ER  - \r\n\r\n")
+	return b.String()
+}
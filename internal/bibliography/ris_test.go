@@ -0,0 +1,72 @@
+package bibliography
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRIS(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *Entry
+		want  []string
+	}{
+		{
+			name: "fixture grant",
+			want: []string{
+				"TY  - PAT",
+				"ID  - US11000000B2",
+				"TI  - Solid electrolyte battery & method",
+				"AU  - Tanaka, Hiro",
+				"AU  - Müller, Anna",
+				"PB  - Acme Battery Co., Ltd.",
+				"CY  - US",
+				"SN  - US11000000B2",
+				"M3  - Patent",
+				"M1  - 17123456",
+				"PY  - 2024",
+				"DA  - 2024/01/02/",
+				"N1  - Filed 2021-03-15",
+				"UR  - https://patents.google.com/patent/US11000000B2",
+			},
+		},
+		{
+			name: "special characters and names",
+			entry: &Entry{
+				Key:   "US20150012345A1",
+				Title: "100% & $5 #1 a_b {x} ~y ^z \\w\r\n  <t>",
+				Inventors: []Name{
+					{Organization: "R&D Labs_Inc"},
+					{Family: "Smith and Jones", Given: "Ann"},
+					{Family: "Madonna"},
+				},
+				Assignees: []string{"Acme & Sons", "Beta Labs"},
+				Country:   "US",
+				Number:    "20150012345",
+				Kind:      "A1",
+			},
+			want: []string{
+				"TY  - PAT",
+				"ID  - US20150012345A1",
+				"TI  - 100% & $5 #1 a_b {x} ~y ^z \\w <t>",
+				"AU  - R&D Labs_Inc",
+				"AU  - Smith and Jones, Ann",
+				"AU  - Madonna",
+				"PB  - Acme & Sons; Beta Labs",
+				"CY  - US",
+				"SN  - US20150012345A1",
+				"M3  - Patent application",
+			},
+		},
+	}
+	for _, tt := range tests {
+		entry := tt.entry
+		if entry == nil {
+			entry = fixtureEntry(t)
+		}
+		want := strings.Join(tt.want, "\r\n") + "\r\nER  - \r\n\r\n"
+		if got := entry.RIS(); got != want {
+			t.Errorf("%s: RIS =\n%q\nwant\n%q", tt.name, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/spf13/viper"
@@ -13,8 +14,95 @@ type TuningConfig struct {
 }
 
 type OutputConfig struct {
-	TextFormat         string
-	ParquetCompression string
+	TextFormat          string
+	DescriptionSections bool
+	ParquetCompression  string
+	ParquetSchema       string
+
+	// Parquet writer tuning
+	ParquetRowGroupSizeMB int
+	ParquetPageSizeKB     int
+	ParquetParallelism    int
+	ParquetChannelSize    int
+	ParquetMaxFileSizeMB  int
+	ParquetMaxFileRows    int
+	ParquetColumnEncoding map[string]string
+
+	// Codecs of columns compressed differently from ParquetCompression, by column path
+	ParquetColumnCompression map[string]string
+
+	// Parquet dataset layout
+	ParquetLayout           string
+	ParquetPartitionBy      []string
+	ParquetTargetFileSizeMB int
+
+	// Delta Lake output
+	DeltaTableName string
+
+	// Iceberg output
+	IcebergWarehouse   string
+	IcebergTable       string
+	IcebergPartitionBy []string
+
+	// Avro output
+	AvroCodec string
+
+	// Arrow output
+	ArrowFormat    string
+	ArrowBatchSize int
+
+	// HTML output
+	HTMLTemplate string
+
+	// Corpus output
+	CorpusChunkTokens   int
+	CorpusOverlapTokens int
+
+	// Claim graph output
+	ClaimGraphFormat string
+
+	// Citation output
+	CitationFormat   string
+	CitationFileName string
+
+	// PatentsView output
+	PatentsViewFormat    string
+	PatentsViewDirectory string
+
+	// RDF output
+	RDFFormat  string
+	RDFBaseIRI string
+
+	// Bibliography output
+	BibliographyURLTemplate string
+
+	// JSON output
+	JSONIndent      bool
+	JSONCompression string
+	JSONNaming      string
+
+	// CSV output
+	CSVDelimiter          string
+	CSVQuoting            string
+	CSVMaxTextLength      int
+	CSVExcludeDescription bool
+	CSVColumns            []string
+
+	// SQLite output
+	SQLiteFileName  string
+	SQLiteBatchSize int
+
+	// Full-text search index output
+	IndexFileName  string
+	IndexCitations bool // Store a citation entry per document for export of search results, which needs the raw XML
+
+	// Elasticsearch/OpenSearch bulk output
+	OpenSearchIndex      string
+	OpenSearchEndpoint   string
+	OpenSearchUsername   string
+	OpenSearchPassword   string
+	OpenSearchBatchSize  int
+	OpenSearchMaxRetries int
 }
 
 type LoggerConfig struct {
@@ -44,6 +132,9 @@ type Config struct {
 	DevConfig DevConfig
 }
 
+// ParquetCompressionCodecs are the values accepted by parquetcompression and parquetcolumncompression.
+var ParquetCompressionCodecs = []string{"snappy", "gzip", "lz4", "zstd", "no-compress"}
+
 func LoadConfig(cliArgConfigPath string) (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("toml")
@@ -56,7 +147,52 @@ func LoadConfig(cliArgConfigPath string) (*Config, error) {
 	}
 
 	viper.SetDefault("output.textformatting", "innerxml")
+	viper.SetDefault("output.descriptionsections", false)
 	viper.SetDefault("output.parquetcompression", "snappy")
+	viper.SetDefault("output.parquetschema", "v1")
+	viper.SetDefault("output.parquetrowgroupsizemb", 128)
+	viper.SetDefault("output.parquetpagesizekb", 8)
+	viper.SetDefault("output.parquetparallelism", 4)
+	viper.SetDefault("output.parquetchannelsize", 100)
+	viper.SetDefault("output.parquetmaxfilesizemb", 0)
+	viper.SetDefault("output.parquetmaxfilerows", 0)
+	viper.SetDefault("output.parquetlayout", "perzip")
+	viper.SetDefault("output.parquetpartitionby", []string{"doc_type", "year", "month"})
+	viper.SetDefault("output.parquettargetfilesizemb", 512)
+	viper.SetDefault("output.deltatablename", "patents_delta")
+	viper.SetDefault("output.icebergwarehouse", "warehouse")
+	viper.SetDefault("output.icebergtable", "uspto.patents")
+	viper.SetDefault("output.icebergpartitionby", []string{"doc_type"})
+	viper.SetDefault("output.avrocodec", "deflate")
+	viper.SetDefault("output.arrowformat", "file")
+	viper.SetDefault("output.arrowbatchsize", 1024)
+	viper.SetDefault("output.htmltemplate", "")
+	viper.SetDefault("output.corpuschunktokens", 512)
+	viper.SetDefault("output.corpusoverlaptokens", 64)
+	viper.SetDefault("output.claimgraphformat", "json")
+	viper.SetDefault("output.citationformat", "parquet")
+	viper.SetDefault("output.citationfilename", "citations")
+	viper.SetDefault("output.patentsviewformat", "tsv")
+	viper.SetDefault("output.patentsviewdirectory", "patentsview")
+	viper.SetDefault("output.rdfformat", "ntriples")
+	viper.SetDefault("output.rdfbaseiri", "https://example.org/uspto/")
+	viper.SetDefault("output.bibliographyurltemplate", "https://patents.google.com/patent/{number}{kind}/en")
+	viper.SetDefault("output.jsonindent", true)
+	viper.SetDefault("output.jsoncompression", "none")
+	viper.SetDefault("output.jsonnaming", "filename")
+	viper.SetDefault("output.csvdelimiter", ",")
+	viper.SetDefault("output.csvquoting", "minimal")
+	viper.SetDefault("output.csvmaxtextlength", 0)
+	viper.SetDefault("output.csvexcludedescription", false)
+	viper.SetDefault("output.csvcolumns", []string{})
+	viper.SetDefault("output.sqlitefilename", "patents.db")
+	viper.SetDefault("output.sqlitebatchsize", 500)
+	viper.SetDefault("output.indexfilename", "search.db")
+	viper.SetDefault("output.indexcitations", false)
+	viper.SetDefault("output.opensearchindex", "patents-{year}")
+	viper.SetDefault("output.opensearchendpoint", "")
+	viper.SetDefault("output.opensearchbatchsize", 500)
+	viper.SetDefault("output.opensearchmaxretries", 3)
 
 	viper.SetDefault("logging.logmode", "prod")
 	viper.SetDefault("logging.loglevel", "warn")
@@ -72,6 +208,16 @@ func LoadConfig(cliArgConfigPath string) (*Config, error) {
 		return nil, fmt.Errorf("fatal error config file: %w", err)
 	}
 
+	// Column names are checked against the schema when the Parquet writer is created, the codecs here
+	if codec := viper.GetString("output.parquetcompression"); !slices.Contains(ParquetCompressionCodecs, codec) {
+		return nil, fmt.Errorf("output.parquetcompression %q is not one of %q", codec, ParquetCompressionCodecs)
+	}
+	for column, codec := range viper.GetStringMapString("output.parquetcolumncompression") {
+		if !slices.Contains(ParquetCompressionCodecs, codec) {
+			return nil, fmt.Errorf("output.parquetcolumncompression %q for column %q is not one of %q", codec, column, ParquetCompressionCodecs)
+		}
+	}
+
 	return &Config{
 		InputDir:   viper.GetString("required.inputdirectory"),
 		OutputDir:  viper.GetString("required.outputdirectory"),
@@ -84,8 +230,72 @@ func LoadConfig(cliArgConfigPath string) (*Config, error) {
 		},
 
 		OutputConfig: OutputConfig{
-			TextFormat:         viper.GetString("output.textformatting"),
-			ParquetCompression: viper.GetString("out.parquetcompression"),
+			TextFormat:          viper.GetString("output.textformatting"),
+			DescriptionSections: viper.GetBool("output.descriptionsections"),
+			ParquetCompression:  viper.GetString("output.parquetcompression"),
+			ParquetSchema:       viper.GetString("output.parquetschema"),
+
+			ParquetRowGroupSizeMB: viper.GetInt("output.parquetrowgroupsizemb"),
+			ParquetPageSizeKB:     viper.GetInt("output.parquetpagesizekb"),
+			ParquetParallelism:    viper.GetInt("output.parquetparallelism"),
+			ParquetChannelSize:    viper.GetInt("output.parquetchannelsize"),
+			ParquetMaxFileSizeMB:  viper.GetInt("output.parquetmaxfilesizemb"),
+			ParquetMaxFileRows:    viper.GetInt("output.parquetmaxfilerows"),
+			ParquetColumnEncoding: viper.GetStringMapString("output.parquetcolumnencoding"),
+
+			ParquetColumnCompression: viper.GetStringMapString("output.parquetcolumncompression"),
+
+			ParquetLayout:           viper.GetString("output.parquetlayout"),
+			ParquetPartitionBy:      viper.GetStringSlice("output.parquetpartitionby"),
+			ParquetTargetFileSizeMB: viper.GetInt("output.parquettargetfilesizemb"),
+
+			DeltaTableName: viper.GetString("output.deltatablename"),
+
+			IcebergWarehouse:   viper.GetString("output.icebergwarehouse"),
+			IcebergTable:       viper.GetString("output.icebergtable"),
+			IcebergPartitionBy: viper.GetStringSlice("output.icebergpartitionby"),
+
+			AvroCodec: viper.GetString("output.avrocodec"),
+
+			ArrowFormat:    viper.GetString("output.arrowformat"),
+			ArrowBatchSize: viper.GetInt("output.arrowbatchsize"),
+
+			HTMLTemplate: viper.GetString("output.htmltemplate"),
+
+			CorpusChunkTokens:    viper.GetInt("output.corpuschunktokens"),
+			CorpusOverlapTokens:  viper.GetInt("output.corpusoverlaptokens"),
+			ClaimGraphFormat:     viper.GetString("output.claimgraphformat"),
+			CitationFormat:       viper.GetString("output.citationformat"),
+			CitationFileName:     viper.GetString("output.citationfilename"),
+			PatentsViewFormat:    viper.GetString("output.patentsviewformat"),
+			PatentsViewDirectory: viper.GetString("output.patentsviewdirectory"),
+			RDFFormat:            viper.GetString("output.rdfformat"),
+			RDFBaseIRI:           viper.GetString("output.rdfbaseiri"),
+
+			BibliographyURLTemplate: viper.GetString("output.bibliographyurltemplate"),
+
+			JSONIndent:      viper.GetBool("output.jsonindent"),
+			JSONCompression: viper.GetString("output.jsoncompression"),
+			JSONNaming:      viper.GetString("output.jsonnaming"),
+
+			CSVDelimiter:          viper.GetString("output.csvdelimiter"),
+			CSVQuoting:            viper.GetString("output.csvquoting"),
+			CSVMaxTextLength:      viper.GetInt("output.csvmaxtextlength"),
+			CSVExcludeDescription: viper.GetBool("output.csvexcludedescription"),
+			CSVColumns:            viper.GetStringSlice("output.csvcolumns"),
+
+			SQLiteFileName:  viper.GetString("output.sqlitefilename"),
+			SQLiteBatchSize: viper.GetInt("output.sqlitebatchsize"),
+
+			IndexFileName:  viper.GetString("output.indexfilename"),
+			IndexCitations: viper.GetBool("output.indexcitations"),
+
+			OpenSearchIndex:      viper.GetString("output.opensearchindex"),
+			OpenSearchEndpoint:   viper.GetString("output.opensearchendpoint"),
+			OpenSearchUsername:   viper.GetString("output.opensearchusername"),
+			OpenSearchPassword:   viper.GetString("output.opensearchpassword"),
+			OpenSearchBatchSize:  viper.GetInt("output.opensearchbatchsize"),
+			OpenSearchMaxRetries: viper.GetInt("output.opensearchmaxretries"),
 		},
 
 		LoggerConfig: LoggerConfig{
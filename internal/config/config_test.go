@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigParquetCompression(t *testing.T) {
+	tests := []struct {
+		output  string
+		wantErr string
+	}{
+		{`parquetcompression = "zstd"` + "\n" + `parquetcolumncompression = { description = "gzip" }`, ""},
+		{`parquetcompression = "brotli"`, `output.parquetcompression "brotli"`},
+		{`parquetcompression = "Snappy"`, `output.parquetcompression "Snappy"`},
+		{`parquetcolumncompression = { description = "gzp" }`, `output.parquetcolumncompression "gzp" for column "description"`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		if err := os.WriteFile(path, []byte("[output]\n"+tt.output+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig(path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig with %s = %v, want an error containing %s", tt.output, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("LoadConfig with %s = %v", tt.output, err)
+		}
+		if cfg.OutputConfig.ParquetCompression != "zstd" || cfg.OutputConfig.ParquetColumnCompression["description"] != "gzip" {
+			t.Errorf("LoadConfig with %s = %+v", tt.output, cfg.OutputConfig)
+		}
+	}
+}
@@ -65,20 +65,10 @@ func Controller(cfg *config.Config, log *zap.Logger) error {
 
 				// * Initialize the USPTGoConfig struct
 
-				usptgoConfig := &types.USPTGoConfig{}
-
-				if cfg.OutputMode == "xml" {
-					usptgoConfig = &types.USPTGoConfig{
-						InputPath:         filepath.Join(cfg.InputDir, bulkZipName),
-						Logger:            logger.NewZapLoggerAdapter(log),
-						ReturnRawSplitDoc: true,
-					}
-				} else {
-					usptgoConfig = &types.USPTGoConfig{
-						InputPath:         filepath.Join(cfg.InputDir, bulkZipName),
-						Logger:            logger.NewZapLoggerAdapter(log),
-						ReturnRawSplitDoc: cfg.DevConfig.ParserReturnsRaw,
-					}
+				usptgoConfig := &types.USPTGoConfig{
+					InputPath:         filepath.Join(cfg.InputDir, bulkZipName),
+					Logger:            logger.NewZapLoggerAdapter(log),
+					ReturnRawSplitDoc: outputhandler.NeedsRawSplitDoc(cfg) || cfg.DevConfig.ParserReturnsRaw,
 				}
 
 				// * Call USPT-Go parser
@@ -112,6 +102,12 @@ func Controller(cfg *config.Config, log *zap.Logger) error {
 	// Wait for all go routines to complete
 	wg.Wait()
 
+	// Complete any output shared across zip files
+	if finalizeErr := outputhandler.Finalize(cfg, log); finalizeErr != nil {
+		log.Error("Error finalizing output", zap.Error(finalizeErr))
+		errorChan <- finalizeErr
+	}
+
 	// Close the error channel after all go routines have finished, signaling the error handler to exit
 	close(errorChan)
 	// Need to revisit this return err to investigate whether a nonfatal error could be returned to main, thereby causing main to believe a fatal error happened even if it did not.
@@ -0,0 +1,85 @@
+// Package fixture provides USPTO bulk data documents for the tests of the other packages, as the
+// uspt-go parser returns them.
+package fixture
+
+import (
+	"embed"
+	"encoding/xml"
+	"strings"
+
+	"github.com/diverged/uspt-go/types"
+)
+
+// Grant is a utility patent grant with every bibliographic element the tool reads, a description with
+// section headings, processing instructions, a table and a list, and three claims, one of them dependent.
+const Grant = "grant.xml"
+
+//go:embed *.xml
+var files embed.FS
+
+// Raw returns the raw split XML of a fixture document.
+func Raw(name string) []byte {
+	data, err := files.ReadFile(name)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+type content struct {
+	Inner string `xml:",innerxml"`
+}
+
+type bibliographic struct {
+	PublicationReference struct {
+		Country   string `xml:"document-id>country"`
+		DocNumber string `xml:"document-id>doc-number"`
+		Kind      string `xml:"document-id>kind"`
+		Date      string `xml:"document-id>date"`
+	} `xml:"publication-reference"`
+	InventionTitle string `xml:"invention-title"`
+	NumberOfClaims int    `xml:"number-of-claims"`
+}
+
+// Doc returns a fixture document with the fields uspt-go fills, including the raw split XML.
+func Doc(name string) *types.USPTGoDoc {
+	raw := Raw(name)
+	var x struct {
+		XMLName      xml.Name
+		File         string        `xml:"file,attr"`
+		Country      string        `xml:"country,attr"`
+		DateProduced string        `xml:"date-produced,attr"`
+		DatePubl     string        `xml:"date-publ,attr"`
+		Grant        bibliographic `xml:"us-bibliographic-data-grant"`
+		Application  bibliographic `xml:"us-bibliographic-data-application"`
+		Abstract     content       `xml:"abstract"`
+		Description  content       `xml:"description"`
+		Claims       content       `xml:"claims"`
+	}
+	if err := xml.Unmarshal(raw, &x); err != nil {
+		panic(name + ": " + err.Error())
+	}
+
+	doc := &types.USPTGoDoc{RawSplitDoc: raw}
+	biblio := x.Grant
+	doc.USPTGoMetadata.DocumentType = "grant"
+	if x.XMLName.Local == "us-patent-application" {
+		biblio = x.Application
+		doc.USPTGoMetadata.DocumentType = "application"
+	}
+	doc.Patent.MetaFileName = x.File
+	doc.Patent.MetaCountry = x.Country
+	doc.Patent.MetaDateProduced = x.DateProduced
+	doc.Patent.MetaDatePubl = x.DatePubl
+	doc.Patent.UsBibliographicData.InventionTitle.Text = biblio.InventionTitle
+	doc.Patent.UsBibliographicData.NumberOfClaims = biblio.NumberOfClaims
+	ref := &doc.Patent.UsBibliographicData.PublicationReference.DocumentID
+	ref.Country = biblio.PublicationReference.Country
+	ref.DocNumber = biblio.PublicationReference.DocNumber
+	ref.KindCode = biblio.PublicationReference.Kind
+	ref.Date = biblio.PublicationReference.Date
+	doc.Patent.Abstract.Content = strings.TrimSpace(x.Abstract.Inner)
+	doc.Patent.Description.Content = strings.TrimSpace(x.Description.Inner)
+	doc.Patent.Claims.Content = strings.TrimSpace(x.Claims.Inner)
+	return doc
+}
@@ -0,0 +1,297 @@
+package outputhandler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// DefaultArrowBatchSize is the number of documents per record batch when none is configured.
+const DefaultArrowBatchSize = 1024
+
+// ArrowSchema derives the Arrow schema from the Parquet row struct of a schema version ("v1" or "v2"),
+// so that record batches carry the same columns as the Parquet output. The schema version is recorded
+// in the schema metadata under uspto_bulk_data_tool.schema_version.
+func ArrowSchema(schemaVersion string) *arrow.Schema {
+	schema, _ := arrowSchema(schemaVersion)
+	return schema
+}
+
+func arrowSchema(schemaVersion string) (*arrow.Schema, []tableField) {
+	schemaVersion = normalizeSchemaVersion(schemaVersion)
+	fields := tableSchemaOf(reflect.TypeOf(parquetSchema(schemaVersion)).Elem())
+	metadata := arrow.MetadataFrom(map[string]string{parquetSchemaVersionKey: schemaVersion})
+	return arrow.NewSchema(arrowFields(fields), &metadata), fields
+}
+
+func arrowFields(fields []tableField) []arrow.Field {
+	out := make([]arrow.Field, len(fields))
+	for i, field := range fields {
+		out[i] = arrow.Field{Name: field.Name, Type: arrowType(field.Type), Nullable: field.Optional}
+	}
+	return out
+}
+
+func arrowType(t tableType) arrow.DataType {
+	switch {
+	case t.Element != nil:
+		return arrow.ListOf(arrowType(*t.Element))
+	case t.Fields != nil:
+		return arrow.StructOf(arrowFields(t.Fields)...)
+	}
+	switch t.Primitive {
+	case "boolean":
+		return arrow.FixedWidthTypes.Boolean
+	case "int":
+		return arrow.PrimitiveTypes.Int32
+	case "long":
+		return arrow.PrimitiveTypes.Int64
+	case "date":
+		return arrow.FixedWidthTypes.Date32
+	}
+	return arrow.BinaryTypes.String
+}
+
+// appendArrow appends a value of a row struct to the builder of its column.
+func appendArrow(b array.Builder, v reflect.Value, t tableType) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			b.AppendNull()
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case t.Element != nil:
+		lb := b.(*array.ListBuilder)
+		lb.Append(true)
+		for i := 0; i < v.Len(); i++ {
+			appendArrow(lb.ValueBuilder(), v.Index(i), *t.Element)
+		}
+		return
+	case t.Fields != nil:
+		sb := b.(*array.StructBuilder)
+		sb.Append(true)
+		for i, field := range t.Fields {
+			appendArrow(sb.FieldBuilder(i), v.FieldByIndex(field.index), field.Type)
+		}
+		return
+	}
+
+	switch t.Primitive {
+	case "boolean":
+		b.(*array.BooleanBuilder).Append(v.Bool())
+	case "int":
+		b.(*array.Int32Builder).Append(int32(v.Int()))
+	case "long":
+		b.(*array.Int64Builder).Append(v.Int())
+	case "date":
+		b.(*array.Date32Builder).Append(arrow.Date32(v.Int()))
+	default:
+		b.(*array.StringBuilder).Append(v.String())
+	}
+}
+
+// arrowBatcher accumulates converted rows into record batches.
+type arrowBatcher struct {
+	builder   *array.RecordBuilder
+	fields    []tableField
+	batchSize int
+	rows      int
+}
+
+func newArrowBatcher(mem memory.Allocator, schemaVersion string, batchSize int) *arrowBatcher {
+	if mem == nil {
+		mem = memory.DefaultAllocator
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultArrowBatchSize
+	}
+	schema, fields := arrowSchema(schemaVersion)
+	return &arrowBatcher{builder: array.NewRecordBuilder(mem, schema), fields: fields, batchSize: batchSize}
+}
+
+// append adds a row, returning a completed record batch once batchSize rows have been added.
+func (a *arrowBatcher) append(row interface{}) array.Record {
+	v := reflect.ValueOf(row)
+	for i, field := range a.fields {
+		appendArrow(a.builder.Field(i), v.FieldByIndex(field.index), field.Type)
+	}
+	a.rows++
+	if a.rows < a.batchSize {
+		return nil
+	}
+	return a.flush()
+}
+
+// flush returns the pending rows as a record batch, or nil if there are none.
+func (a *arrowBatcher) flush() array.Record {
+	if a.rows == 0 {
+		return nil
+	}
+	a.rows = 0
+	return a.builder.NewRecord()
+}
+
+func (a *arrowBatcher) release() {
+	a.builder.Release()
+}
+
+// ArrowRecords converts parsed documents to record batches of the given schema version ("v1" or "v2"), row
+// options and batch size, closing the returned channel once docs is closed. Callers must Release every record.
+// Documents whose nested fields cannot be extracted are reported to errorChan, if it is not nil,
+// without skipping the document.
+//
+// Once ctx is done the returned channel is closed without sending further records, and the remaining
+// documents are discarded so that their sender is not blocked.
+func ArrowRecords(ctx context.Context, docs <-chan *types.USPTGoDoc, schemaVersion string, rowOpts RowOptions, batchSize int, mem memory.Allocator, errorChan chan<- error, log *zap.Logger) <-chan array.Record {
+	records := make(chan array.Record)
+	schemaVersion = normalizeSchemaVersion(schemaVersion)
+
+	go func() {
+		defer func() {
+			for range docs {
+			}
+		}()
+		defer close(records)
+		if errorChan == nil {
+			discard := make(chan error)
+			defer close(discard)
+			go func() {
+				for range discard {
+				}
+			}()
+			errorChan = discard
+		}
+
+		batcher := newArrowBatcher(mem, schemaVersion, batchSize)
+		defer batcher.release()
+
+		send := func(record array.Record) bool {
+			select {
+			case records <- record:
+				return true
+			case <-ctx.Done():
+				record.Release()
+				return false
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case doc, ok := <-docs:
+				if !ok {
+					if record := batcher.flush(); record != nil {
+						send(record)
+					}
+					return
+				}
+				row := parquetRow(doc, schemaVersion, rowOpts, conversionStats{}, errorChan, log)
+				if record := batcher.append(row); record != nil && !send(record) {
+					return
+				}
+			}
+		}
+	}()
+	return records
+}
+
+// arrowRecordWriter is implemented by the IPC file and stream writers.
+type arrowRecordWriter interface {
+	Write(rec array.Record) error
+	Close() error
+}
+
+// WriteArrowFile writes the documents of a single zip to an Arrow IPC file (Feather v2), or an IPC stream,
+// in record batches of the configured size.
+func WriteArrowFile(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteArrowFile has been invoked", zap.String("OriginZipName", originZipName))
+
+	schemaVersion := parquetSchemaVersion(cfg)
+	extension := ".arrow"
+	if cfg.OutputConfig.ArrowFormat == "stream" {
+		extension = ".arrows"
+	}
+	outputFileName := strings.TrimSuffix(originZipName, ".zip") + extension
+	outputFilePath := filepath.Join(cfg.OutputDir, outputFileName)
+
+	fail := func(whence string, err error) {
+		log.Error("Error writing Arrow file", zap.String("file", outputFileName), zap.String("whence", whence), zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    "arrow",
+			Whence:  whence,
+			Err:     err,
+		}
+		for range inputChan {
+		}
+	}
+
+	file, err := os.Create(outputFilePath)
+	if err != nil {
+		fail("creating the output file", err)
+		return
+	}
+	// An IPC file without its footer is unreadable, so it is removed on failure
+	complete := false
+	defer func() {
+		file.Close()
+		if !complete {
+			os.Remove(outputFilePath)
+		}
+	}()
+
+	batcher := newArrowBatcher(memory.DefaultAllocator, schemaVersion, cfg.OutputConfig.ArrowBatchSize)
+	defer batcher.release()
+
+	var w arrowRecordWriter
+	if cfg.OutputConfig.ArrowFormat == "stream" {
+		w = ipc.NewWriter(file, ipc.WithSchema(batcher.builder.Schema()))
+	} else if w, err = ipc.NewFileWriter(file, ipc.WithSchema(batcher.builder.Schema())); err != nil {
+		fail("writing the file header", err)
+		return
+	}
+
+	write := func(record array.Record) error {
+		defer record.Release()
+		return w.Write(record)
+	}
+
+	for doc := range inputChan {
+		row := parquetRow(doc, schemaVersion, rowOptionsOf(cfg), conversionStats{}, errorChan, log)
+		if record := batcher.append(row); record != nil {
+			if err := write(record); err != nil {
+				fail("writing a record batch", err)
+				return
+			}
+		}
+	}
+	if record := batcher.flush(); record != nil {
+		if err := write(record); err != nil {
+			fail("writing the final record batch", err)
+			return
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		fail("writing the file footer", err)
+		return
+	}
+	complete = true
+}
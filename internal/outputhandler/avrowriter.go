@@ -0,0 +1,199 @@
+package outputhandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/avro"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+const (
+	avroNamespace        = "uspto_bulk_data_tool"
+	avroSchemaVersionKey = "uspto_bulk_data_tool.schema_version"
+	avroOriginZipKey     = "uspto_bulk_data_tool.origin_zip"
+)
+
+// avroSchema derives the Avro record schema from the Parquet row struct of a schema version, so that
+// the Avro output carries the same columns as the Parquet output. Optional columns are unions with null
+// and DATE columns are ints with the date logical type.
+func avroSchema(schemaVersion string) (*avro.Schema, []tableField, error) {
+	rowType := reflect.TypeOf(parquetSchema(schemaVersion)).Elem()
+	fields := tableSchemaOf(rowType)
+	name := strings.TrimPrefix(rowType.Name(), "Parquet")
+
+	schemaJSON, err := json.Marshal(map[string]interface{}{
+		"type":      "record",
+		"name":      name,
+		"namespace": avroNamespace,
+		"fields":    avroFields(fields, name),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	schema, err := avro.ParseSchema(string(schemaJSON))
+	return schema, fields, err
+}
+
+// avroFields describes the fields of a record. Nested records are named after the path of their
+// column, e.g. PatentDocumentV2_inventors, as Avro requires record names to be unique.
+func avroFields(fields []tableField, recordName string) []interface{} {
+	out := make([]interface{}, len(fields))
+	for i, field := range fields {
+		typ := avroType(field.Type, recordName+"_"+field.Name)
+		if field.Optional {
+			out[i] = map[string]interface{}{"name": field.Name, "type": []interface{}{"null", typ}, "default": nil}
+		} else {
+			out[i] = map[string]interface{}{"name": field.Name, "type": typ}
+		}
+	}
+	return out
+}
+
+func avroType(t tableType, name string) interface{} {
+	switch {
+	case t.Element != nil:
+		return map[string]interface{}{"type": "array", "items": avroType(*t.Element, name)}
+	case t.Fields != nil:
+		return map[string]interface{}{"type": "record", "name": name, "fields": avroFields(t.Fields, name)}
+	case t.Primitive == "date":
+		return map[string]interface{}{"type": "int", "logicalType": "date"}
+	}
+	return t.Primitive
+}
+
+// avroRecord converts a row struct to the generic record representation of the avro package.
+func avroRecord(v reflect.Value, fields []tableField) map[string]interface{} {
+	record := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		record[field.Name] = avroValue(v.FieldByIndex(field.index), field.Type)
+	}
+	return record
+}
+
+func avroValue(v reflect.Value, t tableType) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch {
+	case t.Element != nil:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = avroValue(v.Index(i), *t.Element)
+		}
+		return items
+	case t.Fields != nil:
+		return avroRecord(v, t.Fields)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int32:
+		return int32(v.Int())
+	case reflect.Int, reflect.Int64:
+		return v.Int()
+	}
+	return v.String()
+}
+
+// avroCodec resolves the configured codec to its Avro name, accepting "none" and "zstd" as aliases.
+func avroCodec(name string) string {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return "null"
+	case "zstd":
+		return "zstandard"
+	}
+	return strings.ToLower(name)
+}
+
+// WriteAvroFile writes the documents of a single zip to an Avro object container file, with the schema
+// of the configured Parquet schema version embedded in its header.
+func WriteAvroFile(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteAvroFile has been invoked", zap.String("OriginZipName", originZipName))
+
+	schemaVersion := parquetSchemaVersion(cfg)
+	outputFileName := strings.TrimSuffix(originZipName, ".zip") + ".avro"
+	outputFilePath := filepath.Join(cfg.OutputDir, outputFileName)
+
+	fail := func(whence string, err error) {
+		log.Error("Error writing Avro file", zap.String("file", outputFileName), zap.String("whence", whence), zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    "avro",
+			Whence:  whence,
+			Err:     err,
+		}
+		for range inputChan {
+		}
+	}
+
+	schema, fields, err := avroSchema(schemaVersion)
+	if err != nil {
+		fail("deriving the Avro schema", err)
+		return
+	}
+
+	file, err := os.Create(outputFilePath)
+	if err != nil {
+		fail("creating the output file", err)
+		return
+	}
+	// An incomplete container file is unreadable, so it is removed on failure
+	complete := false
+	defer func() {
+		if !complete {
+			file.Close()
+			os.Remove(outputFilePath)
+		}
+	}()
+
+	buf := bufio.NewWriter(file)
+	w, err := avro.NewWriter(buf, schema, avroCodec(cfg.OutputConfig.AvroCodec), map[string][]byte{
+		avroSchemaVersionKey: []byte(schemaVersion),
+		avroOriginZipKey:     []byte(originZipName),
+	})
+	if err != nil {
+		fail("writing the file header", err)
+		return
+	}
+
+	stats := conversionStats{}
+	for doc := range inputChan {
+		row := parquetRow(doc, schemaVersion, rowOptionsOf(cfg), stats, errorChan, log)
+		if err := w.Append(avroRecord(reflect.ValueOf(row), fields)); err != nil {
+			fail("writing document "+doc.Patent.MetaFileName, err)
+			return
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		fail("writing the final block", err)
+		return
+	}
+	if err := buf.Flush(); err != nil {
+		fail("flushing the output file", err)
+		return
+	}
+	if err := file.Close(); err != nil {
+		fail("closing the output file", err)
+		return
+	}
+	complete = true
+	if len(stats) > 0 {
+		log.Warn("Values failed Avro type conversion", zap.String("file", outputFileName), zap.Any("failuresByColumn", map[string]int(stats)))
+	}
+}
@@ -0,0 +1,43 @@
+package outputhandler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diverged/uspt-go/types"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+func TestWriteAvroFile(t *testing.T) {
+	cfg := &config.Config{OutputDir: t.TempDir()}
+	cfg.OutputConfig.ParquetSchema = "v1"
+	cfg.OutputConfig.AvroCodec = "deflate"
+
+	if errs := runWriter(WriteAvroFile, cfg, "ipg240102.zip", testDocs("grant", "US11000000-20240102.XML", "US11000001-20240102.XML")); len(errs) != 0 {
+		t.Fatalf("errors reported: %v", errs)
+	}
+	r, records := readAvroRecords(t, filepath.Join(cfg.OutputDir, "ipg240102.avro"))
+	if string(r.Metadata[avroOriginZipKey]) != "ipg240102.zip" || string(r.Metadata[avroSchemaVersionKey]) != "v1" {
+		t.Errorf("metadata = %q", r.Metadata)
+	}
+	if len(records) != 2 || records[1]["document_name"] != "US11000001-20240102.XML" {
+		t.Errorf("records = %v", records)
+	}
+}
+
+func TestWriteAvroFileReportsFailure(t *testing.T) {
+	cfg := &config.Config{OutputDir: filepath.Join(t.TempDir(), "missing")}
+	cfg.OutputConfig.ParquetSchema = "v1"
+
+	errs := runWriter(WriteAvroFile, cfg, "ipg240102.zip", testDocs("grant", "US11000000-20240102.XML"))
+	var uerr *types.USPTGoError
+	if len(errs) != 1 || !errors.As(errs[0], &uerr) || !uerr.Skipped || uerr.Type != "avro" {
+		t.Fatalf("errors reported: %v, want one skipping avro error", errs)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.OutputDir, "ipg240102.avro")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("output file left behind: %v", err)
+	}
+}
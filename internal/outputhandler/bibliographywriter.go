@@ -0,0 +1,98 @@
+package outputhandler
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/bibliography"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// bibliographyExtensions are the file extensions of the "bibtex" and "ris" output modes.
+var bibliographyExtensions = map[string]string{
+	"bibtex": ".bib",
+	"ris":    ".ris",
+}
+
+// bibliographyEntry builds the citation entry of a document.
+func bibliographyEntry(cfg *config.Config, doc *types.USPTGoDoc) (*bibliography.Entry, error) {
+	return bibliography.New(bibliography.Input{
+		Raw:          doc.RawSplitDoc,
+		DocumentType: doc.USPTGoMetadata.DocumentType,
+		Title:        doc.Patent.UsBibliographicData.InventionTitle.Text,
+	}, cfg.OutputConfig.BibliographyURLTemplate)
+}
+
+// WriteBibliographyFile writes a citation entry for each document of a single zip, to a BibTeX file in the
+// "bibtex" output mode or a RIS file in the "ris" output mode.
+func WriteBibliographyFile(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteBibliographyFile has been invoked", zap.String("OriginZipName", originZipName))
+
+	outputFileName := strings.TrimSuffix(originZipName, ".zip") + bibliographyExtensions[cfg.OutputMode]
+	file, err := os.Create(filepath.Join(cfg.OutputDir, outputFileName))
+	if err != nil {
+		log.Error("Error creating bibliography file", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    cfg.OutputMode,
+			Whence:  "creating the output file",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	for doc := range inputChan {
+		entry, err := bibliographyEntry(cfg, doc)
+		if err != nil {
+			log.Warn("Skipping document", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    doc.Patent.MetaFileName,
+				Type:    cfg.OutputMode,
+				Whence:  "building the citation entry",
+				Err:     err,
+			}
+			continue
+		}
+		if cfg.OutputMode == "ris" {
+			_, err = w.WriteString(entry.RIS())
+		} else {
+			_, err = w.WriteString(entry.BibTeX() + "\n")
+		}
+		if err != nil {
+			log.Error("Error writing bibliography file", zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    outputFileName,
+				Type:    cfg.OutputMode,
+				Whence:  "writing the output file",
+				Err:     err,
+			}
+			for range inputChan {
+			}
+			return
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Error("Error flushing bibliography file", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    cfg.OutputMode,
+			Whence:  "flushing the output file",
+			Err:     err,
+		}
+	}
+}
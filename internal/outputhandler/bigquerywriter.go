@@ -0,0 +1,431 @@
+package outputhandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// bigQuerySchemaName is the BigQuery schema of the output, written to the output directory once per run.
+const bigQuerySchemaName = "publications.schema.json"
+
+// bqPublication is a row of the patents-public-data.patents.publications table. Fields the bulk data has no
+// equivalent for, such as family_id and the Japanese classifications, are present but empty so that queries
+// selecting them still run. Dates are integers in YYYYMMDD form, 0 when unknown.
+type bqPublication struct {
+	PublicationNumber          string             `json:"publication_number"` // e.g. "US-11000000-B2"
+	ApplicationNumber          string             `json:"application_number"` // e.g. "US-202117123456-A"
+	CountryCode                string             `json:"country_code"`
+	KindCode                   string             `json:"kind_code"`
+	ApplicationKind            string             `json:"application_kind"`
+	ApplicationNumberFormatted string             `json:"application_number_formatted"`
+	PCTNumber                  string             `json:"pct_number"`
+	FamilyID                   string             `json:"family_id"`
+	SPIFPublicationNumber      string             `json:"spif_publication_number"`
+	SPIFApplicationNumber      string             `json:"spif_application_number"`
+	TitleLocalized             []bqLocalized      `json:"title_localized"`
+	AbstractLocalized          []bqLocalized      `json:"abstract_localized"`
+	ClaimsLocalized            []bqLocalized      `json:"claims_localized"`
+	DescriptionLocalized       []bqLocalized      `json:"description_localized"`
+	PublicationDate            int64              `json:"publication_date"`
+	FilingDate                 int64              `json:"filing_date"`
+	GrantDate                  int64              `json:"grant_date"`
+	PriorityDate               int64              `json:"priority_date"`
+	PriorityClaim              []bqReference      `json:"priority_claim"`
+	Inventor                   []string           `json:"inventor"`
+	InventorHarmonized         []bqHarmonized     `json:"inventor_harmonized"`
+	Assignee                   []string           `json:"assignee"`
+	AssigneeHarmonized         []bqHarmonized     `json:"assignee_harmonized"`
+	Examiner                   []bqExaminer       `json:"examiner"`
+	USPC                       []bqClassification `json:"uspc"`
+	IPC                        []bqClassification `json:"ipc"`
+	CPC                        []bqClassification `json:"cpc"`
+	FI                         []bqClassification `json:"fi"`
+	FTerm                      []bqClassification `json:"fterm"`
+	Locarno                    []bqClassification `json:"locarno"`
+	Citation                   []bqReference      `json:"citation"`
+	Parent                     []bqReference      `json:"parent"`
+	Child                      []bqReference      `json:"child"`
+	EntityStatus               string             `json:"entity_status"`
+	ArtUnit                    string             `json:"art_unit"`
+}
+
+type bqLocalized struct {
+	Text      string `json:"text"`
+	Language  string `json:"language"`
+	Truncated bool   `json:"truncated"`
+}
+
+type bqReference struct {
+	PublicationNumber string `json:"publication_number"`
+	ApplicationNumber string `json:"application_number"`
+	NPLText           string `json:"npl_text"`
+	Type              string `json:"type"`
+	Category          string `json:"category"`
+	FilingDate        int64  `json:"filing_date"`
+}
+
+type bqHarmonized struct {
+	Name        string `json:"name"`
+	CountryCode string `json:"country_code"`
+}
+
+type bqExaminer struct {
+	Name       string `json:"name"`
+	Department string `json:"department"`
+	Level      string `json:"level"`
+}
+
+type bqClassification struct {
+	Code      string   `json:"code"`
+	Inventive bool     `json:"inventive"`
+	First     bool     `json:"first"`
+	Tree      []string `json:"tree"` // Ancestors of the code, not available from the bulk data
+}
+
+// bqSchemaField is a column of a BigQuery schema JSON file, as accepted by `bq load --schema`.
+type bqSchemaField struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Mode   string          `json:"mode"`
+	Fields []bqSchemaField `json:"fields,omitempty"`
+}
+
+// bigQuerySchema derives the BigQuery schema of a struct type from its JSON field names.
+func bigQuerySchema(t reflect.Type) []bqSchemaField {
+	fields := make([]bqSchemaField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		field := bqSchemaField{Name: name, Mode: "NULLABLE"}
+		ft := f.Type
+		if ft.Kind() == reflect.Slice {
+			field.Mode = "REPEATED"
+			ft = ft.Elem()
+		}
+		switch ft.Kind() {
+		case reflect.String:
+			field.Type = "STRING"
+		case reflect.Int64:
+			field.Type = "INTEGER"
+		case reflect.Bool:
+			field.Type = "BOOLEAN"
+		case reflect.Struct:
+			field.Type = "RECORD"
+			field.Fields = bigQuerySchema(ft)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// bqDate converts a USPTO YYYYMMDD date to the integer form of the public dataset.
+func bqDate(date string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(date), 10, 64)
+	if err != nil || n < 10000101 || n > 99991231 {
+		return 0
+	}
+	return n
+}
+
+// bqPublicationNumber formats a document number as in the public dataset, e.g. "US-9123456-B2". US pre-grant
+// publication serials are six digits there, so "20150012345" becomes "2015012345".
+func bqPublicationNumber(country, docNumber, kind string) string {
+	normalized := patentxml.NormalizeDocNumber(country, docNumber)
+	if normalized == "" {
+		return ""
+	}
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" {
+		country = "US"
+	}
+	number := strings.TrimPrefix(normalized, country)
+	if country == "US" && len(number) == 11 && number[4] == '0' {
+		number = number[:4] + number[5:]
+	}
+	if kind = strings.TrimSpace(kind); kind == "" {
+		return country + "-" + number
+	}
+	return country + "-" + number + "-" + kind
+}
+
+// bqApplicationNumber formats an application number as in the public dataset, where US numbers are prefixed
+// with the year of filing, e.g. "US-202117123456-A".
+func bqApplicationNumber(country, docNumber, date, kind string) string {
+	normalized := patentxml.NormalizeDocNumber(country, docNumber)
+	if normalized == "" {
+		return ""
+	}
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" {
+		country = "US"
+	}
+	number := strings.TrimPrefix(normalized, country)
+	if country == "US" && len(date) >= 4 {
+		number = date[:4] + number
+	}
+	return country + "-" + number + "-" + kind
+}
+
+// bqApplicationKinds maps application types to the application kinds of the public dataset.
+var bqApplicationKinds = map[string]string{
+	"utility": "A",
+	"design":  "F",
+	"plant":   "P",
+	"reissue": "E",
+}
+
+// bqCitationCategories maps the citation categories of the bulk data to those of the public dataset.
+var bqCitationCategories = map[string]string{
+	"examiner":    "SEA",
+	"applicant":   "APP",
+	"third party": "TPO",
+}
+
+func bqLocalizedText(text string) []bqLocalized {
+	if text == "" {
+		return []bqLocalized{}
+	}
+	return []bqLocalized{{Text: text, Language: "en"}}
+}
+
+// bqHarmonizedName formats a party's name in the upper case, last name first form of the harmonized columns.
+func bqHarmonizedName(p patentxml.Party) string {
+	if p.OrgName != "" {
+		return strings.ToUpper(p.OrgName)
+	}
+	return strings.ToUpper(strings.TrimSpace(p.LastName + " " + p.FirstName))
+}
+
+// bqEmptySlices replaces nil slices by empty ones, as BigQuery rejects null for repeated fields.
+func bqEmptySlices(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() != reflect.Slice {
+			continue
+		}
+		if field.IsNil() {
+			field.Set(reflect.MakeSlice(field.Type(), 0, 0))
+		}
+		if field.Type().Elem().Kind() == reflect.Struct {
+			for j := 0; j < field.Len(); j++ {
+				bqEmptySlices(field.Index(j))
+			}
+		}
+	}
+}
+
+// bigQueryDoc maps a parsed document onto the publications schema.
+func bigQueryDoc(doc *types.USPTGoDoc) (*bqPublication, error) {
+	biblio, err := patentxml.ParseBibliographic(doc.RawSplitDoc)
+	if err != nil {
+		return nil, fmt.Errorf("parsing bibliographic data: %w", err)
+	}
+
+	pub, app := biblio.Publication, biblio.Application
+	appKind := bqApplicationKinds[biblio.ApplicationType]
+	if appKind == "" {
+		appKind = "A"
+	}
+	row := &bqPublication{
+		PublicationNumber:          bqPublicationNumber(pub.Country, pub.DocNumber, pub.Kind),
+		ApplicationNumber:          bqApplicationNumber(app.Country, app.DocNumber, app.Date, appKind),
+		CountryCode:                strings.ToUpper(pub.Country),
+		KindCode:                   pub.Kind,
+		ApplicationKind:            appKind,
+		ApplicationNumberFormatted: patentxml.NormalizeDocNumber(app.Country, app.DocNumber),
+		TitleLocalized:             bqLocalizedText(patentxml.NormalizeSpace(doc.Patent.UsBibliographicData.InventionTitle.Text)),
+		AbstractLocalized:          bqLocalizedText(patentxml.PlainText(doc.Patent.Abstract.Content)),
+		ClaimsLocalized:            bqLocalizedText(patentxml.PlainText(doc.Patent.Claims.Content)),
+		DescriptionLocalized:       bqLocalizedText(patentxml.PlainText(doc.Patent.Description.Content)),
+		PublicationDate:            bqDate(pub.Date),
+		FilingDate:                 bqDate(app.Date),
+	}
+	if strings.EqualFold(doc.USPTGoMetadata.DocumentType, "grant") {
+		row.GrantDate = row.PublicationDate
+	}
+
+	row.PriorityDate = row.FilingDate
+	for _, p := range biblio.PriorityClaims {
+		date := bqDate(p.Date)
+		row.PriorityClaim = append(row.PriorityClaim, bqReference{
+			ApplicationNumber: bqApplicationNumber(p.Country, p.DocNumber, "", "A"),
+			Category:          p.Kind,
+			FilingDate:        date,
+		})
+		if date != 0 && (row.PriorityDate == 0 || date < row.PriorityDate) {
+			row.PriorityDate = date
+		}
+	}
+
+	for _, p := range biblio.Inventors {
+		row.Inventor = append(row.Inventor, p.Name())
+		row.InventorHarmonized = append(row.InventorHarmonized, bqHarmonized{Name: bqHarmonizedName(p), CountryCode: p.Address.Country})
+	}
+	for _, p := range biblio.Assignees {
+		row.Assignee = append(row.Assignee, p.Name())
+		row.AssigneeHarmonized = append(row.AssigneeHarmonized, bqHarmonized{Name: bqHarmonizedName(p), CountryCode: p.Address.Country})
+	}
+	for _, e := range biblio.Examiners {
+		row.Examiner = append(row.Examiner, bqExaminer{
+			Name:       strings.TrimSpace(e.FirstName + " " + e.LastName),
+			Department: e.Department,
+			Level:      strings.ToUpper(e.Level),
+		})
+		if e.Level == "primary" && row.ArtUnit == "" {
+			row.ArtUnit = e.Department
+		}
+	}
+
+	for _, c := range biblio.Classifications {
+		class := bqClassification{
+			Code:      c.Section + c.Class + c.Subclass + strings.TrimSpace(c.Group) + "/" + c.Subgroup,
+			Inventive: c.Value == "I",
+			First:     c.Main,
+		}
+		if c.Scheme == "cpc" {
+			row.CPC = append(row.CPC, class)
+		} else {
+			row.IPC = append(row.IPC, class)
+		}
+	}
+	for i, l := range biblio.Locarno {
+		row.Locarno = append(row.Locarno, bqClassification{Code: l.Code, First: i == 0})
+	}
+	national := doc.Patent.UsBibliographicData.ClassificationNational
+	for i, value := range []string{national.MainClassification, national.FurtherClassification} {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		_, subclass := uspcSymbol(value)
+		row.USPC = append(row.USPC, bqClassification{Code: subclass, Inventive: i == 0, First: i == 0})
+	}
+
+	for _, c := range biblio.Citations {
+		citation := bqReference{Category: bqCitationCategories[c.CitedBy()], NPLText: c.Text}
+		if c.Patent {
+			citation.PublicationNumber = bqPublicationNumber(c.Document.Country, c.Document.DocNumber, c.Document.Kind)
+		}
+		row.Citation = append(row.Citation, citation)
+	}
+	for _, r := range biblio.RelatedDocuments {
+		switch r.Relation {
+		case "continuation", "continuation-in-part", "division", "reissue", "continuing-reissue", "substitution":
+			row.Parent = append(row.Parent, bqReference{
+				ApplicationNumber: bqApplicationNumber(r.Document.Country, r.Document.DocNumber, r.Document.Date, "A"),
+				Type:              strings.ToUpper(r.Relation),
+				FilingDate:        bqDate(r.Document.Date),
+			})
+		}
+	}
+
+	bqEmptySlices(reflect.ValueOf(row).Elem())
+	return row, nil
+}
+
+var bigQuerySchemaOutput struct {
+	once sync.Once
+	err  error
+}
+
+// writeBigQuerySchema writes the schema file to the output directory, once per run.
+func writeBigQuerySchema(outputDir string) error {
+	bigQuerySchemaOutput.once.Do(func() {
+		data, err := json.MarshalIndent(bigQuerySchema(reflect.TypeOf(bqPublication{})), "", "  ")
+		if err == nil {
+			err = os.WriteFile(filepath.Join(outputDir, bigQuerySchemaName), data, 0644)
+		}
+		bigQuerySchemaOutput.err = err
+	})
+	return bigQuerySchemaOutput.err
+}
+
+// WriteBigQueryFile writes the documents of a single zip as newline-delimited JSON rows of the Google Patents
+// publications schema, alongside the BigQuery schema of the rows.
+func WriteBigQueryFile(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteBigQueryFile has been invoked", zap.String("OriginZipName", originZipName))
+
+	if err := writeBigQuerySchema(cfg.OutputDir); err != nil {
+		log.Error("Error writing BigQuery schema", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: false,
+			Name:    bigQuerySchemaName,
+			Type:    "bigquery",
+			Whence:  "writing the schema file",
+			Err:     err,
+		}
+	}
+
+	outputFileName := strings.TrimSuffix(originZipName, ".zip") + ".publications.jsonl"
+	file, err := os.Create(filepath.Join(cfg.OutputDir, outputFileName))
+	if err != nil {
+		log.Error("Error creating BigQuery file", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    "bigquery",
+			Whence:  "creating the output file",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	for doc := range inputChan {
+		row, err := bigQueryDoc(doc)
+		if err != nil {
+			log.Warn("Skipping document", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    doc.Patent.MetaFileName,
+				Type:    "bigquery",
+				Whence:  "mapping the document to the publications schema",
+				Err:     err,
+			}
+			continue
+		}
+		if err := enc.Encode(row); err != nil {
+			log.Error("Error writing BigQuery row", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    outputFileName,
+				Type:    "bigquery",
+				Whence:  "writing the output file",
+				Err:     err,
+			}
+			for range inputChan {
+			}
+			return
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Error("Error flushing BigQuery file", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    "bigquery",
+			Whence:  "flushing the output file",
+			Err:     err,
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package outputhandler
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func TestBQPublicationNumber(t *testing.T) {
+	tests := []struct {
+		country   string
+		docNumber string
+		kind      string
+		want      string
+	}{
+		{"US", "11000000", "B2", "US-11000000-B2"},
+		{"US", "05123456", "A", "US-5123456-A"},
+		// Pre-grant publications have a six digit serial in the public dataset
+		{"US", "20150012345", "A1", "US-2015012345-A1"},
+		{"US", "2015/0012345", "A1", "US-2015012345-A1"},
+		{"US", "20151012345", "A1", "US-20151012345-A1"},
+		{"US", "D0912345", "S1", "US-D912345-S1"},
+		{"US", "RE049000", "E1", "US-RE49000-E1"},
+		{"us", "US5123456", " A ", "US-5123456-A"},
+		{"", "11000000", "", "US-11000000"},
+		{"EP", "1234567", "A1", "EP-1234567-A1"},
+		{"JP", "2020-012345", "A", "JP-2020012345-A"},
+		{"US", "", "B2", ""},
+	}
+	for _, tt := range tests {
+		if got := bqPublicationNumber(tt.country, tt.docNumber, tt.kind); got != tt.want {
+			t.Errorf("bqPublicationNumber(%q, %q, %q) = %q, want %q", tt.country, tt.docNumber, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestBQApplicationNumber(t *testing.T) {
+	tests := []struct {
+		country   string
+		docNumber string
+		date      string
+		kind      string
+		want      string
+	}{
+		// US application numbers are prefixed with the year of filing
+		{"US", "17123456", "20210315", "A", "US-202117123456-A"},
+		{"US", "29712345", "20191107", "F", "US-201929712345-F"},
+		{"US", "16999999", "", "A", "US-16999999-A"},
+		{"", "17123456", "20210315", "A", "US-202117123456-A"},
+		{"JP", "2020-012345", "20200316", "A", "JP-2020012345-A"},
+		{"US", "", "20210315", "A", ""},
+	}
+	for _, tt := range tests {
+		if got := bqApplicationNumber(tt.country, tt.docNumber, tt.date, tt.kind); got != tt.want {
+			t.Errorf("bqApplicationNumber(%q, %q, %q, %q) = %q, want %q", tt.country, tt.docNumber, tt.date, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestBigQueryDoc(t *testing.T) {
+	row, err := bigQueryDoc(fixture.Doc(fixture.Grant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		field string
+		got   any
+		want  any
+	}{
+		{"publication_number", row.PublicationNumber, "US-11000000-B2"},
+		{"application_number", row.ApplicationNumber, "US-202117123456-A"},
+		{"application_number_formatted", row.ApplicationNumberFormatted, "US17123456"},
+		{"application_kind", row.ApplicationKind, "A"},
+		{"publication_date", row.PublicationDate, int64(20240102)},
+		{"grant_date", row.GrantDate, int64(20240102)},
+		{"filing_date", row.FilingDate, int64(20210315)},
+		{"priority_date", row.PriorityDate, int64(20200316)},
+		{"title", row.TitleLocalized, []bqLocalized{{Text: "Solid electrolyte battery & method", Language: "en"}}},
+		{"priority_claim", row.PriorityClaim, []bqReference{{ApplicationNumber: "JP-2020012345-A", Category: "national", FilingDate: 20200316}}},
+		{"inventor", row.Inventor, []string{"Hiro Tanaka", "Anna Müller"}},
+		{"examiner", row.Examiner, []bqExaminer{{Name: "Rick Roe", Department: "1700", Level: "PRIMARY"}}},
+		{"art_unit", row.ArtUnit, "1700"},
+		{"cpc", row.CPC, []bqClassification{
+			{Code: "H01M10/052", Inventive: true, First: true, Tree: []string{}},
+			{Code: "Y02E60/10", Tree: []string{}},
+		}},
+		{"ipc", row.IPC, []bqClassification{{Code: "H01M10/052", Inventive: true, First: true, Tree: []string{}}}},
+		{"locarno", row.Locarno, []bqClassification{}},
+		{"citation", row.Citation, []bqReference{
+			{PublicationNumber: "US-5123456-A", Category: "SEA"},
+			{PublicationNumber: "US-2015012345-A1", Category: "APP"},
+			{NPLText: "Doe, “Lithium things,” J. Batt. 2019.", Category: "APP"},
+		}},
+		{"parent", row.Parent, []bqReference{{ApplicationNumber: "US-201916999999-A", Type: "CONTINUATION", FilingDate: 20190101}}},
+		{"family_id", row.FamilyID, ""},
+		{"fterm", row.FTerm, []bqClassification{}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %+v, want %+v", tt.field, tt.got, tt.want)
+		}
+	}
+}
+
+func TestBigQueryDocDesign(t *testing.T) {
+	doc := fixture.Doc(fixture.Grant)
+	raw := bytes.Replace(doc.RawSplitDoc, []byte(`appl-type="utility"`), []byte(`appl-type="design"`), 1)
+	raw = bytes.Replace(raw, []byte("<classifications-ipcr>"),
+		[]byte("<classification-locarno><edition>14</edition><main-classification>1402</main-classification></classification-locarno><classifications-ipcr>"), 1)
+	doc.RawSplitDoc = raw
+
+	row, err := bigQueryDoc(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.ApplicationKind != "F" || row.ApplicationNumber != "US-202117123456-F" {
+		t.Errorf("design application = %s, kind %s", row.ApplicationNumber, row.ApplicationKind)
+	}
+	if want := []bqClassification{{Code: "14-02", First: true, Tree: []string{}}}; !reflect.DeepEqual(row.Locarno, want) {
+		t.Errorf("locarno = %+v, want %+v", row.Locarno, want)
+	}
+}
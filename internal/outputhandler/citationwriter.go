@@ -0,0 +1,305 @@
+package outputhandler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// citationEdge is a citation from one document to a patent or non-patent literature reference. Document numbers
+// are normalized with patentxml.NormalizeDocNumber, so that edges join on the documents of grant and application
+// datasets alike. Dates are YYYYMMDD as in the bulk data.
+type citationEdge struct {
+	citingDocNumber         string
+	citingKind              string
+	citingDocType           string
+	citingPubDate           string
+	citingApplicationNumber string
+	sequence                int
+	patent                  bool
+	citedDocNumber          string
+	citedDocNumberRaw       string
+	citedCountry            string
+	citedKind               string
+	citedName               string
+	citedDate               string
+	category                string
+	citedBy                 string
+	nplText                 string
+	originZip               string
+}
+
+// ParquetCitationEdge is a row of the citation edge list.
+type ParquetCitationEdge struct {
+	CitingDocNumber         string `parquet:"name=citing_doc_number, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CitingKind              string `parquet:"name=citing_kind, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	CitingDocType           string `parquet:"name=citing_doc_type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	CitingPubDate           *int32 `parquet:"name=citing_pub_date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	CitingApplicationNumber string `parquet:"name=citing_application_number, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Sequence                int32  `parquet:"name=sequence, type=INT32"`
+	Patent                  bool   `parquet:"name=patent, type=BOOLEAN"`
+	CitedDocNumber          string `parquet:"name=cited_doc_number, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CitedDocNumberRaw       string `parquet:"name=cited_doc_number_raw, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CitedCountry            string `parquet:"name=cited_country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	CitedKind               string `parquet:"name=cited_kind, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	CitedName               string `parquet:"name=cited_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CitedDate               *int32 `parquet:"name=cited_date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	Category                string `parquet:"name=category, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	CitedBy                 string `parquet:"name=cited_by, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	NPLText                 string `parquet:"name=npl_text, type=BYTE_ARRAY, convertedtype=UTF8"`
+	OriginZip               string `parquet:"name=origin_zip, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+// citationEdgeColumns are the CSV columns, in the order of the Parquet schema.
+var citationEdgeColumns = []string{
+	"citing_doc_number", "citing_kind", "citing_doc_type", "citing_pub_date", "citing_application_number",
+	"sequence", "patent", "cited_doc_number", "cited_doc_number_raw", "cited_country", "cited_kind",
+	"cited_name", "cited_date", "category", "cited_by", "npl_text", "origin_zip",
+}
+
+func (e *citationEdge) parquetRow(stats conversionStats) ParquetCitationEdge {
+	return ParquetCitationEdge{
+		CitingDocNumber:         e.citingDocNumber,
+		CitingKind:              e.citingKind,
+		CitingDocType:           e.citingDocType,
+		CitingPubDate:           stats.date("citing_pub_date", e.citingPubDate),
+		CitingApplicationNumber: e.citingApplicationNumber,
+		Sequence:                int32(e.sequence),
+		Patent:                  e.patent,
+		CitedDocNumber:          e.citedDocNumber,
+		CitedDocNumberRaw:       e.citedDocNumberRaw,
+		CitedCountry:            e.citedCountry,
+		CitedKind:               e.citedKind,
+		CitedName:               e.citedName,
+		CitedDate:               stats.date("cited_date", e.citedDate),
+		Category:                e.category,
+		CitedBy:                 e.citedBy,
+		NPLText:                 e.nplText,
+		OriginZip:               e.originZip,
+	}
+}
+
+func (e *citationEdge) csvRecord() []string {
+	return []string{
+		e.citingDocNumber, e.citingKind, e.citingDocType, formatXMLDate(e.citingPubDate), e.citingApplicationNumber,
+		strconv.Itoa(e.sequence), strconv.FormatBool(e.patent), e.citedDocNumber, e.citedDocNumberRaw, e.citedCountry, e.citedKind,
+		e.citedName, formatXMLDate(e.citedDate), e.category, e.citedBy, e.nplText, e.originZip,
+	}
+}
+
+// citationEdges lists the citations of a document, read from its raw split XML.
+func citationEdges(doc *types.USPTGoDoc, originZipName string) ([]citationEdge, error) {
+	biblio, err := patentxml.ParseBibliographic(doc.RawSplitDoc)
+	if err != nil {
+		return nil, fmt.Errorf("parsing bibliographic data: %w", err)
+	}
+
+	edges := make([]citationEdge, 0, len(biblio.Citations))
+	for _, c := range biblio.Citations {
+		edge := citationEdge{
+			citingDocNumber:         patentxml.NormalizeDocNumber(biblio.Publication.Country, biblio.Publication.DocNumber),
+			citingKind:              biblio.Publication.Kind,
+			citingDocType:           doc.USPTGoMetadata.DocumentType,
+			citingPubDate:           biblio.Publication.Date,
+			citingApplicationNumber: patentxml.NormalizeDocNumber(biblio.Application.Country, biblio.Application.DocNumber),
+			sequence:                c.Sequence,
+			patent:                  c.Patent,
+			category:                c.Category,
+			citedBy:                 c.CitedBy(),
+			nplText:                 c.Text,
+			originZip:               originZipName,
+		}
+		if c.Patent {
+			edge.citedDocNumber = patentxml.NormalizeDocNumber(c.Document.Country, c.Document.DocNumber)
+			edge.citedDocNumberRaw = c.Document.DocNumber
+			edge.citedCountry = c.Document.Country
+			edge.citedKind = c.Document.Kind
+			edge.citedName = c.Document.Name
+			edge.citedDate = c.Document.Date
+		}
+		edges = append(edges, edge)
+	}
+	return edges, nil
+}
+
+// citationEdgeFiles are the edge list files shared by every zip processed in a run. They are opened on first
+// use and closed by Finalize.
+type citationEdgeFiles struct {
+	once sync.Once
+	err  error
+
+	mu        sync.Mutex
+	log       *zap.Logger
+	fw        source.ParquetFile
+	pw        *writer.ParquetWriter
+	stats     conversionStats
+	csvFile   *os.File
+	csv       *bufio.Writer
+	delimiter rune
+	quoteAll  bool
+}
+
+var citationOutput citationEdgeFiles
+
+func (c *citationEdgeFiles) open(cfg *config.Config, log *zap.Logger) error {
+	c.once.Do(func() {
+		outCfg := cfg.OutputConfig
+		format := outCfg.CitationFormat
+		if format == "" {
+			format = "parquet"
+		}
+		if format != "parquet" && format != "csv" && format != "both" {
+			c.err = fmt.Errorf("unsupported citationformat %q, expected parquet, csv or both", format)
+			return
+		}
+		baseName := outCfg.CitationFileName
+		if baseName == "" {
+			baseName = "citations"
+		}
+		c.log = log
+		c.stats = conversionStats{}
+
+		if format == "parquet" || format == "both" {
+			path := filepath.Join(cfg.OutputDir, baseName+".parquet")
+			log.Info("Opening citation edge list", zap.String("path", path))
+			if c.fw, c.err = local.NewLocalFileWriter(path); c.err != nil {
+				return
+			}
+			parallelism := int64(max(outCfg.ParquetParallelism, 1))
+			if c.pw, c.err = writer.NewParquetWriter(c.fw, new(ParquetCitationEdge), parallelism); c.err != nil {
+				c.fw.Close()
+				c.fw = nil
+				return
+			}
+			setParquetCompression(c.pw, outCfg.ParquetCompression)
+		}
+
+		if format == "csv" || format == "both" {
+			if c.delimiter, c.err = csvDelimiter(outCfg.CSVDelimiter); c.err != nil {
+				return
+			}
+			if c.quoteAll, c.err = csvQuoteAll(outCfg.CSVQuoting); c.err != nil {
+				return
+			}
+			extension := ".csv"
+			if c.delimiter == '\t' {
+				extension = ".tsv"
+			}
+			path := filepath.Join(cfg.OutputDir, baseName+extension)
+			log.Info("Opening citation edge list", zap.String("path", path))
+			if c.csvFile, c.err = os.Create(path); c.err != nil {
+				return
+			}
+			c.csv = bufio.NewWriter(c.csvFile)
+			c.err = writeCSVRecord(c.csv, citationEdgeColumns, c.delimiter, c.quoteAll)
+		}
+	})
+	return c.err
+}
+
+// write appends the edges of a document to every open file.
+func (c *citationEdgeFiles) write(edges []citationEdge) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range edges {
+		if c.pw != nil {
+			if err := c.pw.Write(edges[i].parquetRow(c.stats)); err != nil {
+				return err
+			}
+		}
+		if c.csv != nil {
+			if err := writeCSVRecord(c.csv, edges[i].csvRecord(), c.delimiter, c.quoteAll); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *citationEdgeFiles) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	if c.pw != nil {
+		recordConversionStats(c.pw, c.stats, "citations", c.log)
+		if err := c.pw.WriteStop(); err != nil {
+			firstErr = err
+		}
+		if err := c.fw.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		c.pw = nil
+	}
+	if c.csv != nil {
+		if err := c.csv.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := c.csvFile.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		c.csv = nil
+	}
+	return firstErr
+}
+
+// WriteCitationEdges appends the citations of every document of a single zip to the run's citation edge list.
+func WriteCitationEdges(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteCitationEdges has been invoked", zap.String("OriginZipName", originZipName))
+
+	if err := citationOutput.open(cfg, log); err != nil {
+		log.Error("Error opening citation edge list", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "citations",
+			Whence:  "opening the citation edge list",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+
+	for doc := range inputChan {
+		edges, err := citationEdges(doc, originZipName)
+		if err != nil {
+			log.Warn("Skipping citations of document", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    doc.Patent.MetaFileName,
+				Type:    "citations",
+				Whence:  "extracting citations",
+				Err:     err,
+			}
+			continue
+		}
+		if err := citationOutput.write(edges); err != nil {
+			log.Error("Error writing citation edges", zap.String("OriginZipName", originZipName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    originZipName,
+				Type:    "citations",
+				Whence:  "writing citation edges",
+				Err:     err,
+			}
+			for range inputChan {
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package outputhandler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+func TestCitationEdges(t *testing.T) {
+	edges, err := citationEdges(fixture.Doc(fixture.Grant), "ipg240102.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	citing := citationEdge{
+		citingDocNumber:         "US11000000",
+		citingKind:              "B2",
+		citingDocType:           "grant",
+		citingPubDate:           "20240102",
+		citingApplicationNumber: "US17123456",
+		originZip:               "ipg240102.zip",
+	}
+	want := []citationEdge{citing, citing, citing}
+	want[0].sequence, want[0].patent, want[0].category, want[0].citedBy = 1, true, "cited by examiner", "examiner"
+	want[0].citedDocNumber, want[0].citedDocNumberRaw, want[0].citedCountry, want[0].citedKind, want[0].citedName, want[0].citedDate = "US5123456", "5123456", "US", "A", "Smith", "19920616"
+	want[1].sequence, want[1].patent, want[1].category, want[1].citedBy = 2, true, "cited by applicant", "applicant"
+	want[1].citedDocNumber, want[1].citedDocNumberRaw, want[1].citedCountry, want[1].citedKind, want[1].citedName, want[1].citedDate = "US20150012345", "20150012345", "US", "A1", "Jones et al.", "20150108"
+	want[2].sequence, want[2].category, want[2].citedBy, want[2].nplText = 3, "cited by applicant", "applicant", "Doe, “Lithium things,” J. Batt. 2019."
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("citationEdges =\n%+v\nwant\n%+v", edges, want)
+	}
+
+	doc := fixture.Doc(fixture.Grant)
+	doc.RawSplitDoc = nil
+	if edges, err := citationEdges(doc, "ipg240102.zip"); edges != nil || !errors.Is(err, patentxml.ErrNoRawDocument) {
+		t.Errorf("citationEdges without the raw document = %v, %v", edges, err)
+	}
+}
@@ -0,0 +1,407 @@
+package outputhandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// claimGraph is the claim dependency graph of a document. Edges run from a claim to the claims that
+// depend on it, so that independent claims are the roots of the tree.
+type claimGraph struct {
+	DocNumber string         `json:"doc_number"`
+	Kind      string         `json:"kind,omitempty"`
+	DocType   string         `json:"doc_type,omitempty"`
+	Claims    []*claimNode   `json:"claims"`
+	Edges     []claimEdge    `json:"edges"`
+	stats     claimDocCounts // Unresolved references and multiple dependencies, for the statistics
+}
+
+type claimNode struct {
+	ID          string `json:"id"`
+	Number      int    `json:"number"`
+	Independent bool   `json:"independent"`
+	Category    string `json:"category,omitempty"`
+	Depth       int    `json:"depth"`                // Length of the longest chain of references to an independent claim
+	DependsOn   []int  `json:"depends_on,omitempty"` // Numbers of the claims referenced
+	position    int    // 1-based position in the claims, which keys the node in DOT and GraphML as numbers may repeat
+}
+
+type claimEdge struct {
+	Parent int `json:"parent"` // Number of the referenced claim
+	Child  int `json:"child"`  // Number of the dependent claim
+	parent int // Positions of the claims
+	child  int
+}
+
+type claimDocCounts struct {
+	unresolved        int
+	multipleDependent int
+}
+
+// newClaimGraph builds the graph of a document's claims. A dependent claim takes the category of the first
+// claim it references, falling back to the category of its own preamble. References to claims that do not
+// exist, or that do not precede the referencing claim, are counted but not linked.
+func newClaimGraph(doc *types.USPTGoDoc) (*claimGraph, error) {
+	pubRef := doc.Patent.UsBibliographicData.PublicationReference.DocumentID
+	graph := &claimGraph{
+		DocNumber: patentxml.NormalizeDocNumber(pubRef.Country, pubRef.DocNumber),
+		Kind:      pubRef.KindCode,
+		DocType:   doc.USPTGoMetadata.DocumentType,
+		Claims:    []*claimNode{},
+		Edges:     []claimEdge{},
+	}
+
+	claims, err := patentxml.ParseClaims(doc.Patent.Claims.Content)
+	byID := map[string]*claimNode{}
+	for i, c := range claims {
+		node := &claimNode{ID: c.ID, Number: c.Number, Independent: c.Independent(), position: i + 1}
+		if node.Number == 0 {
+			node.Number = i + 1
+		}
+		for _, ref := range c.DependsOn {
+			parent, ok := byID[ref]
+			if !ok {
+				graph.stats.unresolved++
+				continue
+			}
+			node.DependsOn = append(node.DependsOn, parent.Number)
+			node.Depth = max(node.Depth, parent.Depth+1)
+			if node.Category == "" {
+				node.Category = parent.Category
+			}
+			graph.Edges = append(graph.Edges, claimEdge{Parent: parent.Number, Child: node.Number, parent: parent.position, child: node.position})
+		}
+		if len(node.DependsOn) > 1 {
+			graph.stats.multipleDependent++
+		}
+		if node.Category == "" {
+			node.Category = patentxml.ClaimCategory(c.Text)
+		}
+		if c.ID != "" {
+			byID[c.ID] = node
+		}
+		graph.Claims = append(graph.Claims, node)
+	}
+	return graph, err
+}
+
+// claimGraphStats aggregates the graphs of a zip file. Categories without a heuristic match are counted as "unknown".
+type claimGraphStats struct {
+	Zip                    string         `json:"zip"`
+	Documents              int            `json:"documents"`
+	DocumentsWithoutClaims int            `json:"documents_without_claims"`
+	Claims                 int            `json:"claims"`
+	Independent            int            `json:"independent"`
+	Dependent              int            `json:"dependent"`
+	MultipleDependent      int            `json:"multiple_dependent"`
+	UnresolvedReferences   int            `json:"unresolved_references"`
+	MeanClaims             float64        `json:"mean_claims_per_document"`
+	MeanIndependent        float64        `json:"mean_independent_per_document"`
+	MaxDepth               int            `json:"max_depth"`
+	DepthHistogram         map[string]int `json:"depth_histogram"`
+	Categories             map[string]int `json:"categories"`
+	IndependentCategories  map[string]int `json:"independent_categories"`
+}
+
+func (s *claimGraphStats) add(graph *claimGraph) {
+	s.Documents++
+	if len(graph.Claims) == 0 {
+		s.DocumentsWithoutClaims++
+	}
+	s.MultipleDependent += graph.stats.multipleDependent
+	s.UnresolvedReferences += graph.stats.unresolved
+	for _, node := range graph.Claims {
+		category := node.Category
+		if category == "" {
+			category = "unknown"
+		}
+		s.Claims++
+		s.Categories[category]++
+		if node.Independent {
+			s.Independent++
+			s.IndependentCategories[category]++
+		} else {
+			s.Dependent++
+		}
+		s.MaxDepth = max(s.MaxDepth, node.Depth)
+		s.DepthHistogram[strconv.Itoa(node.Depth)]++
+	}
+}
+
+func (s *claimGraphStats) finish() {
+	if s.Documents > 0 {
+		s.MeanClaims = float64(s.Claims) / float64(s.Documents)
+		s.MeanIndependent = float64(s.Independent) / float64(s.Documents)
+	}
+}
+
+// claimGraphEncoder writes the graphs of a zip in one of the supported formats.
+type claimGraphEncoder interface {
+	encode(graph *claimGraph) error
+	close() error // Writes any trailer, without closing the underlying writer
+}
+
+// claimGraphExtensions are the file extensions of the supported formats.
+var claimGraphExtensions = map[string]string{
+	"json":    ".claims.jsonl",
+	"dot":     ".claims.dot",
+	"graphml": ".claims.graphml",
+}
+
+// newClaimGraphEncoder returns the encoder of a format, having written any header.
+func newClaimGraphEncoder(format string, w io.Writer) (claimGraphEncoder, error) {
+	switch format {
+	case "dot":
+		return dotClaimGraphs{w}, nil
+	case "graphml":
+		g := &graphMLClaimGraphs{w: w, enc: xml.NewEncoder(w)}
+		return g, g.open()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return jsonClaimGraphs{enc}, nil
+}
+
+// jsonClaimGraphs writes a graph per line.
+type jsonClaimGraphs struct{ enc *json.Encoder }
+
+func (j jsonClaimGraphs) encode(graph *claimGraph) error { return j.enc.Encode(graph) }
+func (j jsonClaimGraphs) close() error                   { return nil }
+
+// dotClaimGraphs writes a digraph per document, which Graphviz renders as separate graphs. Nodes are named
+// by claim position and labeled with the claim number.
+type dotClaimGraphs struct{ w io.Writer }
+
+// dotCategoryShapes distinguish the claim categories in rendered graphs.
+var dotCategoryShapes = map[string]string{
+	patentxml.ClaimMethod:      "ellipse",
+	patentxml.ClaimSystem:      "box3d",
+	patentxml.ClaimApparatus:   "box",
+	patentxml.ClaimComposition: "hexagon",
+	patentxml.ClaimMedium:      "cylinder",
+}
+
+func (d dotClaimGraphs) encode(graph *claimGraph) error {
+	var b strings.Builder
+	name := strconv.Quote(strings.TrimSpace(graph.DocNumber + " " + graph.Kind))
+	fmt.Fprintf(&b, "digraph %s {\n  label=%s;\n  labelloc=t;\n  node [shape=box];\n", name, name)
+	for _, node := range graph.Claims {
+		label := strconv.Itoa(node.Number)
+		if node.Category != "" {
+			label += "\\n" + node.Category
+		}
+		attrs := fmt.Sprintf("label=\"%s\"", label)
+		if shape, ok := dotCategoryShapes[node.Category]; ok {
+			attrs += ", shape=" + shape
+		}
+		if node.Independent {
+			attrs += ", style=bold"
+		}
+		fmt.Fprintf(&b, "  c%d [%s];\n", node.position, attrs)
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "  c%d -> c%d;\n", edge.parent, edge.child)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(d.w, b.String())
+	return err
+}
+
+func (d dotClaimGraphs) close() error { return nil }
+
+// graphMLClaimGraphs writes a GraphML document with a graph per document. Node ids are prefixed with the
+// document number, as GraphML requires them to be unique across the file, and numbered by claim position.
+type graphMLClaimGraphs struct {
+	w   io.Writer
+	enc *xml.Encoder
+}
+
+const graphMLHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://graphml.graphdrawing.org/xmlns http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd">
+  <key id="doc_number" for="graph" attr.name="doc_number" attr.type="string"/>
+  <key id="kind" for="graph" attr.name="kind" attr.type="string"/>
+  <key id="doc_type" for="graph" attr.name="doc_type" attr.type="string"/>
+  <key id="claim_id" for="node" attr.name="claim_id" attr.type="string"/>
+  <key id="number" for="node" attr.name="number" attr.type="int"/>
+  <key id="independent" for="node" attr.name="independent" attr.type="boolean"/>
+  <key id="category" for="node" attr.name="category" attr.type="string"/>
+  <key id="depth" for="node" attr.name="depth" attr.type="int"/>
+`
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type graphMLGraph struct {
+	XMLName     xml.Name      `xml:"graph"`
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Data        []graphMLData `xml:"data"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+func (g *graphMLClaimGraphs) open() error {
+	g.enc.Indent("  ", "  ")
+	_, err := io.WriteString(g.w, graphMLHeader)
+	return err
+}
+
+func (g *graphMLClaimGraphs) encode(graph *claimGraph) error {
+	prefix := graph.DocNumber + "-" + graph.Kind
+	nodeID := func(position int) string { return prefix + "-c" + strconv.Itoa(position) }
+
+	out := graphMLGraph{
+		ID:          prefix,
+		EdgeDefault: "directed",
+		Data: []graphMLData{
+			{Key: "doc_number", Value: graph.DocNumber},
+			{Key: "kind", Value: graph.Kind},
+			{Key: "doc_type", Value: graph.DocType},
+		},
+	}
+	for _, node := range graph.Claims {
+		out.Nodes = append(out.Nodes, graphMLNode{ID: nodeID(node.position), Data: []graphMLData{
+			{Key: "claim_id", Value: node.ID},
+			{Key: "number", Value: strconv.Itoa(node.Number)},
+			{Key: "independent", Value: strconv.FormatBool(node.Independent)},
+			{Key: "category", Value: node.Category},
+			{Key: "depth", Value: strconv.Itoa(node.Depth)},
+		}})
+	}
+	for _, edge := range graph.Edges {
+		out.Edges = append(out.Edges, graphMLEdge{Source: nodeID(edge.parent), Target: nodeID(edge.child)})
+	}
+	if err := g.enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(g.w, "\n")
+	return err
+}
+
+func (g *graphMLClaimGraphs) close() error {
+	_, err := io.WriteString(g.w, "</graphml>\n")
+	return err
+}
+
+// WriteClaimGraphFile writes the claim dependency graph of every document of a single zip in the configured
+// format, followed by a JSON file of aggregate statistics for the zip.
+func WriteClaimGraphFile(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteClaimGraphFile has been invoked", zap.String("OriginZipName", originZipName))
+
+	baseName := strings.TrimSuffix(originZipName, ".zip")
+	outputFileName := baseName + ".claims"
+
+	fail := func(whence string, err error) {
+		log.Error("Error writing claim graphs", zap.String("file", outputFileName), zap.String("whence", whence), zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    "claimgraph",
+			Whence:  whence,
+			Err:     err,
+		}
+		for range inputChan {
+		}
+	}
+
+	format := cfg.OutputConfig.ClaimGraphFormat
+	if format == "" {
+		format = "json"
+	}
+	extension, ok := claimGraphExtensions[format]
+	if !ok {
+		fail("selecting the output format", fmt.Errorf("unsupported claimgraphformat %q, expected json, dot or graphml", format))
+		return
+	}
+	outputFileName = baseName + extension
+	file, err := os.Create(filepath.Join(cfg.OutputDir, outputFileName))
+	if err != nil {
+		fail("creating the output file", err)
+		return
+	}
+	defer file.Close()
+	buf := bufio.NewWriter(file)
+	enc, err := newClaimGraphEncoder(format, buf)
+	if err != nil {
+		fail("writing the file header", err)
+		return
+	}
+
+	stats := &claimGraphStats{
+		Zip:                   originZipName,
+		DepthHistogram:        map[string]int{},
+		Categories:            map[string]int{},
+		IndependentCategories: map[string]int{},
+	}
+	for doc := range inputChan {
+		graph, err := newClaimGraph(doc)
+		if err != nil {
+			// Claims parsed before the error are still written
+			log.Warn("Incomplete claims for document", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: false,
+				Name:    doc.Patent.MetaFileName,
+				Type:    "claimgraph",
+				Whence:  "parsing claims",
+				Err:     err,
+			}
+		}
+		stats.add(graph)
+		if err := enc.encode(graph); err != nil {
+			fail("writing a claim graph", err)
+			return
+		}
+	}
+
+	if err := enc.close(); err != nil {
+		fail("writing the file trailer", err)
+		return
+	}
+	if err := buf.Flush(); err != nil {
+		fail("flushing the output file", err)
+		return
+	}
+
+	stats.finish()
+	statsFileName := baseName + ".claimstats.json"
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(cfg.OutputDir, statsFileName), data, 0644)
+	}
+	if err != nil {
+		log.Error("Error writing claim graph statistics", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: false,
+			Name:    statsFileName,
+			Type:    "claimgraph",
+			Whence:  "writing the statistics file",
+			Err:     err,
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package outputhandler
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspt-go/types"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// claimsDoc returns a grant with the given claims markup.
+func claimsDoc(claims string) *types.USPTGoDoc {
+	doc := &types.USPTGoDoc{}
+	doc.Patent.UsBibliographicData.PublicationReference.DocumentID.Country = "US"
+	doc.Patent.UsBibliographicData.PublicationReference.DocumentID.DocNumber = "11000000"
+	doc.Patent.UsBibliographicData.PublicationReference.DocumentID.KindCode = "B2"
+	doc.Patent.Claims.Content = claims
+	return doc
+}
+
+func TestNewClaimGraph(t *testing.T) {
+	claim := func(id, num, text string) string {
+		return `<claim id="` + id + `" num="` + num + `"><claim-text>` + text + `</claim-text></claim>`
+	}
+	ref := func(id string) string { return `<claim-ref idref="` + id + `">claim</claim-ref>` }
+
+	tests := []struct {
+		name              string
+		claims            string
+		want              []claimNode
+		wantEdges         [][2]int
+		unresolved        int
+		multipleDependent int
+	}{
+		{
+			name: "chain",
+			claims: claim("CLM-1", "00001", "1. A method of charging, comprising: x.") +
+				claim("CLM-2", "00002", "2. The method of "+ref("CLM-1")+", wherein y.") +
+				claim("CLM-3", "00003", "3. The method of "+ref("CLM-2")+", wherein z."),
+			want: []claimNode{
+				{ID: "CLM-1", Number: 1, Independent: true, Category: patentxml.ClaimMethod},
+				{ID: "CLM-2", Number: 2, Category: patentxml.ClaimMethod, Depth: 1, DependsOn: []int{1}},
+				{ID: "CLM-3", Number: 3, Category: patentxml.ClaimMethod, Depth: 2, DependsOn: []int{2}},
+			},
+			wantEdges: [][2]int{{1, 2}, {2, 3}},
+		},
+		{
+			name: "category inherited from the first reference",
+			claims: claim("CLM-1", "00001", "1. A battery comprising: x.") +
+				claim("CLM-2", "00002", "2. A method of using a battery, comprising: y.") +
+				claim("CLM-3", "00003", "3. The composition of "+ref("CLM-2")+" or "+ref("CLM-1")+".") +
+				claim("CLM-4", "00004", "4. The battery of "+ref("CLM-1")+" and "+ref("CLM-3")+"."),
+			want: []claimNode{
+				{ID: "CLM-1", Number: 1, Independent: true, Category: patentxml.ClaimApparatus},
+				{ID: "CLM-2", Number: 2, Independent: true, Category: patentxml.ClaimMethod},
+				{ID: "CLM-3", Number: 3, Category: patentxml.ClaimMethod, Depth: 1, DependsOn: []int{2, 1}},
+				{ID: "CLM-4", Number: 4, Category: patentxml.ClaimApparatus, Depth: 2, DependsOn: []int{1, 3}},
+			},
+			wantEdges:         [][2]int{{2, 3}, {1, 3}, {1, 4}, {3, 4}},
+			multipleDependent: 2,
+		},
+		{
+			name: "unresolved references",
+			claims: claim("CLM-1", "00001", "1. The system of "+ref("CLM-2")+".") +
+				claim("CLM-2", "00002", "2. A system for x.") +
+				claim("CLM-3", "00003", "3. The medium of "+ref("CLM-9")+"."),
+			want: []claimNode{
+				{ID: "CLM-1", Number: 1, Category: patentxml.ClaimSystem},
+				{ID: "CLM-2", Number: 2, Independent: true, Category: patentxml.ClaimSystem},
+				{ID: "CLM-3", Number: 3, Category: patentxml.ClaimMedium},
+			},
+			unresolved: 2,
+		},
+		{
+			name:   "missing numbers",
+			claims: claim("CLM-1", "", "A device.") + claim("", "", "The device of claim 1."),
+			want: []claimNode{
+				{ID: "CLM-1", Number: 1, Independent: true, Category: patentxml.ClaimApparatus},
+				{Number: 2, Independent: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		graph, err := newClaimGraph(claimsDoc(tt.claims))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []claimNode
+		for _, node := range graph.Claims {
+			n := *node
+			n.position = 0
+			got = append(got, n)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: claims = %+v\nwant %+v", tt.name, got, tt.want)
+		}
+		var edges [][2]int
+		for _, edge := range graph.Edges {
+			edges = append(edges, [2]int{edge.Parent, edge.Child})
+		}
+		if !reflect.DeepEqual(edges, tt.wantEdges) {
+			t.Errorf("%s: edges = %v, want %v", tt.name, edges, tt.wantEdges)
+		}
+		if graph.stats != (claimDocCounts{unresolved: tt.unresolved, multipleDependent: tt.multipleDependent}) {
+			t.Errorf("%s: stats = %+v", tt.name, graph.stats)
+		}
+	}
+}
+
+func TestNewClaimGraphFixture(t *testing.T) {
+	graph, err := newClaimGraph(fixture.Doc(fixture.Grant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if graph.DocNumber != "US11000000" || graph.Kind != "B2" || graph.DocType != "grant" || len(graph.Claims) != 3 {
+		t.Fatalf("graph = %+v", graph)
+	}
+	var categories []string
+	for _, node := range graph.Claims {
+		categories = append(categories, node.Category)
+	}
+	if want := []string{patentxml.ClaimApparatus, patentxml.ClaimApparatus, patentxml.ClaimMethod}; !reflect.DeepEqual(categories, want) {
+		t.Errorf("categories = %v, want %v", categories, want)
+	}
+	if len(graph.Edges) != 1 || graph.Edges[0].Parent != 1 || graph.Edges[0].Child != 2 || graph.Claims[1].Depth != 1 {
+		t.Errorf("edges = %+v", graph.Edges)
+	}
+}
+
+func encodeClaimGraph(t *testing.T, format string, graph *claimGraph) string {
+	t.Helper()
+	var b strings.Builder
+	enc, err := newClaimGraphEncoder(format, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.encode(graph); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestClaimGraphDOT(t *testing.T) {
+	graph, err := newClaimGraph(fixture.Doc(fixture.Grant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph "US11000000 B2" {
+  label="US11000000 B2";
+  labelloc=t;
+  node [shape=box];
+  c1 [label="1\napparatus", shape=box, style=bold];
+  c2 [label="2\napparatus", shape=box];
+  c3 [label="3\nmethod", shape=ellipse, style=bold];
+  c1 -> c2;
+}
+`
+	if got := encodeClaimGraph(t, "dot", graph); got != want {
+		t.Errorf("DOT =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestClaimGraphGraphML(t *testing.T) {
+	graph, err := newClaimGraph(fixture.Doc(fixture.Grant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Keys []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"key"`
+		Graphs []graphMLGraph `xml:"graph"`
+	}
+	if err := xml.Unmarshal([]byte(encodeClaimGraph(t, "graphml", graph)), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Keys) != 8 || len(doc.Graphs) != 1 {
+		t.Fatalf("keys %v, graphs %d", doc.Keys, len(doc.Graphs))
+	}
+	g := doc.Graphs[0]
+	if g.ID != "US11000000-B2" || g.EdgeDefault != "directed" || len(g.Nodes) != 3 {
+		t.Fatalf("graph = %+v", g)
+	}
+	if got := g.Nodes[1]; got.ID != "US11000000-B2-c2" || !reflect.DeepEqual(got.Data, []graphMLData{
+		{Key: "claim_id", Value: "CLM-00002"},
+		{Key: "number", Value: "2"},
+		{Key: "independent", Value: "false"},
+		{Key: "category", Value: patentxml.ClaimApparatus},
+		{Key: "depth", Value: "1"},
+	}) {
+		t.Errorf("node = %+v", got)
+	}
+	if want := []graphMLEdge{{Source: "US11000000-B2-c1", Target: "US11000000-B2-c2"}}; !reflect.DeepEqual(g.Edges, want) {
+		t.Errorf("edges = %+v, want %+v", g.Edges, want)
+	}
+}
+
+func TestClaimGraphRepeatedNumbers(t *testing.T) {
+	// The second claim has no number and falls back to its position, which the first claim already uses
+	graph, err := newClaimGraph(claimsDoc(`<claim id="CLM-1" num="00002"><claim-text>2. A device.</claim-text></claim>` +
+		`<claim id="CLM-2"><claim-text>The device of <claim-ref idref="CLM-1">claim 2</claim-ref>.</claim-text></claim>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if graph.Claims[0].Number != 2 || graph.Claims[1].Number != 2 {
+		t.Fatalf("numbers %d, %d, want both 2", graph.Claims[0].Number, graph.Claims[1].Number)
+	}
+
+	dot := encodeClaimGraph(t, "dot", graph)
+	for _, want := range []string{"  c1 [label=\"2\\napparatus\", shape=box, style=bold];\n", "  c2 [label=\"2\\napparatus\", shape=box];\n", "  c1 -> c2;\n"} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT does not contain %q:\n%s", want, dot)
+		}
+	}
+
+	var doc struct {
+		Graphs []graphMLGraph `xml:"graph"`
+	}
+	if err := xml.Unmarshal([]byte(encodeClaimGraph(t, "graphml", graph)), &doc); err != nil {
+		t.Fatal(err)
+	}
+	g := doc.Graphs[0]
+	if len(g.Nodes) != 2 || g.Nodes[0].ID == g.Nodes[1].ID {
+		t.Errorf("nodes = %+v, want distinct ids", g.Nodes)
+	}
+	if want := []graphMLEdge{{Source: g.Nodes[0].ID, Target: g.Nodes[1].ID}}; !reflect.DeepEqual(g.Edges, want) {
+		t.Errorf("edges = %+v, want %+v", g.Edges, want)
+	}
+}
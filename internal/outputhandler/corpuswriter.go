@@ -0,0 +1,349 @@
+package outputhandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// Sections of the corpus output.
+const (
+	corpusAbstract    = "abstract"
+	corpusClaim       = "claim"
+	corpusDescription = "description"
+)
+
+// defaultCorpusChunkTokens is the chunk size used when none is configured.
+const defaultCorpusChunkTokens = 512
+
+// corpusChunk is a line of the corpus output. Offsets count Unicode code points within the text of the
+// section: the paragraphs of the abstract or description joined by newlines, or the text of a single claim.
+type corpusChunk struct {
+	ChunkID      string   `json:"chunk_id"`
+	DocNumber    string   `json:"doc_number"`
+	Kind         string   `json:"kind,omitempty"`
+	DocType      string   `json:"doc_type,omitempty"`
+	PubDate      string   `json:"pub_date,omitempty"`
+	Section      string   `json:"section"`
+	ClaimNumber  int      `json:"claim_number,omitempty"`
+	Heading      string   `json:"heading,omitempty"`
+	ParagraphIDs []string `json:"paragraph_ids,omitempty"`
+	CharStart    int      `json:"char_start"`
+	CharEnd      int      `json:"char_end"`
+	TokenCount   int      `json:"token_count"`
+	Text         string   `json:"text"`
+}
+
+// approxTokens estimates the number of subword tokens in text at four characters per token, which is
+// close to the BPE tokenizers of current language models for English prose.
+func approxTokens(text []rune) int {
+	return (len(text) + 3) / 4
+}
+
+// corpusSegment is a sentence, or a clause of a claim, within the text of a section. Chunks are made of
+// whole segments so that they never end mid-sentence.
+type corpusSegment struct {
+	start, end   int // Code point offsets in the section text
+	paragraph    int
+	paragraphEnd bool // Last segment of its paragraph
+	tokens       int
+}
+
+// abbreviations end with a period that does not end a sentence. Single letters, as in initials, are also
+// treated as abbreviations.
+var abbreviations = map[string]bool{
+	"no": true, "nos": true, "ser": true, "fig": true, "figs": true, "e.g": true, "i.e": true, "u.s": true,
+	"pat": true, "appl": true, "al": true, "approx": true, "vol": true, "col": true, "eq": true, "eqs": true,
+	"ref": true, "inc": true, "co": true, "corp": true, "ltd": true, "vs": true, "ca": true, "cf": true,
+	"dr": true, "mr": true, "mrs": true, "st": true, "pub": true, "sec": true,
+}
+
+// splitSentences returns the [start, end) offsets of the sentences of text. If clauses is set, text is
+// also split after semicolons, as between the elements of a claim.
+func splitSentences(text []rune, clauses bool) [][2]int {
+	var spans [][2]int
+	start := 0
+	for i, r := range text {
+		if r != '.' && r != '?' && r != '!' && !(clauses && r == ';') {
+			continue
+		}
+		if i+1 < len(text) && !unicode.IsSpace(text[i+1]) {
+			continue
+		}
+		if r == '.' && !sentenceEnd(text[start:i+1], text[i+1:]) {
+			continue
+		}
+		spans = append(spans, [2]int{start, i + 1})
+		start = i + 1
+		for start < len(text) && unicode.IsSpace(text[start]) {
+			start++
+		}
+	}
+	if start < len(text) {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// sentenceEnd reports whether the period ending sentence ends it, rather than an abbreviation or number, and
+// is followed by the start of a new sentence.
+func sentenceEnd(sentence, rest []rune) bool {
+	words := strings.Fields(string(sentence))
+	if len(words) == 0 {
+		return false
+	}
+	word := strings.ToLower(strings.TrimLeft(strings.TrimSuffix(words[len(words)-1], "."), "(\"'"))
+	if abbreviations[word] || len([]rune(word)) == 1 && unicode.IsLetter([]rune(word)[0]) {
+		return false
+	}
+	if _, err := strconv.Atoi(word); err == nil && len(words) == 1 {
+		// The number of a claim or list item
+		return false
+	}
+	for _, r := range rest {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		return !unicode.IsLower(r)
+	}
+	return true
+}
+
+// corpusChunker splits the text of sections into chunks of about chunkTokens, repeating up to
+// overlapTokens of each chunk's trailing sentences at the start of the next.
+type corpusChunker struct {
+	chunkTokens   int
+	overlapTokens int
+}
+
+func newCorpusChunker(chunkTokens, overlapTokens int) corpusChunker {
+	if chunkTokens <= 0 {
+		chunkTokens = defaultCorpusChunkTokens
+	}
+	if overlapTokens < 0 {
+		overlapTokens = 0
+	}
+	if overlapTokens >= chunkTokens {
+		// Chunks would never advance past their overlap
+		overlapTokens = chunkTokens / 2
+	}
+	return corpusChunker{chunkTokens: chunkTokens, overlapTokens: overlapTokens}
+}
+
+// section joins paragraphs with newlines and splits them into segments.
+func (c corpusChunker) section(paragraphs []string, clauses bool) ([]rune, []corpusSegment) {
+	var text []rune
+	var segments []corpusSegment
+	for i, paragraph := range paragraphs {
+		if i > 0 {
+			text = append(text, '\n')
+		}
+		base := len(text)
+		runes := []rune(paragraph)
+		text = append(text, runes...)
+		spans := splitSentences(runes, clauses)
+		for j, span := range spans {
+			segments = append(segments, corpusSegment{
+				start:        base + span[0],
+				end:          base + span[1],
+				paragraph:    i,
+				paragraphEnd: j == len(spans)-1,
+				tokens:       approxTokens(runes[span[0]:span[1]]),
+			})
+		}
+	}
+	return text, segments
+}
+
+// chunks groups segments into [from, to) ranges. A chunk ends at the last paragraph boundary that keeps at
+// least half of its tokens, or else at a sentence boundary; a single sentence longer than a chunk is kept whole.
+func (c corpusChunker) chunks(segments []corpusSegment) [][2]int {
+	var ranges [][2]int
+	for start := 0; start < len(segments); {
+		end, tokens := start, 0
+		paragraphEnd, paragraphTokens := -1, 0
+		for end < len(segments) && (end == start || tokens+segments[end].tokens <= c.chunkTokens) {
+			tokens += segments[end].tokens
+			end++
+			if segments[end-1].paragraphEnd {
+				paragraphEnd, paragraphTokens = end, tokens
+			}
+		}
+		if end < len(segments) && paragraphEnd > start && paragraphTokens*2 >= tokens {
+			end = paragraphEnd
+		}
+		ranges = append(ranges, [2]int{start, end})
+		if end == len(segments) {
+			break
+		}
+
+		// The overlap is limited so that the next chunk also fits the segment following this one
+		next, overlap := end, 0
+		for next > start+1 && overlap+segments[next-1].tokens <= min(c.overlapTokens, c.chunkTokens-segments[end].tokens) {
+			next--
+			overlap += segments[next].tokens
+		}
+		start = next
+	}
+	return ranges
+}
+
+// corpusDoc identifies the document of the chunks being written.
+type corpusDoc struct {
+	number, kind, docType, pubDate string
+}
+
+// emit chunks a section and writes its chunks. ids lists the paragraph ids and headings the paragraph headings,
+// either of which may be nil.
+func (c corpusChunker) emit(enc *json.Encoder, doc corpusDoc, section string, claimNumber int, paragraphs, ids, headings []string, clauses bool) error {
+	text, segments := c.section(paragraphs, clauses)
+
+	idPrefix := doc.number + "-" + doc.kind + ":" + section
+	if section == corpusClaim {
+		idPrefix += "-" + strconv.Itoa(claimNumber)
+	}
+
+	for n, r := range c.chunks(segments) {
+		first, last := segments[r[0]], segments[r[1]-1]
+		chunkText := text[first.start:last.end]
+		chunk := corpusChunk{
+			ChunkID:     idPrefix + ":" + strconv.Itoa(n),
+			DocNumber:   doc.number,
+			Kind:        doc.kind,
+			DocType:     doc.docType,
+			PubDate:     doc.pubDate,
+			Section:     section,
+			ClaimNumber: claimNumber,
+			CharStart:   first.start,
+			CharEnd:     last.end,
+			TokenCount:  approxTokens(chunkText),
+			Text:        string(chunkText),
+		}
+		if headings != nil {
+			chunk.Heading = headings[first.paragraph]
+		}
+		if ids != nil {
+			for p := first.paragraph; p <= last.paragraph; p++ {
+				if ids[p] != "" {
+					chunk.ParagraphIDs = append(chunk.ParagraphIDs, ids[p])
+				}
+			}
+		}
+		if err := enc.Encode(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paragraphFields splits paragraphs into their texts, ids and headings.
+func paragraphFields(paragraphs []patentxml.Paragraph) (texts, ids, headings []string) {
+	for _, p := range paragraphs {
+		texts = append(texts, p.Text)
+		ids = append(ids, p.ID)
+		headings = append(headings, p.Heading)
+	}
+	return texts, ids, headings
+}
+
+// writeCorpusDoc writes the chunks of the abstract, each claim and the description of a document.
+func (c corpusChunker) writeCorpusDoc(enc *json.Encoder, doc *types.USPTGoDoc) error {
+	pubRef := doc.Patent.UsBibliographicData.PublicationReference.DocumentID
+	meta := corpusDoc{
+		number:  patentxml.NormalizeDocNumber(pubRef.Country, pubRef.DocNumber),
+		kind:    pubRef.KindCode,
+		docType: doc.USPTGoMetadata.DocumentType,
+		pubDate: formatXMLDate(doc.Patent.MetaDatePubl),
+	}
+
+	abstract := patentxml.Paragraphs(doc.Patent.Abstract.Content)
+	if len(abstract) == 0 {
+		// Some abstracts are bare text rather than paragraphs
+		if text := patentxml.NormalizeSpace(patentxml.PlainText(doc.Patent.Abstract.Content)); text != "" {
+			abstract = []patentxml.Paragraph{{Text: text}}
+		}
+	}
+	texts, ids, _ := paragraphFields(abstract)
+	if err := c.emit(enc, meta, corpusAbstract, 0, texts, ids, nil, false); err != nil {
+		return err
+	}
+
+	claims, _ := patentxml.ParseClaims(doc.Patent.Claims.Content) // Claims parsed before an error are still written
+	for _, claim := range claims {
+		if claim.Text == "" {
+			continue
+		}
+		if err := c.emit(enc, meta, corpusClaim, claim.Number, []string{claim.Text}, []string{claim.ID}, nil, true); err != nil {
+			return err
+		}
+	}
+
+	texts, ids, headings := paragraphFields(patentxml.Paragraphs(doc.Patent.Description.Content))
+	return c.emit(enc, meta, corpusDescription, 0, texts, ids, headings, false)
+}
+
+// WriteCorpusFile writes the documents of a single zip as JSON Lines of text chunks, one line per chunk of
+// the abstract, of each claim and of the description, for training and evaluating retrieval models.
+func WriteCorpusFile(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteCorpusFile has been invoked", zap.String("OriginZipName", originZipName))
+
+	outputFileName := strings.TrimSuffix(originZipName, ".zip") + ".corpus.jsonl"
+	file, err := os.Create(filepath.Join(cfg.OutputDir, outputFileName))
+	if err != nil {
+		log.Error("Error creating corpus file", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    "corpus",
+			Whence:  "creating the output file",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	chunker := newCorpusChunker(cfg.OutputConfig.CorpusChunkTokens, cfg.OutputConfig.CorpusOverlapTokens)
+
+	for doc := range inputChan {
+		if err := chunker.writeCorpusDoc(enc, doc); err != nil {
+			log.Error("Error writing corpus chunks", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    outputFileName,
+				Type:    "corpus",
+				Whence:  "writing the output file",
+				Err:     err,
+			}
+			for range inputChan {
+			}
+			return
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Error("Error flushing corpus file", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    "corpus",
+			Whence:  "flushing the output file",
+			Err:     err,
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package outputhandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		text    string
+		clauses bool
+		want    []string
+	}{
+		{"", false, nil},
+		{"One.  Two.", false, []string{"One.", "Two."}},
+		{"First. Second", false, []string{"First.", "Second"}},
+		{"Is it safe? Yes! It is.", false, []string{"Is it safe?", "Yes!", "It is."}},
+
+		// Abbreviations, initials and numbers
+		{"The cell is shown in FIG. 3. It works.", false, []string{"The cell is shown in FIG. 3.", "It works."}},
+		{"See U.S. Pat. No. 5,123,456. The battery is new.", false, []string{"See U.S. Pat. No. 5,123,456.", "The battery is new."}},
+		{"Metals, e.g. Lithium, are used. Others are not.", false, []string{"Metals, e.g. Lithium, are used.", "Others are not."}},
+		{"J. Smith proposed it. It failed.", false, []string{"J. Smith proposed it.", "It failed."}},
+		{"Version 1.5 is used. It works.", false, []string{"Version 1.5 is used.", "It works."}},
+		{"The range is 5 wt. percent of the total.", false, []string{"The range is 5 wt. percent of the total."}},
+		{`As in (Fig. 2) and "Ref. 4", it holds.`, false, []string{`As in (Fig. 2) and "Ref. 4", it holds.`}},
+
+		// Claim numbers and the clauses of claims
+		{"1. A battery comprising: an anode; a cathode; and an electrolyte.", false, []string{"1. A battery comprising: an anode; a cathode; and an electrolyte."}},
+		{"1. A battery comprising: an anode; a cathode; and an electrolyte.", true, []string{"1. A battery comprising: an anode;", "a cathode;", "and an electrolyte."}},
+		{"2. The battery of claim 1, wherein x;y is a ratio.", true, []string{"2. The battery of claim 1, wherein x;y is a ratio."}},
+		{"12. A method. Another sentence.", false, []string{"12. A method.", "Another sentence."}},
+	}
+	for _, tt := range tests {
+		text := []rune(tt.text)
+		var got []string
+		for _, span := range splitSentences(text, tt.clauses) {
+			got = append(got, string(text[span[0]:span[1]]))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitSentences(%q, %t) = %q, want %q", tt.text, tt.clauses, got, tt.want)
+		}
+	}
+}
+
+// corpusSegments builds segments of the given token counts, ending a paragraph after the segments at paragraphEnds.
+func corpusSegments(tokens []int, paragraphEnds ...int) []corpusSegment {
+	segments := make([]corpusSegment, len(tokens))
+	paragraph := 0
+	for i, n := range tokens {
+		segments[i] = corpusSegment{paragraph: paragraph, tokens: n}
+		for _, end := range paragraphEnds {
+			if end == i {
+				segments[i].paragraphEnd = true
+				paragraph++
+			}
+		}
+	}
+	return segments
+}
+
+func TestCorpusChunks(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunkTokens   int
+		overlapTokens int
+		segments      []corpusSegment
+		want          [][2]int
+	}{
+		{"empty", 100, 0, nil, nil},
+		{"one chunk", 100, 0, corpusSegments([]int{30, 30, 30}, 2), [][2]int{{0, 3}}},
+		{"sentence boundaries", 100, 0, corpusSegments([]int{60, 60, 60}, 2), [][2]int{{0, 1}, {1, 2}, {2, 3}}},
+		{"paragraph boundary preferred", 100, 0, corpusSegments([]int{30, 30, 30, 30}, 1, 3), [][2]int{{0, 2}, {2, 4}}},
+		{"paragraph boundary under half", 100, 0, corpusSegments([]int{10, 40, 40, 40}, 0, 3), [][2]int{{0, 3}, {3, 4}}},
+		{"long sentence kept whole", 100, 0, corpusSegments([]int{150, 30, 30}, 2), [][2]int{{0, 1}, {1, 3}}},
+		{"long sentence after others", 100, 20, corpusSegments([]int{30, 150, 30}, 2), [][2]int{{0, 1}, {1, 2}, {2, 3}}},
+		{"overlap", 100, 40, corpusSegments([]int{30, 30, 30, 30, 30}, 4), [][2]int{{0, 3}, {2, 5}}},
+		{"overlap limited by the next segment", 100, 60, corpusSegments([]int{30, 30, 30, 80}, 3), [][2]int{{0, 3}, {3, 4}}},
+		{"overlap keeps the chunk advancing", 100, 90, corpusSegments([]int{50, 50, 50}, 2), [][2]int{{0, 2}, {1, 3}}},
+	}
+	for _, tt := range tests {
+		c := newCorpusChunker(tt.chunkTokens, tt.overlapTokens)
+		if got := c.chunks(tt.segments); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: chunks = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewCorpusChunker(t *testing.T) {
+	tests := []struct {
+		chunkTokens, overlapTokens int
+		want                       corpusChunker
+	}{
+		{0, 0, corpusChunker{chunkTokens: defaultCorpusChunkTokens}},
+		{256, -1, corpusChunker{chunkTokens: 256}},
+		{256, 64, corpusChunker{chunkTokens: 256, overlapTokens: 64}},
+		{256, 256, corpusChunker{chunkTokens: 256, overlapTokens: 128}},
+	}
+	for _, tt := range tests {
+		if got := newCorpusChunker(tt.chunkTokens, tt.overlapTokens); got != tt.want {
+			t.Errorf("newCorpusChunker(%d, %d) = %+v, want %+v", tt.chunkTokens, tt.overlapTokens, got, tt.want)
+		}
+	}
+}
+
+func TestCorpusChunkerEmit(t *testing.T) {
+	doc := corpusDoc{number: "US11000000", kind: "B2", docType: "grant", pubDate: "2024-01-02"}
+	paragraphs := []string{"Électrode sentence. Second one.", "Third para."}
+	c := newCorpusChunker(10, 5)
+
+	var buf bytes.Buffer
+	if err := c.emit(json.NewEncoder(&buf), doc, corpusDescription, 0, paragraphs, []string{"p-0001", ""}, []string{"SUMMARY", "SUMMARY"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.emit(json.NewEncoder(&buf), doc, corpusClaim, 2, []string{"2. The battery of claim 1."}, nil, nil, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var chunks []corpusChunk
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var chunk corpusChunk
+		if err := dec.Decode(&chunk); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	// Offsets count code points, and the second chunk repeats the last sentence of the first
+	want := []corpusChunk{
+		{ChunkID: "US11000000-B2:description:0", DocNumber: "US11000000", Kind: "B2", DocType: "grant", PubDate: "2024-01-02", Section: corpusDescription,
+			Heading: "SUMMARY", ParagraphIDs: []string{"p-0001"}, CharStart: 0, CharEnd: 31, TokenCount: 8, Text: "Électrode sentence. Second one."},
+		{ChunkID: "US11000000-B2:description:1", DocNumber: "US11000000", Kind: "B2", DocType: "grant", PubDate: "2024-01-02", Section: corpusDescription,
+			Heading: "SUMMARY", ParagraphIDs: []string{"p-0001"}, CharStart: 20, CharEnd: 43, TokenCount: 6, Text: "Second one.\nThird para."},
+		{ChunkID: "US11000000-B2:claim-2:0", DocNumber: "US11000000", Kind: "B2", DocType: "grant", PubDate: "2024-01-02", Section: corpusClaim,
+			ClaimNumber: 2, CharStart: 0, CharEnd: 26, TokenCount: 7, Text: "2. The battery of claim 1."},
+	}
+	if !reflect.DeepEqual(chunks, want) {
+		t.Errorf("chunks = %+v\nwant %+v", chunks, want)
+	}
+}
@@ -0,0 +1,282 @@
+package outputhandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// flatColumn describes a single column of the flat ParquetPatentDocument schema.
+type flatColumn struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	field int
+}
+
+// flatColumns derives the column list from the parquet tags of ParquetPatentDocument, so that the
+// delimited output always carries the same fields, in the same order, as the Parquet output.
+func flatColumns() []flatColumn {
+	t := reflect.TypeOf(ParquetPatentDocument{})
+	columns := make([]flatColumn, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		col := flatColumn{field: i}
+		for _, part := range strings.Split(t.Field(i).Tag.Get("parquet"), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if key == "name" {
+				col.Name = value
+			}
+		}
+		switch t.Field(i).Type.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			col.Type = "int64"
+		default:
+			col.Type = "string"
+		}
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// csvSchema is written alongside each delimited file to describe its layout.
+type csvSchema struct {
+	Delimiter     string       `json:"delimiter"`
+	Quoting       string       `json:"quoting"`
+	MaxTextLength int          `json:"maxTextLength,omitempty"`
+	Columns       []flatColumn `json:"columns"`
+}
+
+func WriteCSVFile(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteCSVFile has been invoked", zap.String("OriginZipName", originZipName))
+
+	outCfg := cfg.OutputConfig
+
+	delimiter, err := csvDelimiter(outCfg.CSVDelimiter)
+	if err != nil {
+		log.Error("Invalid CSV delimiter", zap.Error(err))
+		errorChan <- err
+		for range inputChan {
+		}
+		return
+	}
+	quoteAll, err := csvQuoteAll(outCfg.CSVQuoting)
+	if err != nil {
+		log.Error("Invalid CSV quoting", zap.Error(err))
+		errorChan <- err
+		for range inputChan {
+		}
+		return
+	}
+
+	// Select the configured columns, preserving schema order
+	columns := selectCSVColumns(outCfg.CSVColumns, outCfg.CSVExcludeDescription, log)
+
+	// Set output path and file name based on originating zip file name
+	extension := ".csv"
+	if delimiter == '\t' {
+		extension = ".tsv"
+	}
+	baseName := strings.TrimSuffix(originZipName, ".zip")
+	outputFileName := baseName + extension
+	outputFilePath := filepath.Join(cfg.OutputDir, outputFileName)
+
+	file, err := os.Create(outputFilePath)
+	if err != nil {
+		log.Error("Error creating CSV file", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    "csv",
+			Whence:  "creating the output file",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+
+	// Header row
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.Name
+	}
+	if err := writeCSVRecord(w, header, delimiter, quoteAll); err != nil {
+		log.Error("Error writing CSV header", zap.Error(err))
+		errorChan <- err
+		for range inputChan {
+		}
+		return
+	}
+
+	record := make([]string, len(columns))
+	for doc := range inputChan {
+		row := reflect.ValueOf(flattenDoc(doc, outCfg.TextFormat))
+		for i, col := range columns {
+			value := row.Field(col.field)
+			if col.Type == "int64" {
+				record[i] = strconv.FormatInt(value.Int(), 10)
+			} else {
+				record[i] = truncateText(value.String(), outCfg.CSVMaxTextLength)
+			}
+		}
+
+		if err := writeCSVRecord(w, record, delimiter, quoteAll); err != nil {
+			log.Error("Error writing document to CSV file", zap.Error(err))
+			errorChan <- err
+			for range inputChan {
+			}
+			return
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Error("Error flushing CSV file", zap.Error(err))
+		errorChan <- err
+		return
+	}
+
+	// Write the schema sidecar
+	quoting := "minimal"
+	if quoteAll {
+		quoting = "all"
+	}
+	schema := csvSchema{
+		Delimiter:     string(delimiter),
+		Quoting:       quoting,
+		MaxTextLength: outCfg.CSVMaxTextLength,
+		Columns:       columns,
+	}
+	schemaData, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		log.Error("Failed to marshal CSV schema", zap.Error(err))
+		errorChan <- err
+		return
+	}
+	if err := os.WriteFile(filepath.Join(cfg.OutputDir, baseName+".schema.json"), schemaData, 0644); err != nil {
+		log.Error("Failed to write CSV schema sidecar", zap.Error(err))
+		errorChan <- err
+	}
+}
+
+// csvDelimiter resolves the configured delimiter, accepting "tab" as an alias for a tab character.
+func csvDelimiter(value string) (rune, error) {
+	switch value {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("csv delimiter must be a single character other than a quote or newline, got %q", value)
+	}
+	return r, nil
+}
+
+// csvQuoteAll resolves the configured quoting: "minimal" quotes only the fields that require it, "all" every field.
+func csvQuoteAll(value string) (bool, error) {
+	switch value {
+	case "", "minimal":
+		return false, nil
+	case "all":
+		return true, nil
+	}
+	return false, fmt.Errorf("csv quoting must be \"minimal\" or \"all\", got %q", value)
+}
+
+func selectCSVColumns(names []string, excludeDescription bool, log *zap.Logger) []flatColumn {
+	all := flatColumns()
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	columns := make([]flatColumn, 0, len(all))
+	for _, col := range all {
+		if excludeDescription && col.Name == "description" {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[col.Name] {
+			continue
+		}
+		delete(wanted, col.Name)
+		columns = append(columns, col)
+	}
+
+	for name := range wanted {
+		log.Warn("Unknown CSV column in config, ignoring", zap.String("column", name))
+	}
+	return columns
+}
+
+// writeCSVRecord writes a single delimited record, quoting fields as required by RFC 4180
+// (or unconditionally when quoteAll is set) so that embedded delimiters and newlines in long
+// text fields are preserved safely.
+func writeCSVRecord(w *bufio.Writer, fields []string, delimiter rune, quoteAll bool) error {
+	for i, field := range fields {
+		if i > 0 {
+			if _, err := w.WriteRune(delimiter); err != nil {
+				return err
+			}
+		}
+
+		if !quoteAll && !csvNeedsQuotes(field, delimiter) {
+			if _, err := w.WriteString(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := w.WriteByte('"'); err != nil {
+			return err
+		}
+		if _, err := w.WriteString(strings.ReplaceAll(field, `"`, `""`)); err != nil {
+			return err
+		}
+		if err := w.WriteByte('"'); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteString("\r\n")
+	return err
+}
+
+func csvNeedsQuotes(field string, delimiter rune) bool {
+	if field == "" {
+		return false
+	}
+	if field[0] == ' ' || field[0] == '\t' {
+		return true
+	}
+	return strings.ContainsRune(field, delimiter) || strings.ContainsAny(field, "\"\r\n")
+}
+
+// truncateText shortens s to at most maxLength characters without splitting a multi-byte character.
+func truncateText(s string, maxLength int) string {
+	if maxLength <= 0 || utf8.RuneCountInString(s) <= maxLength {
+		return s
+	}
+	count := 0
+	for i := range s {
+		if count == maxLength {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
@@ -0,0 +1,166 @@
+package outputhandler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func TestWriteCSVRecord(t *testing.T) {
+	tests := []struct {
+		name      string
+		fields    []string
+		delimiter rune
+		quoteAll  bool
+		want      string
+	}{
+		{"plain", []string{"US11000000", "B2", "Battery"}, ',', false, "US11000000,B2,Battery\r\n"},
+		{"empty fields", []string{"", "B2", ""}, ',', false, ",B2,\r\n"},
+		{"quote all", []string{"US11000000", "", "Battery"}, ',', true, `"US11000000","","Battery"` + "\r\n"},
+		{"embedded quote", []string{`The "battery"`}, ',', false, `"The ""battery"""` + "\r\n"},
+		{"embedded LF", []string{"first line\nsecond line", "B2"}, ',', false, "\"first line\nsecond line\",B2\r\n"},
+		{"embedded CR", []string{"first line\rsecond line"}, ',', false, "\"first line\rsecond line\"\r\n"},
+		{"embedded CRLF", []string{"first line\r\nsecond line"}, ',', false, "\"first line\r\nsecond line\"\r\n"},
+		{"delimiter in field", []string{"H01M 10/052, H01M 4/13", "B2"}, ',', false, `"H01M 10/052, H01M 4/13",B2` + "\r\n"},
+		{"comma with tab delimiter", []string{"H01M 10/052, H01M 4/13", "B2"}, '\t', false, "H01M 10/052, H01M 4/13\tB2\r\n"},
+		{"tab in field", []string{"a\tb", "B2"}, '\t', false, "\"a\tb\"\tB2\r\n"},
+		{"semicolon in field", []string{"a;b", "a,b"}, ';', false, `"a;b";a,b` + "\r\n"},
+		{"multi-byte delimiter", []string{"a¦b", "c"}, '¦', false, "\"a¦b\"¦c\r\n"},
+		{"leading space", []string{" Battery"}, ',', false, `" Battery"` + "\r\n"},
+		{"leading tab", []string{"\tBattery"}, ',', false, "\"\tBattery\"\r\n"},
+		{"trailing space", []string{"Battery "}, ',', false, "Battery \r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			if err := writeCSVRecord(w, tt.fields, tt.delimiter, tt.quoteAll); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("writeCSVRecord(%q) = %q, want %q", tt.fields, got, tt.want)
+			}
+
+			// The record reads back to the same fields; encoding/csv turns \r\n inside quotes into \n
+			r := csv.NewReader(&buf)
+			r.Comma = tt.delimiter
+			got, err := r.Read()
+			if err != nil {
+				t.Fatalf("reading back %q: %v", tt.want, err)
+			}
+			want := make([]string, len(tt.fields))
+			for i, field := range tt.fields {
+				want[i] = strings.ReplaceAll(field, "\r\n", "\n")
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("read back %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		s         string
+		maxLength int
+		want      string
+	}{
+		{"battery", 0, "battery"},
+		{"battery", -1, "battery"},
+		{"battery", 7, "battery"},
+		{"battery", 10, "battery"},
+		{"battery", 3, "bat"},
+		{"électrode", 1, "é"},
+		{"électrode", 2, "él"},
+		{"Li-ion 電池", 8, "Li-ion 電"},
+		{"電池", 1, "電"},
+		{"", 3, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateText(tt.s, tt.maxLength); got != tt.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", tt.s, tt.maxLength, got, tt.want)
+		}
+	}
+}
+
+func TestCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    rune
+		wantErr bool
+	}{
+		{"", ',', false},
+		{",", ',', false},
+		{"tab", '\t', false},
+		{`\t`, '\t', false},
+		{"\t", '\t', false},
+		{";", ';', false},
+		{"¦", '¦', false},
+		{`"`, 0, true},
+		{"\n", 0, true},
+		{"\r", 0, true},
+		{";;", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := csvDelimiter(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("csvDelimiter(%q) = %q, %v, want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCSVQuoteAll(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{"", false, false},
+		{"minimal", false, false},
+		{"all", true, false},
+		{"All", false, true},
+		{"al", false, true},
+		{"none", false, true},
+	}
+	for _, tt := range tests {
+		got, err := csvQuoteAll(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("csvQuoteAll(%q) = %v, %v, want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteCSVFileInvalidQuoting(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{OutputDir: dir}
+	cfg.OutputConfig.CSVQuoting = "quoteall"
+	inputChan := make(chan *types.USPTGoDoc, 1)
+	inputChan <- fixture.Doc(fixture.Grant)
+	close(inputChan)
+	errorChan := make(chan error, 10)
+
+	WriteCSVFile(cfg, "ipg240102.zip", inputChan, errorChan, zap.NewNop())
+	close(errorChan)
+	if err := <-errorChan; err == nil || !strings.Contains(err.Error(), "quoteall") {
+		t.Errorf("error = %v, want an invalid quoting error", err)
+	}
+	if len(inputChan) != 0 {
+		t.Error("input channel not drained")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("wrote %d files", len(entries))
+	}
+}
@@ -0,0 +1,471 @@
+package outputhandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// Delta Lake transaction log actions, see https://github.com/delta-io/delta/blob/master/PROTOCOL.md
+type deltaAction struct {
+	Protocol   *deltaProtocol   `json:"protocol,omitempty"`
+	MetaData   *deltaMetaData   `json:"metaData,omitempty"`
+	Add        *deltaAdd        `json:"add,omitempty"`
+	CommitInfo *deltaCommitInfo `json:"commitInfo,omitempty"`
+}
+
+type deltaProtocol struct {
+	MinReaderVersion int `json:"minReaderVersion"`
+	MinWriterVersion int `json:"minWriterVersion"`
+}
+
+type deltaMetaData struct {
+	ID               string            `json:"id"`
+	Format           deltaFormat       `json:"format"`
+	SchemaString     string            `json:"schemaString"`
+	PartitionColumns []string          `json:"partitionColumns"`
+	Configuration    map[string]string `json:"configuration"`
+	CreatedTime      int64             `json:"createdTime"`
+}
+
+type deltaFormat struct {
+	Provider string            `json:"provider"`
+	Options  map[string]string `json:"options"`
+}
+
+type deltaAdd struct {
+	Path             string             `json:"path"`
+	PartitionValues  map[string]*string `json:"partitionValues"`
+	Size             int64              `json:"size"`
+	ModificationTime int64              `json:"modificationTime"`
+	DataChange       bool               `json:"dataChange"`
+	Stats            string             `json:"stats"`
+}
+
+type deltaCommitInfo struct {
+	Timestamp           int64             `json:"timestamp"`
+	Operation           string            `json:"operation"`
+	OperationParameters map[string]string `json:"operationParameters"`
+	IsBlindAppend       bool              `json:"isBlindAppend"`
+	EngineInfo          string            `json:"engineInfo"`
+	UserMetadata        string            `json:"userMetadata"`
+}
+
+type deltaStats struct {
+	NumRecords int64                  `json:"numRecords"`
+	MinValues  map[string]interface{} `json:"minValues"`
+	MaxValues  map[string]interface{} `json:"maxValues"`
+	NullCount  map[string]int64       `json:"nullCount"`
+}
+
+// deltaLogFile matches the commit files of the transaction log, e.g. 00000000000000000003.json
+var deltaLogFile = regexp.MustCompile(`^(\d{20})\.json$`)
+
+// deltaTable is the table shared by every zip of a run. Each zip is committed as a separate table version.
+type deltaTable struct {
+	mu               sync.Mutex
+	root             string
+	schemaVersion    string
+	fields           []tableField
+	schemaString     string
+	partitionColumns []string
+	err              error
+
+	// The transaction log replayed so far, so that each commit only reads the versions added since
+	replayed bool
+	next     int64
+	metaData *deltaMetaData
+}
+
+var deltaOutput struct {
+	once  sync.Once
+	table *deltaTable
+}
+
+func getDeltaTable(cfg *config.Config) *deltaTable {
+	deltaOutput.once.Do(func() {
+		schemaVersion := parquetSchemaVersion(cfg)
+		t := &deltaTable{
+			root:             filepath.Join(cfg.OutputDir, cfg.OutputConfig.DeltaTableName),
+			schemaVersion:    schemaVersion,
+			fields:           tableSchemaOf(reflect.TypeOf(parquetSchema(schemaVersion)).Elem()),
+			partitionColumns: append([]string{}, cfg.OutputConfig.ParquetPartitionBy...),
+		}
+		t.schemaString, t.err = t.deltaSchema()
+		deltaOutput.table = t
+	})
+	return deltaOutput.table
+}
+
+// deltaSchema renders the table schema: the columns of the Parquet files followed by the partition columns,
+// whose values are only recorded in the transaction log.
+func (t *deltaTable) deltaSchema() (string, error) {
+	fields := make([]deltaStructField, 0, len(t.fields)+len(t.partitionColumns))
+	for _, field := range t.fields {
+		fields = append(fields, deltaField(field.Name, field.Type))
+	}
+	for _, column := range t.partitionColumns {
+		for _, field := range t.fields {
+			if field.Name == column {
+				return "", fmt.Errorf("partition column %q conflicts with a column of the %s schema", column, t.schemaVersion)
+			}
+		}
+		if !isPartitionColumn(column) {
+			return "", fmt.Errorf("unknown partition column %q", column)
+		}
+		fields = append(fields, deltaField(column, tableType{Primitive: "string"}))
+	}
+	schema, err := json.Marshal(deltaStructType{Type: "struct", Fields: fields})
+	return string(schema), err
+}
+
+// Delta Lake schema serialization, as used by Spark
+type deltaStructType struct {
+	Type   string             `json:"type"`
+	Fields []deltaStructField `json:"fields"`
+}
+
+type deltaStructField struct {
+	Name     string                 `json:"name"`
+	Type     interface{}            `json:"type"`
+	Nullable bool                   `json:"nullable"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+type deltaArrayType struct {
+	Type         string      `json:"type"`
+	ElementType  interface{} `json:"elementType"`
+	ContainsNull bool        `json:"containsNull"`
+}
+
+func deltaField(name string, t tableType) deltaStructField {
+	return deltaStructField{Name: name, Type: deltaType(t), Nullable: true, Metadata: map[string]interface{}{}}
+}
+
+func deltaType(t tableType) interface{} {
+	switch {
+	case t.Element != nil:
+		return deltaArrayType{Type: "array", ElementType: deltaType(*t.Element), ContainsNull: true}
+	case t.Fields != nil:
+		fields := make([]deltaStructField, len(t.Fields))
+		for i, field := range t.Fields {
+			fields[i] = deltaField(field.Name, field.Type)
+		}
+		return deltaStructType{Type: "struct", Fields: fields}
+	case t.Primitive == "int":
+		return "integer"
+	}
+	return t.Primitive
+}
+
+// deltaFileStats renders the per-file statistics readers use to skip files.
+func (t *deltaTable) deltaFileStats(s *columnStats) (string, error) {
+	stats := deltaStats{NumRecords: s.rows, MinValues: map[string]interface{}{}, MaxValues: map[string]interface{}{}, NullCount: map[string]int64{}}
+	for _, field := range t.fields {
+		if field.Type.Primitive == "" || field.Type.Primitive == "boolean" {
+			continue
+		}
+		stats.NullCount[field.Name] = s.nulls[field.Name]
+		if min, ok := s.min[field.Name]; ok {
+			stats.MinValues[field.Name] = deltaStatValue(field.Type, min)
+			stats.MaxValues[field.Name] = deltaStatValue(field.Type, s.max[field.Name])
+		}
+	}
+	data, err := json.Marshal(stats)
+	return string(data), err
+}
+
+func deltaStatValue(t tableType, value interface{}) interface{} {
+	if days, ok := value.(int64); ok && t.Primitive == "date" {
+		return epochDate(days)
+	}
+	return value
+}
+
+// WriteDeltaTable writes the documents of a single zip to Parquet files of the Delta table and commits
+// them to its transaction log as one new table version.
+func WriteDeltaTable(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteDeltaTable has been invoked", zap.String("OriginZipName", originZipName))
+
+	table := getDeltaTable(cfg)
+	if table.err != nil {
+		log.Error("Invalid Delta table configuration", zap.Error(table.err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "delta",
+			Whence:  "configuring the table schema",
+			Err:     table.err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+
+	files := newTableFiles(cfg, table.schemaVersion, table.root, originZipName, table.fields, log)
+
+	for doc := range inputChan {
+		stats := conversionStats{}
+		row := parquetRow(doc, table.schemaVersion, rowOptionsOf(cfg), stats, errorChan, log)
+
+		segments := make([]string, len(table.partitionColumns))
+		values := make(map[string]*string, len(table.partitionColumns))
+		for i, column := range table.partitionColumns {
+			value := partitionValue(doc, column)
+			if value == "" {
+				segments[i] = column + "=" + hiveDefaultPartition
+				values[column] = nil
+				continue
+			}
+			segments[i] = column + "=" + value
+			values[column] = &value
+		}
+
+		if whence, err := files.write(strings.Join(segments, "/"), values, convertedRow{row: row, stats: stats}); err != nil {
+			log.Error("Error writing document to Delta table", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    originZipName,
+				Type:    "delta",
+				Whence:  whence,
+				Err:     err,
+			}
+			// Files that are not committed to the log are invisible to readers
+			files.abort()
+			for range inputChan {
+			}
+			return
+		}
+	}
+
+	dataFiles, err := files.close()
+	if err != nil {
+		log.Error("Error finalizing Delta table files", zap.String("OriginZipName", originZipName), zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "delta",
+			Whence:  "finalizing the data files",
+			Err:     err,
+		}
+		return
+	}
+
+	var adds []*deltaAdd
+	for _, file := range dataFiles {
+		add, err := table.addAction(file)
+		if err != nil {
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    originZipName,
+				Type:    "delta",
+				Whence:  "collecting file statistics",
+				Err:     err,
+			}
+			return
+		}
+		adds = append(adds, add)
+	}
+
+	if len(adds) == 0 {
+		log.Info("No documents to commit to the Delta table", zap.String("OriginZipName", originZipName))
+		return
+	}
+
+	version, err := table.commit(adds, originZipName)
+	if err != nil {
+		log.Error("Error committing to the Delta table", zap.String("OriginZipName", originZipName), zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "delta",
+			Whence:  "committing to the transaction log",
+			Err:     err,
+		}
+		return
+	}
+	log.Info("Committed zip to the Delta table", zap.String("OriginZipName", originZipName), zap.Int64("version", version), zap.Int("files", len(adds)))
+}
+
+func (t *deltaTable) addAction(file tableDataFile) (*deltaAdd, error) {
+	statsJSON, err := t.deltaFileStats(file.Stats)
+	if err != nil {
+		return nil, err
+	}
+
+	// Paths are relative URIs
+	segments := strings.Split(file.Path, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+
+	return &deltaAdd{
+		Path:             strings.Join(segments, "/"),
+		PartitionValues:  file.Partition.Values.(map[string]*string),
+		Size:             file.Size,
+		ModificationTime: file.ModificationTime.UnixMilli(),
+		DataChange:       true,
+		Stats:            statsJSON,
+	}, nil
+}
+
+// commit atomically adds the files as the next version of the table. A version file is only ever created
+// by hard linking a completed temporary file, which fails if another writer committed that version first,
+// in which case the commit is retried as the following version.
+func (t *deltaTable) commit(adds []*deltaAdd, originZipName string) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	logDir := filepath.Join(t.root, "_delta_log")
+	if err := os.MkdirAll(logDir, os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	for {
+		version, metaData, err := t.latest(logDir)
+		if err != nil {
+			return 0, err
+		}
+
+		now := time.Now().UnixMilli()
+		var actions []deltaAction
+		if version == 0 {
+			actions = append(actions,
+				deltaAction{Protocol: &deltaProtocol{MinReaderVersion: 1, MinWriterVersion: 2}},
+				deltaAction{MetaData: &deltaMetaData{
+					ID:               uuid.NewString(),
+					Format:           deltaFormat{Provider: "parquet", Options: map[string]string{}},
+					SchemaString:     t.schemaString,
+					PartitionColumns: t.partitionColumns,
+					Configuration:    map[string]string{},
+					CreatedTime:      now,
+				}},
+			)
+		} else if metaData != nil {
+			if metaData.SchemaString != t.schemaString || strings.Join(metaData.PartitionColumns, ",") != strings.Join(t.partitionColumns, ",") {
+				return 0, fmt.Errorf("the table at %s has a different schema or partitioning, configure a new deltatablename", t.root)
+			}
+		}
+
+		for _, add := range adds {
+			actions = append(actions, deltaAction{Add: add})
+		}
+		partitionBy, _ := json.Marshal(t.partitionColumns)
+		actions = append(actions, deltaAction{CommitInfo: &deltaCommitInfo{
+			Timestamp:           now,
+			Operation:           "WRITE",
+			OperationParameters: map[string]string{"mode": "Append", "partitionBy": string(partitionBy)},
+			IsBlindAppend:       true,
+			EngineInfo:          "uspto-bulk-data-tool",
+			UserMetadata:        originZipName,
+		}})
+
+		tmp, err := os.CreateTemp(logDir, ".tmp-*.json")
+		if err != nil {
+			return 0, err
+		}
+		enc := json.NewEncoder(tmp)
+		enc.SetEscapeHTML(false)
+		for _, action := range actions {
+			if err = enc.Encode(action); err != nil {
+				break
+			}
+		}
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return 0, err
+		}
+
+		err = putIfAbsent(tmp.Name(), filepath.Join(logDir, fmt.Sprintf("%020d.json", version)))
+		if err == nil {
+			return version, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return 0, err
+		}
+	}
+}
+
+// putIfAbsent moves the completed file at tmpPath to path unless path already exists, in which case it fails
+// with an error wrapping os.ErrExist. Unlike a rename, which replaces the target, a hard link is created only
+// if the name is free.
+func putIfAbsent(tmpPath, path string) error {
+	err := os.Link(tmpPath, path)
+	os.Remove(tmpPath)
+	return err
+}
+
+// latest returns the next version of the table and its most recent metadata, if still in the JSON log.
+// The log is listed once; later calls only read the versions committed since, by this or another writer.
+func (t *deltaTable) latest(logDir string) (int64, *deltaMetaData, error) {
+	if !t.replayed {
+		entries, err := os.ReadDir(logDir)
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, entry := range entries { // Sorted by file name, and so by version
+			match := deltaLogFile.FindStringSubmatch(entry.Name())
+			if match == nil {
+				continue
+			}
+			var version int64
+			fmt.Sscan(match[1], &version)
+			if err := t.replay(logDir, version); err != nil {
+				return 0, nil, err
+			}
+		}
+		t.replayed = true
+	}
+
+	for {
+		err := t.replay(logDir, t.next)
+		if errors.Is(err, os.ErrNotExist) {
+			return t.next, t.metaData, nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+}
+
+// replay reads the metadata of a version of the log, after which the next version is the one following it.
+func (t *deltaTable) replay(logDir string, version int64) error {
+	f, err := os.Open(filepath.Join(logDir, fmt.Sprintf("%020d.json", version)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var action deltaAction
+		if json.Unmarshal(scanner.Bytes(), &action) == nil && action.MetaData != nil {
+			t.metaData = action.MetaData
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	t.next = version + 1
+	return nil
+}
@@ -0,0 +1,263 @@
+package outputhandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// readDeltaVersion reads the actions of a version of the transaction log.
+func readDeltaVersion(t *testing.T, logDir string, version int64) []deltaAction {
+	t.Helper()
+	f, err := os.Open(filepath.Join(logDir, fmt.Sprintf("%020d.json", version)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var actions []deltaAction
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var action deltaAction
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		actions = append(actions, action)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return actions
+}
+
+// writeDeltaVersion writes a version of the transaction log as another writer would.
+func writeDeltaVersion(t *testing.T, logDir string, version int64, actions ...deltaAction) {
+	t.Helper()
+	var data []byte
+	for _, action := range actions {
+		line, err := json.Marshal(action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := os.WriteFile(filepath.Join(logDir, fmt.Sprintf("%020d.json", version)), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteDeltaTableCommits(t *testing.T) {
+	// The table is shared by the zips of a run, start from a fresh one
+	resetDeltaOutput := func() { deltaOutput.once, deltaOutput.table = sync.Once{}, nil }
+	resetDeltaOutput()
+	t.Cleanup(resetDeltaOutput)
+
+	cfg := &config.Config{OutputDir: t.TempDir()}
+	cfg.OutputConfig.ParquetSchema = "v1"
+	cfg.OutputConfig.ParquetCompression = "snappy"
+	cfg.OutputConfig.DeltaTableName = "patents_delta"
+	cfg.OutputConfig.ParquetPartitionBy = []string{"doc_type"}
+
+	grants := testDocs("grant", "US11000000-20240102.XML", "US11000001-20240102.XML")
+	grants[0].Patent.UsBibliographicData.InventionTitle.Text = "Battery"
+	grants[1].Patent.UsBibliographicData.InventionTitle.Text = "Rechargeable lithium-ion battery with a solid electrolyte"
+	if errs := runWriter(WriteDeltaTable, cfg, "ipg240102.zip", grants); len(errs) != 0 {
+		t.Fatalf("ipg240102.zip: %v", errs)
+	}
+	applications := testDocs("application", "US20240000001-20240104.XML")
+	applications[0].Patent.UsBibliographicData.InventionTitle.Text = "Électrode"
+	if errs := runWriter(WriteDeltaTable, cfg, "ipa240104.zip", applications); len(errs) != 0 {
+		t.Fatalf("ipa240104.zip: %v", errs)
+	}
+
+	root := filepath.Join(cfg.OutputDir, "patents_delta")
+	logDir := filepath.Join(root, "_delta_log")
+	if _, err := os.Stat(filepath.Join(logDir, fmt.Sprintf("%020d.json", 2))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("version 2 exists (%v), want two versions", err)
+	}
+
+	// The first version creates the table
+	first := readDeltaVersion(t, logDir, 0)
+	if len(first) != 4 || first[0].Protocol == nil || first[1].MetaData == nil || first[2].Add == nil || first[3].CommitInfo == nil {
+		t.Fatalf("version 0 actions = %+v, want protocol, metaData, add and commitInfo", first)
+	}
+	if p := first[0].Protocol; p.MinReaderVersion != 1 || p.MinWriterVersion != 2 {
+		t.Errorf("protocol = %+v", p)
+	}
+	table := getDeltaTable(cfg)
+	if m := first[1].MetaData; m.SchemaString != table.schemaString || len(m.PartitionColumns) != 1 || m.PartitionColumns[0] != "doc_type" {
+		t.Errorf("metaData = %+v", m)
+	}
+	if info := first[3].CommitInfo; info.UserMetadata != "ipg240102.zip" || !info.IsBlindAppend || info.Operation != "WRITE" {
+		t.Errorf("commitInfo = %+v", info)
+	}
+
+	add := first[2].Add
+	if value := add.PartitionValues["doc_type"]; value == nil || *value != "grant" {
+		t.Errorf("partitionValues = %v", add.PartitionValues)
+	}
+	if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(add.Path))); err != nil || info.Size() != add.Size {
+		t.Errorf("data file %s: %v, size %d", add.Path, err, add.Size)
+	}
+	var stats deltaStats
+	if err := json.Unmarshal([]byte(add.Stats), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.NumRecords != 2 {
+		t.Errorf("numRecords = %d, want 2", stats.NumRecords)
+	}
+	// Strings longer than maxStatsStringLength characters are truncated, the maximum remaining an upper bound
+	if min := stats.MinValues["invention_title"]; min != "Battery" {
+		t.Errorf("invention_title minimum = %q", min)
+	}
+	if max := stats.MaxValues["invention_title"]; max != "Rechargeable lithium-ion battery\U0010FFFF" {
+		t.Errorf("invention_title maximum = %q", max)
+	}
+	if min := stats.MinValues["document_name"]; min != "US11000000-20240102.XML" {
+		t.Errorf("document_name minimum = %q", min)
+	}
+
+	// The second version only appends
+	second := readDeltaVersion(t, logDir, 1)
+	if len(second) != 2 || second[0].Add == nil || second[1].CommitInfo == nil {
+		t.Fatalf("version 1 actions = %+v, want add and commitInfo", second)
+	}
+	if value := second[0].Add.PartitionValues["doc_type"]; value == nil || *value != "application" {
+		t.Errorf("partitionValues = %v", second[0].Add.PartitionValues)
+	}
+	if info := second[1].CommitInfo; info.UserMetadata != "ipa240104.zip" {
+		t.Errorf("commitInfo = %+v", info)
+	}
+}
+
+func TestDeltaLogReplay(t *testing.T) {
+	root := t.TempDir()
+	logDir := filepath.Join(root, "_delta_log")
+	if err := os.MkdirAll(logDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// Versions before 3 have been cleaned up, version 4 changed the schema
+	writeDeltaVersion(t, logDir, 3, deltaAction{MetaData: &deltaMetaData{SchemaString: "old", PartitionColumns: []string{}}})
+	writeDeltaVersion(t, logDir, 4, deltaAction{MetaData: &deltaMetaData{SchemaString: "current", PartitionColumns: []string{}}})
+	writeDeltaVersion(t, logDir, 5, deltaAction{CommitInfo: &deltaCommitInfo{Operation: "WRITE"}})
+	if err := os.WriteFile(filepath.Join(logDir, "00000000000000000005.checkpoint.parquet"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table := &deltaTable{root: root, schemaString: "current", partitionColumns: []string{}}
+	next, metaData, err := table.latest(logDir)
+	if err != nil || next != 6 || metaData == nil || metaData.SchemaString != "current" {
+		t.Fatalf("latest = %d, %+v, %v, want 6 and the metadata of version 4", next, metaData, err)
+	}
+
+	// Later calls read the versions committed since, without listing the log again
+	writeDeltaVersion(t, logDir, 6, deltaAction{CommitInfo: &deltaCommitInfo{Operation: "WRITE"}})
+	if err := os.Remove(filepath.Join(logDir, "00000000000000000003.json")); err != nil {
+		t.Fatal(err)
+	}
+	if next, _, err := table.latest(logDir); err != nil || next != 7 {
+		t.Fatalf("latest after another writer committed = %d, %v, want 7", next, err)
+	}
+
+	version, err := table.commit([]*deltaAdd{{Path: "part-00000.parquet", PartitionValues: map[string]*string{}, Stats: "{}"}}, "ipg240102.zip")
+	if err != nil || version != 7 {
+		t.Fatalf("commit = %d, %v, want version 7", version, err)
+	}
+	if actions := readDeltaVersion(t, logDir, 7); len(actions) != 2 || actions[0].Add == nil || actions[0].Add.Path != "part-00000.parquet" {
+		t.Errorf("version 7 actions = %+v", actions)
+	}
+
+	// A table written with another schema is not appended to
+	writeDeltaVersion(t, logDir, 8, deltaAction{MetaData: &deltaMetaData{SchemaString: "other", PartitionColumns: []string{}}})
+	if _, err := table.commit([]*deltaAdd{{Path: "part-00001.parquet"}}, "ipg240109.zip"); err == nil {
+		t.Error("commit to a table with a different schema succeeded")
+	}
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "00000000000000000000.json")
+	put := func(content string) error {
+		tmp := filepath.Join(dir, ".tmp-"+content+".json")
+		if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := putIfAbsent(tmp, path)
+		if _, statErr := os.Stat(tmp); !errors.Is(statErr, os.ErrNotExist) {
+			t.Errorf("temporary file %s not removed: %v", tmp, statErr)
+		}
+		return err
+	}
+
+	if err := put("first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("second"); !errors.Is(err, os.ErrExist) {
+		t.Errorf("putIfAbsent over an existing version = %v, want os.ErrExist", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "first" {
+		t.Errorf("version contains %q, %v, want the first commit", data, err)
+	}
+}
+
+func TestDeltaConcurrentCommits(t *testing.T) {
+	root := t.TempDir()
+
+	// Separate tables stand for concurrent runs writing to the same table, racing for each version
+	const writers, commits = 4, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*commits)
+	for w := 0; w < writers; w++ {
+		table := &deltaTable{root: root, schemaString: "schema", partitionColumns: []string{}}
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for c := 0; c < commits; c++ {
+				zip := fmt.Sprintf("writer%d-zip%d", w, c)
+				if _, err := table.commit([]*deltaAdd{{Path: zip + ".parquet", PartitionValues: map[string]*string{}, Stats: "{}"}}, zip); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	logDir := filepath.Join(root, "_delta_log")
+	var zips []string
+	for version := int64(0); version < writers*commits; version++ {
+		actions := readDeltaVersion(t, logDir, version)
+		if hasProtocol := actions[0].Protocol != nil; hasProtocol != (version == 0) {
+			t.Errorf("version %d has protocol %v", version, hasProtocol)
+		}
+		info := actions[len(actions)-1].CommitInfo
+		if info == nil {
+			t.Fatalf("version %d has no commitInfo", version)
+		}
+		zips = append(zips, info.UserMetadata)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, fmt.Sprintf("%020d.json", writers*commits))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("more versions than commits: %v", err)
+	}
+	sort.Strings(zips)
+	for i := 1; i < len(zips); i++ {
+		if zips[i] == zips[i-1] {
+			t.Errorf("%s committed twice", zips[i])
+		}
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(logDir, ".tmp-*")); len(leftovers) != 0 {
+		t.Errorf("temporary files left in the log: %v", leftovers)
+	}
+}
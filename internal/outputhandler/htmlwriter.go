@@ -1,6 +1,11 @@
 package outputhandler
 
 import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,38 +14,273 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+	"github.com/diverged/uspto-bulk-data-tool/internal/site"
 )
 
-// Do not use
-func WriteHtmlFiles(cfg *config.Config, parsedDocs <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+//go:embed templates/patent.html
+var defaultHTMLTemplate string
+
+// HTMLPage is the data passed to the HTML page template. Dates are formatted as YYYY-MM-DD; the
+// bibliographic lists are empty if the raw split document could not be parsed.
+type HTMLPage struct {
+	SourceFile        string
+	DocumentType      string
+	DocumentNumber    string // Normalized, e.g. US11000000
+	Country           string
+	Kind              string
+	Title             string
+	PublicationDate   string
+	ApplicationNumber string
+	ApplicationDate   string
+	ApplicationType   string
+
+	Inventors        []patentxml.Party
+	Applicants       []patentxml.Party
+	Assignees        []patentxml.Party
+	Classifications  []patentxml.Classification
+	Citations        []patentxml.Citation
+	PriorityClaims   []patentxml.PriorityClaim
+	RelatedDocuments []patentxml.RelatedDocument
+
+	Abstract    template.HTML
+	Claims      []*HTMLClaim // Independent claims, with their dependent claims nested
+	Description template.HTML
+	Contents    []patentxml.Heading // Headings of the description
+}
+
+// HTMLClaim is a claim of an HTMLPage.
+type HTMLClaim struct {
+	ID         string
+	Number     int
+	DependsOn  []HTMLClaimRef
+	Body       template.HTML
+	Dependents []*HTMLClaim // Claims that depend on this claim, nested under the first claim they reference
+}
+
+// HTMLClaimRef links to a claim that a claim depends on.
+type HTMLClaimRef struct {
+	ID     string
+	Number int
+}
+
+// htmlTemplateFuncs are available to the default and custom templates.
+var htmlTemplateFuncs = template.FuncMap{
+	"date":  formatXMLDate,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// formatXMLDate formats a USPTO YYYYMMDD date as YYYY-MM-DD, returning other values unchanged.
+func formatXMLDate(date string) string {
+	if len(date) != 8 {
+		return date
+	}
+	return date[:4] + "-" + date[4:6] + "-" + date[6:]
+}
+
+// loadHTMLTemplate parses the template configured by htmltemplate, or the embedded default.
+func loadHTMLTemplate(cfg *config.Config) (*template.Template, error) {
+	path := cfg.OutputConfig.HTMLTemplate
+	if path == "" {
+		return template.New("patent.html").Funcs(htmlTemplateFuncs).Parse(defaultHTMLTemplate)
+	}
+	t, err := template.New(filepath.Base(path)).Funcs(htmlTemplateFuncs).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading HTML template: %w", err)
+	}
+	return t, nil
+}
+
+// WriteHtmlFiles renders each document as a self-contained HTML page, named after its source XML file, and
+// lists the pages written for the zip in a manifest read by the site generator.
+func WriteHtmlFiles(cfg *config.Config, originZipName string, parsedDocs <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
 
 	log.Info("WriteHtmlFiles called")
 	outputDir := cfg.OutputDir
 
-	for doc := range parsedDocs {
+	tmpl, err := loadHTMLTemplate(cfg)
+	if err != nil {
+		log.Error("Error loading HTML template", zap.Error(err))
+		errorChan <- err
+		// Drain the channel so the parser is not blocked
+		for range parsedDocs {
+		}
+		return
+	}
 
-		// Use the "DocIndexOfZip" from SplitterMetadata for the filename.
-		filename := doc.USPTGoMetadata.OriginZip.IndexName
-		log.Info("Writing HTML documents for:", zap.Any("index", filename))
+	manifestName := strings.TrimSuffix(originZipName, ".zip") + site.ManifestSuffix
+	manifestFile, err := os.Create(filepath.Join(outputDir, manifestName))
+	if err != nil {
+		log.Error("Error creating HTML page manifest", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    manifestName,
+			Type:    "html",
+			Whence:  "creating the page manifest",
+			Err:     err,
+		}
+		for range parsedDocs {
+		}
+		return
+	}
+	defer manifestFile.Close()
+	manifest := json.NewEncoder(manifestFile)
 
+	var buf bytes.Buffer
+	for doc := range parsedDocs {
+
+		filename := doc.Patent.MetaFileName
 		if filename == "" {
-			log.Error("Document does not have a 'DocIndexOfZip' in its metadata")
-			// Handle the error appropriately, possibly continue to the next document.
+			log.Error("Document does not have a file name in its metadata")
 			continue
 		}
-
 		outputFileName := strings.TrimSuffix(strings.TrimSuffix(filename, ".XML"), ".xml") + ".html"
 
-		outputFilePath := filepath.Join(outputDir, outputFileName)
+		page := htmlPage(doc, errorChan, log)
+		buf.Reset()
+		if err := tmpl.Execute(&buf, page); err != nil {
+			log.Error("Failed to render HTML page", zap.String("filename", filename), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    filename,
+				Type:    "html",
+				Whence:  "rendering the template",
+				Err:     err,
+			}
+			continue
+		}
+
+		if err := os.WriteFile(filepath.Join(outputDir, outputFileName), buf.Bytes(), 0644); err != nil {
+			log.Error("Failed to save document to disk", zap.String("filename", filename), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    filename,
+				Type:    "html",
+				Whence:  "writing the output file",
+				Err:     err,
+			}
+			continue
+		}
+		if err := manifest.Encode(page.sitePage(outputFileName, originZipName, doc)); err != nil {
+			log.Error("Failed to write HTML page manifest", zap.String("filename", filename), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: false,
+				Name:    manifestName,
+				Type:    "html",
+				Whence:  "writing the page manifest",
+				Err:     err,
+			}
+		}
+		log.Debug("Document saved", zap.String("filename", filename), zap.String("output", outputFileName))
+	}
+}
 
-		err := os.WriteFile(outputFilePath, []byte(doc.Patent.Description.Content), 0644)
-		if err != nil {
-			log.Error("Failed to save document to disk", zap.String("filename",
-				filename), zap.Error(err))
-			/* 			errorChan <- fmt.Errorf("failed to save document %s: %w", filename,
-			err) */
+// sitePage describes a written page for the site generator.
+func (p *HTMLPage) sitePage(fileName string, originZipName string, doc *types.USPTGoDoc) site.Page {
+	entry := site.Page{
+		File:            fileName,
+		DocumentType:    p.DocumentType,
+		DocumentNumber:  p.DocumentNumber,
+		Kind:            p.Kind,
+		Title:           p.Title,
+		PublicationDate: p.PublicationDate,
+		Abstract:        patentxml.PlainText(doc.Patent.Abstract.Content),
+		SourceZip:       originZipName,
+	}
+	for _, c := range p.Classifications {
+		if c.Scheme != "cpc" {
 			continue
 		}
-		log.Debug("Document saved", zap.String("filename", filename))
+		if c.Main {
+			entry.CPC = append([]string{c.Symbol()}, entry.CPC...)
+		} else {
+			entry.CPC = append(entry.CPC, c.Symbol())
+		}
+	}
+	for _, party := range p.Assignees {
+		entry.Assignees = append(entry.Assignees, party.Name())
+	}
+	for _, party := range p.Inventors {
+		entry.Inventors = append(entry.Inventors, party.Name())
+	}
+	return entry
+}
+
+// htmlPage collects the data of a document's page. The bibliographic lists are read from the raw split
+// document; if it is unavailable or malformed, the page is rendered without them.
+func htmlPage(doc *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) *HTMLPage {
+	bib := doc.Patent.UsBibliographicData
+	pubRef := bib.PublicationReference.DocumentID
+
+	page := &HTMLPage{
+		SourceFile:      doc.Patent.MetaFileName,
+		DocumentType:    doc.USPTGoMetadata.DocumentType,
+		DocumentNumber:  patentxml.NormalizeDocNumber(pubRef.Country, pubRef.DocNumber),
+		Country:         pubRef.Country,
+		Kind:            pubRef.KindCode,
+		Title:           bib.InventionTitle.Text,
+		PublicationDate: formatXMLDate(doc.Patent.MetaDatePubl),
+		Abstract:        template.HTML(patentxml.HTML(doc.Patent.Abstract.Content)),
+		Description:     template.HTML(patentxml.HTML(doc.Patent.Description.Content)),
+		Contents:        patentxml.Headings(doc.Patent.Description.Content),
+		Claims:          htmlClaims(doc.Patent.Claims.Content),
+	}
+
+	biblio, err := patentxml.ParseBibliographic(doc.RawSplitDoc)
+	if err != nil {
+		err = fmt.Errorf("parsing bibliographic data: %w", err)
+		log.Warn("Rendering HTML page without bibliographic data", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: false,
+			Name:    doc.Patent.MetaFileName,
+			Type:    "html",
+			Whence:  "extracting bibliographic data",
+			Err:     err,
+		}
+		return page
+	}
+
+	page.ApplicationNumber = patentxml.NormalizeDocNumber(biblio.Application.Country, biblio.Application.DocNumber)
+	page.ApplicationDate = formatXMLDate(biblio.Application.Date)
+	page.ApplicationType = biblio.ApplicationType
+	page.Inventors = biblio.Inventors
+	page.Applicants = biblio.Applicants
+	page.Assignees = biblio.Assignees
+	page.Classifications = biblio.Classifications
+	page.Citations = biblio.Citations
+	page.PriorityClaims = biblio.PriorityClaims
+	page.RelatedDocuments = biblio.RelatedDocuments
+	return page
+}
+
+// htmlClaims nests each dependent claim under the first earlier claim it references, returning the
+// independent claims along with any claims whose references could not be resolved.
+func htmlClaims(content string) []*HTMLClaim {
+	claims, _ := patentxml.ParseClaims(content) // Claims parsed before an error are still rendered
+	bodies := patentxml.ClaimsHTML(content)
+
+	byID := make(map[string]*HTMLClaim, len(claims))
+	var roots []*HTMLClaim
+	for _, c := range claims {
+		claim := &HTMLClaim{ID: c.ID, Number: c.Number, Body: template.HTML(bodies[c.ID])}
+		for _, id := range c.DependsOn {
+			ref := HTMLClaimRef{ID: id}
+			if parent, ok := byID[id]; ok {
+				ref.Number = parent.Number
+			}
+			claim.DependsOn = append(claim.DependsOn, ref)
+		}
+
+		if len(c.DependsOn) > 0 && byID[c.DependsOn[0]] != nil {
+			parent := byID[c.DependsOn[0]]
+			parent.Dependents = append(parent.Dependents, claim)
+		} else {
+			roots = append(roots, claim)
+		}
+		if c.ID != "" {
+			byID[c.ID] = claim
+		}
 	}
+	return roots
 }
@@ -0,0 +1,206 @@
+package outputhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/site"
+)
+
+// claimTree formats nested claims as their numbers, with dependents in brackets and references after a
+// colon, e.g. "1[2:1 3:2] 4".
+func claimTree(claims []*HTMLClaim) string {
+	var parts []string
+	for _, c := range claims {
+		s := fmt.Sprint(c.Number)
+		for i, ref := range c.DependsOn {
+			if i == 0 {
+				s += ":"
+			} else {
+				s += ","
+			}
+			if ref.Number != 0 {
+				s += fmt.Sprint(ref.Number)
+			} else {
+				s += ref.ID
+			}
+		}
+		if len(c.Dependents) > 0 {
+			s += "[" + claimTree(c.Dependents) + "]"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestHTMLClaims(t *testing.T) {
+	claim := func(num int, refs ...string) string {
+		text := fmt.Sprintf("%d. A battery", num)
+		for _, ref := range refs {
+			text += ` of <claim-ref idref="` + ref + `">claim</claim-ref>`
+		}
+		return fmt.Sprintf(`<claim id="CLM-%05d" num="%05d"><claim-text>%s.</claim-text></claim>`, num, num, text)
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"fixture grant", testDocs("grant", "US11000000-20240102.XML")[0].Patent.Claims.Content, "1[2:1] 3"},
+		{"chain", claim(1) + claim(2, "CLM-00001") + claim(3, "CLM-00002") + claim(4), "1[2:1[3:2]] 4"},
+		{"several references nest under the first", claim(1) + claim(2) + claim(3, "CLM-00002", "CLM-00001"), "1 2[3:2,1]"},
+		{"unknown reference", claim(1) + claim(2, "CLM-00009"), "1 2:CLM-00009"},
+		{"forward reference", claim(1, "CLM-00002") + claim(2), "1:CLM-00002 2"},
+		{"malformed after the first claim", claim(1) + claim(2, "CLM-00001") + `<claim id="CLM-00003"><claim-text>3. <!-- unterminated`, "1[2:1]"},
+		{"no claims", "", ""},
+	}
+	for _, tt := range tests {
+		if got := claimTree(htmlClaims(tt.content)); got != tt.want {
+			t.Errorf("%s: htmlClaims = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	claims := htmlClaims(claim(1) + claim(2, "CLM-00001"))
+	if body := string(claims[0].Dependents[0].Body); !strings.Contains(body, `<a href="#CLM-00001"`) || !strings.Contains(body, "2. A battery of") {
+		t.Errorf("dependent claim body = %s", body)
+	}
+}
+
+func TestHTMLPage(t *testing.T) {
+	doc := testDocs("grant", "US11000000-20240102.XML")[0]
+	errorChan := make(chan error, 10)
+	page := htmlPage(doc, errorChan, zap.NewNop())
+	close(errorChan)
+	for err := range errorChan {
+		t.Errorf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		field string
+		got   any
+		want  any
+	}{
+		{"DocumentNumber", page.DocumentNumber, "US11000000"},
+		{"Kind", page.Kind, "B2"},
+		{"Title", page.Title, "Solid electrolyte battery & method"},
+		{"PublicationDate", page.PublicationDate, "2024-01-02"},
+		{"ApplicationNumber", page.ApplicationNumber, "US17123456"},
+		{"ApplicationDate", page.ApplicationDate, "2021-03-15"},
+		{"ApplicationType", page.ApplicationType, "utility"},
+		{"Inventors", len(page.Inventors), 2},
+		{"Citations", len(page.Citations), 3},
+		{"Contents", len(page.Contents), 7},
+		{"Claims", claimTree(page.Claims), "1[2:1] 3"},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.field, tt.got, tt.want)
+		}
+	}
+
+	entry := page.sitePage("US11000000-20240102.html", "ipg240102.zip", doc)
+	want := site.Page{
+		File:            "US11000000-20240102.html",
+		DocumentType:    "grant",
+		DocumentNumber:  "US11000000",
+		Kind:            "B2",
+		Title:           "Solid electrolyte battery & method",
+		PublicationDate: "2024-01-02",
+		CPC:             []string{"H01M 10/052", "Y02E 60/10"},
+		Assignees:       []string{"Acme Battery Co., Ltd."},
+		Inventors:       []string{"Hiro Tanaka", "Anna Müller"},
+		Abstract:        "A solid electrolyte battery includes a cathode & an anode. The electrolyte has a garnet structure.",
+		SourceZip:       "ipg240102.zip",
+	}
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("sitePage =\n%+v\nwant\n%+v", entry, want)
+	}
+
+	// Without the raw document the page is rendered without bibliographic lists, and the error reported
+	doc.RawSplitDoc = nil
+	errorChan = make(chan error, 10)
+	page = htmlPage(doc, errorChan, zap.NewNop())
+	close(errorChan)
+	var uerr *types.USPTGoError
+	if err := <-errorChan; !errors.As(err, &uerr) || uerr.Skipped || uerr.Type != "html" {
+		t.Errorf("error = %v, want a non-skipping html error", err)
+	}
+	if page.Title == "" || page.Inventors != nil || page.ApplicationNumber != "" || len(page.Claims) != 2 {
+		t.Errorf("page without bibliographic data = %+v", page)
+	}
+}
+
+func TestWriteHtmlFiles(t *testing.T) {
+	cfg := &config.Config{OutputDir: t.TempDir()}
+	docs := testDocs("grant", "US11000000-20240102.XML", "US11000001-20240102.XML")
+	if errs := runWriter(WriteHtmlFiles, cfg, "ipg240102.zip", docs); len(errs) != 0 {
+		t.Fatalf("errors reported: %v", errs)
+	}
+
+	data, err := os.ReadFile(filepath.Join(cfg.OutputDir, "US11000000-20240102.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(data)
+	for _, want := range []string{
+		"<title>US11000000 – Solid electrolyte battery &amp; method</title>",
+		`<div class="claim" id="CLM-00001">`,
+		`<div class="dependents"><div class="claim" id="CLM-00002">`,
+		`Depends on <a href="#CLM-00001">claim 1</a>`,
+		`<a href="#h-0002">BACKGROUND</a>`,
+		"H01M 10/052 (CPC)",
+		"Doe, “Lithium things,” J. Batt. 2019.",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("page does not contain %q", want)
+		}
+	}
+
+	manifest, err := os.ReadFile(filepath.Join(cfg.OutputDir, "ipg240102"+site.ManifestSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(manifest)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("manifest has %d lines, want 2", len(lines))
+	}
+	var page site.Page
+	if err := json.Unmarshal([]byte(lines[1]), &page); err != nil || page.File != "US11000001-20240102.html" {
+		t.Errorf("manifest entry = %+v, %v", page, err)
+	}
+}
+
+func TestWriteHtmlFilesTemplate(t *testing.T) {
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "custom.html")
+	if err := os.WriteFile(custom, []byte(`{{.DocumentNumber}}|{{range .Claims}}{{.Number}}{{range .Dependents}}>{{.Number}}{{end}} {{end}}|{{date "20240102"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{OutputDir: t.TempDir()}
+	cfg.OutputConfig.HTMLTemplate = custom
+	if errs := runWriter(WriteHtmlFiles, cfg, "ipg240102.zip", testDocs("grant", "US11000000-20240102.XML")); len(errs) != 0 {
+		t.Fatalf("errors reported: %v", errs)
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.OutputDir, "US11000000-20240102.html"))
+	if err != nil || string(data) != "US11000000|1>2 3 |2024-01-02" {
+		t.Errorf("page = %q, %v", data, err)
+	}
+
+	// A template that does not parse is reported once, and the documents are drained
+	cfg.OutputConfig.HTMLTemplate = filepath.Join(dir, "missing.html")
+	if errs := runWriter(WriteHtmlFiles, cfg, "ipg240109.zip", testDocs("grant", "US11000002-20240109.XML")); len(errs) != 1 {
+		t.Errorf("errors reported: %v, want one", errs)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.OutputDir, "US11000002-20240109.html")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("page written with a missing template: %v", err)
+	}
+}
@@ -0,0 +1,923 @@
+package outputhandler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/diverged/uspto-bulk-data-tool/internal/avro"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// Iceberg tables are written in format version 1, see https://iceberg.apache.org/spec/
+const icebergFormatVersion = 1
+
+// icebergBlockSize is the block_size_in_bytes recorded for data files, required by format version 1.
+const icebergBlockSize = 64 * 1024 * 1024
+
+// icebergPartitionSources maps the partition columns of the configuration to the source column and
+// transform of an Iceberg partition field.
+var icebergPartitionSources = map[string]struct {
+	source    string
+	transform string
+	name      string
+}{
+	"doc_type": {"document_type", "identity", "document_type"},
+	"kind":     {"pub_ref_kind_code", "identity", "pub_ref_kind_code"},
+	"country":  {"country", "identity", "country"},
+	"year":     {"date_publ", "year", "date_publ_year"},
+	"month":    {"date_publ", "month", "date_publ_month"},
+}
+
+// icebergColumn is a field of the table schema with its Iceberg field id.
+type icebergColumn struct {
+	tableField
+	id        int
+	elementID int // Field id of the element of a list
+	children  []icebergColumn
+}
+
+type icebergPartitionField struct {
+	Name      string `json:"name"`
+	Transform string `json:"transform"`
+	SourceID  int    `json:"source-id"`
+	FieldID   int    `json:"field-id"`
+
+	source *icebergColumn
+}
+
+// icebergTable is the table shared by every zip of a run. Each zip is committed as a separate snapshot.
+type icebergTable struct {
+	mu            sync.Mutex
+	root          string
+	location      string
+	schemaVersion string
+	fields        []tableField
+	columns       []icebergColumn
+	lastColumnID  int
+	partitionSpec []icebergPartitionField
+	schemaJSON    map[string]interface{}
+	nameMapping   string
+	entrySchema   *avro.Schema
+	err           error
+}
+
+var icebergOutput struct {
+	once  sync.Once
+	table *icebergTable
+}
+
+func getIcebergTable(cfg *config.Config) *icebergTable {
+	icebergOutput.once.Do(func() {
+		schemaVersion := parquetSchemaVersion(cfg)
+		namespace, name, ok := strings.Cut(cfg.OutputConfig.IcebergTable, ".")
+		if !ok {
+			namespace, name = "default", cfg.OutputConfig.IcebergTable
+		}
+		t := &icebergTable{
+			root:          filepath.Join(cfg.OutputDir, cfg.OutputConfig.IcebergWarehouse, namespace, name),
+			schemaVersion: schemaVersion,
+			fields:        tableSchemaOf(reflect.TypeOf(parquetSchema(schemaVersion)).Elem()),
+		}
+		t.err = t.init(cfg.OutputConfig.IcebergPartitionBy)
+		icebergOutput.table = t
+	})
+	return icebergOutput.table
+}
+
+func (t *icebergTable) init(partitionBy []string) error {
+	abs, err := filepath.Abs(t.root)
+	if err != nil {
+		return err
+	}
+	t.location = "file://" + filepath.ToSlash(abs)
+
+	// Top-level columns are numbered first, followed by nested fields
+	t.columns = make([]icebergColumn, len(t.fields))
+	for i, field := range t.fields {
+		t.columns[i] = icebergColumn{tableField: field, id: i + 1}
+	}
+	t.lastColumnID = len(t.fields)
+	for i := range t.columns {
+		t.assignNestedIDs(&t.columns[i])
+	}
+
+	for i, column := range partitionBy {
+		source, ok := icebergPartitionSources[column]
+		if !ok {
+			return fmt.Errorf("unknown partition column %q", column)
+		}
+		var sourceColumn *icebergColumn
+		for j := range t.columns {
+			if t.columns[j].Name == source.source {
+				sourceColumn = &t.columns[j]
+			}
+		}
+		if sourceColumn == nil {
+			return fmt.Errorf("partition column %q requires the %s column", column, source.source)
+		}
+		if source.transform != "identity" && sourceColumn.Type.Primitive != "date" {
+			return fmt.Errorf("partition column %q requires a date typed %s column, set parquetschema to v2", column, source.source)
+		}
+		t.partitionSpec = append(t.partitionSpec, icebergPartitionField{
+			Name:      source.name,
+			Transform: source.transform,
+			SourceID:  sourceColumn.id,
+			FieldID:   1000 + i,
+			source:    sourceColumn,
+		})
+	}
+
+	t.schemaJSON = map[string]interface{}{"type": "struct", "schema-id": 0, "fields": icebergFields(t.columns)}
+	mapping, err := json.Marshal(icebergNameMapping(t.columns))
+	if err != nil {
+		return err
+	}
+	t.nameMapping = string(mapping)
+
+	t.entrySchema, err = avro.ParseSchema(t.manifestEntrySchema())
+	return err
+}
+
+func (t *icebergTable) assignNestedIDs(column *icebergColumn) {
+	fieldType := column.Type
+	if fieldType.Element != nil {
+		t.lastColumnID++
+		column.elementID = t.lastColumnID
+		fieldType = *fieldType.Element
+	}
+	if fieldType.Fields == nil {
+		return
+	}
+	column.children = make([]icebergColumn, len(fieldType.Fields))
+	for i, field := range fieldType.Fields {
+		t.lastColumnID++
+		column.children[i] = icebergColumn{tableField: field, id: t.lastColumnID}
+	}
+	for i := range column.children {
+		t.assignNestedIDs(&column.children[i])
+	}
+}
+
+// icebergFields renders the columns as Iceberg schema fields.
+func icebergFields(columns []icebergColumn) []interface{} {
+	fields := make([]interface{}, len(columns))
+	for i, column := range columns {
+		fields[i] = map[string]interface{}{
+			"id":       column.id,
+			"name":     column.Name,
+			"required": false,
+			"type":     icebergType(column, column.Type),
+		}
+	}
+	return fields
+}
+
+func icebergType(column icebergColumn, t tableType) interface{} {
+	switch {
+	case t.Element != nil:
+		return map[string]interface{}{
+			"type":             "list",
+			"element-id":       column.elementID,
+			"element":          icebergType(column, *t.Element),
+			"element-required": false,
+		}
+	case t.Fields != nil:
+		return map[string]interface{}{"type": "struct", "fields": icebergFields(column.children)}
+	}
+	return t.Primitive
+}
+
+// icebergNameMapping maps the column names of the Parquet files, which carry no field ids, to the schema.
+func icebergNameMapping(columns []icebergColumn) []interface{} {
+	mapping := make([]interface{}, len(columns))
+	for i, column := range columns {
+		m := map[string]interface{}{"field-id": column.id, "names": []string{column.Name}}
+		children := icebergNameMapping(column.children)
+		if column.elementID != 0 {
+			element := map[string]interface{}{"field-id": column.elementID, "names": []string{"element"}}
+			if len(children) > 0 {
+				element["fields"] = children
+			}
+			m["fields"] = []interface{}{element}
+		} else if len(children) > 0 {
+			m["fields"] = children
+		}
+		mapping[i] = m
+	}
+	return mapping
+}
+
+// partitionTuple computes the partition values of a row and the directory of its data files.
+func (t *icebergTable) partitionTuple(row interface{}) (string, map[string]interface{}) {
+	values := make(map[string]interface{}, len(t.partitionSpec))
+	segments := make([]string, len(t.partitionSpec))
+	v := reflect.ValueOf(row)
+	for i, field := range t.partitionSpec {
+		var value interface{}
+		var display string
+
+		fv := v.FieldByIndex(field.source.index)
+		switch field.Transform {
+		case "identity":
+			if s := fv.String(); s != "" {
+				value, display = s, s
+			}
+		default:
+			if !fv.IsNil() {
+				date := time.Unix(fv.Elem().Int()*24*60*60, 0).UTC()
+				years := int32(date.Year() - 1970)
+				if field.Transform == "year" {
+					value, display = years, date.Format("2006")
+				} else {
+					value, display = years*12+int32(date.Month())-1, date.Format("2006-01")
+				}
+			}
+		}
+
+		values[field.Name] = value
+		if value == nil {
+			display = "null"
+		}
+		segments[i] = field.Name + "=" + display
+	}
+	return strings.Join(append([]string{"data"}, segments...), "/"), values
+}
+
+// WriteIcebergTable writes the documents of a single zip to Parquet data files of the Iceberg table and
+// commits them as a new snapshot, tagged with the name of the zip.
+func WriteIcebergTable(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteIcebergTable has been invoked", zap.String("OriginZipName", originZipName))
+
+	table := getIcebergTable(cfg)
+	if table.err != nil {
+		log.Error("Invalid Iceberg table configuration", zap.Error(table.err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "iceberg",
+			Whence:  "configuring the table schema",
+			Err:     table.err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+
+	files := newTableFiles(cfg, table.schemaVersion, table.root, originZipName, table.fields, log)
+
+	for doc := range inputChan {
+		stats := conversionStats{}
+		row := parquetRow(doc, table.schemaVersion, rowOptionsOf(cfg), stats, errorChan, log)
+		dir, values := table.partitionTuple(row)
+
+		if whence, err := files.write(dir, values, convertedRow{row: row, stats: stats}); err != nil {
+			log.Error("Error writing document to Iceberg table", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    originZipName,
+				Type:    "iceberg",
+				Whence:  whence,
+				Err:     err,
+			}
+			// Files that are not committed to a snapshot are invisible to readers
+			files.abort()
+			for range inputChan {
+			}
+			return
+		}
+	}
+
+	dataFiles, err := files.close()
+	if err != nil {
+		log.Error("Error finalizing Iceberg table files", zap.String("OriginZipName", originZipName), zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "iceberg",
+			Whence:  "finalizing the data files",
+			Err:     err,
+		}
+		return
+	}
+
+	if len(dataFiles) == 0 {
+		log.Info("No documents to commit to the Iceberg table", zap.String("OriginZipName", originZipName))
+		return
+	}
+
+	snapshotID, err := table.commit(dataFiles, originZipName)
+	if err != nil {
+		log.Error("Error committing to the Iceberg table", zap.String("OriginZipName", originZipName), zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "iceberg",
+			Whence:  "committing the snapshot",
+			Err:     err,
+		}
+		return
+	}
+	log.Info("Committed zip to the Iceberg table", zap.String("OriginZipName", originZipName), zap.Int64("snapshotID", snapshotID), zap.Int("files", len(dataFiles)))
+}
+
+// commit writes a manifest of the data files and adds it, with the manifests of the current snapshot,
+// as a new snapshot. Metadata versions are created by hard linking a completed temporary file, which fails
+// if another writer committed that version first, in which case the snapshot is rebuilt on the new version.
+func (t *icebergTable) commit(dataFiles []tableDataFile, originZipName string) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	metadataDir := filepath.Join(t.root, "metadata")
+	if err := os.MkdirAll(metadataDir, os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	snapshotID := rand.Int63()
+	manifest, err := t.writeManifest(metadataDir, snapshotID, dataFiles)
+	if err != nil {
+		return 0, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(t.localPath(manifest["manifest_path"].(string)))
+		}
+	}()
+
+	for {
+		version, metadata, err := t.current(metadataDir)
+		if err != nil {
+			return 0, err
+		}
+
+		now := time.Now().UnixMilli()
+		if metadata == nil {
+			metadata = t.newMetadata(now)
+		} else if err := t.checkCompatible(metadata); err != nil {
+			return 0, err
+		}
+
+		parent := metadata["current-snapshot-id"].(json.Number).String()
+		parentID, _ := strconv.ParseInt(parent, 10, 64)
+		var parentSnapshot map[string]interface{}
+		snapshots, _ := metadata["snapshots"].([]interface{})
+		for _, s := range snapshots {
+			snapshot := s.(map[string]interface{})
+			if snapshot["snapshot-id"].(json.Number).String() == parent {
+				parentSnapshot = snapshot
+			}
+		}
+
+		manifests := []interface{}{manifest}
+		if parentSnapshot != nil {
+			previous, err := readManifestList(t.localPath(parentSnapshot["manifest-list"].(string)))
+			if err != nil {
+				return 0, err
+			}
+			manifests = append(manifests, previous...)
+		}
+
+		manifestList := filepath.Join(metadataDir, fmt.Sprintf("snap-%d-1-%s.avro", snapshotID, uuid.NewString()))
+		if err := writeAvroFile(manifestList, icebergManifestListSchema, nil, manifests); err != nil {
+			return 0, err
+		}
+
+		snapshot := map[string]interface{}{
+			"snapshot-id":   snapshotID,
+			"timestamp-ms":  now,
+			"summary":       t.summary(dataFiles, parentSnapshot, originZipName),
+			"manifest-list": t.uri(manifestList),
+			"schema-id":     0,
+		}
+		if parentSnapshot != nil {
+			snapshot["parent-snapshot-id"] = parentID
+		}
+
+		if version > 0 {
+			metadataLog, _ := metadata["metadata-log"].([]interface{})
+			metadata["metadata-log"] = append(metadataLog, map[string]interface{}{
+				"timestamp-ms":  metadata["last-updated-ms"],
+				"metadata-file": t.uri(filepath.Join(metadataDir, fmt.Sprintf("v%d.metadata.json", version))),
+			})
+		}
+		snapshotLog, _ := metadata["snapshot-log"].([]interface{})
+		refs, _ := metadata["refs"].(map[string]interface{})
+		if refs == nil {
+			refs = map[string]interface{}{}
+		}
+		refs["main"] = map[string]interface{}{"snapshot-id": snapshotID, "type": "branch"}
+		refs[strings.TrimSuffix(originZipName, ".zip")] = map[string]interface{}{"snapshot-id": snapshotID, "type": "tag"}
+
+		metadata["snapshots"] = append(snapshots, snapshot)
+		metadata["snapshot-log"] = append(snapshotLog, map[string]interface{}{"timestamp-ms": now, "snapshot-id": snapshotID})
+		metadata["current-snapshot-id"] = snapshotID
+		metadata["refs"] = refs
+		metadata["last-updated-ms"] = now
+
+		if committed, err = t.writeMetadata(metadataDir, version+1, metadata); err != nil {
+			return 0, err
+		}
+		if committed {
+			return snapshotID, nil
+		}
+		os.Remove(manifestList)
+	}
+}
+
+// localPath converts a file URI of the table metadata to a local path.
+func (t *icebergTable) localPath(uri string) string {
+	return filepath.FromSlash(strings.TrimPrefix(uri, "file://"))
+}
+
+func (t *icebergTable) uri(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	return "file://" + filepath.ToSlash(abs)
+}
+
+// current returns the latest metadata version of the table, or 0 and nil if it does not exist yet.
+// Numbers are decoded as json.Number to preserve snapshot ids.
+func (t *icebergTable) current(metadataDir string) (int, map[string]interface{}, error) {
+	version := 0
+	if hint, err := os.ReadFile(filepath.Join(metadataDir, "version-hint.text")); err == nil {
+		version, _ = strconv.Atoi(strings.TrimSpace(string(hint)))
+	}
+	// The hint is updated after each commit, so it may lag behind
+	for {
+		if _, err := os.Stat(filepath.Join(metadataDir, fmt.Sprintf("v%d.metadata.json", version+1))); err != nil {
+			break
+		}
+		version++
+	}
+	if version == 0 {
+		return 0, nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(metadataDir, fmt.Sprintf("v%d.metadata.json", version)))
+	if err != nil {
+		return 0, nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var metadata map[string]interface{}
+	if err := dec.Decode(&metadata); err != nil {
+		return 0, nil, fmt.Errorf("reading v%d.metadata.json: %w", version, err)
+	}
+	return version, metadata, nil
+}
+
+func (t *icebergTable) newMetadata(now int64) map[string]interface{} {
+	lastPartitionID := 999
+	if len(t.partitionSpec) > 0 {
+		lastPartitionID = t.partitionSpec[len(t.partitionSpec)-1].FieldID
+	}
+	spec := t.partitionSpec
+	if spec == nil {
+		spec = []icebergPartitionField{}
+	}
+	return map[string]interface{}{
+		"format-version":        icebergFormatVersion,
+		"table-uuid":            uuid.NewString(),
+		"location":              t.location,
+		"last-updated-ms":       now,
+		"last-column-id":        t.lastColumnID,
+		"schema":                t.schemaJSON,
+		"current-schema-id":     0,
+		"schemas":               []interface{}{t.schemaJSON},
+		"partition-spec":        spec,
+		"default-spec-id":       0,
+		"partition-specs":       []interface{}{map[string]interface{}{"spec-id": 0, "fields": spec}},
+		"last-partition-id":     lastPartitionID,
+		"default-sort-order-id": 0,
+		"sort-orders":           []interface{}{map[string]interface{}{"order-id": 0, "fields": []interface{}{}}},
+		"properties": map[string]interface{}{
+			"write.format.default":        "parquet",
+			"schema.name-mapping.default": t.nameMapping,
+		},
+		"current-snapshot-id": json.Number("-1"),
+		"refs":                map[string]interface{}{},
+		"snapshots":           []interface{}{},
+		"snapshot-log":        []interface{}{},
+		"metadata-log":        []interface{}{},
+	}
+}
+
+// checkCompatible verifies that an existing table has the schema and partitioning of this run.
+func (t *icebergTable) checkCompatible(metadata map[string]interface{}) error {
+	normalize := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var out interface{}
+		dec.Decode(&out)
+		normalized, _ := json.Marshal(out)
+		return string(normalized)
+	}
+
+	var schema interface{}
+	if schemas, ok := metadata["schemas"].([]interface{}); ok {
+		for _, s := range schemas {
+			if s.(map[string]interface{})["schema-id"] == metadata["current-schema-id"] {
+				schema = s.(map[string]interface{})["fields"]
+			}
+		}
+	} else if s, ok := metadata["schema"].(map[string]interface{}); ok {
+		schema = s["fields"]
+	}
+
+	spec := interface{}(t.partitionSpec)
+	if t.partitionSpec == nil {
+		spec = []interface{}{}
+	}
+	if normalize(schema) != normalize(t.schemaJSON["fields"]) || normalize(metadata["partition-spec"]) != normalize(spec) {
+		return fmt.Errorf("the table at %s has a different schema or partitioning, configure a new icebergtable", t.root)
+	}
+	return nil
+}
+
+// writeMetadata creates the given metadata version, returning false if it already exists.
+func (t *icebergTable) writeMetadata(metadataDir string, version int, metadata map[string]interface{}) (bool, error) {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	tmp, err := writeTempFile(metadataDir, data)
+	if err != nil {
+		return false, err
+	}
+	err = os.Link(tmp, filepath.Join(metadataDir, fmt.Sprintf("v%d.metadata.json", version)))
+	os.Remove(tmp)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// The hint is replaced atomically, readers see either the previous or the new version
+	if tmp, err = writeTempFile(metadataDir, []byte(strconv.Itoa(version))); err != nil {
+		return true, err
+	}
+	return true, os.Rename(tmp, filepath.Join(metadataDir, "version-hint.text"))
+}
+
+func writeTempFile(dir string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func (t *icebergTable) summary(dataFiles []tableDataFile, parent map[string]interface{}, originZipName string) map[string]string {
+	var records, size int64
+	partitions := map[string]bool{}
+	for _, file := range dataFiles {
+		records += file.Rows
+		size += file.Size
+		partitions[file.Partition.Dir] = true
+	}
+
+	total := func(key string, added int64) string {
+		if parent != nil {
+			if summary, ok := parent["summary"].(map[string]interface{}); ok {
+				if previous, err := strconv.ParseInt(fmt.Sprint(summary[key]), 10, 64); err == nil {
+					added += previous
+				}
+			}
+		}
+		return strconv.FormatInt(added, 10)
+	}
+
+	return map[string]string{
+		"operation":               "append",
+		"added-data-files":        strconv.Itoa(len(dataFiles)),
+		"added-records":           strconv.FormatInt(records, 10),
+		"added-files-size":        strconv.FormatInt(size, 10),
+		"changed-partition-count": strconv.Itoa(len(partitions)),
+		"total-data-files":        total("total-data-files", int64(len(dataFiles))),
+		"total-records":           total("total-records", records),
+		"total-files-size":        total("total-files-size", size),
+		"total-delete-files":      "0",
+		"total-position-deletes":  "0",
+		"total-equality-deletes":  "0",
+		"origin-zip":              originZipName,
+	}
+}
+
+// writeManifest writes the data files to a manifest, returning its manifest list entry.
+func (t *icebergTable) writeManifest(metadataDir string, snapshotID int64, dataFiles []tableDataFile) (map[string]interface{}, error) {
+	entries := make([]interface{}, len(dataFiles))
+	var rows int64
+	for i, file := range dataFiles {
+		rows += file.Rows
+		entries[i] = map[string]interface{}{
+			"status":      int32(1), // ADDED
+			"snapshot_id": snapshotID,
+			"data_file":   t.dataFile(file),
+		}
+	}
+
+	spec := t.partitionSpec
+	if spec == nil {
+		spec = []icebergPartitionField{}
+	}
+	schemaJSON, _ := json.Marshal(t.schemaJSON)
+	specJSON, _ := json.Marshal(spec)
+	metadata := map[string][]byte{
+		"schema":            schemaJSON,
+		"schema-id":         []byte("0"),
+		"partition-spec":    specJSON,
+		"partition-spec-id": []byte("0"),
+		"format-version":    []byte(strconv.Itoa(icebergFormatVersion)),
+		"content":           []byte("data"),
+	}
+
+	path := filepath.Join(metadataDir, uuid.NewString()+"-m0.avro")
+	if err := writeAvroFile(path, t.entrySchema, metadata, entries); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"manifest_path":             t.uri(path),
+		"manifest_length":           info.Size(),
+		"partition_spec_id":         int32(0),
+		"added_snapshot_id":         snapshotID,
+		"added_data_files_count":    int32(len(dataFiles)),
+		"existing_data_files_count": int32(0),
+		"deleted_data_files_count":  int32(0),
+		"partitions":                t.partitionSummaries(dataFiles),
+		"added_rows_count":          rows,
+		"existing_rows_count":       int64(0),
+		"deleted_rows_count":        int64(0),
+	}, nil
+}
+
+func (t *icebergTable) dataFile(file tableDataFile) map[string]interface{} {
+	valueCounts := []interface{}{}
+	nullCounts := []interface{}{}
+	lowerBounds := []interface{}{}
+	upperBounds := []interface{}{}
+	for _, column := range t.columns {
+		if column.Type.Primitive == "" {
+			continue
+		}
+		id := int32(column.id)
+		valueCounts = append(valueCounts, map[string]interface{}{"key": id, "value": file.Stats.rows})
+		nullCounts = append(nullCounts, map[string]interface{}{"key": id, "value": file.Stats.nulls[column.Name]})
+		if min, ok := file.Stats.min[column.Name]; ok {
+			lowerBounds = append(lowerBounds, map[string]interface{}{"key": id, "value": icebergBound(column.Type, min)})
+			upperBounds = append(upperBounds, map[string]interface{}{"key": id, "value": icebergBound(column.Type, file.Stats.max[column.Name])})
+		}
+	}
+
+	return map[string]interface{}{
+		"file_path":           t.location + "/" + file.Path,
+		"file_format":         "PARQUET",
+		"partition":           file.Partition.Values,
+		"record_count":        file.Rows,
+		"file_size_in_bytes":  file.Size,
+		"block_size_in_bytes": int64(icebergBlockSize),
+		"value_counts":        valueCounts,
+		"null_value_counts":   nullCounts,
+		"lower_bounds":        lowerBounds,
+		"upper_bounds":        upperBounds,
+	}
+}
+
+// icebergBound serializes a statistics value with Iceberg's single-value binary serialization.
+func icebergBound(t tableType, value interface{}) []byte {
+	switch value := value.(type) {
+	case string:
+		return []byte(value)
+	case int64:
+		if t.Primitive == "long" {
+			return binary.LittleEndian.AppendUint64(nil, uint64(value))
+		}
+		return binary.LittleEndian.AppendUint32(nil, uint32(int32(value)))
+	case int32:
+		return binary.LittleEndian.AppendUint32(nil, uint32(value))
+	}
+	return nil
+}
+
+// partitionSummaries summarizes the values of each partition field across the files of a manifest.
+func (t *icebergTable) partitionSummaries(dataFiles []tableDataFile) []interface{} {
+	summaries := make([]interface{}, len(t.partitionSpec))
+	for i, field := range t.partitionSpec {
+		summary := map[string]interface{}{"contains_null": false, "contains_nan": false, "lower_bound": nil, "upper_bound": nil}
+		var min, max interface{}
+		for _, file := range dataFiles {
+			value := file.Partition.Values.(map[string]interface{})[field.Name]
+			if value == nil {
+				summary["contains_null"] = true
+				continue
+			}
+			if min == nil || lessPartitionValue(value, min) {
+				min = value
+			}
+			if max == nil || lessPartitionValue(max, value) {
+				max = value
+			}
+		}
+		if min != nil {
+			primitive := tableType{Primitive: "string"}
+			if field.Transform != "identity" {
+				primitive = tableType{Primitive: "int"}
+			}
+			summary["lower_bound"] = icebergBound(primitive, min)
+			summary["upper_bound"] = icebergBound(primitive, max)
+		}
+		summaries[i] = summary
+	}
+	return summaries
+}
+
+func lessPartitionValue(a, b interface{}) bool {
+	switch a := a.(type) {
+	case string:
+		return a < b.(string)
+	case int32:
+		return a < b.(int32)
+	}
+	return false
+}
+
+// manifestEntrySchema is the format version 1 manifest_entry Avro schema, with the partition
+// record of the table's partition spec.
+func (t *icebergTable) manifestEntrySchema() string {
+	partitionFields := make([]interface{}, len(t.partitionSpec))
+	for i, field := range t.partitionSpec {
+		fieldType := "string"
+		if field.Transform != "identity" {
+			fieldType = "int"
+		}
+		partitionFields[i] = map[string]interface{}{
+			"name": field.Name, "type": []interface{}{"null", fieldType}, "default": nil, "field-id": field.FieldID,
+		}
+	}
+
+	intMap := func(name string, id, keyID, valueID int, valueType string) map[string]interface{} {
+		return map[string]interface{}{
+			"name": name,
+			"type": []interface{}{"null", map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "record",
+					"name": fmt.Sprintf("k%d_v%d", keyID, valueID),
+					"fields": []interface{}{
+						map[string]interface{}{"name": "key", "type": "int", "field-id": keyID},
+						map[string]interface{}{"name": "value", "type": valueType, "field-id": valueID},
+					},
+				},
+				"logicalType": "map",
+			}},
+			"default":  nil,
+			"field-id": id,
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type": "record",
+		"name": "manifest_entry",
+		"fields": []interface{}{
+			map[string]interface{}{"name": "status", "type": "int", "field-id": 0},
+			map[string]interface{}{"name": "snapshot_id", "type": "long", "field-id": 1},
+			map[string]interface{}{
+				"name": "data_file",
+				"type": map[string]interface{}{
+					"type": "record",
+					"name": "r2",
+					"fields": []interface{}{
+						map[string]interface{}{"name": "file_path", "type": "string", "field-id": 100},
+						map[string]interface{}{"name": "file_format", "type": "string", "field-id": 101},
+						map[string]interface{}{
+							"name":     "partition",
+							"type":     map[string]interface{}{"type": "record", "name": "r102", "fields": partitionFields},
+							"field-id": 102,
+						},
+						map[string]interface{}{"name": "record_count", "type": "long", "field-id": 103},
+						map[string]interface{}{"name": "file_size_in_bytes", "type": "long", "field-id": 104},
+						map[string]interface{}{"name": "block_size_in_bytes", "type": "long", "field-id": 105},
+						intMap("value_counts", 109, 119, 120, "long"),
+						intMap("null_value_counts", 110, 121, 122, "long"),
+						intMap("lower_bounds", 125, 126, 127, "bytes"),
+						intMap("upper_bounds", 128, 129, 130, "bytes"),
+					},
+				},
+				"field-id": 2,
+			},
+		},
+	}
+	data, _ := json.Marshal(schema)
+	return string(data)
+}
+
+// icebergManifestListSchema is the format version 1 manifest_file Avro schema.
+var icebergManifestListSchema = avro.MustParseSchema(`{
+  "type": "record",
+  "name": "manifest_file",
+  "fields": [
+    {"name": "manifest_path", "type": "string", "field-id": 500},
+    {"name": "manifest_length", "type": "long", "field-id": 501},
+    {"name": "partition_spec_id", "type": "int", "field-id": 502},
+    {"name": "added_snapshot_id", "type": ["null", "long"], "default": null, "field-id": 503},
+    {"name": "added_data_files_count", "type": ["null", "int"], "default": null, "field-id": 504},
+    {"name": "existing_data_files_count", "type": ["null", "int"], "default": null, "field-id": 505},
+    {"name": "deleted_data_files_count", "type": ["null", "int"], "default": null, "field-id": 506},
+    {"name": "partitions", "type": ["null", {"type": "array", "items": {
+      "type": "record",
+      "name": "r508",
+      "fields": [
+        {"name": "contains_null", "type": "boolean", "field-id": 509},
+        {"name": "contains_nan", "type": ["null", "boolean"], "default": null, "field-id": 518},
+        {"name": "lower_bound", "type": ["null", "bytes"], "default": null, "field-id": 510},
+        {"name": "upper_bound", "type": ["null", "bytes"], "default": null, "field-id": 511}
+      ]
+    }, "element-id": 508}], "default": null, "field-id": 507},
+    {"name": "added_rows_count", "type": ["null", "long"], "default": null, "field-id": 512},
+    {"name": "existing_rows_count", "type": ["null", "long"], "default": null, "field-id": 513},
+    {"name": "deleted_rows_count", "type": ["null", "long"], "default": null, "field-id": 514}
+  ]
+}`)
+
+// readManifestList reads the entries of a manifest list, to carry them over to the next snapshot.
+func readManifestList(path string) ([]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := avro.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest list %s: %w", path, err)
+	}
+	var entries []interface{}
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest list %s: %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func writeAvroFile(path string, schema *avro.Schema, metadata map[string][]byte, records []interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w, err := avro.NewWriter(f, schema, "deflate", metadata)
+	if err == nil {
+		for _, record := range records {
+			if err = w.Append(record); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package outputhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/avro"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+func readAvroRecords(t *testing.T, path string) (*avro.Reader, []map[string]interface{}) {
+	t.Helper()
+	f, err := os.Open(strings.TrimPrefix(path, "file://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := avro.NewReader(f)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	var records []map[string]interface{}
+	for {
+		record, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return r, records
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		records = append(records, record.(map[string]interface{}))
+	}
+}
+
+func TestWriteIcebergTableCommits(t *testing.T) {
+	// The table is shared by the zips of a run, start from a fresh one
+	resetIcebergOutput := func() { icebergOutput.once, icebergOutput.table = sync.Once{}, nil }
+	resetIcebergOutput()
+	t.Cleanup(resetIcebergOutput)
+
+	cfg := &config.Config{OutputDir: t.TempDir()}
+	cfg.OutputConfig.ParquetSchema = "v1"
+	cfg.OutputConfig.ParquetCompression = "snappy"
+	cfg.OutputConfig.IcebergWarehouse = "warehouse"
+	cfg.OutputConfig.IcebergTable = "uspto.patents"
+	cfg.OutputConfig.IcebergPartitionBy = []string{"doc_type"}
+
+	if errs := runWriter(WriteIcebergTable, cfg, "ipg240102.zip", testDocs("grant", "US11000000-20240102.XML", "US11000001-20240102.XML")); len(errs) != 0 {
+		t.Fatalf("ipg240102.zip: %v", errs)
+	}
+	if errs := runWriter(WriteIcebergTable, cfg, "ipa240104.zip", testDocs("application", "US20240000001-20240104.XML")); len(errs) != 0 {
+		t.Fatalf("ipa240104.zip: %v", errs)
+	}
+
+	metadataDir := filepath.Join(cfg.OutputDir, "warehouse", "uspto", "patents", "metadata")
+	hint, err := os.ReadFile(filepath.Join(metadataDir, "version-hint.text"))
+	if err != nil || string(hint) != "2" {
+		t.Fatalf("version-hint.text = %q, %v, want 2", hint, err)
+	}
+	data, err := os.ReadFile(filepath.Join(metadataDir, "v2.metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata struct {
+		CurrentSnapshotID int64 `json:"current-snapshot-id"`
+		Snapshots         []struct {
+			SnapshotID   int64             `json:"snapshot-id"`
+			ParentID     int64             `json:"parent-snapshot-id"`
+			ManifestList string            `json:"manifest-list"`
+			Summary      map[string]string `json:"summary"`
+		} `json:"snapshots"`
+		Refs map[string]struct {
+			SnapshotID int64  `json:"snapshot-id"`
+			Type       string `json:"type"`
+		} `json:"refs"`
+		MetadataLog []map[string]interface{} `json:"metadata-log"`
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata.Snapshots) != 2 {
+		t.Fatalf("got %d snapshots, want 2", len(metadata.Snapshots))
+	}
+	first, second := metadata.Snapshots[0], metadata.Snapshots[1]
+	if metadata.CurrentSnapshotID != second.SnapshotID || second.ParentID != first.SnapshotID {
+		t.Errorf("current %d, second snapshot %d with parent %d, first %d", metadata.CurrentSnapshotID, second.SnapshotID, second.ParentID, first.SnapshotID)
+	}
+	if second.Summary["added-records"] != "1" || second.Summary["total-records"] != "3" || second.Summary["total-data-files"] != "2" {
+		t.Errorf("second snapshot summary = %v", second.Summary)
+	}
+	wantRefs := map[string]int64{"main": second.SnapshotID, "ipg240102": first.SnapshotID, "ipa240104": second.SnapshotID}
+	for name, id := range wantRefs {
+		ref, ok := metadata.Refs[name]
+		if !ok || ref.SnapshotID != id {
+			t.Errorf("ref %s = %+v, want snapshot %d", name, ref, id)
+		}
+		if wantType := map[bool]string{true: "branch", false: "tag"}[name == "main"]; ref.Type != wantType {
+			t.Errorf("ref %s has type %q, want %q", name, ref.Type, wantType)
+		}
+	}
+	if len(metadata.MetadataLog) != 1 {
+		t.Errorf("metadata log has %d entries, want v1", len(metadata.MetadataLog))
+	}
+
+	// The second manifest list carries over the manifest of the first snapshot
+	_, firstList := readAvroRecords(t, first.ManifestList)
+	_, secondList := readAvroRecords(t, second.ManifestList)
+	if len(firstList) != 1 || len(secondList) != 2 {
+		t.Fatalf("manifest lists have %d and %d entries, want 1 and 2", len(firstList), len(secondList))
+	}
+	if secondList[0]["added_snapshot_id"] != second.SnapshotID || secondList[1]["added_snapshot_id"] != first.SnapshotID {
+		t.Errorf("second manifest list added snapshots %v, %v", secondList[0]["added_snapshot_id"], secondList[1]["added_snapshot_id"])
+	}
+	if secondList[1]["manifest_path"] != firstList[0]["manifest_path"] {
+		t.Errorf("carried-over manifest %v, want %v", secondList[1]["manifest_path"], firstList[0]["manifest_path"])
+	}
+	if secondList[1]["added_rows_count"] != int64(2) {
+		t.Errorf("carried-over manifest added_rows_count = %v, want 2", secondList[1]["added_rows_count"])
+	}
+
+	// The manifest of the first snapshot lists its data file
+	manifest, entries := readAvroRecords(t, firstList[0]["manifest_path"].(string))
+	if string(manifest.Metadata["format-version"]) != "1" || string(manifest.Metadata["content"]) != "data" {
+		t.Errorf("manifest metadata = %q", manifest.Metadata)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("manifest has %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry["status"] != int32(1) || entry["snapshot_id"] != first.SnapshotID {
+		t.Errorf("manifest entry status %v, snapshot %v", entry["status"], entry["snapshot_id"])
+	}
+	dataFile := entry["data_file"].(map[string]interface{})
+	if dataFile["record_count"] != int64(2) {
+		t.Errorf("record_count = %v, want 2", dataFile["record_count"])
+	}
+	if partition := dataFile["partition"].(map[string]interface{}); partition["document_type"] != "grant" {
+		t.Errorf("partition = %v", partition)
+	}
+	path := strings.TrimPrefix(dataFile["file_path"].(string), "file://")
+	if !strings.Contains(path, "/document_type=grant/") {
+		t.Errorf("data file %s is not in the partition directory", path)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != dataFile["file_size_in_bytes"] {
+		t.Errorf("data file %s: %v, size %v", path, err, dataFile["file_size_in_bytes"])
+	}
+}
@@ -0,0 +1,179 @@
+package outputhandler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// SearchIndexSchema is the layout of the full-text index database, shared with the search package.
+// The FTS5 table is keyed by the rowid of its companion documents table, as is the citation entry of each
+// document, stored as JSON with indexcitations for exporting search results to BibTeX or RIS.
+const SearchIndexSchema = `
+CREATE TABLE IF NOT EXISTS documents (
+	id         INTEGER PRIMARY KEY,
+	file_name  TEXT NOT NULL UNIQUE,
+	doc_number TEXT,
+	kind_code  TEXT,
+	pub_date   TEXT,
+	title      TEXT
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS patents_fts USING fts5 (
+	doc_number,
+	title,
+	abstract,
+	claims,
+	description,
+	tokenize = 'porter unicode61'
+);
+CREATE TABLE IF NOT EXISTS bibliography (
+	id    INTEGER PRIMARY KEY,
+	entry TEXT NOT NULL
+);
+`
+
+var indexOutput sharedSQLiteDB
+
+// WriteSearchIndex adds the documents of a single zip to the shared SQLite FTS5 search index.
+func WriteSearchIndex(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteSearchIndex has been invoked", zap.String("OriginZipName", originZipName))
+
+	db, err := indexOutput.open(filepath.Join(cfg.OutputDir, cfg.OutputConfig.IndexFileName), SearchIndexSchema, log)
+	if err != nil {
+		log.Error("Error opening search index", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "index",
+			Whence:  "opening the search index",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+
+	batchSize := cfg.OutputConfig.SQLiteBatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	batch := make([]*types.USPTGoDoc, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := indexBatch(db, batch, cfg, errorChan, log); err != nil {
+			log.Error("Error adding batch to search index", zap.Int("documents", len(batch)), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    originZipName,
+				Type:    "index",
+				Whence:  fmt.Sprintf("indexing a batch of %d documents", len(batch)),
+				Err:     err,
+			}
+		}
+		batch = batch[:0]
+	}
+
+	for doc := range inputChan {
+		batch = append(batch, doc)
+		if len(batch) >= batchSize {
+			flush()
+		}
+	}
+	flush()
+}
+
+// indexBatch adds a batch of documents to the index in a single transaction. A document whose citation entry
+// cannot be built is indexed without one and reported as not skipped.
+func indexBatch(db *sql.DB, batch []*types.USPTGoDoc, cfg *config.Config, errorChan chan<- error, log *zap.Logger) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, doc := range batch {
+		pubRef := doc.Patent.UsBibliographicData.PublicationReference.DocumentID
+		title := doc.Patent.UsBibliographicData.InventionTitle.Text
+
+		// Re-indexing a document replaces its previous entry
+		var oldID int64
+		switch err = tx.QueryRow(`SELECT id FROM documents WHERE file_name = ?`, doc.Patent.MetaFileName).Scan(&oldID); err {
+		case nil:
+			if _, err = tx.Exec(`DELETE FROM patents_fts WHERE rowid = ?`, oldID); err != nil {
+				return err
+			}
+			if _, err = tx.Exec(`DELETE FROM bibliography WHERE id = ?`, oldID); err != nil {
+				return err
+			}
+			if _, err = tx.Exec(`DELETE FROM documents WHERE id = ?`, oldID); err != nil {
+				return err
+			}
+		case sql.ErrNoRows:
+			err = nil
+		default:
+			return err
+		}
+
+		res, err := tx.Exec(`INSERT INTO documents (file_name, doc_number, kind_code, pub_date, title) VALUES (?, ?, ?, ?, ?)`,
+			doc.Patent.MetaFileName, pubRef.DocNumber, pubRef.KindCode, doc.Patent.MetaDatePubl, title)
+		if err != nil {
+			return err
+		}
+		docID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO patents_fts (rowid, doc_number, title, abstract, claims, description) VALUES (?, ?, ?, ?, ?, ?)`,
+			docID,
+			pubRef.DocNumber,
+			title,
+			patentxml.PlainText(doc.Patent.Abstract.Content),
+			patentxml.PlainText(doc.Patent.Claims.Content),
+			patentxml.PlainText(doc.Patent.Description.Content),
+		)
+		if err != nil {
+			return err
+		}
+
+		if !cfg.OutputConfig.IndexCitations {
+			continue
+		}
+		entry, entryErr := bibliographyEntry(cfg, doc)
+		if entryErr != nil {
+			log.Warn("Indexing document without a citation entry", zap.String("filename", doc.Patent.MetaFileName), zap.Error(entryErr))
+			errorChan <- &types.USPTGoError{
+				Skipped: false,
+				Name:    doc.Patent.MetaFileName,
+				Type:    "index",
+				Whence:  "building the citation entry",
+				Err:     entryErr,
+			}
+			continue
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`INSERT INTO bibliography (id, entry) VALUES (?, ?)`, docID, string(data)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,80 @@
+package outputhandler
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/search"
+)
+
+const indexTestGrant = `<?xml version="1.0" encoding="UTF-8"?>
+<us-patent-grant>
+<us-bibliographic-data-grant>
+<publication-reference><document-id><country>US</country><doc-number>11000000</doc-number><kind>B2</kind><date>20240102</date></document-id></publication-reference>
+<invention-title id="title">Solid electrolyte battery</invention-title>
+</us-bibliographic-data-grant>
+</us-patent-grant>`
+
+func TestIndexBatchCitationEntries(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "search.db")
+	var shared sharedSQLiteDB
+	db, err := shared.open(dbPath, SearchIndexSchema, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.close()
+
+	withRaw := &types.USPTGoDoc{RawSplitDoc: []byte(indexTestGrant)}
+	withRaw.Patent.MetaFileName = "US11000000-20240102.XML"
+	withRaw.Patent.UsBibliographicData.InventionTitle.Text = "Solid electrolyte battery"
+	withRaw.USPTGoMetadata.DocumentType = "grant"
+	withoutRaw := &types.USPTGoDoc{}
+	withoutRaw.Patent.MetaFileName = "US11000001-20240102.XML"
+	withoutRaw.Patent.UsBibliographicData.InventionTitle.Text = "Liquid electrolyte battery"
+	withoutRaw.USPTGoMetadata.DocumentType = "grant"
+
+	cfg := &config.Config{}
+	cfg.OutputConfig.IndexCitations = true
+	errorChan := make(chan error, 10)
+	if err := indexBatch(db, []*types.USPTGoDoc{withRaw, withoutRaw}, cfg, errorChan, zap.NewNop()); err != nil {
+		t.Fatalf("indexBatch: %v", err)
+	}
+	close(errorChan)
+
+	var reported []string
+	for err := range errorChan {
+		var uerr *types.USPTGoError
+		if !errors.As(err, &uerr) || uerr.Skipped {
+			t.Errorf("error %v is not a non-skipping USPTGoError", err)
+			continue
+		}
+		reported = append(reported, uerr.Name)
+	}
+	if strings.Join(reported, ",") != withoutRaw.Patent.MetaFileName {
+		t.Errorf("errors reported for %v, want the document without raw XML", reported)
+	}
+
+	results, err := search.Search(dbPath, "title:battery", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want both documents indexed", len(results))
+	}
+	entries, missing, err := search.Entries(dbPath, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != "US11000000B2" || entries[0].Title != "Solid electrolyte battery" {
+		t.Errorf("entries = %+v", entries)
+	}
+	if strings.Join(missing, ",") != withoutRaw.Patent.MetaFileName {
+		t.Errorf("missing = %v", missing)
+	}
+}
@@ -1,11 +1,17 @@
 package outputhandler
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/klauspost/compress/zstd"
 	"go.uber.org/zap"
 
 	"github.com/diverged/uspt-go/types"
@@ -18,6 +24,29 @@ func WriteJSONFiles(cfg *config.Config, parsedDocs <-chan *types.USPTGoDoc, erro
 	log.Info("WriteJSONFiles called")
 	outputDir := cfg.OutputDir
 
+	compressor, err := newJSONCompressor(cfg.OutputConfig.JSONCompression)
+	if err != nil {
+		log.Error("Error initializing JSON compressor", zap.Error(err))
+		errorChan <- err
+		// Drain the channel so the parser is not blocked
+		for range parsedDocs {
+		}
+		return
+	}
+	defer compressor.Close()
+
+	naming := cfg.OutputConfig.JSONNaming
+	switch naming {
+	case "", "filename", "contenthash":
+	default:
+		err := fmt.Errorf("unsupported JSON naming %q", naming)
+		log.Error("Invalid JSON output configuration", zap.Error(err))
+		errorChan <- err
+		for range parsedDocs {
+		}
+		return
+	}
+
 	for doc := range parsedDocs {
 
 		//outputSubDir := filepath.Join(outputDir, doc.USPTGoMetadata.OriginZip.ZipName)
@@ -32,25 +61,117 @@ func WriteJSONFiles(cfg *config.Config, parsedDocs <-chan *types.USPTGoDoc, erro
 			continue
 		}
 
-		outputFileName := strings.TrimSuffix(strings.TrimSuffix(filename, ".XML"), ".xml") + ".json"
-
-		outputFilePath := filepath.Join(outputDir, outputFileName)
+		// The description is segmented before its text is rendered, as segmentation reads its markup
+		var out interface{} = doc
+		if cfg.OutputConfig.DescriptionSections {
+			out = struct {
+				*types.USPTGoDoc
+				DescriptionSections *descriptionSections
+			}{doc, describeSections(doc.Patent.Description.Content, cfg.OutputConfig.TextFormat)}
+		}
+		renderDocText(doc, cfg.OutputConfig.TextFormat)
 
 		// Marshall the JSON
-		jsonData, err := json.MarshalIndent(doc, "", "  ")
+		var jsonData []byte
+		if cfg.OutputConfig.JSONIndent {
+			jsonData, err = json.MarshalIndent(out, "", "  ")
+		} else {
+			jsonData, err = json.Marshal(out)
+		}
 		if err != nil {
 			log.Error("Failed to marshal document to JSON", zap.String("filename",
 				filename), zap.Error(err))
 			continue
 		}
 
-		err = os.WriteFile(outputFilePath, jsonData, 0644)
+		outputFileName := jsonFileName(naming, filename, jsonData) + compressor.Extension()
+
+		outputFilePath := filepath.Join(outputDir, outputFileName)
+
+		fileData, err := compressor.Compress(jsonData)
+		if err != nil {
+			log.Error("Failed to compress JSON document", zap.String("filename",
+				filename), zap.Error(err))
+			continue
+		}
+
+		err = os.WriteFile(outputFilePath, fileData, 0644)
 		if err != nil {
 			log.Error("Failed to save document to disk", zap.String("filename",
 				filename), zap.Error(err))
 			continue
 		}
-		log.Debug("Document saved", zap.String("filename", filename))
+		log.Debug("Document saved", zap.String("filename", filename), zap.String("output", outputFileName))
+
+	}
+}
+
+// jsonFileName names a JSON file after the source XML file, or after the hash of its uncompressed contents for
+// the "contenthash" naming, so that identical documents get the same name whatever the compression.
+func jsonFileName(naming, sourceName string, jsonData []byte) string {
+	if naming == "contenthash" {
+		sum := sha256.Sum256(jsonData)
+		return hex.EncodeToString(sum[:]) + ".json"
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(sourceName, ".XML"), ".xml") + ".json"
+}
+
+// jsonCompressor compresses individual JSON documents before they are written to disk.
+type jsonCompressor struct {
+	mode    string
+	zstdEnc *zstd.Encoder
+}
+
+func newJSONCompressor(mode string) (*jsonCompressor, error) {
+	switch mode {
+	case "", "none":
+		return &jsonCompressor{mode: "none"}, nil
+	case "gzip":
+		return &jsonCompressor{mode: mode}, nil
+	case "zstd":
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonCompressor{mode: mode, zstdEnc: enc}, nil
+	default:
+		return nil, fmt.Errorf("unsupported JSON compression %q", mode)
+	}
+}
+
+// Extension returns the file extension appended after ".json" for the compression mode.
+func (c *jsonCompressor) Extension() string {
+	switch c.mode {
+	case "gzip":
+		return ".gz"
+	case "zstd":
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+func (c *jsonCompressor) Compress(data []byte) ([]byte, error) {
+	switch c.mode {
+	case "gzip":
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		if _, err := gw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := gw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "zstd":
+		return c.zstdEnc.EncodeAll(data, make([]byte, 0, len(data)/4)), nil
+	default:
+		return data, nil
+	}
+}
 
+func (c *jsonCompressor) Close() {
+	if c.zstdEnc != nil {
+		c.zstdEnc.Close()
 	}
 }
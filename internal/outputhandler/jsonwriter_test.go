@@ -0,0 +1,184 @@
+package outputhandler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// The sections are added by wrapping the document in a struct that embeds it, which only works while
+// USPTGoDoc has no MarshalJSON method of its own: an embedded one would be promoted and drop the field.
+func TestWriteJSONFilesDescriptionSections(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{OutputDir: dir}
+	cfg.OutputConfig.DescriptionSections = true
+	cfg.OutputConfig.TextFormat = "innerxml"
+	cfg.OutputConfig.JSONCompression = "none"
+	cfg.OutputConfig.JSONNaming = "filename"
+
+	doc := testDocs("grant", "US11000000-20240102.XML")[0]
+	inputChan := make(chan *types.USPTGoDoc, 1)
+	inputChan <- doc
+	close(inputChan)
+	errorChan := make(chan error, 10)
+
+	WriteJSONFiles(cfg, inputChan, errorChan, zap.NewNop())
+	close(errorChan)
+	for err := range errorChan {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "US11000000-20240102.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Patent              json.RawMessage
+		DescriptionSections *descriptionSections
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Patent) == 0 || !strings.Contains(string(out.Patent), "Solid electrolyte battery") {
+		t.Errorf("document fields missing from the output: %s", data)
+	}
+	if out.DescriptionSections == nil {
+		t.Fatalf("DescriptionSections missing from the output: %s", data)
+	}
+	if !strings.Contains(out.DescriptionSections.Field, "relates to batteries.") || !strings.Contains(out.DescriptionSections.Background, "liquid electrolytes.") || !strings.Contains(out.DescriptionSections.Summary, "It does not leak.") {
+		t.Errorf("DescriptionSections = %+v", out.DescriptionSections)
+	}
+}
+
+func TestWriteJSONFilesCompression(t *testing.T) {
+	tests := []struct {
+		compression string
+		naming      string
+		extension   string
+	}{
+		{"none", "filename", ".json"},
+		{"gzip", "filename", ".json.gz"},
+		{"zstd", "filename", ".json.zst"},
+		{"none", "contenthash", ".json"},
+		{"gzip", "contenthash", ".json.gz"},
+		{"zstd", "contenthash", ".json.zst"},
+	}
+	hashes := map[string]bool{}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		cfg := &config.Config{OutputDir: dir}
+		cfg.OutputConfig.TextFormat = "innerxml"
+		cfg.OutputConfig.JSONCompression = tt.compression
+		cfg.OutputConfig.JSONNaming = tt.naming
+		inputChan := make(chan *types.USPTGoDoc, 1)
+		inputChan <- testDocs("grant", "US11000000-20240102.XML")[0]
+		close(inputChan)
+		errorChan := make(chan error, 10)
+
+		WriteJSONFiles(cfg, inputChan, errorChan, zap.NewNop())
+		close(errorChan)
+		for err := range errorChan {
+			t.Errorf("%s/%s: unexpected error: %v", tt.compression, tt.naming, err)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("%s/%s: output files %v, %v, want one", tt.compression, tt.naming, entries, err)
+		}
+		name := entries[0].Name()
+		if !strings.HasSuffix(name, tt.extension) {
+			t.Errorf("%s/%s: file %s, want extension %s", tt.compression, tt.naming, name, tt.extension)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tt.compression {
+		case "gzip":
+			r, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s/%s: %v", tt.compression, tt.naming, err)
+			}
+			data, err = io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%s/%s: %v", tt.compression, tt.naming, err)
+			}
+		case "zstd":
+			r, err := zstd.NewReader(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err = r.DecodeAll(data, nil)
+			r.Close()
+			if err != nil {
+				t.Fatalf("%s/%s: %v", tt.compression, tt.naming, err)
+			}
+		}
+		if !json.Valid(data) || !bytes.Contains(data, []byte("Solid electrolyte battery")) {
+			t.Errorf("%s/%s: output is not the JSON document: %.100s", tt.compression, tt.naming, data)
+		}
+
+		base := strings.TrimSuffix(name, tt.extension)
+		if tt.naming == "filename" {
+			if base != "US11000000-20240102" {
+				t.Errorf("%s/%s: file %s, want it named after the source XML", tt.compression, tt.naming, name)
+			}
+			continue
+		}
+		// The hash is of the uncompressed JSON, so it does not depend on the compression
+		if sum := sha256.Sum256(data); base != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s/%s: file %s, want the SHA-256 of its uncompressed contents", tt.compression, tt.naming, name)
+		}
+		hashes[base] = true
+	}
+	if len(hashes) != 1 {
+		t.Errorf("content hashes differ between compressions: %v", hashes)
+	}
+}
+
+func TestWriteJSONFilesInvalidConfig(t *testing.T) {
+	tests := []struct {
+		compression string
+		naming      string
+	}{
+		{"lz4", "filename"},
+		{"gzip", "hash"},
+		{"none", "Filename"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		cfg := &config.Config{OutputDir: dir}
+		cfg.OutputConfig.JSONCompression = tt.compression
+		cfg.OutputConfig.JSONNaming = tt.naming
+		inputChan := make(chan *types.USPTGoDoc, 2)
+		inputChan <- testDocs("grant", "US11000000-20240102.XML")[0]
+		inputChan <- testDocs("grant", "US11000000-20240102.XML")[0]
+		close(inputChan)
+		errorChan := make(chan error, 10)
+
+		WriteJSONFiles(cfg, inputChan, errorChan, zap.NewNop())
+		close(errorChan)
+		if errs := len(errorChan); errs != 1 {
+			t.Errorf("%s/%s: %d errors, want 1", tt.compression, tt.naming, errs)
+		}
+		if len(inputChan) != 0 {
+			t.Errorf("%s/%s: input channel not drained", tt.compression, tt.naming)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%s/%s: wrote %d files", tt.compression, tt.naming, len(entries))
+		}
+	}
+}
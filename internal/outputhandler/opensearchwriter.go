@@ -0,0 +1,402 @@
+package outputhandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// openSearchDoc is the _source of each document sent to Elasticsearch/OpenSearch.
+type openSearchDoc struct {
+	FileName              string `json:"file_name"`
+	DocumentType          string `json:"document_type"`
+	DocNumber             string `json:"doc_number"`
+	KindCode              string `json:"kind_code"`
+	Country               string `json:"country"`
+	PubDate               string `json:"pub_date,omitempty"`
+	DateProduced          string `json:"date_produced,omitempty"`
+	Title                 string `json:"title"`
+	NumberOfClaims        int    `json:"number_of_claims"`
+	Abstract              string `json:"abstract"`
+	Claims                string `json:"claims"`
+	Description           string `json:"description"`
+	MainClassification    string `json:"main_classification,omitempty"`
+	FurtherClassification string `json:"further_classification,omitempty"`
+	OriginZip             string `json:"origin_zip"`
+}
+
+// openSearchMappings matches openSearchDoc and is used for the generated index template.
+var openSearchMappings = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"file_name":              map[string]string{"type": "keyword"},
+		"document_type":          map[string]string{"type": "keyword"},
+		"doc_number":             map[string]string{"type": "keyword"},
+		"kind_code":              map[string]string{"type": "keyword"},
+		"country":                map[string]string{"type": "keyword"},
+		"pub_date":               map[string]string{"type": "date", "format": "yyyy-MM-dd"},
+		"date_produced":          map[string]string{"type": "date", "format": "yyyy-MM-dd"},
+		"title":                  map[string]string{"type": "text"},
+		"number_of_claims":       map[string]string{"type": "integer"},
+		"abstract":               map[string]string{"type": "text"},
+		"claims":                 map[string]string{"type": "text"},
+		"description":            map[string]string{"type": "text"},
+		"main_classification":    map[string]string{"type": "keyword"},
+		"further_classification": map[string]string{"type": "keyword"},
+		"origin_zip":             map[string]string{"type": "keyword"},
+	},
+}
+
+// The index template is generated (and, for the HTTP sink, installed) once per run.
+var openSearchTemplate struct {
+	once sync.Once
+	err  error
+}
+
+// WriteOpenSearchBulk renders the documents of a single zip as _bulk NDJSON, in batches of opensearchbatchsize
+// documents written to a file each or posted to the configured endpoint.
+func WriteOpenSearchBulk(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteOpenSearchBulk has been invoked", zap.String("OriginZipName", originZipName))
+
+	outCfg := cfg.OutputConfig
+
+	var client *bulkClient
+	if outCfg.OpenSearchEndpoint != "" {
+		client = &bulkClient{
+			endpoint:   strings.TrimSuffix(outCfg.OpenSearchEndpoint, "/"),
+			username:   outCfg.OpenSearchUsername,
+			password:   outCfg.OpenSearchPassword,
+			maxRetries: outCfg.OpenSearchMaxRetries,
+			backoff:    time.Second,
+			http:       &http.Client{Timeout: 60 * time.Second},
+			log:        log,
+		}
+	}
+
+	openSearchTemplate.once.Do(func() {
+		openSearchTemplate.err = installOpenSearchTemplate(cfg, client)
+	})
+	if openSearchTemplate.err != nil {
+		log.Error("Error generating OpenSearch index template", zap.Error(openSearchTemplate.err))
+		errorChan <- openSearchTemplate.err
+	}
+
+	batchSize := outCfg.OpenSearchBatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	// Without an endpoint, each batch is written to its own NDJSON file, e.g. ipg240102-00001.ndjson, so that
+	// the files can be posted to _bulk as they are
+	baseName := strings.TrimSuffix(originZipName, ".zip")
+	batches := 0
+	var batch []bulkItem
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		batches++
+		if client != nil {
+			for _, failure := range client.send(batch) {
+				errorChan <- failure
+			}
+		} else {
+			outputFileName := fmt.Sprintf("%s-%05d.ndjson", baseName, batches)
+			if err := writeBulkFile(filepath.Join(cfg.OutputDir, outputFileName), batch); err != nil {
+				log.Error("Error writing bulk NDJSON file", zap.String("file", outputFileName), zap.Error(err))
+				errorChan <- &types.USPTGoError{
+					Skipped: true,
+					Name:    outputFileName,
+					Type:    "opensearch",
+					Whence:  "writing the bulk NDJSON file",
+					Err:     err,
+				}
+			}
+		}
+		batch = batch[:0]
+	}
+
+	for doc := range inputChan {
+		item, err := newBulkItem(outCfg.OpenSearchIndex, originZipName, doc)
+		if err != nil {
+			log.Error("Failed to render bulk action", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			continue
+		}
+		batch = append(batch, item)
+		if len(batch) >= batchSize {
+			flush()
+		}
+	}
+	flush()
+}
+
+// writeBulkFile writes the action and source lines of a batch to a file.
+func writeBulkFile(path string, batch []bulkItem) error {
+	var body bytes.Buffer
+	for _, item := range batch {
+		body.Write(item.lines)
+	}
+	return os.WriteFile(path, body.Bytes(), 0644)
+}
+
+// bulkItem is the action and source lines for a single document.
+type bulkItem struct {
+	id    string
+	lines []byte
+}
+
+func newBulkItem(indexPattern, originZipName string, doc *types.USPTGoDoc) (bulkItem, error) {
+	biblio := doc.Patent.UsBibliographicData
+	pubRef := biblio.PublicationReference.DocumentID
+
+	source := openSearchDoc{
+		FileName:              doc.Patent.MetaFileName,
+		DocumentType:          doc.USPTGoMetadata.DocumentType,
+		DocNumber:             pubRef.DocNumber,
+		KindCode:              pubRef.KindCode,
+		Country:               doc.Patent.MetaCountry,
+		PubDate:               isoDate(doc.Patent.MetaDatePubl),
+		DateProduced:          isoDate(doc.Patent.MetaDateProduced),
+		Title:                 biblio.InventionTitle.Text,
+		NumberOfClaims:        biblio.NumberOfClaims,
+		Abstract:              patentxml.PlainText(doc.Patent.Abstract.Content),
+		Claims:                patentxml.PlainText(doc.Patent.Claims.Content),
+		Description:           patentxml.PlainText(doc.Patent.Description.Content),
+		MainClassification:    biblio.ClassificationNational.MainClassification,
+		FurtherClassification: biblio.ClassificationNational.FurtherClassification,
+		OriginZip:             originZipName,
+	}
+
+	id := strings.TrimSuffix(strings.TrimSuffix(doc.Patent.MetaFileName, ".XML"), ".xml")
+	action := map[string]map[string]string{
+		"index": {"_index": openSearchIndexName(indexPattern, doc), "_id": id},
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf) // Encode terminates each line with a newline
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(action); err != nil {
+		return bulkItem{}, err
+	}
+	if err := enc.Encode(source); err != nil {
+		return bulkItem{}, err
+	}
+	return bulkItem{id: id, lines: buf.Bytes()}, nil
+}
+
+// openSearchIndexName expands the {year}, {month} and {doctype} placeholders of the configured index pattern.
+func openSearchIndexName(pattern string, doc *types.USPTGoDoc) string {
+	date := doc.Patent.MetaDatePubl
+	year, month := "unknown", "unknown"
+	if len(date) >= 6 {
+		year, month = date[:4], date[4:6]
+	}
+	return strings.NewReplacer(
+		"{year}", year,
+		"{month}", month,
+		"{doctype}", strings.ToLower(doc.USPTGoMetadata.DocumentType),
+	).Replace(pattern)
+}
+
+// isoDate converts a USPTO YYYYMMDD date to YYYY-MM-DD, returning "" for malformed input.
+func isoDate(date string) string {
+	t, err := time.Parse("20060102", date)
+	if err != nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// installOpenSearchTemplate writes the index template to the output directory and, when an endpoint is
+// configured, installs it as a composable index template.
+func installOpenSearchTemplate(cfg *config.Config, client *bulkClient) error {
+	pattern := cfg.OutputConfig.OpenSearchIndex
+	wildcard, name := pattern, pattern
+	for _, placeholder := range []string{"{year}", "{month}", "{doctype}"} {
+		wildcard = strings.ReplaceAll(wildcard, placeholder, "*")
+		name = strings.ReplaceAll(name, placeholder, "")
+	}
+	name = strings.Trim(name, "-_.")
+
+	template := map[string]interface{}{
+		"index_patterns": []string{wildcard},
+		"template": map[string]interface{}{
+			"mappings": openSearchMappings,
+		},
+	}
+	body, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(cfg.OutputDir, "opensearch-template.json"), body, 0644); err != nil {
+		return err
+	}
+
+	if client == nil {
+		return nil
+	}
+	resp, err := client.do(http.MethodPut, "/_index_template/"+name, "application/json", body)
+	if err != nil {
+		return fmt.Errorf("installing index template: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("installing index template: %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// bulkClient posts _bulk requests, retrying transport failures, throttling responses and throttled items.
+type bulkClient struct {
+	endpoint   string
+	username   string
+	password   string
+	maxRetries int
+	backoff    time.Duration // Delay before the first retry, doubled for each further retry
+	http       *http.Client
+	log        *zap.Logger
+}
+
+type bulkResponse struct {
+	Errors bool                                `json:"errors"`
+	Items  []map[string]bulkResponseItemResult `json:"items"`
+}
+
+type bulkResponseItemResult struct {
+	ID     string `json:"_id"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+func (c *bulkClient) do(method, path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return c.http.Do(req)
+}
+
+// send posts a batch and returns an error for every document that could not be indexed.
+func (c *bulkClient) send(batch []bulkItem) []error {
+	pending := batch
+	var failures []error
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			backoff := c.backoff << uint(attempt-1)
+			c.log.Warn("Retrying OpenSearch bulk request", zap.Int("attempt", attempt), zap.Int("documents", len(pending)), zap.Duration("backoff", backoff))
+			time.Sleep(backoff)
+		}
+		exhausted := attempt >= c.maxRetries
+
+		var body bytes.Buffer
+		for _, item := range pending {
+			body.Write(item.lines)
+		}
+
+		resp, err := c.do(http.MethodPost, "/_bulk", "application/x-ndjson", body.Bytes())
+		if err != nil {
+			if exhausted {
+				return append(failures, c.itemErrors(pending, err)...)
+			}
+			continue
+		}
+		result, status, err := readBulkResponse(resp)
+		if err != nil || status == http.StatusTooManyRequests || status >= 500 {
+			if err == nil {
+				err = fmt.Errorf("bulk request failed: %s", http.StatusText(status))
+			}
+			if exhausted {
+				return append(failures, c.itemErrors(pending, err)...)
+			}
+			continue
+		}
+		if status >= 300 {
+			return append(failures, c.itemErrors(pending, fmt.Errorf("bulk request rejected: %s", http.StatusText(status)))...)
+		}
+		if !result.Errors {
+			return failures
+		}
+
+		// Items are returned in request order; retry only the throttled ones
+		var retry []bulkItem
+		for i, item := range result.Items {
+			if i >= len(pending) {
+				break
+			}
+			for _, r := range item {
+				if r.Error == nil && r.Status < 300 {
+					continue
+				}
+				if r.Status == http.StatusTooManyRequests && !exhausted {
+					retry = append(retry, pending[i])
+					continue
+				}
+				reason := http.StatusText(r.Status)
+				if r.Error != nil {
+					reason = r.Error.Type + ": " + r.Error.Reason
+				}
+				failures = append(failures, c.itemError(pending[i].id, fmt.Errorf("%s", reason)))
+			}
+		}
+		// Documents missing from a short response were not confirmed as indexed
+		for i := len(result.Items); i < len(pending); i++ {
+			failures = append(failures, c.itemError(pending[i].id, fmt.Errorf("no result returned for the document")))
+		}
+		pending = retry
+	}
+	return failures
+}
+
+func readBulkResponse(resp *http.Response) (*bulkResponse, int, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil, resp.StatusCode, nil
+	}
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("decoding bulk response: %w", err)
+	}
+	return &result, resp.StatusCode, nil
+}
+
+func (c *bulkClient) itemErrors(items []bulkItem, err error) []error {
+	errs := make([]error, len(items))
+	for i, item := range items {
+		errs[i] = c.itemError(item.id, err)
+	}
+	return errs
+}
+
+func (c *bulkClient) itemError(id string, err error) error {
+	c.log.Error("Document not indexed", zap.String("id", id), zap.Error(err))
+	return &types.USPTGoError{
+		Skipped: true,
+		Name:    id,
+		Type:    "opensearch",
+		Whence:  "indexing the document",
+		Err:     err,
+	}
+}
@@ -0,0 +1,282 @@
+package outputhandler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// bulkStub is a local _bulk endpoint answering each request with the next scripted handler.
+type bulkStub struct {
+	mu       sync.Mutex
+	requests [][]string // Document ids of each request, in order
+	handlers []func(w http.ResponseWriter, ids []string)
+}
+
+func (s *bulkStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var ids []string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, 1<<20)
+	for line := 0; scanner.Scan(); line++ {
+		if line%2 == 1 {
+			continue
+		}
+		var action map[string]map[string]string
+		json.Unmarshal(scanner.Bytes(), &action)
+		ids = append(ids, action["index"]["_id"])
+	}
+
+	s.mu.Lock()
+	n := len(s.requests)
+	s.requests = append(s.requests, ids)
+	s.mu.Unlock()
+	if n >= len(s.handlers) {
+		http.Error(w, "unexpected request", http.StatusInternalServerError)
+		return
+	}
+	s.handlers[n](w, ids)
+}
+
+// bulkItemsResponse writes a _bulk response with one item per id, with the given status.
+func bulkItemsResponse(w http.ResponseWriter, ids []string, status func(id string) int) {
+	result := bulkResponse{}
+	for _, id := range ids {
+		item := bulkResponseItemResult{ID: id, Status: status(id)}
+		if item.Status >= 300 {
+			result.Errors = true
+			item.Error = &struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			}{"mapper_parsing_exception", "failed to parse " + id}
+		}
+		result.Items = append(result.Items, map[string]bulkResponseItemResult{"index": item})
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func newTestBulkClient(t *testing.T, stub *bulkStub) *bulkClient {
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return &bulkClient{
+		endpoint:   server.URL,
+		maxRetries: 3,
+		backoff:    time.Millisecond,
+		http:       server.Client(),
+		log:        zap.NewNop(),
+	}
+}
+
+func testBulkItems(ids ...string) []bulkItem {
+	items := make([]bulkItem, len(ids))
+	for i, id := range ids {
+		items[i] = bulkItem{id: id, lines: []byte(`{"index":{"_index":"patents","_id":"` + id + `"}}` + "\n{}\n")}
+	}
+	return items
+}
+
+func failedIDs(t *testing.T, failures []error) []string {
+	var ids []string
+	for _, err := range failures {
+		var uerr *types.USPTGoError
+		if !errors.As(err, &uerr) {
+			t.Fatalf("failure %v is not a USPTGoError", err)
+		}
+		if !uerr.Skipped || uerr.Type != "opensearch" {
+			t.Errorf("failure for %s: Skipped = %v, Type = %q", uerr.Name, uerr.Skipped, uerr.Type)
+		}
+		ids = append(ids, uerr.Name)
+	}
+	return ids
+}
+
+func TestBulkClientRetriesServerErrors(t *testing.T) {
+	ok := func(string) int { return http.StatusCreated }
+	stub := &bulkStub{handlers: []func(http.ResponseWriter, []string){
+		func(w http.ResponseWriter, ids []string) { http.Error(w, "unavailable", http.StatusServiceUnavailable) },
+		func(w http.ResponseWriter, ids []string) { http.Error(w, "bad gateway", http.StatusBadGateway) },
+		func(w http.ResponseWriter, ids []string) { bulkItemsResponse(w, ids, ok) },
+	}}
+	client := newTestBulkClient(t, stub)
+
+	if failures := client.send(testBulkItems("a", "b")); len(failures) != 0 {
+		t.Fatalf("send returned failures %v", failures)
+	}
+	if len(stub.requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(stub.requests))
+	}
+	for i, ids := range stub.requests {
+		if strings.Join(ids, ",") != "a,b" {
+			t.Errorf("request %d sent %v, want the whole batch", i, ids)
+		}
+	}
+}
+
+func TestBulkClientGivesUpAfterMaxRetries(t *testing.T) {
+	fail := func(w http.ResponseWriter, ids []string) { http.Error(w, "unavailable", http.StatusServiceUnavailable) }
+	stub := &bulkStub{handlers: []func(http.ResponseWriter, []string){fail, fail, fail, fail}}
+	client := newTestBulkClient(t, stub)
+
+	got := failedIDs(t, client.send(testBulkItems("a", "b")))
+	if strings.Join(got, ",") != "a,b" {
+		t.Errorf("failures for %v, want a,b", got)
+	}
+	if len(stub.requests) != client.maxRetries+1 {
+		t.Errorf("got %d requests, want %d", len(stub.requests), client.maxRetries+1)
+	}
+}
+
+func TestBulkClientRetriesThrottledItems(t *testing.T) {
+	stub := &bulkStub{handlers: []func(http.ResponseWriter, []string){
+		func(w http.ResponseWriter, ids []string) {
+			bulkItemsResponse(w, ids, func(id string) int {
+				if id == "b" || id == "c" {
+					return http.StatusTooManyRequests
+				}
+				return http.StatusCreated
+			})
+		},
+		func(w http.ResponseWriter, ids []string) {
+			bulkItemsResponse(w, ids, func(string) int { return http.StatusCreated })
+		},
+	}}
+	client := newTestBulkClient(t, stub)
+
+	if failures := client.send(testBulkItems("a", "b", "c")); len(failures) != 0 {
+		t.Fatalf("send returned failures %v", failures)
+	}
+	if len(stub.requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(stub.requests))
+	}
+	if got := strings.Join(stub.requests[1], ","); got != "b,c" {
+		t.Errorf("retry sent %s, want only the throttled items b,c", got)
+	}
+}
+
+func TestBulkClientReportsItemErrors(t *testing.T) {
+	stub := &bulkStub{handlers: []func(http.ResponseWriter, []string){
+		func(w http.ResponseWriter, ids []string) {
+			bulkItemsResponse(w, ids, func(id string) int {
+				if id == "b" {
+					return http.StatusBadRequest
+				}
+				return http.StatusCreated
+			})
+		},
+	}}
+	client := newTestBulkClient(t, stub)
+
+	failures := client.send(testBulkItems("a", "b", "c"))
+	if got := failedIDs(t, failures); strings.Join(got, ",") != "b" {
+		t.Fatalf("failures for %v, want b", got)
+	}
+	if !strings.Contains(failures[0].Error(), "mapper_parsing_exception") {
+		t.Errorf("failure %q does not carry the item error", failures[0])
+	}
+	if len(stub.requests) != 1 {
+		t.Errorf("got %d requests, want no retry of rejected items", len(stub.requests))
+	}
+}
+
+func TestBulkClientReportsItemsMissingFromResponse(t *testing.T) {
+	stub := &bulkStub{handlers: []func(http.ResponseWriter, []string){
+		func(w http.ResponseWriter, ids []string) {
+			// Only the first item has a result, and the throttled one forces the per-item path
+			bulkItemsResponse(w, ids[:1], func(string) int { return http.StatusTooManyRequests })
+		},
+		func(w http.ResponseWriter, ids []string) {
+			bulkItemsResponse(w, ids, func(string) int { return http.StatusCreated })
+		},
+	}}
+	client := newTestBulkClient(t, stub)
+
+	got := failedIDs(t, client.send(testBulkItems("a", "b", "c")))
+	if strings.Join(got, ",") != "b,c" {
+		t.Errorf("failures for %v, want b,c", got)
+	}
+}
+
+func TestWriteOpenSearchBulkFileSink(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{OutputDir: dir}
+	cfg.OutputConfig.OpenSearchIndex = "patents-{year}"
+	cfg.OutputConfig.OpenSearchBatchSize = 2
+
+	docs := testDocs("grant", "US11000000-20240102.XML", "US11000001-20240102.XML", "US11000002-20240102.XML")
+	for _, err := range runWriter(WriteOpenSearchBulk, cfg, "ipg240102.zip", docs) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// The batches are written to files of their own
+	first, err := os.ReadFile(filepath.Join(dir, "ipg240102-00001.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSuffix(string(first), "\n"), "\n"); len(lines) != 4 {
+		t.Errorf("first batch has %d lines, want an action and a source line for each of 2 documents", len(lines))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "ipg240102-00002.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("second batch has %d lines, want an action and a source line for the last document", len(lines))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ipg240102-00003.ndjson")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("third batch file exists (%v)", err)
+	}
+	var action map[string]map[string]string
+	if err := json.Unmarshal([]byte(lines[0]), &action); err != nil {
+		t.Fatal(err)
+	}
+	if action["index"]["_index"] != "patents-2024" || action["index"]["_id"] != "US11000002-20240102" {
+		t.Errorf("last action = %v", action)
+	}
+	var source openSearchDoc
+	if err := json.Unmarshal([]byte(lines[1]), &source); err != nil {
+		t.Fatal(err)
+	}
+	if source.PubDate != "2024-01-02" || source.Title != "Solid electrolyte battery & method" || source.OriginZip != "ipg240102.zip" {
+		t.Errorf("last source = %+v", source)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "opensearch-template.json")); err != nil {
+		t.Errorf("index template not written: %v", err)
+	}
+}
+
+func TestWriteOpenSearchBulkFileSinkFailure(t *testing.T) {
+	cfg := &config.Config{OutputDir: filepath.Join(t.TempDir(), "missing")}
+	cfg.OutputConfig.OpenSearchIndex = "patents"
+	cfg.OutputConfig.OpenSearchBatchSize = 2
+	// The template is written once per run, mark it written so that only the batch files fail
+	resetOpenSearchTemplate := func() { openSearchTemplate.once, openSearchTemplate.err = sync.Once{}, nil }
+	resetOpenSearchTemplate()
+	t.Cleanup(resetOpenSearchTemplate)
+	openSearchTemplate.once.Do(func() {})
+
+	docs := testDocs("grant", "US11000000-20240102.XML", "US11000001-20240102.XML", "US11000002-20240102.XML")
+	errs := runWriter(WriteOpenSearchBulk, cfg, "ipg240102.zip", docs)
+	if len(errs) != 2 {
+		t.Fatalf("errors reported: %v, want one per batch", errs)
+	}
+	var uerr *types.USPTGoError
+	if !errors.As(errs[1], &uerr) || !uerr.Skipped || uerr.Name != "ipg240102-00002.ndjson" {
+		t.Errorf("second error = %v, want the second batch file skipped", errs[1])
+	}
+}
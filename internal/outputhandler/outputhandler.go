@@ -12,6 +12,15 @@ func HandleOutput(cfg *config.Config, inputChan <-chan *types.USPTGoDoc, errorCh
 
 	log.Debug("Handling output", zap.String("originZipName", originZipName))
 
+	// Checked for every mode, although only the JSON and tabular writers render text
+	if err := validateTextFormat(cfg.OutputConfig.TextFormat); err != nil {
+		log.Error("Invalid output configuration", zap.Error(err))
+		errorChan <- err
+		for range inputChan {
+		}
+		return
+	}
+
 	var wg sync.WaitGroup
 
 	// Handle output based on configuration
@@ -29,6 +38,20 @@ func HandleOutput(cfg *config.Config, inputChan <-chan *types.USPTGoDoc, errorCh
 			WriteJSONFiles(cfg, inputChan, errorChan, log)
 		}()
 		wg.Wait()
+	} else if cfg.OutputMode == "html" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteHtmlFiles(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "parquet" && cfg.OutputConfig.ParquetLayout == "dataset" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteParquetDataset(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
 	} else if cfg.OutputMode == "parquet" {
 		wg.Add(1)
 		go func() {
@@ -37,8 +60,157 @@ func HandleOutput(cfg *config.Config, inputChan <-chan *types.USPTGoDoc, errorCh
 
 		}()
 		wg.Wait()
+	} else if cfg.OutputMode == "csv" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteCSVFile(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "sqlite" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteSQLite(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "index" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteSearchIndex(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "opensearch" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteOpenSearchBulk(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "delta" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteDeltaTable(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "iceberg" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteIcebergTable(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "avro" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteAvroFile(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "arrow" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteArrowFile(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "corpus" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteCorpusFile(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "claimgraph" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteClaimGraphFile(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "citations" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteCitationEdges(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "patentsview" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WritePatentsView(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "bigquery" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteBigQueryFile(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "st96" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteST96Files(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "rdf" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteRDFFile(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
+	} else if cfg.OutputMode == "bibtex" || cfg.OutputMode == "ris" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteBibliographyFile(cfg, originZipName, inputChan, errorChan, log)
+		}()
+		wg.Wait()
 	} else {
 
 		log.Debug("No output mode specified, skipping output handling")
 	}
 }
+
+// NeedsRawSplitDoc reports whether the configured output reads the raw split XML of each document,
+// which the parser only returns on request.
+func NeedsRawSplitDoc(cfg *config.Config) bool {
+	switch cfg.OutputMode {
+	case "xml", "html", "citations", "patentsview", "bigquery", "st96", "rdf", "bibtex", "ris":
+		return true
+	case "index":
+		return cfg.OutputConfig.IndexCitations
+	case "parquet", "delta", "iceberg", "avro", "arrow":
+		return cfg.OutputConfig.ParquetSchema == parquetSchemaV2
+	}
+	return false
+}
+
+// Finalize completes output that spans every zip of a run, such as closing shared databases.
+// It must be called once, after HandleOutput has returned for all zip files.
+func Finalize(cfg *config.Config, log *zap.Logger) error {
+
+	log.Debug("Finalizing output", zap.String("outputMode", cfg.OutputMode))
+
+	switch cfg.OutputMode {
+	case "sqlite":
+		return sqliteOutput.close()
+	case "index":
+		return indexOutput.close()
+	case "citations":
+		return citationOutput.close()
+	case "patentsview":
+		return patentsViewOutput.close()
+	case "parquet":
+		if cfg.OutputConfig.ParquetLayout == "dataset" {
+			return closeParquetDataset()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package outputhandler
+
+import (
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+// testDocs returns copies of the fixture grant named after the given source files, as the documents of one zip
+// of the given type.
+func testDocs(docType string, names ...string) []*types.USPTGoDoc {
+	docs := make([]*types.USPTGoDoc, len(names))
+	for i, name := range names {
+		docs[i] = fixture.Doc(fixture.Grant)
+		docs[i].Patent.MetaFileName = name
+		docs[i].USPTGoMetadata.DocumentType = docType
+	}
+	return docs
+}
+
+// runWriter runs a zip writer on the documents of one zip, returning the errors it reported.
+func runWriter(write func(*config.Config, string, <-chan *types.USPTGoDoc, chan<- error, *zap.Logger), cfg *config.Config, zipName string, docs []*types.USPTGoDoc) []error {
+	inputChan := make(chan *types.USPTGoDoc, len(docs))
+	for _, doc := range docs {
+		inputChan <- doc
+	}
+	close(inputChan)
+	errorChan := make(chan error, len(docs)+10)
+	write(cfg, zipName, inputChan, errorChan, zap.NewNop())
+	close(errorChan)
+	var errs []error
+	for err := range errorChan {
+		errs = append(errs, err)
+	}
+	return errs
+}
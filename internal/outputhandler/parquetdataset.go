@@ -0,0 +1,372 @@
+package outputhandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// hiveDefaultPartition is the value Hive-style engines use for a partition column with no value.
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// datasetManifestName is written to the dataset root, listing every part file with its partition values.
+// It is this tool's own record of what a run wrote; query engines do not read it and prune only on the partition directory names.
+const datasetManifestName = "_manifest.json"
+
+// datasetCommonMetadataName is the schema-only Parquet footer written to the dataset root, as read by Spark and Arrow.
+const datasetCommonMetadataName = "_common_metadata"
+
+type datasetManifest struct {
+	SchemaVersion    string        `json:"schemaVersion"`
+	PartitionColumns []string      `json:"partitionColumns"`
+	Files            []datasetFile `json:"files"`
+}
+
+type datasetFile struct {
+	Path       string            `json:"path"` // Relative to the dataset root, using forward slashes
+	Partition  map[string]string `json:"partition"`
+	Rows       int64             `json:"rows"`
+	Bytes      int64             `json:"bytes"`
+	OriginZips []string          `json:"originZips"`
+}
+
+// parquetPart is an open part file of the dataset. Parts are shared by every zip writing to the same partition.
+type parquetPart struct {
+	mu        sync.Mutex
+	file      datasetFile
+	fw        source.ParquetFile
+	pw        *writer.ParquetWriter
+	stats     conversionStats
+	zips      map[string]bool
+	partition string
+}
+
+// estimatedSize approximates the size of the part file from the bytes flushed to disk plus those buffered.
+func (p *parquetPart) estimatedSize() int64 {
+	return p.pw.Offset + p.pw.Size + p.pw.ObjsSize
+}
+
+// parquetDataset writes Hive-partitioned Parquet part files across all zips of a run.
+type parquetDataset struct {
+	mu       sync.Mutex
+	cfg      *config.Config
+	log      *zap.Logger
+	root     string
+	runID    string
+	columns  []string
+	schema   string
+	open     map[string]*parquetPart
+	sequence map[string]int
+	closed   []datasetFile
+	err      error // Invalid configuration, reported for every zip and by finish
+}
+
+var datasetOutput struct {
+	once    sync.Once
+	dataset *parquetDataset
+}
+
+func getParquetDataset(cfg *config.Config, log *zap.Logger) *parquetDataset {
+	datasetOutput.once.Do(func() {
+		columns := cfg.OutputConfig.ParquetPartitionBy
+		if len(columns) == 0 {
+			columns = []string{"doc_type", "year", "month"}
+		}
+		datasetOutput.dataset = &parquetDataset{
+			cfg:      cfg,
+			log:      log,
+			root:     cfg.OutputDir,
+			runID:    cfg.RunTime.Format("20060102T150405"),
+			columns:  columns,
+			schema:   parquetSchemaVersion(cfg),
+			open:     make(map[string]*parquetPart),
+			sequence: make(map[string]int),
+		}
+		for _, column := range columns {
+			if !isPartitionColumn(column) {
+				datasetOutput.dataset.err = fmt.Errorf("unknown partition column %q", column)
+				break
+			}
+		}
+	})
+	return datasetOutput.dataset
+}
+
+// partitionValue derives the value of a partition column from a document, returning "" when it has none.
+func partitionValue(doc *types.USPTGoDoc, column string) string {
+	date := doc.Patent.MetaDatePubl
+	switch column {
+	case "doc_type":
+		return strings.ToLower(doc.USPTGoMetadata.DocumentType)
+	case "year":
+		if len(date) >= 4 {
+			return date[:4]
+		}
+	case "month":
+		if len(date) >= 6 {
+			return date[4:6]
+		}
+	case "kind":
+		return doc.Patent.UsBibliographicData.PublicationReference.DocumentID.KindCode
+	case "country":
+		return doc.Patent.MetaCountry
+	}
+	return ""
+}
+
+// isPartitionColumn reports whether partitionValue derives the column.
+func isPartitionColumn(column string) bool {
+	switch column {
+	case "doc_type", "year", "month", "kind", "country":
+		return true
+	}
+	return false
+}
+
+// partitionValues derives the configured partition column values of a document. The columns are checked when
+// the dataset is created, so the default partition only stands for a document without the value.
+func (d *parquetDataset) partitionValues(doc *types.USPTGoDoc) map[string]string {
+	values := make(map[string]string, len(d.columns))
+	for _, column := range d.columns {
+		value := partitionValue(doc, column)
+		if value == "" {
+			value = hiveDefaultPartition
+		}
+		values[column] = value
+	}
+	return values
+}
+
+func (d *parquetDataset) partitionPath(values map[string]string) string {
+	parts := make([]string, len(d.columns))
+	for i, column := range d.columns {
+		parts[i] = column + "=" + values[column]
+	}
+	return strings.Join(parts, "/")
+}
+
+// part returns the open part file for a partition, opening a new one if required.
+func (d *parquetDataset) part(partition string, values map[string]string) (*parquetPart, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if p, ok := d.open[partition]; ok {
+		return p, nil
+	}
+
+	d.sequence[partition]++
+	relPath := fmt.Sprintf("%s/part-%s-%05d.parquet", partition, d.runID, d.sequence[partition])
+	fullPath := filepath.Join(d.root, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	fw, err := local.NewLocalFileWriter(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	pw, err := newParquetWriter(fw, d.cfg, d.schema)
+	if err != nil {
+		fw.Close()
+		return nil, err
+	}
+
+	p := &parquetPart{
+		file:      datasetFile{Path: relPath, Partition: values},
+		fw:        fw,
+		pw:        pw,
+		stats:     conversionStats{},
+		zips:      make(map[string]bool),
+		partition: partition,
+	}
+	d.open[partition] = p
+	return p, nil
+}
+
+// write appends a row to the partition of the document, rolling to a new part file once the target size or maximum row count is reached.
+func (d *parquetDataset) write(doc *types.USPTGoDoc, row interface{}, stats conversionStats, originZipName string) error {
+	values := d.partitionValues(doc)
+	partition := d.partitionPath(values)
+
+	var p *parquetPart
+	for {
+		var err error
+		if p, err = d.part(partition, values); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		// The part may have been rolled by another zip between lookup and lock
+		if p.pw != nil {
+			break
+		}
+		p.mu.Unlock()
+	}
+	defer p.mu.Unlock()
+
+	if err := p.pw.Write(row); err != nil {
+		return err
+	}
+	p.file.Rows++
+	p.zips[originZipName] = true
+	for column, n := range stats {
+		p.stats[column] += n
+	}
+
+	targetBytes := int64(d.cfg.OutputConfig.ParquetTargetFileSizeMB) * 1024 * 1024
+	maxRows := int64(d.cfg.OutputConfig.ParquetMaxFileRows)
+	if (targetBytes > 0 && p.estimatedSize() >= targetBytes) || (maxRows > 0 && p.file.Rows >= maxRows) {
+		d.mu.Lock()
+		delete(d.open, partition)
+		d.mu.Unlock()
+		return d.closePart(p)
+	}
+	return nil
+}
+
+// closePart finalizes a part file and records it for the manifest. The caller must hold the part's lock.
+func (d *parquetDataset) closePart(p *parquetPart) error {
+	recordConversionStats(p.pw, p.stats, p.file.Path, d.log)
+	err := p.pw.WriteStop()
+	if closeErr := p.fw.Close(); err == nil {
+		err = closeErr
+	}
+	p.pw = nil
+
+	if info, statErr := os.Stat(filepath.Join(d.root, filepath.FromSlash(p.file.Path))); statErr == nil {
+		p.file.Bytes = info.Size()
+	}
+	for zip := range p.zips {
+		p.file.OriginZips = append(p.file.OriginZips, zip)
+	}
+	sort.Strings(p.file.OriginZips)
+
+	d.mu.Lock()
+	d.closed = append(d.closed, p.file)
+	d.mu.Unlock()
+
+	d.log.Debug("Closed dataset part file", zap.String("path", p.file.Path), zap.Int64("rows", p.file.Rows))
+	return err
+}
+
+// finish closes every open part file and writes the common metadata and the dataset manifest.
+func (d *parquetDataset) finish() error {
+	if d.err != nil {
+		return d.err
+	}
+
+	d.mu.Lock()
+	open := make([]*parquetPart, 0, len(d.open))
+	for _, p := range d.open {
+		open = append(open, p)
+	}
+	d.open = make(map[string]*parquetPart)
+	d.mu.Unlock()
+
+	var firstErr error
+	for _, p := range open {
+		p.mu.Lock()
+		if err := d.closePart(p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		p.mu.Unlock()
+	}
+
+	if err := d.writeCommonMetadata(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	// Merge with the manifest of earlier runs writing to the same dataset
+	manifestPath := filepath.Join(d.root, datasetManifestName)
+	manifest := datasetManifest{}
+	if existing, err := os.ReadFile(manifestPath); err == nil {
+		if err := json.Unmarshal(existing, &manifest); err != nil {
+			d.log.Warn("Ignoring unreadable dataset manifest", zap.String("path", manifestPath), zap.Error(err))
+			manifest = datasetManifest{}
+		}
+	}
+	manifest.SchemaVersion = d.schema
+	manifest.PartitionColumns = d.columns
+	manifest.Files = append(manifest.Files, d.closed...)
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// writeCommonMetadata writes the schema of the part files as a Parquet file without row groups.
+func (d *parquetDataset) writeCommonMetadata() error {
+	fw, err := local.NewLocalFileWriter(filepath.Join(d.root, datasetCommonMetadataName))
+	if err != nil {
+		return err
+	}
+	pw, err := newParquetWriter(fw, d.cfg, d.schema)
+	if err == nil {
+		err = pw.WriteStop()
+	}
+	if closeErr := fw.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WriteParquetDataset writes the documents of a single zip into the Hive-partitioned dataset shared by the run.
+func WriteParquetDataset(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteParquetDataset has been invoked", zap.String("OriginZipName", originZipName))
+
+	dataset := getParquetDataset(cfg, log)
+	if dataset.err != nil {
+		log.Error("Invalid Parquet dataset configuration", zap.Error(dataset.err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "parquet",
+			Whence:  "configuring the partition columns",
+			Err:     dataset.err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+
+	for doc := range inputChan {
+		stats := conversionStats{}
+		row := parquetRow(doc, dataset.schema, rowOptionsOf(cfg), stats, errorChan, log)
+
+		if err := dataset.write(doc, row, stats, originZipName); err != nil {
+			log.Error("Error writing document to parquet dataset", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    doc.Patent.MetaFileName,
+				Type:    "parquet",
+				Whence:  "writing the document to the dataset",
+				Err:     err,
+			}
+		}
+	}
+}
+
+func closeParquetDataset() error {
+	if datasetOutput.dataset == nil {
+		return nil
+	}
+	return datasetOutput.dataset.finish()
+}
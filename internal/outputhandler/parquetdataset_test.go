@@ -0,0 +1,97 @@
+package outputhandler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+func TestParquetDatasetCommonMetadata(t *testing.T) {
+	// The dataset is shared by the zips of a run, start from a fresh one
+	resetDatasetOutput := func() { datasetOutput.once, datasetOutput.dataset = sync.Once{}, nil }
+	resetDatasetOutput()
+	t.Cleanup(resetDatasetOutput)
+
+	cfg := &config.Config{OutputDir: t.TempDir(), RunTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	cfg.OutputConfig.ParquetSchema = "v1"
+	cfg.OutputConfig.ParquetCompression = "snappy"
+
+	if errs := runWriter(WriteParquetDataset, cfg, "ipg240102.zip", testDocs("grant", "US11000000-20240102.XML")); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if err := closeParquetDataset(); err != nil {
+		t.Fatal(err)
+	}
+
+	footer := func(path string) (int64, []string) {
+		t.Helper()
+		fr, err := local.NewLocalFileReader(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fr.Close()
+		pr, err := reader.NewParquetColumnReader(fr, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		defer pr.ReadStop()
+		var columns []string
+		for _, element := range pr.Footer.Schema {
+			columns = append(columns, element.Name)
+		}
+		return pr.GetNumRows(), columns
+	}
+
+	rows, columns := footer(filepath.Join(cfg.OutputDir, datasetCommonMetadataName))
+	if rows != 0 {
+		t.Errorf("%s has %d rows, want none", datasetCommonMetadataName, rows)
+	}
+	parts, err := filepath.Glob(filepath.Join(cfg.OutputDir, "doc_type=grant", "year=2024", "month=01", "part-*.parquet"))
+	if err != nil || len(parts) != 1 {
+		t.Fatalf("part files %v, %v, want one", parts, err)
+	}
+	partRows, partColumns := footer(parts[0])
+	if partRows != 1 {
+		t.Errorf("part file has %d rows, want 1", partRows)
+	}
+	if len(columns) != len(partColumns) {
+		t.Fatalf("%s has %d schema elements, the part file %d", datasetCommonMetadataName, len(columns), len(partColumns))
+	}
+	for i := range columns {
+		if columns[i] != partColumns[i] {
+			t.Errorf("schema element %d is %s, %s in the part file", i, columns[i], partColumns[i])
+		}
+	}
+}
+
+func TestParquetDatasetUnknownPartitionColumn(t *testing.T) {
+	resetDatasetOutput := func() { datasetOutput.once, datasetOutput.dataset = sync.Once{}, nil }
+	resetDatasetOutput()
+	t.Cleanup(resetDatasetOutput)
+
+	cfg := &config.Config{OutputDir: t.TempDir()}
+	cfg.OutputConfig.ParquetSchema = "v1"
+	cfg.OutputConfig.ParquetPartitionBy = []string{"doc_type", "yaer"}
+
+	errs := runWriter(WriteParquetDataset, cfg, "ipg240102.zip", testDocs("grant", "US11000000-20240102.XML"))
+	var uerr *types.USPTGoError
+	if len(errs) != 1 || !errors.As(errs[0], &uerr) || !uerr.Skipped || !strings.Contains(uerr.Err.Error(), `"yaer"`) {
+		t.Fatalf("errors reported: %v, want one skipping error for the unknown column", errs)
+	}
+	if err := closeParquetDataset(); err == nil {
+		t.Error("closing a dataset with an unknown partition column returned no error")
+	}
+	if entries, _ := os.ReadDir(cfg.OutputDir); len(entries) != 0 {
+		t.Errorf("dataset files written: %v", entries)
+	}
+}
@@ -0,0 +1,301 @@
+package outputhandler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diverged/uspt-go/types"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// Parquet schema versions, recorded in the key-value metadata of every file written.
+const (
+	parquetSchemaVersionKey = "uspto_bulk_data_tool.schema_version"
+	parquetSchemaV1         = "v1" // Flat ParquetPatentDocument
+	parquetSchemaV2         = "v2" // Nested ParquetPatentDocumentV2
+
+	parquetConversionFailuresKey = "uspto_bulk_data_tool.conversion_failures"
+)
+
+type ParquetParty struct {
+	Sequence  int32  `parquet:"name=sequence, type=INT32"`
+	Role      string `parquet:"name=role, type=BYTE_ARRAY, convertedtype=UTF8"`
+	OrgName   string `parquet:"name=org_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LastName  string `parquet:"name=last_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	FirstName string `parquet:"name=first_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	City      string `parquet:"name=city, type=BYTE_ARRAY, convertedtype=UTF8"`
+	State     string `parquet:"name=state, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Postcode  string `parquet:"name=postcode, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Country   string `parquet:"name=country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+type ParquetClassification struct {
+	Scheme   string `parquet:"name=scheme, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Symbol   string `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Main     bool   `parquet:"name=main, type=BOOLEAN"`
+	Section  string `parquet:"name=section, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Class    string `parquet:"name=class, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Subclass string `parquet:"name=subclass, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Group    string `parquet:"name=group, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Subgroup string `parquet:"name=subgroup, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Value    string `parquet:"name=value, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type ParquetCitation struct {
+	Sequence            int32  `parquet:"name=sequence, type=INT32"`
+	Patent              bool   `parquet:"name=patent, type=BOOLEAN"`
+	Country             string `parquet:"name=country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	DocNumber           string `parquet:"name=doc_number, type=BYTE_ARRAY, convertedtype=UTF8"`
+	DocNumberNormalized string `parquet:"name=doc_number_normalized, type=BYTE_ARRAY, convertedtype=UTF8"`
+	KindCode            string `parquet:"name=kind_code, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Name                string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Date                *int32 `parquet:"name=date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	Text                string `parquet:"name=text, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Category            string `parquet:"name=category, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+type ParquetPriorityClaim struct {
+	Sequence  int32  `parquet:"name=sequence, type=INT32"`
+	Kind      string `parquet:"name=kind, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Country   string `parquet:"name=country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	DocNumber string `parquet:"name=doc_number, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Date      *int32 `parquet:"name=date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+}
+
+type ParquetRelatedDocument struct {
+	Relation  string `parquet:"name=relation, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Status    string `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Country   string `parquet:"name=country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	DocNumber string `parquet:"name=doc_number, type=BYTE_ARRAY, convertedtype=UTF8"`
+	KindCode  string `parquet:"name=kind_code, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Date      *int32 `parquet:"name=date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+}
+
+type ParquetClaim struct {
+	Number      int32    `parquet:"name=number, type=INT32"`
+	ID          string   `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Independent bool     `parquet:"name=independent, type=BOOLEAN"`
+	DependsOn   []string `parquet:"name=depends_on, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Text        string   `parquet:"name=text, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// ParquetPatentDocumentV2 is the nested schema, extending the flat v1 fields with parties, classifications,
+// citations, priority claims, related documents and structured claims. Unlike v1, dates are DATE logical types
+// (null when a value fails conversion), low-cardinality codes are dictionary encoded, and document numbers
+// are also provided in the normalized form produced by patentxml.NormalizeDocNumber.
+type ParquetPatentDocumentV2 struct {
+
+	// Patent Metadata
+	MetaFileName       string `parquet:"name=document_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	MetaFileType       string `parquet:"name=document_type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	MetaDateProduced   *int32 `parquet:"name=date_produced, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	MetaDatePubl       *int32 `parquet:"name=date_publ, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	MetaCountry        string `parquet:"name=country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	MetaInventionTitle string `parquet:"name=invention_title, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	MetaNumberOfClaims int32  `parquet:"name=number_of_claims, type=INT32"`
+
+	// Invention Contents
+	Abstract    string `parquet:"name=abstract, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	Description string `parquet:"name=description, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+
+	// Description sections, empty unless descriptionsections is enabled
+	DescCrossReference       string `parquet:"name=desc_cross_reference, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	DescGovernmentInterest   string `parquet:"name=desc_government_interest, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	DescField                string `parquet:"name=desc_field, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	DescBackground           string `parquet:"name=desc_background, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	DescSummary              string `parquet:"name=desc_summary, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	DescDrawings             string `parquet:"name=desc_drawings, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	DescDetailedDescription  string `parquet:"name=desc_detailed_description, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	DescOther                string `parquet:"name=desc_other, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	DescSegmentation         string `parquet:"name=desc_segmentation, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	DescSegmentationFallback bool   `parquet:"name=desc_segmentation_fallback, type=BOOLEAN"`
+
+	// PublicationReference fields
+	PubRefCountry             string `parquet:"name=pub_ref_country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	PubRefDocNumber           string `parquet:"name=pub_ref_doc_number, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	PubRefDocNumberNormalized string `parquet:"name=pub_ref_doc_number_normalized, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	PubRefKindCode            string `parquet:"name=pub_ref_kind_code, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	PubRefDate                *int32 `parquet:"name=pub_ref_date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+
+	// ApplicationReference fields
+	AppRefCountry   string `parquet:"name=app_ref_country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	AppRefDocNumber string `parquet:"name=app_ref_doc_number, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	AppRefDate      *int32 `parquet:"name=app_ref_date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	AppRefType      string `parquet:"name=app_ref_type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+
+	// ClassificationNational fields
+	ClassNatCountry               string `parquet:"name=class_nat_country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	ClassNatMainClassification    string `parquet:"name=class_nat_main_classification, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+	ClassNatFurtherClassification string `parquet:"name=class_nat_further_classification, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
+
+	// Nested fields
+	Inventors        []ParquetParty           `parquet:"name=inventors, type=LIST"`
+	Applicants       []ParquetParty           `parquet:"name=applicants, type=LIST"`
+	Assignees        []ParquetParty           `parquet:"name=assignees, type=LIST"`
+	Classifications  []ParquetClassification  `parquet:"name=classifications, type=LIST"`
+	Citations        []ParquetCitation        `parquet:"name=citations, type=LIST"`
+	PriorityClaims   []ParquetPriorityClaim   `parquet:"name=priority_claims, type=LIST"`
+	RelatedDocuments []ParquetRelatedDocument `parquet:"name=related_documents, type=LIST"`
+	Claims           []ParquetClaim           `parquet:"name=claims, type=LIST"`
+}
+
+// conversionStats counts, per column, the non-empty values that could not be converted to their logical type.
+type conversionStats map[string]int
+
+// date converts a USPTO YYYYMMDD date to a Parquet DATE (days since the Unix epoch).
+func (c conversionStats) date(column, value string) *int32 {
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse("20060102", value)
+	if err != nil {
+		c[column]++
+		return nil
+	}
+	days := int32(t.Unix() / 86400)
+	return &days
+}
+
+// nestedDoc maps a parsed document onto the nested v2 schema. The bibliographic lists are read from the raw
+// split document; if it is unavailable or malformed, the flat fields are still returned along with the error.
+// Malformed claims keep the claims read before the error, and the error is returned with the filled row.
+func nestedDoc(doc *types.USPTGoDoc, rowOpts RowOptions, stats conversionStats) (ParquetPatentDocumentV2, error) {
+	flat := flattenDoc(doc, rowOpts.TextFormat)
+
+	nested := ParquetPatentDocumentV2{
+		MetaFileName:                  flat.MetaFileName,
+		MetaFileType:                  flat.MetaFileType,
+		MetaDateProduced:              stats.date("date_produced", flat.MetaDateProduced),
+		MetaDatePubl:                  stats.date("date_publ", flat.MetaDatePubl),
+		MetaCountry:                   flat.MetaCountry,
+		MetaInventionTitle:            flat.MetaInventionTitle,
+		MetaNumberOfClaims:            int32(flat.MetaNumberOfClaims),
+		Abstract:                      flat.Abstract,
+		Description:                   flat.Description,
+		PubRefCountry:                 flat.PubRefCountry,
+		PubRefDocNumber:               flat.PubRefDocNumber,
+		PubRefDocNumberNormalized:     patentxml.NormalizeDocNumber(flat.PubRefCountry, flat.PubRefDocNumber),
+		PubRefKindCode:                flat.PubRefKindCode,
+		PubRefDate:                    stats.date("pub_ref_date", flat.PubRefDate),
+		ClassNatCountry:               flat.ClassNatCountry,
+		ClassNatMainClassification:    flat.ClassNatMainClassification,
+		ClassNatFurtherClassification: flat.ClassNatFurtherClassification,
+	}
+
+	if rowOpts.DescriptionSections {
+		sections := describeSections(doc.Patent.Description.Content, rowOpts.TextFormat)
+		nested.DescCrossReference = sections.CrossReference
+		nested.DescGovernmentInterest = sections.GovernmentInterest
+		nested.DescField = sections.Field
+		nested.DescBackground = sections.Background
+		nested.DescSummary = sections.Summary
+		nested.DescDrawings = sections.Drawings
+		nested.DescDetailedDescription = sections.DetailedDescription
+		nested.DescOther = sections.Other
+		nested.DescSegmentation = sections.Confidence
+		nested.DescSegmentationFallback = sections.Fallback
+	}
+
+	// The claims read before a parse error are kept, and the bibliographic fields are filled regardless
+	var errs []error
+	claims, err := patentxml.ParseClaims(doc.Patent.Claims.Content)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("parsing claims: %w", err))
+	}
+	for _, c := range claims {
+		nested.Claims = append(nested.Claims, ParquetClaim{
+			Number:      int32(c.Number),
+			ID:          c.ID,
+			Independent: c.Independent(),
+			DependsOn:   c.DependsOn,
+			Text:        c.Text,
+		})
+	}
+
+	biblio, err := patentxml.ParseBibliographic(doc.RawSplitDoc)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("parsing bibliographic data: %w", err))
+		return nested, errors.Join(errs...)
+	}
+
+	nested.AppRefCountry = biblio.Application.Country
+	nested.AppRefDocNumber = biblio.Application.DocNumber
+	nested.AppRefDate = stats.date("app_ref_date", biblio.Application.Date)
+	nested.AppRefType = biblio.ApplicationType
+
+	nested.Inventors = parquetParties(biblio.Inventors)
+	nested.Applicants = parquetParties(biblio.Applicants)
+	nested.Assignees = parquetParties(biblio.Assignees)
+
+	for _, c := range biblio.Classifications {
+		nested.Classifications = append(nested.Classifications, ParquetClassification{
+			Scheme:   c.Scheme,
+			Symbol:   c.Symbol(),
+			Main:     c.Main,
+			Section:  c.Section,
+			Class:    c.Class,
+			Subclass: c.Subclass,
+			Group:    c.Group,
+			Subgroup: c.Subgroup,
+			Value:    c.Value,
+		})
+	}
+	for _, c := range biblio.Citations {
+		citation := ParquetCitation{
+			Sequence: int32(c.Sequence),
+			Patent:   c.Patent,
+			Text:     c.Text,
+			Category: c.Category,
+		}
+		if c.Patent {
+			citation.Country = c.Document.Country
+			citation.DocNumber = c.Document.DocNumber
+			citation.DocNumberNormalized = patentxml.NormalizeDocNumber(c.Document.Country, c.Document.DocNumber)
+			citation.KindCode = c.Document.Kind
+			citation.Name = c.Document.Name
+			citation.Date = stats.date("citations.date", c.Document.Date)
+		}
+		nested.Citations = append(nested.Citations, citation)
+	}
+	for _, p := range biblio.PriorityClaims {
+		nested.PriorityClaims = append(nested.PriorityClaims, ParquetPriorityClaim{
+			Sequence:  int32(p.Sequence),
+			Kind:      p.Kind,
+			Country:   p.Country,
+			DocNumber: p.DocNumber,
+			Date:      stats.date("priority_claims.date", p.Date),
+		})
+	}
+	for _, r := range biblio.RelatedDocuments {
+		nested.RelatedDocuments = append(nested.RelatedDocuments, ParquetRelatedDocument{
+			Relation:  r.Relation,
+			Status:    r.Status,
+			Country:   r.Document.Country,
+			DocNumber: r.Document.DocNumber,
+			KindCode:  r.Document.Kind,
+			Date:      stats.date("related_documents.date", r.Document.Date),
+		})
+	}
+
+	return nested, errors.Join(errs...)
+}
+
+func parquetParties(parties []patentxml.Party) []ParquetParty {
+	var out []ParquetParty
+	for _, p := range parties {
+		out = append(out, ParquetParty{
+			Sequence:  int32(p.Sequence),
+			Role:      p.Role,
+			OrgName:   p.OrgName,
+			LastName:  p.LastName,
+			FirstName: p.FirstName,
+			City:      p.Address.City,
+			State:     p.Address.State,
+			Postcode:  p.Address.Postcode,
+			Country:   p.Address.Country,
+		})
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package outputhandler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func TestNestedDoc(t *testing.T) {
+	doc := fixture.Doc(fixture.Grant)
+	nested, err := nestedDoc(doc, RowOptions{}, conversionStats{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nested.Claims) != 3 || nested.Claims[1].Independent || nested.Claims[1].DependsOn[0] != "CLM-00001" {
+		t.Errorf("claims = %+v", nested.Claims)
+	}
+	if len(nested.Inventors) != 2 || len(nested.Assignees) != 1 || len(nested.Classifications) != 3 ||
+		len(nested.Citations) != 3 || len(nested.PriorityClaims) != 1 || len(nested.RelatedDocuments) != 3 {
+		t.Errorf("bibliographic lists = %d inventors, %d assignees, %d classifications, %d citations, %d priority claims, %d related documents",
+			len(nested.Inventors), len(nested.Assignees), len(nested.Classifications), len(nested.Citations), len(nested.PriorityClaims), len(nested.RelatedDocuments))
+	}
+	if nested.PubRefDocNumberNormalized != "US11000000" || nested.Citations[0].DocNumberNormalized != "US5123456" {
+		t.Errorf("normalized numbers %q, %q", nested.PubRefDocNumberNormalized, nested.Citations[0].DocNumberNormalized)
+	}
+	if nested.PubRefDate == nil || epochDate(int64(*nested.PubRefDate)) != "2024-01-02" {
+		t.Errorf("pub_ref_date = %v", nested.PubRefDate)
+	}
+}
+
+func TestNestedDocMalformedClaims(t *testing.T) {
+	doc := fixture.Doc(fixture.Grant)
+	// Truncate the claims within the second claim
+	doc.Patent.Claims.Content = doc.Patent.Claims.Content[:strings.Index(doc.Patent.Claims.Content, "wherein")] + "<!-- unterminated"
+
+	nested, err := nestedDoc(doc, RowOptions{}, conversionStats{})
+	if err == nil || !strings.Contains(err.Error(), "parsing claims") {
+		t.Errorf("nestedDoc error = %v, want a claims error", err)
+	}
+	if len(nested.Claims) != 1 || nested.Claims[0].ID != "CLM-00001" {
+		t.Errorf("claims = %+v, want the claim read before the error", nested.Claims)
+	}
+	// The bibliographic fields are filled regardless
+	if len(nested.Inventors) != 2 || len(nested.Citations) != 3 || len(nested.Classifications) != 3 ||
+		len(nested.PriorityClaims) != 1 || len(nested.RelatedDocuments) != 3 || nested.AppRefDocNumber != "17123456" {
+		t.Errorf("bibliographic fields missing after a claims error: %+v", nested)
+	}
+
+	doc.RawSplitDoc = nil
+	if _, err := nestedDoc(doc, RowOptions{}, conversionStats{}); err == nil || !strings.Contains(err.Error(), "parsing claims") || !strings.Contains(err.Error(), "raw split document") {
+		t.Errorf("nestedDoc error = %v, want both the claims and the bibliographic error", err)
+	}
+}
@@ -1,11 +1,18 @@
 package outputhandler
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/layout"
 	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/schema"
+	"github.com/xitongsys/parquet-go/source"
 	"github.com/xitongsys/parquet-go/writer"
 
 	"go.uber.org/zap"
@@ -42,124 +49,450 @@ type ParquetPatentDocument struct {
 	ClassNatFurtherClassification string `parquet:"name=class_nat_further_classification, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN"`
 }
 
-func parquetConvert(parsedDocIn <-chan *types.USPTGoDoc, parquetDocChan chan<- ParquetPatentDocument, log *zap.Logger) {
+// convertedRow is a row of the Parquet schema along with the values that failed type conversion in it.
+type convertedRow struct {
+	row   interface{}
+	stats conversionStats
+}
 
-	log.Debug("ParquetConvert has been invoked")
+func parquetConvert(parsedDocIn <-chan *types.USPTGoDoc, parquetDocChan chan<- convertedRow, schemaVersion string, rowOpts RowOptions, errorChan chan<- error, log *zap.Logger) {
 
-	for doc := range parsedDocIn {
-		// Convert XMLPatentDocument to ParquetFile
-		mappedParquet := ParquetPatentDocument{
-
-			MetaFileName:       doc.Patent.MetaFileName,
-			MetaFileType:       doc.USPTGoMetadata.DocumentType,
-			MetaDateProduced:   doc.Patent.MetaDateProduced,
-			MetaDatePubl:       doc.Patent.MetaDatePubl,
-			MetaCountry:        doc.Patent.MetaCountry,
-			MetaInventionTitle: doc.Patent.UsBibliographicData.InventionTitle.Text,
-			MetaNumberOfClaims: doc.Patent.UsBibliographicData.NumberOfClaims,
-
-			// MainTextFields
-			Abstract:    doc.Patent.Abstract.Content,
-			Description: doc.Patent.Description.Content,
-			Claims:      doc.Patent.Claims.Content,
-
-			// Biblio Data
-			PubRefCountry:                 doc.Patent.UsBibliographicData.PublicationReference.DocumentID.Country,
-			PubRefDocNumber:               doc.Patent.UsBibliographicData.PublicationReference.DocumentID.DocNumber,
-			PubRefKindCode:                doc.Patent.UsBibliographicData.PublicationReference.DocumentID.KindCode,
-			PubRefDate:                    doc.Patent.UsBibliographicData.PublicationReference.DocumentID.Date,
-			ClassNatCountry:               doc.Patent.UsBibliographicData.ClassificationNational.Country,
-			ClassNatMainClassification:    doc.Patent.UsBibliographicData.ClassificationNational.MainClassification,
-			ClassNatFurtherClassification: doc.Patent.UsBibliographicData.ClassificationNational.FurtherClassification,
-		}
+	log.Debug("ParquetConvert has been invoked", zap.String("schemaVersion", schemaVersion))
 
+	for doc := range parsedDocIn {
 		// Send the ParquetFile to the parquetDocOut channel
-		parquetDocChan <- mappedParquet
+		stats := conversionStats{}
+		parquetDocChan <- convertedRow{row: parquetRow(doc, schemaVersion, rowOpts, stats, errorChan, log), stats: stats}
 		log.Debug("ParquetConvert: doc => parquetDocChan")
 
 	}
 }
 
-func WriteParquetFile(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
-
-	log.Debug("WriteParquetFile has been invoked", zap.String("OriginZipName", originZipName))
-
-	// Set output path and file name based on originating zip file name
-	outputFileName := strings.TrimSuffix(originZipName, ".zip") + ".parquet"
-	outputFilePath := filepath.Join(cfg.OutputDir, outputFileName)
+// parquetRow converts a document to a row of the given schema version, rendering its text fields as set by
+// rowOpts. Documents whose nested fields cannot be extracted are still returned with their flat fields.
+func parquetRow(doc *types.USPTGoDoc, schemaVersion string, rowOpts RowOptions, stats conversionStats, errorChan chan<- error, log *zap.Logger) interface{} {
+	if schemaVersion != parquetSchemaV2 {
+		return flattenDoc(doc, rowOpts.TextFormat)
+	}
 
-	// * Initialize LOCAL file writer
-	var err error
-	fw, err := local.NewLocalFileWriter(outputFilePath)
+	nested, err := nestedDoc(doc, rowOpts, stats)
 	if err != nil {
-		log.Error("Error initializing parquet file writer", zap.Error(err))
+		log.Warn("Incomplete nested fields for document", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
 		errorChan <- &types.USPTGoError{
-			Skipped: true,
-			Name:    outputFileName,
+			Skipped: false,
+			Name:    doc.Patent.MetaFileName,
 			Type:    "parquet",
-			Whence:  "initializing the local file writer",
+			Whence:  "extracting nested fields",
 			Err:     err,
 		}
+	}
+	return nested
+}
+
+// parquetSchemaVersion returns the configured schema version, defaulting to v1.
+func parquetSchemaVersion(cfg *config.Config) string {
+	return normalizeSchemaVersion(cfg.OutputConfig.ParquetSchema)
+}
+
+// normalizeSchemaVersion returns v2 if requested, and v1 otherwise.
+func normalizeSchemaVersion(schemaVersion string) string {
+	if schemaVersion == parquetSchemaV2 {
+		return parquetSchemaV2
+	}
+	return parquetSchemaV1
+}
+
+// parquetSchema returns the schema object passed to the Parquet writer for the configured schema version.
+func parquetSchema(schemaVersion string) interface{} {
+	if schemaVersion == parquetSchemaV2 {
+		return new(ParquetPatentDocumentV2)
+	}
+	return new(ParquetPatentDocument)
+}
+
+// flattenDoc maps a parsed document onto the flat ParquetPatentDocument field set shared by the tabular writers,
+// with the abstract, description and claims rendered in textFormat.
+func flattenDoc(doc *types.USPTGoDoc, textFormat string) ParquetPatentDocument {
+	return ParquetPatentDocument{
+
+		MetaFileName:       doc.Patent.MetaFileName,
+		MetaFileType:       doc.USPTGoMetadata.DocumentType,
+		MetaDateProduced:   doc.Patent.MetaDateProduced,
+		MetaDatePubl:       doc.Patent.MetaDatePubl,
+		MetaCountry:        doc.Patent.MetaCountry,
+		MetaInventionTitle: doc.Patent.UsBibliographicData.InventionTitle.Text,
+		MetaNumberOfClaims: doc.Patent.UsBibliographicData.NumberOfClaims,
+
+		// MainTextFields
+		Abstract:    renderText(doc.Patent.Abstract.Content, textFormat),
+		Description: renderText(doc.Patent.Description.Content, textFormat),
+		Claims:      renderText(doc.Patent.Claims.Content, textFormat),
+
+		// Biblio Data
+		PubRefCountry:                 doc.Patent.UsBibliographicData.PublicationReference.DocumentID.Country,
+		PubRefDocNumber:               doc.Patent.UsBibliographicData.PublicationReference.DocumentID.DocNumber,
+		PubRefKindCode:                doc.Patent.UsBibliographicData.PublicationReference.DocumentID.KindCode,
+		PubRefDate:                    doc.Patent.UsBibliographicData.PublicationReference.DocumentID.Date,
+		ClassNatCountry:               doc.Patent.UsBibliographicData.ClassificationNational.Country,
+		ClassNatMainClassification:    doc.Patent.UsBibliographicData.ClassificationNational.MainClassification,
+		ClassNatFurtherClassification: doc.Patent.UsBibliographicData.ClassificationNational.FurtherClassification,
+	}
+}
+
+// newParquetWriter initializes a Parquet writer for the schema version with the configured properties.
+func newParquetWriter(fw source.ParquetFile, cfg *config.Config, schemaVersion string) (*writer.ParquetWriter, error) {
+
+	parallelism := int64(cfg.OutputConfig.ParquetParallelism)
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	pw, err := writer.NewParquetWriter(fw, parquetSchema(schemaVersion), parallelism)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyColumnEncodings(pw, cfg.OutputConfig.ParquetColumnEncoding); err != nil {
+		return nil, err
+	}
+	if err := applyColumnCompression(pw, cfg.OutputConfig.ParquetColumnCompression); err != nil {
+		return nil, err
+	}
+
+	// Record the schema version so consumers can tell the flat and nested layouts apart
+	pw.Footer.KeyValueMetadata = append(pw.Footer.KeyValueMetadata, &parquet.KeyValue{
+		Key:   parquetSchemaVersionKey,
+		Value: &schemaVersion,
+	})
+
+	// Set Parquet writer properties as needed
+	if cfg.OutputConfig.ParquetRowGroupSizeMB > 0 {
+		pw.RowGroupSize = int64(cfg.OutputConfig.ParquetRowGroupSizeMB) * 1024 * 1024
+	}
+	if cfg.OutputConfig.ParquetPageSizeKB > 0 {
+		pw.PageSize = int64(cfg.OutputConfig.ParquetPageSizeKB) * 1024
+	}
+
+	setParquetCompression(pw, cfg.OutputConfig.ParquetCompression)
+
+	return pw, nil
+}
+
+// parquetCompressionCodecs maps the names in config.ParquetCompressionCodecs to codecs.
+var parquetCompressionCodecs = map[string]parquet.CompressionCodec{
+	"snappy":      parquet.CompressionCodec_SNAPPY,
+	"gzip":        parquet.CompressionCodec_GZIP,
+	"no-compress": parquet.CompressionCodec_UNCOMPRESSED,
+	"lz4":         parquet.CompressionCodec_LZ4,
+	"zstd":        parquet.CompressionCodec_ZSTD,
+}
+
+// setParquetCompression applies the configured parquetcompression codec. The name is validated when the
+// configuration is loaded; an empty name keeps the writer's default.
+func setParquetCompression(pw *writer.ParquetWriter, compression string) {
+	if codec, ok := parquetCompressionCodecs[compression]; ok {
+		pw.CompressionType = codec
+	}
+}
+
+// parquetEncodings are the encodings that may be configured per column, with the physical types they apply to.
+var parquetEncodings = map[string]struct {
+	encoding parquet.Encoding
+	types    []parquet.Type
+}{
+	"PLAIN":                   {parquet.Encoding_PLAIN, nil},
+	"PLAIN_DICTIONARY":        {parquet.Encoding_PLAIN_DICTIONARY, nil},
+	"DELTA_BINARY_PACKED":     {parquet.Encoding_DELTA_BINARY_PACKED, []parquet.Type{parquet.Type_INT32, parquet.Type_INT64}},
+	"DELTA_LENGTH_BYTE_ARRAY": {parquet.Encoding_DELTA_LENGTH_BYTE_ARRAY, []parquet.Type{parquet.Type_BYTE_ARRAY}},
+	"DELTA_BYTE_ARRAY":        {parquet.Encoding_DELTA_BYTE_ARRAY, []parquet.Type{parquet.Type_BYTE_ARRAY}},
+}
+
+// applyColumnEncodings overrides the encoding of the configured columns. Columns are named by their path
+// below the schema root, e.g. "description" or "inventors.list.element.last_name".
+func applyColumnEncodings(pw *writer.ParquetWriter, overrides map[string]string) error {
+	for column, name := range overrides {
+		enc, ok := parquetEncodings[strings.ToUpper(name)]
+		if !ok {
+			return fmt.Errorf("unsupported encoding %q for column %q", name, column)
+		}
+
+		inPaths := parquetColumnPaths(pw, column)
+		if len(inPaths) == 0 {
+			return fmt.Errorf("unknown column %q in parquetcolumnencoding", column)
+		}
+		for _, inPath := range inPaths {
+			index := pw.SchemaHandler.MapIndex[inPath]
+			if enc.types != nil && !containsType(enc.types, pw.SchemaHandler.SchemaElements[index].GetType()) {
+				return fmt.Errorf("encoding %s does not apply to column %q of type %s", strings.ToUpper(name), column, pw.SchemaHandler.SchemaElements[index].GetType())
+			}
+			pw.SchemaHandler.Infos[index].Encoding = enc.encoding
+		}
+	}
+	return nil
+}
+
+// applyColumnCompression overrides the codec of the configured columns, e.g. to compress the description more
+// heavily than the short columns. parquet-go compresses every page with the writer's codec, so the pages of
+// these columns are built in a wrapped MarshalFunc instead; the writer then encodes with a single goroutine to
+// keep them in row order. Dictionary-encoded columns are rejected, as their dictionary page always gets the
+// writer's codec.
+func applyColumnCompression(pw *writer.ParquetWriter, overrides map[string]string) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+
+	codecs := map[string]parquet.CompressionCodec{}
+	for column, name := range overrides {
+		codec, ok := parquetCompressionCodecs[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("unsupported compression %q for column %q", name, column)
+		}
+		inPaths := parquetColumnPaths(pw, column)
+		if len(inPaths) == 0 {
+			return fmt.Errorf("unknown column %q in parquetcolumncompression", column)
+		}
+		for _, inPath := range inPaths {
+			switch pw.SchemaHandler.Infos[pw.SchemaHandler.MapIndex[inPath]].Encoding {
+			case parquet.Encoding_PLAIN_DICTIONARY, parquet.Encoding_RLE_DICTIONARY:
+				return fmt.Errorf("column %q is dictionary encoded and cannot be compressed separately", column)
+			}
+			codecs[inPath] = codec
+		}
+	}
+
+	marshal := pw.MarshalFunc
+	pw.NP = 1
+	pw.MarshalFunc = func(src []interface{}, sh *schema.SchemaHandler) (*map[string]*layout.Table, error) {
+		tableMap, err := marshal(src, sh)
+		if err != nil {
+			return tableMap, err
+		}
+		for inPath, codec := range codecs {
+			table, ok := (*tableMap)[inPath]
+			if !ok {
+				continue
+			}
+			pages, _ := layout.TableToDataPages(table, int32(pw.PageSize), codec)
+			for _, page := range pages {
+				pw.Size += int64(len(page.RawData))
+				page.DataTable = nil
+			}
+			pw.PagesMapBuf[inPath] = append(pw.PagesMapBuf[inPath], pages...)
+			delete(*tableMap, inPath)
+		}
+		return tableMap, nil
+	}
+	return nil
+}
+
+// parquetColumnPaths returns the in-paths of the columns named by their path below the schema root, compared
+// case-insensitively.
+func parquetColumnPaths(pw *writer.ParquetWriter, column string) []string {
+	var inPaths []string
+	for _, inPath := range pw.SchemaHandler.ValueColumns {
+		exPath := strings.SplitN(pw.SchemaHandler.InPathToExPath[inPath], common.PAR_GO_PATH_DELIMITER, 2)
+		if len(exPath) == 2 && strings.EqualFold(strings.ReplaceAll(exPath[1], common.PAR_GO_PATH_DELIMITER, "."), column) {
+			inPaths = append(inPaths, inPath)
+		}
+	}
+	return inPaths
+}
+
+func containsType(types []parquet.Type, t parquet.Type) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+// recordConversionStats reports values that could not be converted to their logical type, which are written
+// as nulls, in the log and in the key-value metadata of the file. It must be called before WriteStop.
+func recordConversionStats(pw *writer.ParquetWriter, stats conversionStats, fileName string, log *zap.Logger) {
+	if len(stats) == 0 {
 		return
 	}
-	defer fw.Close()
+	log.Warn("Values failed Parquet type conversion", zap.String("file", fileName), zap.Any("failuresByColumn", map[string]int(stats)))
+	if statsJSON, err := json.Marshal(stats); err == nil {
+		failures := string(statsJSON)
+		pw.Footer.KeyValueMetadata = append(pw.Footer.KeyValueMetadata, &parquet.KeyValue{
+			Key:   parquetConversionFailuresKey,
+			Value: &failures,
+		})
+	}
+}
 
-	// * Initialize PARQUET writer
+// parquetRollingFile writes the documents of a zip file to one Parquet file, or to numbered part files
+// when a maximum file size or row count is configured.
+type parquetRollingFile struct {
+	cfg           *config.Config
+	schemaVersion string
+	dir           string
+	name          func(part int, rolling bool) string
+	rolling       bool
+	maxBytes      int64
+	maxRows       int64
+	part          int
+	fileName      string
+	fw            source.ParquetFile
+	pw            *writer.ParquetWriter
+	rows          int64
+	stats         conversionStats
+	closed        []rolledFile
+	log           *zap.Logger
+}
+
+// rolledFile is a file completed by a parquetRollingFile.
+type rolledFile struct {
+	Name string
+	Rows int64
+}
+
+func newParquetRollingFile(cfg *config.Config, schemaVersion string, originZipName string, log *zap.Logger) *parquetRollingFile {
+	baseName := strings.TrimSuffix(originZipName, ".zip")
+	return newParquetRollingFileIn(cfg, schemaVersion, cfg.OutputDir, func(part int, rolling bool) string {
+		if rolling {
+			return fmt.Sprintf("%s-part-%04d.parquet", baseName, part)
+		}
+		return baseName + ".parquet"
+	}, log)
+}
+
+// newParquetRollingFileIn creates a parquetRollingFile writing to dir, naming the files with name.
+func newParquetRollingFileIn(cfg *config.Config, schemaVersion string, dir string, name func(part int, rolling bool) string, log *zap.Logger) *parquetRollingFile {
+	maxBytes := int64(cfg.OutputConfig.ParquetMaxFileSizeMB) * 1024 * 1024
+	maxRows := int64(cfg.OutputConfig.ParquetMaxFileRows)
+	return &parquetRollingFile{
+		cfg:           cfg,
+		schemaVersion: schemaVersion,
+		dir:           dir,
+		name:          name,
+		rolling:       maxBytes > 0 || maxRows > 0,
+		maxBytes:      maxBytes,
+		maxRows:       maxRows,
+		log:           log,
+	}
+}
+
+// open starts the next output file. The Whence of a returned error describes the failed step.
+func (f *parquetRollingFile) open() (string, error) {
+	f.part++
+	f.fileName = f.name(f.part, f.rolling)
+	if err := os.MkdirAll(f.dir, os.ModePerm); err != nil {
+		return "creating the output directory", err
+	}
+
+	// * Initialize LOCAL file writer
+	fw, err := local.NewLocalFileWriter(filepath.Join(f.dir, f.fileName))
+	if err != nil {
+		return "initializing the local file writer", err
+	}
 
-	pw, err := writer.NewParquetWriter(fw, new(ParquetPatentDocument), 4) // Observe & experiment with the parallelism as needed
+	// * Initialize PARQUET writer
+	pw, err := newParquetWriter(fw, f.cfg, f.schemaVersion)
 	if err != nil {
-		log.Error("Error initializing parquet writer", zap.Error(err))
+		fw.Close()
+		return "initializing the Parquet writer", err
+	}
+
+	f.fw, f.pw, f.rows, f.stats = fw, pw, 0, conversionStats{}
+	return "", nil
+}
+
+// write appends a row, rolling over to a new part file once a threshold has been reached.
+func (f *parquetRollingFile) write(row convertedRow) (string, error) {
+	if f.pw == nil {
+		if whence, err := f.open(); err != nil {
+			return whence, err
+		}
+	}
+
+	if err := f.pw.Write(row.row); err != nil {
+		return "writing the document", err
+	}
+	f.rows++
+	for column, n := range row.stats {
+		f.stats[column] += n
+	}
+
+	if (f.maxRows > 0 && f.rows >= f.maxRows) || (f.maxBytes > 0 && f.pw.Offset+f.pw.Size+f.pw.ObjsSize >= f.maxBytes) {
+		return "finalizing the file", f.close()
+	}
+	return "", nil
+}
+
+// close finalizes the current file, if any.
+func (f *parquetRollingFile) close() error {
+	if f.pw == nil {
+		return nil
+	}
+	recordConversionStats(f.pw, f.stats, f.fileName, f.log)
+
+	// Finalize writing and close the file
+	err := f.pw.WriteStop()
+	if closeErr := f.fw.Close(); err == nil {
+		err = closeErr
+	}
+	f.fw, f.pw = nil, nil
+	f.closed = append(f.closed, rolledFile{Name: f.fileName, Rows: f.rows})
+	return err
+}
+
+func WriteParquetFile(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteParquetFile has been invoked", zap.String("OriginZipName", originZipName))
+
+	schemaVersion := parquetSchemaVersion(cfg)
+	out := newParquetRollingFile(cfg, schemaVersion, originZipName, log)
+
+	// Open the first file up front so that zip files without documents still produce output
+	if whence, err := out.open(); err != nil {
+		log.Error("Error initializing parquet writer", zap.String("file", out.fileName), zap.Error(err))
 		errorChan <- &types.USPTGoError{
 			Skipped: true,
-			Name:    outputFileName,
+			Name:    out.fileName,
 			Type:    "parquet",
-			Whence:  "initializing the Parquet writer",
+			Whence:  whence,
 			Err:     err,
 		}
+		for range inputChan {
+		}
 		return
 	}
-	defer pw.WriteStop()
 
-	// Set Parquet writer properties as needed
-	pw.RowGroupSize = 128 * 1024 * 1024 //128M
-	pw.PageSize = 8 * 1024              //8K
-
-	switch cfg.OutputConfig.ParquetCompression {
-	case "snappy":
-		pw.CompressionType = parquet.CompressionCodec_SNAPPY
-	case "gzip":
-		pw.CompressionType = parquet.CompressionCodec_GZIP
-	case "no-compress":
-		pw.CompressionType = parquet.CompressionCodec_UNCOMPRESSED
-	case "lz4":
-		pw.CompressionType = parquet.CompressionCodec_LZ4
-	case "zstd":
-		pw.CompressionType = parquet.CompressionCodec_ZSTD
-	}
-
-	// Convert incoming types.USPTGoDoc docs to ParquetPatentDocument
-	parquetDocChan := make(chan ParquetPatentDocument, 100) // ! Experiment with different sizes relative to NewParquetWriter's value ()
+	// Convert incoming types.USPTGoDoc docs to the Parquet schema
+	channelSize := cfg.OutputConfig.ParquetChannelSize
+	if channelSize < 0 {
+		channelSize = 0
+	}
+	parquetDocChan := make(chan convertedRow, channelSize)
 	go func() {
 		defer close(parquetDocChan)
-		parquetConvert(inputChan, parquetDocChan, log)
+		parquetConvert(inputChan, parquetDocChan, schemaVersion, rowOptionsOf(cfg), errorChan, log)
 	}()
 
-	// Range over the channel and write to the parquet file
+	// Range over the channel and write to the parquet file(s)
 	for doc := range parquetDocChan {
 
-		if err = pw.Write(doc); err != nil {
-			log.Error("Error writing document to parquet file", zap.Error(err))
-			errorChan <- err
+		if whence, err := out.write(doc); err != nil {
+			log.Error("Error writing document to parquet file", zap.String("file", out.fileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    out.fileName,
+				Type:    "parquet",
+				Whence:  whence,
+				Err:     err,
+			}
+			out.close()
+			for range parquetDocChan {
+			}
 			return
 		}
-		//log.Debug("Wrote doc to Parquet", zap.String("doc written", doc.Patent.MetaFileName), zap.String("to parquet file", outputFileName))
 	}
 
-	// Finalize writing and close the file outside the loop
-	if err = pw.WriteStop(); err != nil {
+	if err := out.close(); err != nil {
 		log.Error("Error finalizing parquet file", zap.Error(err))
 		errorChan <- err
 	}
-
-	fw.Close()
 }
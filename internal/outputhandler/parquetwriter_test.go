@@ -0,0 +1,221 @@
+package outputhandler
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go-source/writerfile"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// readParquetFile returns the footer and the rows of a Parquet file written with the v1 schema.
+func readParquetFile(t *testing.T, path string) (*parquet.FileMetaData, []ParquetPatentDocument) {
+	t.Helper()
+	fr, err := local.NewLocalFileReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, new(ParquetPatentDocument), 1)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	defer pr.ReadStop()
+	rows := make([]ParquetPatentDocument, pr.GetNumRows())
+	if err := pr.Read(&rows); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return pr.Footer, rows
+}
+
+// columnCodecs returns the codec of each column of the first row group. parquet-go records the paths of the
+// columns with the Go field names.
+func columnCodecs(footer *parquet.FileMetaData) map[string]parquet.CompressionCodec {
+	codecs := map[string]parquet.CompressionCodec{}
+	for _, column := range footer.RowGroups[0].Columns {
+		codecs[strings.Join(column.MetaData.PathInSchema, ".")] = column.MetaData.Codec
+	}
+	return codecs
+}
+
+func newTestParquetWriter(t *testing.T) *writer.ParquetWriter {
+	t.Helper()
+	pw, err := writer.NewParquetWriter(writerfile.NewWriterFile(&strings.Builder{}), parquetSchema("v1"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pw
+}
+
+func TestApplyColumnEncodings(t *testing.T) {
+	tests := []struct {
+		overrides map[string]string
+		column    string
+		want      parquet.Encoding
+		wantErr   string
+	}{
+		{map[string]string{"description": "delta_byte_array"}, "Description", parquet.Encoding_DELTA_BYTE_ARRAY, ""},
+		{map[string]string{"COUNTRY": "PLAIN_DICTIONARY"}, "MetaCountry", parquet.Encoding_PLAIN_DICTIONARY, ""},
+		{map[string]string{"number_of_claims": "DELTA_BINARY_PACKED"}, "MetaNumberOfClaims", parquet.Encoding_DELTA_BINARY_PACKED, ""},
+		{map[string]string{"number_of_claims": "DELTA_BYTE_ARRAY"}, "", 0, "does not apply"},
+		{map[string]string{"description": "RLE"}, "", 0, "unsupported encoding"},
+		{map[string]string{"descriptions": "PLAIN"}, "", 0, "unknown column"},
+	}
+	for _, tt := range tests {
+		pw := newTestParquetWriter(t)
+		err := applyColumnEncodings(pw, tt.overrides)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("applyColumnEncodings(%v) = %v, want an error containing %q", tt.overrides, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("applyColumnEncodings(%v) = %v", tt.overrides, err)
+			continue
+		}
+		inPath := "Parquet_go_root" + "\x01" + tt.column
+		if got := pw.SchemaHandler.Infos[pw.SchemaHandler.MapIndex[inPath]].Encoding; got != tt.want {
+			t.Errorf("applyColumnEncodings(%v): %s encoding is %s, want %s", tt.overrides, tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestApplyColumnCompression(t *testing.T) {
+	for _, name := range config.ParquetCompressionCodecs {
+		if _, ok := parquetCompressionCodecs[name]; !ok {
+			t.Errorf("compression %q is accepted by the configuration but has no codec", name)
+		}
+	}
+
+	for _, tt := range []struct {
+		overrides map[string]string
+		wantErr   string
+	}{
+		{map[string]string{"description": "brotli"}, "unsupported compression"},
+		{map[string]string{"descriptions": "gzip"}, "unknown column"},
+		{map[string]string{"document_type": "gzip"}, "dictionary encoded"},
+	} {
+		if err := applyColumnCompression(newTestParquetWriter(t), tt.overrides); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("applyColumnCompression(%v) = %v, want an error containing %q", tt.overrides, err, tt.wantErr)
+		}
+	}
+
+	cfg := &config.Config{OutputDir: t.TempDir()}
+	cfg.OutputConfig.ParquetCompression = "snappy"
+	cfg.OutputConfig.ParquetParallelism = 4
+	cfg.OutputConfig.ParquetColumnCompression = map[string]string{"description": "gzip", "claims": "zstd"}
+
+	out := newParquetRollingFile(cfg, "v1", "ipg240102.zip", zap.NewNop())
+	for i := 0; i < 50; i++ {
+		row := &ParquetPatentDocument{
+			MetaFileName: fmt.Sprintf("US%08d-20240102.XML", 11000000+i),
+			MetaFileType: "grant",
+			Description:  strings.Repeat(fmt.Sprintf("description %d ", i), 200),
+			Claims:       fmt.Sprintf("%d. A battery.", i+1),
+		}
+		if whence, err := out.write(convertedRow{row: row}); err != nil {
+			t.Fatalf("%s: %v", whence, err)
+		}
+	}
+	if err := out.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	footer, rows := readParquetFile(t, filepath.Join(cfg.OutputDir, "ipg240102.parquet"))
+	codecs := columnCodecs(footer)
+	for column, want := range map[string]parquet.CompressionCodec{
+		"Description":  parquet.CompressionCodec_GZIP,
+		"Claims":       parquet.CompressionCodec_ZSTD,
+		"Abstract":     parquet.CompressionCodec_SNAPPY,
+		"MetaFileType": parquet.CompressionCodec_SNAPPY,
+	} {
+		if codecs[column] != want {
+			t.Errorf("column %s is compressed with %s, want %s", column, codecs[column], want)
+		}
+	}
+	// The separately compressed pages stay aligned with the rows of the other columns
+	if len(rows) != 50 {
+		t.Fatalf("read %d rows, want 50", len(rows))
+	}
+	for i, row := range rows {
+		if !strings.HasPrefix(row.Description, fmt.Sprintf("description %d ", i)) || row.Claims != fmt.Sprintf("%d. A battery.", i+1) || row.MetaFileName != fmt.Sprintf("US%08d-20240102.XML", 11000000+i) {
+			t.Errorf("row %d = %s, %.20q, %q", i, row.MetaFileName, row.Description, row.Claims)
+		}
+	}
+}
+
+func TestParquetRollingFile(t *testing.T) {
+	// Random text does not compress, so the file size follows the description length. The page statistics hold
+	// the minimum and maximum description as well, so each row takes about four times its length.
+	rng := rand.New(rand.NewSource(1))
+	text := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = 'a' + byte(rng.Intn(26))
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		name        string
+		maxRows     int
+		maxSizeMB   int
+		rows        int
+		description int
+		wantFiles   []string
+		wantRows    []int64
+	}{
+		{"no limit", 0, 0, 5, 10, []string{"ipg240102.parquet"}, []int64{5}},
+		{"rows", 2, 0, 5, 10, []string{"ipg240102-part-0001.parquet", "ipg240102-part-0002.parquet", "ipg240102-part-0003.parquet"}, []int64{2, 2, 1}},
+		{"rows exactly", 5, 0, 5, 10, []string{"ipg240102-part-0001.parquet"}, []int64{5}},
+		{"size", 0, 1, 6, 100 * 1024, []string{"ipg240102-part-0001.parquet", "ipg240102-part-0002.parquet"}, nil},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{OutputDir: t.TempDir()}
+		cfg.OutputConfig.ParquetMaxFileRows = tt.maxRows
+		cfg.OutputConfig.ParquetMaxFileSizeMB = tt.maxSizeMB
+
+		out := newParquetRollingFile(cfg, "v1", "ipg240102.zip", zap.NewNop())
+		for i := 0; i < tt.rows; i++ {
+			row := &ParquetPatentDocument{MetaFileName: fmt.Sprintf("doc-%d", i), Description: text(tt.description)}
+			if whence, err := out.write(convertedRow{row: row}); err != nil {
+				t.Fatalf("%s: %s: %v", tt.name, whence, err)
+			}
+		}
+		if err := out.close(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var names []string
+		var total int
+		for i, file := range out.closed {
+			names = append(names, file.Name)
+			_, rows := readParquetFile(t, filepath.Join(cfg.OutputDir, file.Name))
+			if int64(len(rows)) != file.Rows {
+				t.Errorf("%s: %s has %d rows, recorded %d", tt.name, file.Name, len(rows), file.Rows)
+			}
+			if tt.wantRows != nil && file.Rows != tt.wantRows[i] {
+				t.Errorf("%s: %s has %d rows, want %d", tt.name, file.Name, file.Rows, tt.wantRows[i])
+			}
+			for j, row := range rows {
+				if row.MetaFileName != fmt.Sprintf("doc-%d", total+j) {
+					t.Errorf("%s: %s row %d is %s", tt.name, file.Name, j, row.MetaFileName)
+				}
+			}
+			total += len(rows)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(tt.wantFiles) || total != tt.rows {
+			t.Errorf("%s: files %v with %d rows, want %v with %d", tt.name, names, total, tt.wantFiles, tt.rows)
+		}
+	}
+}
@@ -0,0 +1,588 @@
+package outputhandler
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// The tables below follow the PatentsView bulk download layout, keyed by patent_id, the patent number without
+// country code or leading zeros (e.g. "11000000", "D912345", "RE49000"). Sequences count from 0 as in
+// PatentsView. Surrogate keys are derived from the data, so they are stable across runs: "<patent_id>-<sequence>"
+// for rows of a patent, and a hash of the normalized city, state and country for locations. Dates are YYYY-MM-DD.
+
+type PatentsViewPatent struct {
+	ID        string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Type      string `parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Number    string `parquet:"name=number, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Country   string `parquet:"name=country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Date      string `parquet:"name=date, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Abstract  string `parquet:"name=abstract, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Title     string `parquet:"name=title, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Kind      string `parquet:"name=kind, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	NumClaims int32  `parquet:"name=num_claims, type=INT32"`
+	Filename  string `parquet:"name=filename, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type PatentsViewApplication struct {
+	ID         string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"` // Normalized application number, e.g. "US17123456"
+	PatentID   string `parquet:"name=patent_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SeriesCode string `parquet:"name=series_code, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Number     string `parquet:"name=number, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Country    string `parquet:"name=country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Date       string `parquet:"name=date, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Type       string `parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+type PatentsViewInventor struct {
+	ID         string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PatentID   string `parquet:"name=patent_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LocationID string `parquet:"name=location_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	NameFirst  string `parquet:"name=name_first, type=BYTE_ARRAY, convertedtype=UTF8"`
+	NameLast   string `parquet:"name=name_last, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Sequence   int32  `parquet:"name=sequence, type=INT32"`
+}
+
+type PatentsViewAssignee struct {
+	ID           string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PatentID     string `parquet:"name=patent_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LocationID   string `parquet:"name=location_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Type         string `parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // USPTO assignee type code, e.g. "2" for a US company
+	NameFirst    string `parquet:"name=name_first, type=BYTE_ARRAY, convertedtype=UTF8"`
+	NameLast     string `parquet:"name=name_last, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Organization string `parquet:"name=organization, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Sequence     int32  `parquet:"name=sequence, type=INT32"`
+}
+
+type PatentsViewLocation struct {
+	ID      string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	City    string `parquet:"name=city, type=BYTE_ARRAY, convertedtype=UTF8"`
+	State   string `parquet:"name=state, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Country string `parquet:"name=country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+type PatentsViewCPC struct {
+	ID           string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PatentID     string `parquet:"name=patent_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SectionID    string `parquet:"name=section_id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`    // e.g. "H"
+	SubsectionID string `parquet:"name=subsection_id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // e.g. "H01"
+	GroupID      string `parquet:"name=group_id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`      // e.g. "H01M"
+	SubgroupID   string `parquet:"name=subgroup_id, type=BYTE_ARRAY, convertedtype=UTF8"`                              // e.g. "H01M10/052"
+	Category     string `parquet:"name=category, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`      // "inventive" or "additional"
+	Sequence     int32  `parquet:"name=sequence, type=INT32"`
+}
+
+type PatentsViewUSPC struct {
+	ID          string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PatentID    string `parquet:"name=patent_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	MainclassID string `parquet:"name=mainclass_id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // e.g. "429"
+	SubclassID  string `parquet:"name=subclass_id, type=BYTE_ARRAY, convertedtype=UTF8"`                             // e.g. "429/231.95"
+	Sequence    int32  `parquet:"name=sequence, type=INT32"`
+}
+
+type PatentsViewCitation struct {
+	ID         string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PatentID   string `parquet:"name=patent_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CitationID string `parquet:"name=citation_id, type=BYTE_ARRAY, convertedtype=UTF8"` // patent_id form for US documents, normalized number with country code otherwise
+	Date       string `parquet:"name=date, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Name       string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Kind       string `parquet:"name=kind, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Country    string `parquet:"name=country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Category   string `parquet:"name=category, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Sequence   int32  `parquet:"name=sequence, type=INT32"`
+}
+
+type PatentsViewClaim struct {
+	ID        string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PatentID  string `parquet:"name=patent_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Text      string `parquet:"name=text, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Dependent string `parquet:"name=dependent, type=BYTE_ARRAY, convertedtype=UTF8"` // Comma separated numbers of the claims referenced, empty for independent claims
+	Sequence  int32  `parquet:"name=sequence, type=INT32"`
+	Number    int32  `parquet:"name=number, type=INT32"`
+	Exemplary bool   `parquet:"name=exemplary, type=BOOLEAN"`
+}
+
+// patentsViewTables are the tables written, in order, with the row type of each.
+var patentsViewTables = []struct {
+	name string
+	row  interface{}
+}{
+	{"patent", new(PatentsViewPatent)},
+	{"application", new(PatentsViewApplication)},
+	{"inventor", new(PatentsViewInventor)},
+	{"assignee", new(PatentsViewAssignee)},
+	{"location", new(PatentsViewLocation)},
+	{"cpc_current", new(PatentsViewCPC)},
+	{"uspc", new(PatentsViewUSPC)},
+	{"citation", new(PatentsViewCitation)},
+	{"claims", new(PatentsViewClaim)},
+}
+
+// patentsViewRows are the rows of a single patent, keyed by table name.
+type patentsViewRows map[string][]interface{}
+
+// patentsViewID formats a document number as a PatentsView patent_id, dropping the country code of US documents.
+func patentsViewID(country, docNumber string) string {
+	id := patentxml.NormalizeDocNumber(country, docNumber)
+	if rest, ok := strings.CutPrefix(id, "US"); ok && (country == "" || strings.EqualFold(strings.TrimSpace(country), "US")) {
+		return rest
+	}
+	return id
+}
+
+// patentsViewType maps the application type of a grant to the PatentsView patent type.
+func patentsViewType(applicationType string) string {
+	return strings.ReplaceAll(applicationType, "-", " ")
+}
+
+// patentsViewLocation returns the row of a party's address, or nil if the address is empty.
+func patentsViewLocation(address patentxml.Address) *PatentsViewLocation {
+	city, state, country := patentxml.NormalizeSpace(address.City), strings.TrimSpace(address.State), strings.TrimSpace(address.Country)
+	if city == "" && state == "" && country == "" {
+		return nil
+	}
+	key := strings.ToLower(city + "|" + state + "|" + country)
+	sum := sha1.Sum([]byte(key))
+	return &PatentsViewLocation{ID: hex.EncodeToString(sum[:8]), City: city, State: state, Country: country}
+}
+
+// uspcSymbol splits a USPC classification as written in the bulk data, a three character class followed by the
+// subclass, into PatentsView main class and subclass ids: "429231951" is "429" and "429/231.951", and
+// "D11143" is "D11" and "D11/143".
+func uspcSymbol(value string) (mainclass, subclass string) {
+	value = strings.TrimSpace(value)
+	if len(value) <= 3 {
+		return value, ""
+	}
+	mainclass = strings.TrimSpace(value[:3])
+	// Subclasses are three digits followed by an optional decimal part
+	whole, decimal := strings.TrimSpace(value[3:]), ""
+	if len(whole) > 3 && isDigitsOnly(whole[:3]) {
+		whole, decimal = whole[:3], whole[3:]
+	}
+	if whole = strings.TrimLeft(whole, "0"); decimal != "" {
+		whole += "." + decimal
+	}
+	return mainclass, mainclass + "/" + whole
+}
+
+func isDigitsOnly(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// patentsViewDoc maps a grant onto the rows of the PatentsView tables. If its claims are malformed, the rows
+// are returned with the claims read before the error, along with the error.
+func patentsViewDoc(doc *types.USPTGoDoc) (patentsViewRows, error) {
+	biblio, err := patentxml.ParseBibliographic(doc.RawSplitDoc)
+	if err != nil {
+		return nil, fmt.Errorf("parsing bibliographic data: %w", err)
+	}
+	claims, claimsErr := patentxml.ParseClaims(doc.Patent.Claims.Content)
+	if claimsErr != nil {
+		claimsErr = fmt.Errorf("parsing claims: %w", claimsErr)
+	}
+
+	pub := biblio.Publication
+	patentID := patentsViewID(pub.Country, pub.DocNumber)
+	if patentID == "" {
+		return nil, fmt.Errorf("no publication number")
+	}
+	key := func(sequence int) string { return patentID + "-" + strconv.Itoa(sequence) }
+	rows := patentsViewRows{}
+	add := func(table string, row interface{}) { rows[table] = append(rows[table], row) }
+
+	add("patent", &PatentsViewPatent{
+		ID:        patentID,
+		Type:      patentsViewType(biblio.ApplicationType),
+		Number:    patentID,
+		Country:   pub.Country,
+		Date:      formatXMLDate(pub.Date),
+		Abstract:  patentxml.PlainText(doc.Patent.Abstract.Content),
+		Title:     patentxml.NormalizeSpace(doc.Patent.UsBibliographicData.InventionTitle.Text),
+		Kind:      pub.Kind,
+		NumClaims: int32(doc.Patent.UsBibliographicData.NumberOfClaims),
+		Filename:  doc.Patent.MetaFileName,
+	})
+
+	app := biblio.Application
+	if app.DocNumber != "" {
+		add("application", &PatentsViewApplication{
+			ID:         patentxml.NormalizeDocNumber(app.Country, app.DocNumber),
+			PatentID:   patentID,
+			SeriesCode: biblio.SeriesCode,
+			Number:     app.DocNumber,
+			Country:    app.Country,
+			Date:       formatXMLDate(app.Date),
+			Type:       biblio.ApplicationType,
+		})
+	}
+
+	locationID := func(address patentxml.Address) string {
+		location := patentsViewLocation(address)
+		if location == nil {
+			return ""
+		}
+		add("location", location)
+		return location.ID
+	}
+	for i, p := range biblio.Inventors {
+		add("inventor", &PatentsViewInventor{
+			ID:         key(i),
+			PatentID:   patentID,
+			LocationID: locationID(p.Address),
+			NameFirst:  p.FirstName,
+			NameLast:   p.LastName,
+			Sequence:   int32(i),
+		})
+	}
+	for i, p := range biblio.Assignees {
+		add("assignee", &PatentsViewAssignee{
+			ID:           key(i),
+			PatentID:     patentID,
+			LocationID:   locationID(p.Address),
+			Type:         strings.TrimLeft(p.Role, "0"),
+			NameFirst:    p.FirstName,
+			NameLast:     p.LastName,
+			Organization: p.OrgName,
+			Sequence:     int32(i),
+		})
+	}
+
+	sequence := 0
+	for _, c := range biblio.Classifications {
+		if c.Scheme != "cpc" {
+			continue
+		}
+		category := "additional"
+		if c.Value == "I" {
+			category = "inventive"
+		}
+		add("cpc_current", &PatentsViewCPC{
+			ID:           key(sequence),
+			PatentID:     patentID,
+			SectionID:    c.Section,
+			SubsectionID: c.Section + c.Class,
+			GroupID:      c.Section + c.Class + c.Subclass,
+			SubgroupID:   c.Section + c.Class + c.Subclass + strings.TrimSpace(c.Group) + "/" + c.Subgroup,
+			Category:     category,
+			Sequence:     int32(sequence),
+		})
+		sequence++
+	}
+
+	national := doc.Patent.UsBibliographicData.ClassificationNational
+	sequence = 0
+	for _, value := range []string{national.MainClassification, national.FurtherClassification} {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		mainclass, subclass := uspcSymbol(value)
+		add("uspc", &PatentsViewUSPC{ID: key(sequence), PatentID: patentID, MainclassID: mainclass, SubclassID: subclass, Sequence: int32(sequence)})
+		sequence++
+	}
+
+	sequence = 0
+	for _, c := range biblio.Citations {
+		if !c.Patent {
+			continue
+		}
+		add("citation", &PatentsViewCitation{
+			ID:         key(sequence),
+			PatentID:   patentID,
+			CitationID: patentsViewID(c.Document.Country, c.Document.DocNumber),
+			Date:       formatXMLDate(c.Document.Date),
+			Name:       c.Document.Name,
+			Kind:       c.Document.Kind,
+			Country:    c.Document.Country,
+			Category:   c.Category,
+			Sequence:   int32(sequence),
+		})
+		sequence++
+	}
+
+	exemplary := map[int]bool{}
+	for _, n := range biblio.ExemplaryClaims {
+		exemplary[n] = true
+	}
+	numbers := map[string]int{}
+	for i, c := range claims {
+		number := c.Number
+		if number == 0 {
+			number = i + 1
+		}
+		numbers[c.ID] = number
+		var dependent []string
+		for _, ref := range c.DependsOn {
+			if n, ok := numbers[ref]; ok {
+				dependent = append(dependent, strconv.Itoa(n))
+			}
+		}
+		add("claims", &PatentsViewClaim{
+			ID:        key(i),
+			PatentID:  patentID,
+			Text:      c.Text,
+			Dependent: strings.Join(dependent, ","),
+			Sequence:  int32(i),
+			Number:    int32(number),
+			Exemplary: exemplary[number],
+		})
+	}
+
+	return rows, claimsErr
+}
+
+// patentsViewTable is an open table file, written as TSV or Parquet.
+type patentsViewTable struct {
+	fields  []int // Indexes of the struct fields, in column order
+	fw      source.ParquetFile
+	pw      *writer.ParquetWriter
+	tsvFile *os.File
+	tsv     *bufio.Writer
+}
+
+// patentsViewColumns returns the column names of a row type, taken from its parquet tags.
+func patentsViewColumns(rowType reflect.Type) []string {
+	columns := make([]string, rowType.NumField())
+	for i := range columns {
+		tag := rowType.Field(i).Tag.Get("parquet")
+		name, _, _ := strings.Cut(strings.TrimPrefix(tag, "name="), ",")
+		columns[i] = name
+	}
+	return columns
+}
+
+func (t *patentsViewTable) write(row interface{}) error {
+	if t.pw != nil {
+		return t.pw.Write(row)
+	}
+	v := reflect.ValueOf(row).Elem()
+	record := make([]string, v.NumField())
+	for i := range record {
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Int32:
+			record[i] = strconv.FormatInt(field.Int(), 10)
+		case reflect.Bool:
+			record[i] = "0"
+			if field.Bool() {
+				record[i] = "1"
+			}
+		default:
+			record[i] = field.String()
+		}
+	}
+	return writeCSVRecord(t.tsv, record, '\t', false)
+}
+
+func (t *patentsViewTable) close() error {
+	if t.pw != nil {
+		if err := t.pw.WriteStop(); err != nil {
+			t.fw.Close()
+			return err
+		}
+		return t.fw.Close()
+	}
+	if err := t.tsv.Flush(); err != nil {
+		t.tsvFile.Close()
+		return err
+	}
+	return t.tsvFile.Close()
+}
+
+// patentsViewFiles holds the tables shared by every zip processed in a run. They are opened on first use
+// and closed by Finalize.
+type patentsViewFiles struct {
+	once sync.Once
+	err  error
+
+	mu        sync.Mutex
+	log       *zap.Logger
+	tables    map[string]*patentsViewTable
+	locations map[string]bool // Ids of the locations written
+	skipped   int             // Documents other than grants
+}
+
+var patentsViewOutput patentsViewFiles
+
+func (p *patentsViewFiles) open(cfg *config.Config, log *zap.Logger) error {
+	p.once.Do(func() {
+		outCfg := cfg.OutputConfig
+		format := outCfg.PatentsViewFormat
+		if format == "" {
+			format = "tsv"
+		}
+		if format != "tsv" && format != "parquet" {
+			p.err = fmt.Errorf("unsupported patentsviewformat %q, expected tsv or parquet", format)
+			return
+		}
+		dir := filepath.Join(cfg.OutputDir, outCfg.PatentsViewDirectory)
+		if p.err = os.MkdirAll(dir, os.ModePerm); p.err != nil {
+			return
+		}
+		log.Info("Opening PatentsView tables", zap.String("directory", dir), zap.String("format", format))
+
+		p.log = log
+		p.tables = make(map[string]*patentsViewTable, len(patentsViewTables))
+		p.locations = make(map[string]bool)
+		parallelism := int64(max(outCfg.ParquetParallelism, 1))
+		for _, spec := range patentsViewTables {
+			table := &patentsViewTable{}
+			path := filepath.Join(dir, spec.name+"."+format)
+			if format == "parquet" {
+				if table.fw, p.err = local.NewLocalFileWriter(path); p.err != nil {
+					return
+				}
+				if table.pw, p.err = writer.NewParquetWriter(table.fw, spec.row, parallelism); p.err != nil {
+					table.fw.Close()
+					return
+				}
+				setParquetCompression(table.pw, outCfg.ParquetCompression)
+			} else {
+				if table.tsvFile, p.err = os.Create(path); p.err != nil {
+					return
+				}
+				table.tsv = bufio.NewWriter(table.tsvFile)
+				if p.err = writeCSVRecord(table.tsv, patentsViewColumns(reflect.TypeOf(spec.row).Elem()), '\t', false); p.err != nil {
+					return
+				}
+			}
+			p.tables[spec.name] = table
+		}
+	})
+	return p.err
+}
+
+// write appends the rows of a patent to the tables, writing each location once per run.
+func (p *patentsViewFiles) write(rows patentsViewRows) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, spec := range patentsViewTables {
+		table := p.tables[spec.name]
+		for _, row := range rows[spec.name] {
+			if location, ok := row.(*PatentsViewLocation); ok {
+				if p.locations[location.ID] {
+					continue
+				}
+				p.locations[location.ID] = true
+			}
+			if err := table.write(row); err != nil {
+				return fmt.Errorf("writing table %s: %w", spec.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *patentsViewFiles) skip() {
+	p.mu.Lock()
+	p.skipped++
+	p.mu.Unlock()
+}
+
+func (p *patentsViewFiles) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.skipped > 0 {
+		p.log.Info("Documents other than grants were not written to the PatentsView tables", zap.Int("skipped", p.skipped))
+	}
+	var firstErr error
+	for _, spec := range patentsViewTables {
+		table, ok := p.tables[spec.name]
+		if !ok {
+			continue
+		}
+		if err := table.close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("closing table %s: %w", spec.name, err)
+		}
+	}
+	p.tables = nil
+	return firstErr
+}
+
+// WritePatentsView appends the grants of a single zip to the run's PatentsView-style tables. Pre-grant
+// publications, which PatentsView publishes as a separate set of tables, are skipped.
+func WritePatentsView(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WritePatentsView has been invoked", zap.String("OriginZipName", originZipName))
+
+	if err := patentsViewOutput.open(cfg, log); err != nil {
+		log.Error("Error opening PatentsView tables", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "patentsview",
+			Whence:  "opening the PatentsView tables",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+
+	for doc := range inputChan {
+		if !strings.EqualFold(doc.USPTGoMetadata.DocumentType, "grant") {
+			log.Debug("Skipping document other than a grant", zap.String("filename", doc.Patent.MetaFileName))
+			patentsViewOutput.skip()
+			continue
+		}
+		rows, err := patentsViewDoc(doc)
+		if rows == nil {
+			log.Warn("Skipping document", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    doc.Patent.MetaFileName,
+				Type:    "patentsview",
+				Whence:  "mapping the document to PatentsView tables",
+				Err:     err,
+			}
+			continue
+		}
+		if err != nil {
+			// The claims read before the error are written with the other tables
+			log.Warn("Writing document with incomplete claims", zap.String("filename", doc.Patent.MetaFileName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: false,
+				Name:    doc.Patent.MetaFileName,
+				Type:    "patentsview",
+				Whence:  "parsing the claims",
+				Err:     err,
+			}
+		}
+		if err := patentsViewOutput.write(rows); err != nil {
+			log.Error("Error writing PatentsView tables", zap.String("OriginZipName", originZipName), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    originZipName,
+				Type:    "patentsview",
+				Whence:  "writing the PatentsView tables",
+				Err:     err,
+			}
+			for range inputChan {
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package outputhandler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+func TestUSPCSymbol(t *testing.T) {
+	tests := []struct {
+		value     string
+		mainclass string
+		subclass  string
+	}{
+		{"429231951", "429", "429/231.951"},
+		{"429231", "429", "429/231"},
+		{"429 12", "429", "429/12"},
+		{"429012", "429", "429/12"},
+		{"D11143", "D11", "D11/143"},
+		{"PLT263", "PLT", "PLT/263"},
+		{" 71 11", "71", "71/11"},
+		{"  429231951 ", "429", "429/231.951"},
+		{"429", "429", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		mainclass, subclass := uspcSymbol(tt.value)
+		if mainclass != tt.mainclass || subclass != tt.subclass {
+			t.Errorf("uspcSymbol(%q) = %q, %q, want %q, %q", tt.value, mainclass, subclass, tt.mainclass, tt.subclass)
+		}
+	}
+}
+
+func TestPatentsViewID(t *testing.T) {
+	tests := []struct {
+		country   string
+		docNumber string
+		want      string
+	}{
+		{"US", "11000000", "11000000"},
+		{"US", "05123456", "5123456"},
+		{"", "11000000", "11000000"},
+		{"us", "US5123456", "5123456"},
+		{"US", "D0912345", "D912345"},
+		{"US", "RE049000", "RE49000"},
+		{"US", "PP034000", "PP34000"},
+		{"US", "H0002345", "H2345"},
+		{"US", "20150012345", "20150012345"},
+		{"US", "2015/0012345", "20150012345"},
+		{"JP", "2020-012345", "JP2020012345"},
+		{"EP", "1234567", "EP1234567"},
+		{"DE", "US1234567", "DEUS1234567"},
+		{"US", "", ""},
+	}
+	for _, tt := range tests {
+		if got := patentsViewID(tt.country, tt.docNumber); got != tt.want {
+			t.Errorf("patentsViewID(%q, %q) = %q, want %q", tt.country, tt.docNumber, got, tt.want)
+		}
+	}
+}
+
+func TestPatentsViewLocation(t *testing.T) {
+	tests := []struct {
+		address patentxml.Address
+		wantID  string
+	}{
+		// The ids are derived from the address alone, so they must not change between runs or releases
+		{patentxml.Address{City: "Osaka", Country: "JP"}, "1cf8b65cbf721cc2"},
+		{patentxml.Address{City: " OSAKA ", Country: "jp "}, "1cf8b65cbf721cc2"},
+		{patentxml.Address{City: "Austin", State: "TX", Country: "US"}, "9ec004b7c4941c8f"},
+		{patentxml.Address{City: "Austin", State: "TX", Country: "US", Postcode: "78701"}, "9ec004b7c4941c8f"},
+	}
+	for _, tt := range tests {
+		location := patentsViewLocation(tt.address)
+		if location == nil {
+			t.Fatalf("patentsViewLocation(%+v) = nil", tt.address)
+		}
+		if location.ID != tt.wantID {
+			t.Errorf("patentsViewLocation(%+v).ID = %s, want %s", tt.address, location.ID, tt.wantID)
+		}
+	}
+	if a, b := patentsViewLocation(patentxml.Address{City: "New\n  York", State: "NY"}), patentsViewLocation(patentxml.Address{City: "New York", State: "NY"}); a.ID != b.ID || a.City != "New York" {
+		t.Errorf("whitespace in the city changes the location: %+v, %+v", a, b)
+	}
+	if a, b := patentsViewLocation(patentxml.Address{City: "Portland", State: "OR"}), patentsViewLocation(patentxml.Address{City: "Portland", State: "ME"}); a.ID == b.ID {
+		t.Errorf("different states share location %s", a.ID)
+	}
+	if location := patentsViewLocation(patentxml.Address{Postcode: "78701"}); location != nil {
+		t.Errorf("empty address has location %+v", location)
+	}
+}
+
+func TestPatentsViewDoc(t *testing.T) {
+	rows, err := patentsViewDoc(fixture.Doc(fixture.Grant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for table, tableRows := range rows {
+		counts[table] = len(tableRows)
+	}
+	want := map[string]int{"patent": 1, "application": 1, "inventor": 2, "assignee": 1, "location": 3, "cpc_current": 2, "citation": 2, "claims": 3}
+	for _, spec := range patentsViewTables {
+		if counts[spec.name] != want[spec.name] {
+			t.Errorf("table %s has %d rows, want %d", spec.name, counts[spec.name], want[spec.name])
+		}
+	}
+
+	patent := rows["patent"][0].(*PatentsViewPatent)
+	if patent.ID != "11000000" || patent.Date != "2024-01-02" || patent.Type != "utility" || patent.NumClaims != 3 || patent.Title != "Solid electrolyte battery & method" {
+		t.Errorf("patent = %+v", patent)
+	}
+	if citation := rows["citation"][1].(*PatentsViewCitation); citation.CitationID != "20150012345" || citation.Sequence != 1 || citation.ID != "11000000-1" {
+		t.Errorf("citation = %+v", citation)
+	}
+	if claim := rows["claims"][1].(*PatentsViewClaim); claim.Dependent != "1" || claim.Number != 2 || claim.Exemplary {
+		t.Errorf("dependent claim = %+v", claim)
+	}
+	if claim := rows["claims"][0].(*PatentsViewClaim); !claim.Exemplary {
+		t.Errorf("exemplary claim = %+v", claim)
+	}
+}
+
+func TestPatentsViewDocMalformedClaims(t *testing.T) {
+	doc := fixture.Doc(fixture.Grant)
+	doc.Patent.Claims.Content = doc.Patent.Claims.Content[:strings.Index(doc.Patent.Claims.Content, "wherein")] + "<!-- unterminated"
+
+	rows, err := patentsViewDoc(doc)
+	if err == nil || !strings.Contains(err.Error(), "parsing claims") {
+		t.Errorf("patentsViewDoc error = %v, want a claims error", err)
+	}
+	if rows == nil {
+		t.Fatal("no rows for a patent with malformed claims")
+	}
+	// The other tables are written in full, the claims up to the error
+	for table, want := range map[string]int{"patent": 1, "inventor": 2, "assignee": 1, "citation": 2, "claims": 1} {
+		if len(rows[table]) != want {
+			t.Errorf("table %s has %d rows, want %d", table, len(rows[table]), want)
+		}
+	}
+
+	doc.RawSplitDoc = nil
+	if rows, err := patentsViewDoc(doc); rows != nil || err == nil {
+		t.Errorf("patentsViewDoc without bibliographic data = %v, %v, want no rows and an error", rows, err)
+	}
+}
@@ -0,0 +1,172 @@
+package outputhandler
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/rdf"
+)
+
+// rdfVocabularyName is the Turtle description of the patent vocabulary, written to the output directory once
+// per run so that it can be loaded alongside the data.
+const rdfVocabularyName = "vocab.ttl"
+
+// rdfExtensions are the file extensions of the RDF formats.
+var rdfExtensions = map[string]string{
+	"ntriples": ".nt",
+	"jsonld":   ".jsonld",
+}
+
+var rdfVocabularyOutput struct {
+	once sync.Once
+	err  error
+}
+
+// writeRDFVocabulary writes the vocabulary file to the output directory, once per run.
+func writeRDFVocabulary(outputDir string) error {
+	rdfVocabularyOutput.once.Do(func() {
+		rdfVocabularyOutput.err = os.WriteFile(filepath.Join(outputDir, rdfVocabularyName), rdf.Vocabulary, 0644)
+	})
+	return rdfVocabularyOutput.err
+}
+
+// rdfBaseIRI validates the configured base IRI, adding a trailing slash unless it ends with "/" or "#". url.Parse
+// accepts characters that are not allowed in an IRI, such as spaces and angle brackets, so these are rejected first.
+func rdfBaseIRI(base string) (string, error) {
+	if base == "" {
+		base = "https://example.org/uspto/"
+	}
+	if i := strings.IndexFunc(base, rdf.InvalidIRIChar); i >= 0 {
+		return "", fmt.Errorf("invalid rdfbaseiri %q: character %q is not allowed in an IRI", base, base[i])
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid rdfbaseiri %q: %w", base, err)
+	}
+	if !u.IsAbs() {
+		return "", fmt.Errorf("invalid rdfbaseiri %q: not an absolute IRI", base)
+	}
+	if !strings.HasSuffix(base, "/") && !strings.HasSuffix(base, "#") {
+		base += "/"
+	}
+	return base, nil
+}
+
+// WriteRDFFile writes the documents of a single zip as an RDF graph, in N-Triples or JSON-LD, using schema.org
+// and the patent vocabulary.
+func WriteRDFFile(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteRDFFile has been invoked", zap.String("OriginZipName", originZipName))
+
+	format := cfg.OutputConfig.RDFFormat
+	if format == "" {
+		format = "ntriples"
+	}
+	extension, ok := rdfExtensions[format]
+	base, err := rdfBaseIRI(cfg.OutputConfig.RDFBaseIRI)
+	if !ok {
+		err = fmt.Errorf("unknown rdfformat %q", format)
+	}
+	if err != nil {
+		log.Error("Invalid RDF output configuration", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "rdf",
+			Whence:  "reading the configuration",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+	iris := rdf.IRIs{Base: base}
+
+	if err := writeRDFVocabulary(cfg.OutputDir); err != nil {
+		log.Error("Error writing RDF vocabulary", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: false,
+			Name:    rdfVocabularyName,
+			Type:    "rdf",
+			Whence:  "writing the vocabulary file",
+			Err:     err,
+		}
+	}
+
+	outputFileName := strings.TrimSuffix(originZipName, ".zip") + extension
+	file, err := os.Create(filepath.Join(cfg.OutputDir, outputFileName))
+	if err != nil {
+		log.Error("Error creating RDF file", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    "rdf",
+			Whence:  "creating the output file",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	writeGraph := func(g *rdf.Graph) error { return g.WriteNTriples(w) }
+	var jsonld *rdf.JSONLDWriter
+	if format == "jsonld" {
+		jsonld, err = rdf.NewJSONLDWriter(w)
+		writeGraph = jsonld.WriteGraph
+	}
+
+	for doc := range inputChan {
+		if err != nil {
+			break
+		}
+		g, descErr := rdf.Describe(rdf.Input{
+			Raw:            doc.RawSplitDoc,
+			DocumentType:   doc.USPTGoMetadata.DocumentType,
+			Title:          doc.Patent.UsBibliographicData.InventionTitle.Text,
+			Abstract:       doc.Patent.Abstract.Content,
+			NumberOfClaims: doc.Patent.UsBibliographicData.NumberOfClaims,
+		}, iris)
+		if descErr != nil {
+			log.Warn("Skipping document", zap.String("filename", doc.Patent.MetaFileName), zap.Error(descErr))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    doc.Patent.MetaFileName,
+				Type:    "rdf",
+				Whence:  "describing the document",
+				Err:     descErr,
+			}
+			continue
+		}
+		err = writeGraph(g)
+	}
+	if err == nil && jsonld != nil {
+		err = jsonld.Close()
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Error("Error writing RDF file", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    outputFileName,
+			Type:    "rdf",
+			Whence:  "writing the output file",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package outputhandler
+
+import "testing"
+
+func TestRDFBaseIRI(t *testing.T) {
+	tests := []struct {
+		base    string
+		want    string
+		wantErr bool
+	}{
+		{"", "https://example.org/uspto/", false},
+		{"https://data.example.com/patents", "https://data.example.com/patents/", false},
+		{"https://data.example.com/patents/", "https://data.example.com/patents/", false},
+		{"https://data.example.com/patents#", "https://data.example.com/patents#", false},
+		{"/patents/", "", true},
+		{"https://data.example.com/my patents/", "", true},
+		{"https://data.example.com/<patents>/", "", true},
+		{"https://data.example.com/{patents}/", "", true},
+		{"https://data.example.com/pat\"ents/", "", true},
+		{"https://data.example.com/pat\tents/", "", true},
+		{"https://data.example.com/pat|ents/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := rdfBaseIRI(tt.base)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("rdfBaseIRI(%q) error = %v, want error %v", tt.base, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("rdfBaseIRI(%q) = %q, want %q", tt.base, got, tt.want)
+		}
+	}
+}
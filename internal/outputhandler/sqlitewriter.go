@@ -0,0 +1,289 @@
+package outputhandler
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver, registered as "sqlite"
+
+	"github.com/diverged/uspt-go/types"
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS documents (
+	id               INTEGER PRIMARY KEY,
+	file_name        TEXT NOT NULL UNIQUE,
+	document_type    TEXT,
+	doc_number       TEXT,
+	kind_code        TEXT,
+	country          TEXT,
+	pub_date         TEXT,
+	date_produced    TEXT,
+	title            TEXT,
+	number_of_claims INTEGER,
+	abstract         TEXT,
+	description      TEXT,
+	origin_zip       TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_documents_doc_number ON documents (doc_number);
+CREATE INDEX IF NOT EXISTS idx_documents_pub_date ON documents (pub_date);
+
+CREATE TABLE IF NOT EXISTS publication_references (
+	document_id INTEGER NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+	country     TEXT,
+	doc_number  TEXT,
+	kind_code   TEXT,
+	date        TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_publication_references_document ON publication_references (document_id);
+CREATE INDEX IF NOT EXISTS idx_publication_references_doc_number ON publication_references (doc_number);
+CREATE INDEX IF NOT EXISTS idx_publication_references_date ON publication_references (date);
+
+CREATE TABLE IF NOT EXISTS classifications (
+	document_id            INTEGER NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+	scheme                 TEXT NOT NULL,
+	country                TEXT,
+	main_classification    TEXT,
+	further_classification TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_classifications_document ON classifications (document_id);
+CREATE INDEX IF NOT EXISTS idx_classifications_main ON classifications (main_classification);
+
+CREATE TABLE IF NOT EXISTS claims (
+	document_id  INTEGER NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+	claim_id     TEXT NOT NULL,
+	claim_number INTEGER,
+	independent  INTEGER NOT NULL,
+	text         TEXT,
+	PRIMARY KEY (document_id, claim_id)
+);
+
+CREATE TABLE IF NOT EXISTS claim_references (
+	document_id  INTEGER NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+	claim_id     TEXT NOT NULL,
+	ref_claim_id TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_claim_references_document ON claim_references (document_id);
+`
+
+// sharedSQLiteDB is a database shared by every zip processed in a run. It is opened on first use and closed by Finalize.
+type sharedSQLiteDB struct {
+	once sync.Once
+	db   *sql.DB
+	err  error
+}
+
+var sqliteOutput sharedSQLiteDB
+
+func (s *sharedSQLiteDB) open(dbPath, schema string, log *zap.Logger) (*sql.DB, error) {
+	s.once.Do(func() {
+		log.Info("Opening SQLite database", zap.String("path", dbPath))
+
+		dsn := "file:" + dbPath + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)"
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			s.err = err
+			return
+		}
+		// A single connection serializes writers from concurrently processed zips
+		db.SetMaxOpenConns(1)
+
+		if _, err := db.Exec(schema); err != nil {
+			db.Close()
+			s.err = fmt.Errorf("creating sqlite schema: %w", err)
+			return
+		}
+		s.db = db
+	})
+	return s.db, s.err
+}
+
+func (s *sharedSQLiteDB) close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// WriteSQLite inserts the documents of a single zip into the shared SQLite database in batched transactions.
+func WriteSQLite(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteSQLite has been invoked", zap.String("OriginZipName", originZipName))
+
+	db, err := sqliteOutput.open(filepath.Join(cfg.OutputDir, cfg.OutputConfig.SQLiteFileName), sqliteSchema, log)
+	if err != nil {
+		log.Error("Error opening SQLite database", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: true,
+			Name:    originZipName,
+			Type:    "sqlite",
+			Whence:  "opening the SQLite database",
+			Err:     err,
+		}
+		for range inputChan {
+		}
+		return
+	}
+
+	batchSize := cfg.OutputConfig.SQLiteBatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	batch := make([]*types.USPTGoDoc, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := insertSQLiteBatch(db, originZipName, batch, errorChan, log); err != nil {
+			log.Error("Error inserting batch into SQLite database", zap.Int("documents", len(batch)), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    originZipName,
+				Type:    "sqlite",
+				Whence:  fmt.Sprintf("inserting a batch of %d documents", len(batch)),
+				Err:     err,
+			}
+		}
+		batch = batch[:0]
+	}
+
+	for doc := range inputChan {
+		batch = append(batch, doc)
+		if len(batch) >= batchSize {
+			flush()
+		}
+	}
+	flush()
+}
+
+// insertSQLiteBatch inserts a batch of documents in a single transaction. A document that fails to insert is
+// rolled back to its savepoint and reported as skipped, without affecting the rest of the batch; a document
+// whose claims fail to parse is inserted without claims and reported as not skipped.
+func insertSQLiteBatch(db *sql.DB, originZipName string, batch []*types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stmts := map[string]string{
+		"delete":   `DELETE FROM documents WHERE file_name = ?`,
+		"document": `INSERT INTO documents (file_name, document_type, doc_number, kind_code, country, pub_date, date_produced, title, number_of_claims, abstract, description, origin_zip) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		"pubref":   `INSERT INTO publication_references (document_id, country, doc_number, kind_code, date) VALUES (?, ?, ?, ?, ?)`,
+		"class":    `INSERT INTO classifications (document_id, scheme, country, main_classification, further_classification) VALUES (?, ?, ?, ?, ?)`,
+		"claim":    `INSERT OR REPLACE INTO claims (document_id, claim_id, claim_number, independent, text) VALUES (?, ?, ?, ?, ?)`,
+		"claimref": `INSERT INTO claim_references (document_id, claim_id, ref_claim_id) VALUES (?, ?, ?)`,
+	}
+	prepared := make(map[string]*sql.Stmt, len(stmts))
+	for name, query := range stmts {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		prepared[name] = stmt
+	}
+
+	for _, doc := range batch {
+		claims, claimsErr := patentxml.ParseClaims(doc.Patent.Claims.Content)
+		if claimsErr != nil {
+			log.Warn("Inserting document without claims", zap.String("filename", doc.Patent.MetaFileName), zap.Error(claimsErr))
+			errorChan <- &types.USPTGoError{
+				Skipped: false,
+				Name:    doc.Patent.MetaFileName,
+				Type:    "sqlite",
+				Whence:  "parsing the claims",
+				Err:     claimsErr,
+			}
+			claims = nil
+		}
+
+		if _, err = tx.Exec(`SAVEPOINT document`); err != nil {
+			return err
+		}
+		if docErr := insertSQLiteDocument(prepared, originZipName, doc, claims); docErr != nil {
+			log.Error("Error inserting document into SQLite database", zap.String("filename", doc.Patent.MetaFileName), zap.Error(docErr))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    doc.Patent.MetaFileName,
+				Type:    "sqlite",
+				Whence:  "inserting the document",
+				Err:     docErr,
+			}
+			if _, err = tx.Exec(`ROLLBACK TO document`); err != nil {
+				return err
+			}
+		}
+		if _, err = tx.Exec(`RELEASE document`); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertSQLiteDocument inserts a document with its claims, replacing any earlier copy.
+func insertSQLiteDocument(prepared map[string]*sql.Stmt, originZipName string, doc *types.USPTGoDoc, claims []patentxml.Claim) error {
+	biblio := doc.Patent.UsBibliographicData
+	pubRef := biblio.PublicationReference.DocumentID
+
+	// Re-processing a zip replaces its documents rather than duplicating them
+	if _, err := prepared["delete"].Exec(doc.Patent.MetaFileName); err != nil {
+		return err
+	}
+
+	res, err := prepared["document"].Exec(
+		doc.Patent.MetaFileName,
+		doc.USPTGoMetadata.DocumentType,
+		pubRef.DocNumber,
+		pubRef.KindCode,
+		doc.Patent.MetaCountry,
+		doc.Patent.MetaDatePubl,
+		doc.Patent.MetaDateProduced,
+		biblio.InventionTitle.Text,
+		biblio.NumberOfClaims,
+		doc.Patent.Abstract.Content,
+		doc.Patent.Description.Content,
+		originZipName,
+	)
+	if err != nil {
+		return err
+	}
+	docID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if _, err = prepared["pubref"].Exec(docID, pubRef.Country, pubRef.DocNumber, pubRef.KindCode, pubRef.Date); err != nil {
+		return err
+	}
+
+	national := biblio.ClassificationNational
+	if national.MainClassification != "" {
+		if _, err = prepared["class"].Exec(docID, "national", national.Country, national.MainClassification, national.FurtherClassification); err != nil {
+			return err
+		}
+	}
+
+	for _, claim := range claims {
+		if _, err = prepared["claim"].Exec(docID, claim.ID, claim.Number, claim.Independent(), claim.Text); err != nil {
+			return err
+		}
+		for _, ref := range claim.DependsOn {
+			if _, err = prepared["claimref"].Exec(docID, claim.ID, ref); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
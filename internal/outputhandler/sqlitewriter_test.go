@@ -0,0 +1,104 @@
+package outputhandler
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+)
+
+func openTestSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "patents.db")+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testSQLiteDoc(name, claims string) *types.USPTGoDoc {
+	doc := &types.USPTGoDoc{}
+	doc.Patent.MetaFileName = name
+	doc.Patent.Claims.Content = claims
+	doc.USPTGoMetadata.DocumentType = "grant"
+	return doc
+}
+
+const testClaims = `<claim id="CLM-00001" num="00001"><claim-text>1. A battery.</claim-text></claim>` +
+	`<claim id="CLM-00002" num="00002"><claim-text>2. The battery of <claim-ref idref="CLM-00001">claim 1</claim-ref>.</claim-text></claim>`
+
+func TestInsertSQLiteBatchIsolatesDocuments(t *testing.T) {
+	db := openTestSQLite(t)
+	// Reject one document at insertion, as a constraint violation would
+	if _, err := db.Exec(`CREATE TRIGGER reject BEFORE INSERT ON documents WHEN NEW.file_name = 'rejected.XML'
+		BEGIN SELECT RAISE(ABORT, 'document rejected'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := []*types.USPTGoDoc{
+		testSQLiteDoc("first.XML", testClaims),
+		testSQLiteDoc("malformed.XML", `<claim id="CLM-00001" num="00001"><claim-text>1. A battery.</claim-text></claim><!-- unterminated`),
+		testSQLiteDoc("rejected.XML", testClaims),
+		testSQLiteDoc("last.XML", testClaims),
+	}
+	errorChan := make(chan error, 10)
+	if err := insertSQLiteBatch(db, "ipg240102.zip", batch, errorChan, zap.NewNop()); err != nil {
+		t.Fatalf("insertSQLiteBatch: %v", err)
+	}
+	close(errorChan)
+
+	reported := map[string]bool{} // File name to Skipped
+	for err := range errorChan {
+		var uerr *types.USPTGoError
+		if !errors.As(err, &uerr) {
+			t.Fatalf("error %v is not a USPTGoError", err)
+		}
+		reported[uerr.Name] = uerr.Skipped
+	}
+	if skipped, ok := reported["malformed.XML"]; !ok || skipped {
+		t.Errorf("malformed claims reported %v, skipped %v, want a non-skipping error", ok, skipped)
+	}
+	if skipped, ok := reported["rejected.XML"]; !ok || !skipped {
+		t.Errorf("rejected document reported %v, skipped %v, want a skipping error", ok, skipped)
+	}
+	if len(reported) != 2 {
+		t.Errorf("errors reported for %v", reported)
+	}
+
+	claimCounts := map[string]int{}
+	rows, err := db.Query(`SELECT d.file_name, COUNT(c.claim_id) FROM documents d LEFT JOIN claims c ON c.document_id = d.id GROUP BY d.file_name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			t.Fatal(err)
+		}
+		claimCounts[name] = count
+	}
+	want := map[string]int{"first.XML": 2, "malformed.XML": 0, "last.XML": 2}
+	if len(claimCounts) != len(want) {
+		t.Errorf("documents with claim counts %v, want %v", claimCounts, want)
+	}
+	for name, count := range want {
+		if got, ok := claimCounts[name]; !ok || got != count {
+			t.Errorf("%s has %d claims (present %v), want %d", name, got, ok, count)
+		}
+	}
+
+	var refs int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM claim_references`).Scan(&refs); err != nil || refs != 2 {
+		t.Errorf("claim_references has %d rows (%v), want 2", refs, err)
+	}
+}
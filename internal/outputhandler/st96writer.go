@@ -0,0 +1,139 @@
+package outputhandler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/st96"
+)
+
+// st96Report summarizes the conversion of a zip file: the number of documents written and the source elements
+// that were not mapped to ST.96.
+type st96Report struct {
+	Zip       string         `json:"zip"`
+	Documents int            `json:"documents"`
+	Unmapped  []st96Unmapped `json:"unmapped"`
+}
+
+type st96Unmapped struct {
+	Path        string `json:"path"` // Element path below the document element, e.g. "us-bibliographic-data-grant/us-parties/agents"
+	Occurrences int    `json:"occurrences"`
+	Documents   int    `json:"documents"`
+}
+
+// WriteST96Files converts each document of a single zip to an ST.96 XML file and writes a report of the unmapped
+// elements for the zip. The files are not validated against the WIPO ST.96 XSDs; use an XSD processor such as
+// xmllint --schema for that.
+func WriteST96Files(cfg *config.Config, originZipName string, inputChan <-chan *types.USPTGoDoc, errorChan chan<- error, log *zap.Logger) {
+
+	log.Debug("WriteST96Files has been invoked", zap.String("OriginZipName", originZipName))
+
+	reportName := strings.TrimSuffix(originZipName, ".zip") + ".st96report.json"
+	report := st96Report{
+		Zip:      originZipName,
+		Unmapped: []st96Unmapped{},
+	}
+	unmapped := map[string]*st96Unmapped{}
+
+	for doc := range inputChan {
+		filename := doc.Patent.MetaFileName
+		if filename == "" {
+			log.Error("Document does not have a file name in its metadata")
+			continue
+		}
+		outputFileName := strings.TrimSuffix(strings.TrimSuffix(filename, ".XML"), ".xml") + ".st96.xml"
+
+		pub, err := st96.Convert(st96.Input{
+			Raw:      doc.RawSplitDoc,
+			Title:    doc.Patent.UsBibliographicData.InventionTitle.Text,
+			Abstract: doc.Patent.Abstract.Content,
+			Claims:   doc.Patent.Claims.Content,
+		})
+		if pub == nil {
+			log.Warn("Skipping document", zap.String("filename", filename), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    filename,
+				Type:    "st96",
+				Whence:  "converting the document",
+				Err:     err,
+			}
+			continue
+		}
+		if err != nil {
+			// The claims read before the error are kept
+			errorChan <- &types.USPTGoError{
+				Skipped: false,
+				Name:    filename,
+				Type:    "st96",
+				Whence:  "converting the claims",
+				Err:     err,
+			}
+		}
+
+		data, err := st96.Marshal(pub)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(cfg.OutputDir, outputFileName), data, 0644)
+		}
+		if err != nil {
+			log.Error("Failed to write ST.96 document", zap.String("filename", filename), zap.Error(err))
+			errorChan <- &types.USPTGoError{
+				Skipped: true,
+				Name:    filename,
+				Type:    "st96",
+				Whence:  "writing the output file",
+				Err:     err,
+			}
+			continue
+		}
+
+		report.Documents++
+
+		paths, err := st96.Unmapped(doc.RawSplitDoc)
+		if err != nil {
+			log.Warn("Incomplete unmapped element report for document", zap.String("filename", filename), zap.Error(err))
+		}
+		for path, count := range paths {
+			entry, ok := unmapped[path]
+			if !ok {
+				entry = &st96Unmapped{Path: path}
+				unmapped[path] = entry
+			}
+			entry.Occurrences += count
+			entry.Documents++
+		}
+	}
+
+	for _, entry := range unmapped {
+		report.Unmapped = append(report.Unmapped, *entry)
+	}
+	sort.Slice(report.Unmapped, func(i, j int) bool {
+		a, b := report.Unmapped[i], report.Unmapped[j]
+		if a.Documents != b.Documents {
+			return a.Documents > b.Documents
+		}
+		return a.Path < b.Path
+	})
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(cfg.OutputDir, reportName), data, 0644)
+	}
+	if err != nil {
+		log.Error("Error writing ST.96 report", zap.Error(err))
+		errorChan <- &types.USPTGoError{
+			Skipped: false,
+			Name:    reportName,
+			Type:    "st96",
+			Whence:  "writing the report",
+			Err:     err,
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package outputhandler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+)
+
+// tableType is a column type of the Parquet schemas, described independently of the table formats
+// (Delta Lake, Iceberg) that publish them.
+type tableType struct {
+	Primitive string       // "string", "int", "long", "boolean" or "date", empty for lists and structs
+	Element   *tableType   // Element type of a list
+	Fields    []tableField // Fields of a struct
+}
+
+type tableField struct {
+	Name     string
+	Type     tableType
+	Optional bool  // Only nullable at the Parquet level, i.e. pointer fields
+	index    []int // Index of the Go struct field
+}
+
+// tableSchemaOf reflects over the parquet tags of a row struct, such as ParquetPatentDocument.
+func tableSchemaOf(t reflect.Type) []tableField {
+	fields := make([]tableField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tags := map[string]string{}
+		for _, part := range strings.Split(sf.Tag.Get("parquet"), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			tags[key] = value
+		}
+		if tags["name"] == "" {
+			continue
+		}
+		fields = append(fields, tableField{
+			Name:     tags["name"],
+			Type:     tableTypeOf(sf.Type, tags),
+			Optional: sf.Type.Kind() == reflect.Ptr,
+			index:    sf.Index,
+		})
+	}
+	return fields
+}
+
+func tableTypeOf(t reflect.Type, tags map[string]string) tableType {
+	if tags["convertedtype"] == "DATE" {
+		return tableType{Primitive: "date"}
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		element := t.Elem()
+		if element.Kind() == reflect.Struct {
+			return tableType{Element: &tableType{Fields: tableSchemaOf(element)}}
+		}
+		return tableType{Element: &tableType{Primitive: primitiveOf(element)}}
+	case reflect.Struct:
+		return tableType{Fields: tableSchemaOf(t)}
+	}
+	return tableType{Primitive: primitiveOf(t)}
+}
+
+func primitiveOf(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int32:
+		return "int"
+	case reflect.Int, reflect.Int64:
+		return "long"
+	}
+	return "string"
+}
+
+// columnStats tracks the row count, minimum, maximum and null count of the top-level primitive columns
+// of the rows written to a data file, as recorded by the table formats to allow file skipping.
+type columnStats struct {
+	fields []tableField
+	rows   int64
+	min    map[string]interface{}
+	max    map[string]interface{}
+	nulls  map[string]int64
+}
+
+// maxStatsStringLength is the number of characters of a string kept in min/max statistics. Longer values,
+// such as the text fields, are truncated as Delta Lake writers do: the minimum to its prefix, and the maximum
+// to its prefix followed by statsMaxCharacter so that it remains an upper bound.
+const maxStatsStringLength = 32
+
+const statsMaxCharacter = "\U0010FFFF"
+
+func newColumnStats(fields []tableField) *columnStats {
+	return &columnStats{
+		fields: fields,
+		min:    map[string]interface{}{},
+		max:    map[string]interface{}{},
+		nulls:  map[string]int64{},
+	}
+}
+
+func (s *columnStats) add(row interface{}) {
+	s.rows++
+	v := reflect.ValueOf(row)
+	for _, field := range s.fields {
+		if field.Type.Primitive == "" {
+			continue
+		}
+		fv := v.FieldByIndex(field.index)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				s.nulls[field.Name]++
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		var lower, upper interface{}
+		switch fv.Kind() {
+		case reflect.String:
+			lower, upper = fv.String(), fv.String()
+			if prefix := truncateText(fv.String(), maxStatsStringLength); len(prefix) < fv.Len() {
+				lower, upper = prefix, prefix+statsMaxCharacter
+			}
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			lower, upper = fv.Int(), fv.Int()
+		default:
+			continue
+		}
+
+		if current, ok := s.min[field.Name]; !ok || lessStat(lower, current) {
+			s.min[field.Name] = lower
+		}
+		if current, ok := s.max[field.Name]; !ok || lessStat(current, upper) {
+			s.max[field.Name] = upper
+		}
+	}
+}
+
+func lessStat(a, b interface{}) bool {
+	switch a := a.(type) {
+	case string:
+		return a < b.(string)
+	case int64:
+		return a < b.(int64)
+	}
+	return false
+}
+
+// epochDate formats a Parquet DATE value, in days since the Unix epoch, as YYYY-MM-DD.
+func epochDate(days int64) string {
+	return time.Unix(days*24*60*60, 0).UTC().Format("2006-01-02")
+}
+
+// tableFiles writes the rows of a zip to Parquet data files of a table, grouped by partition directory,
+// tracking column statistics per file for the table's metadata.
+type tableFiles struct {
+	cfg           *config.Config
+	schemaVersion string
+	root          string
+	baseName      string
+	fields        []tableField
+	partitions    map[string]*tablePartition
+	log           *zap.Logger
+}
+
+// tablePartition holds the files written for one partition of a zip. Values is the partition tuple
+// in the representation of the table format.
+type tablePartition struct {
+	Dir    string
+	Values interface{}
+	out    *parquetRollingFile
+	stats  map[string]*columnStats
+}
+
+// tableDataFile is a completed data file.
+type tableDataFile struct {
+	Partition        *tablePartition
+	Path             string // Relative to the table root, using forward slashes
+	Rows             int64
+	Size             int64
+	ModificationTime time.Time
+	Stats            *columnStats
+}
+
+func newTableFiles(cfg *config.Config, schemaVersion string, root string, originZipName string, fields []tableField, log *zap.Logger) *tableFiles {
+	return &tableFiles{
+		cfg:           cfg,
+		schemaVersion: schemaVersion,
+		root:          root,
+		baseName:      strings.TrimSuffix(originZipName, ".zip"),
+		fields:        fields,
+		partitions:    map[string]*tablePartition{},
+		log:           log,
+	}
+}
+
+// write appends a row to the files of the partition directory dir, relative to the table root.
+// The Whence of a returned error describes the failed step.
+func (t *tableFiles) write(dir string, values interface{}, row convertedRow) (string, error) {
+	partition, ok := t.partitions[dir]
+	if !ok {
+		fileID := uuid.NewString()
+		partition = &tablePartition{Dir: dir, Values: values, stats: map[string]*columnStats{}}
+		partition.out = newParquetRollingFileIn(t.cfg, t.schemaVersion, filepath.Join(t.root, filepath.FromSlash(dir)),
+			func(part int, _ bool) string {
+				return fmt.Sprintf("part-%s-%04d-%s.parquet", t.baseName, part, fileID)
+			}, t.log)
+		t.partitions[dir] = partition
+	}
+
+	if whence, err := partition.out.write(row); err != nil {
+		return whence, err
+	}
+
+	fileStats, ok := partition.stats[partition.out.fileName]
+	if !ok {
+		fileStats = newColumnStats(t.fields)
+		partition.stats[partition.out.fileName] = fileStats
+	}
+	fileStats.add(row.row)
+	return "", nil
+}
+
+// abort closes the open files. They remain on disk, but are invisible to readers of the table.
+func (t *tableFiles) abort() {
+	for _, partition := range t.partitions {
+		partition.out.close()
+	}
+}
+
+// close finalizes every file, returning them ordered by path.
+func (t *tableFiles) close() ([]tableDataFile, error) {
+	var files []tableDataFile
+	for _, partition := range t.partitions {
+		if err := partition.out.close(); err != nil {
+			t.abort()
+			return nil, err
+		}
+		for _, file := range partition.out.closed {
+			path := file.Name
+			if partition.Dir != "" {
+				path = partition.Dir + "/" + file.Name
+			}
+			info, err := os.Stat(filepath.Join(t.root, filepath.FromSlash(path)))
+			if err != nil {
+				return nil, err
+			}
+			stats := partition.stats[file.Name]
+			if stats == nil {
+				stats = newColumnStats(t.fields)
+			}
+			files = append(files, tableDataFile{
+				Partition:        partition,
+				Path:             path,
+				Rows:             file.Rows,
+				Size:             info.Size(),
+				ModificationTime: info.ModTime(),
+				Stats:            stats,
+			})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
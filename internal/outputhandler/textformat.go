@@ -0,0 +1,98 @@
+package outputhandler
+
+import (
+	"fmt"
+
+	"github.com/diverged/uspt-go/types"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/config"
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// Renderings of the abstract, description and claims selected by textformatting.
+const (
+	textFormatInnerXML = "innerxml" // The markup of the bulk data, unchanged
+	textFormatPlain    = "plain"    // Tags stripped, entities decoded and whitespace normalized
+	textFormatMarkdown = "markdown"
+	textFormatHTML     = "html" // Sanitized HTML, limited to formatting elements, ids and internal links
+)
+
+// RowOptions select how the text of documents is rendered when they are converted to rows.
+type RowOptions struct {
+	TextFormat          string // "innerxml" (default), "plain", "markdown" or "html"
+	DescriptionSections bool   // Fill the v2 description section columns
+}
+
+func rowOptionsOf(cfg *config.Config) RowOptions {
+	return RowOptions{
+		TextFormat:          cfg.OutputConfig.TextFormat,
+		DescriptionSections: cfg.OutputConfig.DescriptionSections,
+	}
+}
+
+// validateTextFormat reports an unknown textformatting value. An empty value selects innerxml.
+func validateTextFormat(format string) error {
+	switch format {
+	case "", textFormatInnerXML, textFormatPlain, textFormatMarkdown, textFormatHTML:
+		return nil
+	}
+	return fmt.Errorf("unsupported textformatting %q, expected innerxml, plain, markdown or html", format)
+}
+
+// renderText renders an inner XML fragment in a text format. Unknown formats return the fragment unchanged.
+func renderText(content string, format string) string {
+	switch format {
+	case textFormatPlain:
+		return patentxml.PlainText(content)
+	case textFormatMarkdown:
+		return patentxml.Markdown(content)
+	case textFormatHTML:
+		return patentxml.HTML(content)
+	}
+	return content
+}
+
+// renderDocText renders the abstract, description and claims of a document in a text format, in place.
+func renderDocText(doc *types.USPTGoDoc, format string) {
+	if format == "" || format == textFormatInnerXML {
+		return
+	}
+	doc.Patent.Abstract.Content = renderText(doc.Patent.Abstract.Content, format)
+	doc.Patent.Description.Content = renderText(doc.Patent.Description.Content, format)
+	doc.Patent.Claims.Content = renderText(doc.Patent.Claims.Content, format)
+}
+
+// descriptionSections are the conventional sections of a description, rendered in a text format. They are
+// added to JSON documents and filled in the v2 schema when descriptionsections is enabled.
+type descriptionSections struct {
+	CrossReference      string `json:",omitempty"`
+	GovernmentInterest  string `json:",omitempty"`
+	Field               string `json:",omitempty"`
+	Background          string `json:",omitempty"`
+	Summary             string `json:",omitempty"`
+	Drawings            string `json:",omitempty"` // Brief description of the drawings
+	DetailedDescription string `json:",omitempty"`
+	Other               string `json:",omitempty"` // Content before the first recognized section
+	Confidence          string // "high", "medium" or "low", see patentxml.SegmentDescription
+	Fallback            bool   // No section was recognized, so the whole description is the detailed description
+}
+
+// describeSections segments a description and renders its sections in a text format.
+func describeSections(content string, format string) *descriptionSections {
+	seg := patentxml.SegmentDescription(content)
+	section := func(name string) string {
+		return renderText(seg.Content(name), format)
+	}
+	return &descriptionSections{
+		CrossReference:      section(patentxml.SectionCrossReference),
+		GovernmentInterest:  section(patentxml.SectionGovernmentInterest),
+		Field:               section(patentxml.SectionField),
+		Background:          section(patentxml.SectionBackground),
+		Summary:             section(patentxml.SectionSummary),
+		Drawings:            section(patentxml.SectionDrawings),
+		DetailedDescription: section(patentxml.SectionDetailed),
+		Other:               section(patentxml.SectionOther),
+		Confidence:          seg.Confidence,
+		Fallback:            seg.Fallback,
+	}
+}
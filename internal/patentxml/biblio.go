@@ -0,0 +1,481 @@
+package patentxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DocumentID identifies a patent document, as found in publication, application, citation and related document references.
+type DocumentID struct {
+	Country   string `json:"country,omitempty"`
+	DocNumber string `json:"docNumber,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Date      string `json:"date,omitempty"`
+}
+
+// Address is the postal location of a party.
+type Address struct {
+	City     string `json:"city,omitempty"`
+	State    string `json:"state,omitempty"`
+	Postcode string `json:"postcode,omitempty"`
+	Country  string `json:"country,omitempty"`
+}
+
+// Party is an inventor, applicant or assignee.
+type Party struct {
+	Sequence  int     `json:"sequence"`
+	Role      string  `json:"role,omitempty"`
+	OrgName   string  `json:"orgName,omitempty"`
+	LastName  string  `json:"lastName,omitempty"`
+	FirstName string  `json:"firstName,omitempty"`
+	Address   Address `json:"address"`
+}
+
+// Name returns the organization name of the party, or the personal name when it is an individual.
+func (p Party) Name() string {
+	if p.OrgName != "" {
+		return p.OrgName
+	}
+	return strings.TrimSpace(p.FirstName + " " + p.LastName)
+}
+
+// Classification is a single CPC or IPC classification symbol.
+type Classification struct {
+	Scheme   string `json:"scheme"` // "cpc" or "ipc"
+	Main     bool   `json:"main"`
+	Section  string `json:"section"`
+	Class    string `json:"class"`
+	Subclass string `json:"subclass"`
+	Group    string `json:"group"`
+	Subgroup string `json:"subgroup"`
+	Value    string `json:"value,omitempty"` // "I" (inventive) or "A" (additional)
+	Version  string `json:"version,omitempty"`
+}
+
+// Symbol formats the classification in its conventional form, e.g. "H01M 10/052".
+func (c Classification) Symbol() string {
+	return c.Section + c.Class + c.Subclass + " " + c.Group + "/" + c.Subgroup
+}
+
+// LocarnoClassification is the international design classification of a design document.
+type LocarnoClassification struct {
+	Edition string `json:"edition,omitempty"`
+	Code    string `json:"code"` // Class and subclass, e.g. "14-02"
+}
+
+// Citation is a patent or non-patent literature reference cited by the document.
+type Citation struct {
+	Sequence int        `json:"sequence"`
+	Patent   bool       `json:"patent"`
+	Document DocumentID `json:"document"`
+	Text     string     `json:"text,omitempty"` // Non-patent literature citation text
+	Category string     `json:"category,omitempty"`
+}
+
+// CitedBy returns the party that made the citation, reduced from its category, e.g. "examiner" for
+// "cited by examiner". Other categories are returned in lower case.
+func (c Citation) CitedBy() string {
+	category := strings.ToLower(strings.TrimSpace(c.Category))
+	if party, ok := strings.CutPrefix(category, "cited by "); ok {
+		return party
+	}
+	return category
+}
+
+// PriorityClaim is a claim to the priority of an earlier application.
+type PriorityClaim struct {
+	Sequence  int    `json:"sequence"`
+	Kind      string `json:"kind,omitempty"`
+	Country   string `json:"country,omitempty"`
+	DocNumber string `json:"docNumber,omitempty"`
+	Date      string `json:"date,omitempty"`
+}
+
+// RelatedDocument is a parent application, provisional application or earlier publication of the document.
+type RelatedDocument struct {
+	Relation string     `json:"relation"` // e.g. "continuation", "division", "us-provisional-application"
+	Status   string     `json:"status,omitempty"`
+	Document DocumentID `json:"document"`
+}
+
+// Examiner is a primary or assistant examiner of a grant.
+type Examiner struct {
+	Level      string `json:"level"` // "primary" or "assistant"
+	LastName   string `json:"lastName,omitempty"`
+	FirstName  string `json:"firstName,omitempty"`
+	Department string `json:"department,omitempty"` // Art unit, e.g. "1700"
+}
+
+// Bibliographic holds the bibliographic data of a grant or application that uspt-go does not expose.
+type Bibliographic struct {
+	Publication      DocumentID              `json:"publication"`
+	Application      DocumentID              `json:"application"`
+	ApplicationType  string                  `json:"applicationType,omitempty"`
+	SeriesCode       string                  `json:"seriesCode,omitempty"`      // Series code of the application number, e.g. "17"
+	ExemplaryClaims  []int                   `json:"exemplaryClaims,omitempty"` // Numbers of the claims designated exemplary for the Official Gazette
+	Inventors        []Party                 `json:"inventors,omitempty"`
+	Applicants       []Party                 `json:"applicants,omitempty"`
+	Assignees        []Party                 `json:"assignees,omitempty"`
+	Classifications  []Classification        `json:"classifications,omitempty"`
+	Locarno          []LocarnoClassification `json:"locarno,omitempty"` // Design documents only
+	Citations        []Citation              `json:"citations,omitempty"`
+	PriorityClaims   []PriorityClaim         `json:"priorityClaims,omitempty"`
+	RelatedDocuments []RelatedDocument       `json:"relatedDocuments,omitempty"`
+	Examiners        []Examiner              `json:"examiners,omitempty"`
+}
+
+// ErrNoBibliographicData is returned when a document contains no us-bibliographic-data element.
+var ErrNoBibliographicData = errors.New("no bibliographic data element found")
+
+// ErrNoRawDocument is returned when the raw split XML of a document is empty, as it is unless the parser
+// was asked to return it (see outputhandler.NeedsRawSplitDoc).
+var ErrNoRawDocument = errors.New("raw split document not returned by parser")
+
+// ParseBibliographic extracts the bibliographic data from a raw split grant or application XML document.
+func ParseBibliographic(raw []byte) (*Bibliographic, error) {
+	if len(raw) == 0 {
+		return nil, ErrNoRawDocument
+	}
+	d := newDecoder(bytes.NewReader(raw))
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, ErrNoBibliographicData
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || !strings.HasPrefix(start.Name.Local, "us-bibliographic-data-") {
+			continue
+		}
+
+		var b bibXML
+		if err := d.DecodeElement(&b, &start); err != nil {
+			return nil, err
+		}
+		return b.convert(), nil
+	}
+}
+
+// SourceFields maps the elements read by ParseBibliographic, as paths below the bibliographic data element such
+// as "assignees/assignee/addressbook/address/city", to the Bibliographic field each fills, as dotted paths such
+// as "Assignees.Address.City". A "*" path segment stands for any element name. Attributes are not included.
+func SourceFields() map[string]string {
+	fields := map[string]string{}
+	sourceFields(reflect.TypeOf(bibXML{}), "", "", fields)
+	return fields
+}
+
+// sourceFields walks the XML mapping types. The bib tag of a field names the Bibliographic field it fills,
+// relative to that of the enclosing element; container elements without a bib tag add no path segment.
+func sourceFields(t reflect.Type, path, field string, fields map[string]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("xml"), ",")
+		if f.Name == "XMLName" || opts == "attr" {
+			continue
+		}
+		if opts == "any" {
+			name = "*"
+		}
+		elem := strings.TrimPrefix(path+"/"+strings.ReplaceAll(name, ">", "/"), "/")
+		bib, tagged := f.Tag.Lookup("bib")
+		if bib != "" && field != "" {
+			bib = field + "." + bib
+		} else if bib == "" {
+			bib = field
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer || ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(innerXML{}) {
+			sourceFields(ft, elem, bib, fields)
+		} else if tagged {
+			fields[elem] = bib
+		}
+	}
+}
+
+// * XML mapping
+
+type docIDXML struct {
+	Country   string `xml:"country" bib:"Country"`
+	DocNumber string `xml:"doc-number" bib:"DocNumber"`
+	Kind      string `xml:"kind" bib:"Kind"`
+	Name      string `xml:"name" bib:"Name"`
+	Date      string `xml:"date" bib:"Date"`
+}
+
+func (x docIDXML) convert() DocumentID {
+	return DocumentID{
+		Country:   strings.TrimSpace(x.Country),
+		DocNumber: strings.TrimSpace(x.DocNumber),
+		Kind:      strings.TrimSpace(x.Kind),
+		Name:      NormalizeSpace(x.Name),
+		Date:      strings.TrimSpace(x.Date),
+	}
+}
+
+type partyXML struct {
+	Sequence          string `xml:"sequence,attr"`
+	AppType           string `xml:"app-type,attr"`
+	AuthorityCategory string `xml:"applicant-authority-category,attr"`
+	OrgName           string `xml:"addressbook>orgname" bib:"OrgName"`
+	LastName          string `xml:"addressbook>last-name" bib:"LastName"`
+	FirstName         string `xml:"addressbook>first-name" bib:"FirstName"`
+	Role              string `xml:"addressbook>role" bib:"Role"`
+	City              string `xml:"addressbook>address>city" bib:"Address.City"`
+	State             string `xml:"addressbook>address>state" bib:"Address.State"`
+	Postcode          string `xml:"addressbook>address>postcode" bib:"Address.Postcode"`
+	Country           string `xml:"addressbook>address>country" bib:"Address.Country"`
+}
+
+func (x partyXML) convert(role string) Party {
+	seq, _ := strconv.Atoi(strings.TrimLeft(x.Sequence, "0"))
+	return Party{
+		Sequence:  seq,
+		Role:      role,
+		OrgName:   NormalizeSpace(x.OrgName),
+		LastName:  NormalizeSpace(x.LastName),
+		FirstName: NormalizeSpace(x.FirstName),
+		Address: Address{
+			City:     NormalizeSpace(x.City),
+			State:    strings.TrimSpace(x.State),
+			Postcode: strings.TrimSpace(x.Postcode),
+			Country:  strings.TrimSpace(x.Country),
+		},
+	}
+}
+
+type partiesXML struct {
+	USApplicants []partyXML `xml:"us-applicants>us-applicant" bib:"Applicants"`
+	Applicants   []partyXML `xml:"applicants>applicant" bib:"Applicants"`
+	Inventors    []partyXML `xml:"inventors>inventor" bib:"Inventors"`
+}
+
+type classXML struct {
+	Version  string `xml:"ipc-version-indicator>date" bib:"Version"`
+	CPCVer   string `xml:"cpc-version-indicator>date" bib:"Version"`
+	Section  string `xml:"section" bib:"Section"`
+	Class    string `xml:"class" bib:"Class"`
+	Subclass string `xml:"subclass" bib:"Subclass"`
+	Group    string `xml:"main-group" bib:"Group"`
+	Subgroup string `xml:"subgroup" bib:"Subgroup"`
+	Position string `xml:"symbol-position" bib:"Main"`
+	Value    string `xml:"classification-value" bib:"Value"`
+}
+
+func (x classXML) convert(scheme string, main bool) Classification {
+	version := x.Version
+	if scheme == "cpc" {
+		version = x.CPCVer
+	}
+	return Classification{
+		Scheme:   scheme,
+		Main:     main,
+		Section:  strings.TrimSpace(x.Section),
+		Class:    strings.TrimSpace(x.Class),
+		Subclass: strings.TrimSpace(x.Subclass),
+		Group:    strings.TrimSpace(x.Group),
+		Subgroup: strings.TrimSpace(x.Subgroup),
+		Value:    strings.TrimSpace(x.Value),
+		Version:  strings.TrimSpace(version),
+	}
+}
+
+type innerXML struct {
+	Content string `xml:",innerxml"`
+}
+
+type citationXML struct {
+	Patcit *struct {
+		Num        string   `xml:"num,attr"`
+		DocumentID docIDXML `xml:"document-id"`
+	} `xml:"patcit" bib:"Document"`
+	Nplcit *struct {
+		Num      string   `xml:"num,attr"`
+		Othercit innerXML `xml:"othercit" bib:"Text"`
+	} `xml:"nplcit"`
+	Category string `xml:"category" bib:"Category"`
+}
+
+type relatedXML struct {
+	Items []struct {
+		XMLName      xml.Name
+		ParentDoc    docIDXML `xml:"relation>parent-doc>document-id" bib:"Document"`
+		ParentStatus string   `xml:"relation>parent-doc>parent-status" bib:"Status"`
+		DocumentID   docIDXML `xml:"document-id" bib:"Document"`
+	} `xml:",any"`
+}
+
+type bibXML struct {
+	Publication docIDXML `xml:"publication-reference>document-id" bib:"Publication"`
+	Application struct {
+		Type       string   `xml:"appl-type,attr"`
+		DocumentID docIDXML `xml:"document-id"`
+	} `xml:"application-reference" bib:"Application"`
+	SeriesCode     string   `xml:"us-application-series-code" bib:"SeriesCode"`
+	Exemplary      []string `xml:"us-exemplary-claim" bib:"ExemplaryClaims"`
+	PriorityClaims []struct {
+		Sequence  string `xml:"sequence,attr"`
+		Kind      string `xml:"kind,attr"`
+		Country   string `xml:"country" bib:"Country"`
+		DocNumber string `xml:"doc-number" bib:"DocNumber"`
+		Date      string `xml:"date" bib:"Date"`
+	} `xml:"priority-claims>priority-claim" bib:"PriorityClaims"`
+	IPC        []classXML `xml:"classifications-ipcr>classification-ipcr" bib:"Classifications"`
+	MainCPC    []classXML `xml:"classifications-cpc>main-cpc>classification-cpc" bib:"Classifications"`
+	FurtherCPC []classXML `xml:"classifications-cpc>further-cpc>classification-cpc" bib:"Classifications"`
+	Locarno    []struct {
+		Edition string `xml:"edition" bib:"Edition"`
+		Main    string `xml:"main-classification" bib:"Code"`
+	} `xml:"classification-locarno" bib:"Locarno"`
+	USCitations []citationXML `xml:"us-references-cited>us-citation" bib:"Citations"`
+	Citations   []citationXML `xml:"references-cited>citation" bib:"Citations"`
+	Related     relatedXML    `xml:"us-related-documents" bib:"RelatedDocuments"`
+	USParties   partiesXML    `xml:"us-parties"`
+	Parties     partiesXML    `xml:"parties"`
+	Assignees   []partyXML    `xml:"assignees>assignee" bib:"Assignees"`
+	Examiners   struct {
+		Primary   []examinerXML `xml:"primary-examiner"`
+		Assistant []examinerXML `xml:"assistant-examiner"`
+	} `xml:"examiners" bib:"Examiners"`
+}
+
+type examinerXML struct {
+	LastName   string `xml:"last-name" bib:"LastName"`
+	FirstName  string `xml:"first-name" bib:"FirstName"`
+	Department string `xml:"department" bib:"Department"`
+}
+
+func (x examinerXML) convert(level string) Examiner {
+	return Examiner{
+		Level:      level,
+		LastName:   NormalizeSpace(x.LastName),
+		FirstName:  NormalizeSpace(x.FirstName),
+		Department: strings.TrimSpace(x.Department),
+	}
+}
+
+func (x *bibXML) convert() *Bibliographic {
+	b := &Bibliographic{
+		Publication:     x.Publication.convert(),
+		Application:     x.Application.DocumentID.convert(),
+		ApplicationType: x.Application.Type,
+		SeriesCode:      strings.TrimSpace(x.SeriesCode),
+	}
+	for _, e := range x.Exemplary {
+		if n, err := strconv.Atoi(strings.TrimSpace(e)); err == nil {
+			b.ExemplaryClaims = append(b.ExemplaryClaims, n)
+		}
+	}
+
+	// Grants since 2012 use us-parties; earlier documents use parties. Older applications list
+	// inventors as applicants with an app-type of "applicant-inventor".
+	for _, parties := range []partiesXML{x.USParties, x.Parties} {
+		for _, p := range append(parties.USApplicants, parties.Applicants...) {
+			b.Applicants = append(b.Applicants, p.convert(firstNonEmpty(p.AuthorityCategory, p.AppType, "applicant")))
+			if p.AppType == "applicant-inventor" && len(parties.Inventors) == 0 {
+				b.Inventors = append(b.Inventors, p.convert("inventor"))
+			}
+		}
+		for _, p := range parties.Inventors {
+			b.Inventors = append(b.Inventors, p.convert("inventor"))
+		}
+	}
+	for _, p := range x.Assignees {
+		b.Assignees = append(b.Assignees, p.convert(firstNonEmpty(strings.TrimSpace(p.Role), "assignee")))
+	}
+
+	for i, c := range x.MainCPC {
+		b.Classifications = append(b.Classifications, c.convert("cpc", i == 0))
+	}
+	for _, c := range x.FurtherCPC {
+		b.Classifications = append(b.Classifications, c.convert("cpc", false))
+	}
+	for _, c := range x.IPC {
+		b.Classifications = append(b.Classifications, c.convert("ipc", c.Position == "F"))
+	}
+
+	for _, l := range x.Locarno {
+		code := strings.TrimSpace(l.Main)
+		if code == "" {
+			continue
+		}
+		// Main classifications are given as four digits, class then subclass
+		if len(code) == 4 && strings.Trim(code, "0123456789") == "" {
+			code = code[:2] + "-" + code[2:]
+		}
+		b.Locarno = append(b.Locarno, LocarnoClassification{Edition: strings.TrimSpace(l.Edition), Code: code})
+	}
+
+	for _, c := range append(x.USCitations, x.Citations...) {
+		citation := Citation{Category: NormalizeSpace(c.Category)}
+		switch {
+		case c.Patcit != nil:
+			citation.Patent = true
+			citation.Sequence, _ = strconv.Atoi(strings.TrimLeft(c.Patcit.Num, "0"))
+			citation.Document = c.Patcit.DocumentID.convert()
+		case c.Nplcit != nil:
+			citation.Sequence, _ = strconv.Atoi(strings.TrimLeft(c.Nplcit.Num, "0"))
+			citation.Text = PlainText(c.Nplcit.Othercit.Content)
+		default:
+			continue
+		}
+		b.Citations = append(b.Citations, citation)
+	}
+
+	for _, p := range x.PriorityClaims {
+		seq, _ := strconv.Atoi(strings.TrimLeft(p.Sequence, "0"))
+		b.PriorityClaims = append(b.PriorityClaims, PriorityClaim{
+			Sequence:  seq,
+			Kind:      p.Kind,
+			Country:   strings.TrimSpace(p.Country),
+			DocNumber: strings.TrimSpace(p.DocNumber),
+			Date:      strings.TrimSpace(p.Date),
+		})
+	}
+
+	for _, r := range x.Related.Items {
+		related := RelatedDocument{Relation: r.XMLName.Local}
+		if r.ParentDoc.DocNumber != "" {
+			related.Document = r.ParentDoc.convert()
+			related.Status = NormalizeSpace(r.ParentStatus)
+		} else {
+			related.Document = r.DocumentID.convert()
+		}
+		if related.Document.DocNumber == "" {
+			continue
+		}
+		b.RelatedDocuments = append(b.RelatedDocuments, related)
+	}
+
+	for _, e := range x.Examiners.Primary {
+		b.Examiners = append(b.Examiners, e.convert("primary"))
+	}
+	for _, e := range x.Examiners.Assistant {
+		b.Examiners = append(b.Examiners, e.convert("assistant"))
+	}
+
+	return b
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package patentxml
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func TestParseBibliographic(t *testing.T) {
+	got, err := ParseBibliographic(fixture.Raw(fixture.Grant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Bibliographic{
+		Publication:     DocumentID{Country: "US", DocNumber: "11000000", Kind: "B2", Date: "20240102"},
+		Application:     DocumentID{Country: "US", DocNumber: "17123456", Date: "20210315"},
+		ApplicationType: "utility",
+		SeriesCode:      "17",
+		ExemplaryClaims: []int{1},
+		Inventors: []Party{
+			{Sequence: 1, Role: "inventor", LastName: "Tanaka", FirstName: "Hiro", Address: Address{City: "Osaka", Country: "JP"}},
+			{Sequence: 2, Role: "inventor", LastName: "Müller", FirstName: "Anna", Address: Address{City: "Austin", State: "TX", Country: "US"}},
+		},
+		Applicants: []Party{
+			{Sequence: 1, Role: "assignee", OrgName: "Acme Battery Co., Ltd.", Address: Address{City: "Osaka", Country: "JP"}},
+		},
+		Assignees: []Party{
+			{Role: "03", OrgName: "Acme Battery Co., Ltd.", Address: Address{City: "Osaka", Country: "JP"}},
+		},
+		Classifications: []Classification{
+			{Scheme: "cpc", Main: true, Section: "H", Class: "01", Subclass: "M", Group: "10", Subgroup: "052", Value: "I", Version: "20130101"},
+			{Scheme: "cpc", Section: "Y", Class: "02", Subclass: "E", Group: "60", Subgroup: "10", Value: "A", Version: "20130101"},
+			{Scheme: "ipc", Main: true, Section: "H", Class: "01", Subclass: "M", Group: "10", Subgroup: "052", Value: "I", Version: "20060101"},
+		},
+		Citations: []Citation{
+			{Sequence: 1, Patent: true, Document: DocumentID{Country: "US", DocNumber: "5123456", Kind: "A", Name: "Smith", Date: "19920616"}, Category: "cited by examiner"},
+			{Sequence: 2, Patent: true, Document: DocumentID{Country: "US", DocNumber: "20150012345", Kind: "A1", Name: "Jones et al.", Date: "20150108"}, Category: "cited by applicant"},
+			{Sequence: 3, Text: "Doe, “Lithium things,” J. Batt. 2019.", Category: "cited by applicant"},
+		},
+		PriorityClaims: []PriorityClaim{
+			{Sequence: 1, Kind: "national", Country: "JP", DocNumber: "2020-012345", Date: "20200316"},
+		},
+		RelatedDocuments: []RelatedDocument{
+			{Relation: "continuation", Status: "ABANDONED", Document: DocumentID{Country: "US", DocNumber: "16999999", Date: "20190101"}},
+			{Relation: "us-provisional-application", Document: DocumentID{Country: "US", DocNumber: "62888888", Date: "20180505"}},
+			{Relation: "related-publication", Document: DocumentID{Country: "US", DocNumber: "20210290000", Kind: "A1", Date: "20210916"}},
+		},
+		Examiners: []Examiner{
+			{Level: "primary", LastName: "Roe", FirstName: "Rick", Department: "1700"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseBibliographic(%s) =\n%+v\nwant\n%+v", fixture.Grant, got, want)
+	}
+	if symbol := got.Classifications[0].Symbol(); symbol != "H01M 10/052" {
+		t.Errorf("Symbol() = %q", symbol)
+	}
+	if name := got.Inventors[1].Name(); name != "Anna Müller" {
+		t.Errorf("Name() = %q", name)
+	}
+}
+
+func TestParseBibliographicErrors(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want error
+	}{
+		{"", ErrNoRawDocument},
+		{`<?xml version="1.0" encoding="UTF-8"?><us-patent-grant><abstract/></us-patent-grant>`, ErrNoBibliographicData},
+	}
+	for _, tt := range tests {
+		if _, err := ParseBibliographic([]byte(tt.raw)); !errors.Is(err, tt.want) {
+			t.Errorf("ParseBibliographic(%q) = %v, want %v", tt.raw, err, tt.want)
+		}
+	}
+}
+
+func TestCitationCitedBy(t *testing.T) {
+	tests := []struct {
+		category string
+		want     string
+	}{
+		{"cited by examiner", "examiner"},
+		{" Cited by Applicant ", "applicant"},
+		{"cited by third party", "third party"},
+		{"cited by other", "other"},
+		{"X", "x"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := (Citation{Category: tt.category}).CitedBy(); got != tt.want {
+			t.Errorf("CitedBy of %q = %q, want %q", tt.category, got, tt.want)
+		}
+	}
+}
+
+func TestParseBibliographicLocarno(t *testing.T) {
+	raw := `<us-patent-grant><us-bibliographic-data-grant>` +
+		`<publication-reference><document-id><country>US</country><doc-number>D0912345</doc-number><kind>S1</kind></document-id></publication-reference>` +
+		`<classification-locarno><edition>14</edition><main-classification>1402</main-classification></classification-locarno>` +
+		`</us-bibliographic-data-grant></us-patent-grant>`
+	got, err := ParseBibliographic([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []LocarnoClassification{{Edition: "14", Code: "14-02"}}; !reflect.DeepEqual(got.Locarno, want) {
+		t.Errorf("Locarno = %+v, want %+v", got.Locarno, want)
+	}
+}
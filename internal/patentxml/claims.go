@@ -0,0 +1,177 @@
+// Package patentxml extracts structured data from USPTO patent XML that the uspt-go parser
+// does not expose directly.
+package patentxml
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Claim is a single claim with its dependency references resolved to claim ids.
+type Claim struct {
+	ID        string   `json:"id"`
+	Number    int      `json:"number"`
+	Text      string   `json:"text"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// Independent reports whether the claim references no other claim.
+func (c Claim) Independent() bool {
+	return len(c.DependsOn) == 0
+}
+
+// newDecoder returns a non-strict decoder that tolerates the named entities used throughout USPTO XML.
+func newDecoder(r io.Reader) *xml.Decoder {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	return d
+}
+
+// ParseClaims extracts the claims from the inner XML of a <claims> element (or any fragment containing <claim> elements).
+func ParseClaims(content string) ([]Claim, error) {
+	d := newDecoder(strings.NewReader("<root>" + content + "</root>"))
+
+	var claims []Claim
+	var current *Claim
+	var text strings.Builder
+	depth := 0
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return claims, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if current == nil {
+				if t.Name.Local == "claim" {
+					current = &Claim{ID: attr(t, "id")}
+					current.Number, _ = strconv.Atoi(strings.TrimLeft(attr(t, "num"), "0"))
+					text.Reset()
+					depth = 1
+				}
+				continue
+			}
+			depth++
+			if t.Name.Local == "claim-ref" {
+				if idref := attr(t, "idref"); idref != "" {
+					current.DependsOn = append(current.DependsOn, strings.Fields(strings.ReplaceAll(idref, ",", " "))...)
+				}
+			}
+			if t.Name.Local == "claim-text" && text.Len() > 0 {
+				text.WriteByte(' ')
+			}
+		case xml.EndElement:
+			if current == nil {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				current.Text = NormalizeSpace(text.String())
+				claims = append(claims, *current)
+				current = nil
+			}
+		case xml.CharData:
+			if current != nil {
+				text.Write(t)
+			}
+		}
+	}
+
+	return claims, nil
+}
+
+// NormalizeSpace collapses all runs of whitespace into single spaces and trims the result.
+func NormalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// Claim categories assigned by ClaimCategory.
+const (
+	ClaimMethod      = "method"
+	ClaimSystem      = "system"
+	ClaimApparatus   = "apparatus"
+	ClaimComposition = "composition"
+	ClaimMedium      = "medium" // Computer-readable media and program products
+)
+
+// claimCategoryNouns are the nouns of a claim preamble that determine its category.
+var claimCategoryNouns = []struct {
+	noun     string
+	category string
+}{
+	{"method", ClaimMethod},
+	{"process", ClaimMethod},
+	{"system", ClaimSystem},
+	{"medium", ClaimMedium},
+	{"media", ClaimMedium},
+	{"program product", ClaimMedium},
+	{"composition", ClaimComposition},
+	{"compound", ClaimComposition},
+	{"formulation", ClaimComposition},
+	{"mixture", ClaimComposition},
+	{"alloy", ClaimComposition},
+}
+
+// preambleEnds are the transitional phrases and punctuation that end a claim preamble.
+var preambleEnds = []string{" comprising", " consisting", " including", " wherein", " having", " characterized", ":", ";"}
+
+// ClaimCategory classifies a claim by the first category noun of its preamble, e.g. "A method of
+// manufacturing a battery" is a method and "A system for ..." a system. Other preambles introducing an
+// article, such as "A battery comprising", are apparatus claims; anything else returns "".
+func ClaimCategory(text string) string {
+	preamble := strings.ToLower(strings.TrimLeft(text, "0123456789. \t\n"))
+	for _, end := range preambleEnds {
+		if i := strings.Index(preamble, end); i >= 0 {
+			preamble = preamble[:i]
+		}
+	}
+
+	category, first := "", len(preamble)
+	for _, c := range claimCategoryNouns {
+		for from := 0; from < first; {
+			i := strings.Index(preamble[from:], c.noun)
+			if i < 0 {
+				break
+			}
+			i += from
+			// Match whole words only, e.g. not "processor" for "process"
+			after := i + len(c.noun)
+			if (i == 0 || !isWordByte(preamble[i-1])) && (after == len(preamble) || !isWordByte(preamble[after])) {
+				if i < first {
+					category, first = c.category, i
+				}
+				break
+			}
+			from = i + 1
+		}
+	}
+	if category != "" {
+		return category
+	}
+	if strings.HasPrefix(preamble, "a ") || strings.HasPrefix(preamble, "an ") {
+		return ClaimApparatus
+	}
+	return ""
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '-'
+}
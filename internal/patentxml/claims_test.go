@@ -0,0 +1,98 @@
+package patentxml
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func TestParseClaims(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Claim
+		wantErr bool
+	}{
+		{
+			name:    "fixture grant",
+			content: fixture.Doc(fixture.Grant).Patent.Claims.Content,
+			want: []Claim{
+				{ID: "CLM-00001", Number: 1, Text: "1. A battery comprising: a cathode; an anode; and a solid electrolyte disposed between the cathode and the anode."},
+				{ID: "CLM-00002", Number: 2, Text: "2. The battery of claim 1, wherein the solid electrolyte has a garnet structure.", DependsOn: []string{"CLM-00001"}},
+				{ID: "CLM-00003", Number: 3, Text: "3. A method of manufacturing a battery, the method comprising: stacking a cathode, a solid electrolyte and an anode."},
+			},
+		},
+		{
+			name: "several references in one idref",
+			content: `<claim id="CLM-00004" num="00004"><claim-text>4. The battery of <claim-ref idref="CLM-00001, CLM-00002">claims 1 or 2</claim-ref> ` +
+				`or <claim-ref idref="CLM-00003">3</claim-ref>.</claim-text></claim>`,
+			want: []Claim{
+				{ID: "CLM-00004", Number: 4, Text: "4. The battery of claims 1 or 2 or 3.", DependsOn: []string{"CLM-00001", "CLM-00002", "CLM-00003"}},
+			},
+		},
+		{
+			name:    "entities and inline markup",
+			content: `<claim id="CLM-00001" num="00001"><claim-text>1. A compound of H<sub>2</sub>O &amp; Li&#x2082; &mdash; dry.</claim-text></claim>`,
+			want:    []Claim{{ID: "CLM-00001", Number: 1, Text: "1. A compound of H2O & Li₂ — dry."}},
+		},
+		{
+			name:    "missing number",
+			content: `<claim id="CLM-00001"><claim-text>A battery.</claim-text></claim>`,
+			want:    []Claim{{ID: "CLM-00001", Text: "A battery."}},
+		},
+		{
+			name:    "no claims",
+			content: `<p>What is claimed is:</p>`,
+		},
+		{
+			name: "malformed after the first claim",
+			content: `<claim id="CLM-00001" num="00001"><claim-text>1. A battery.</claim-text></claim>` +
+				`<claim id="CLM-00002" num="00002"><claim-text>2. The battery <!-- unterminated`,
+			want:    []Claim{{ID: "CLM-00001", Number: 1, Text: "1. A battery."}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClaims(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseClaims error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseClaims =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimCategory(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"1. A method of manufacturing a battery, comprising: stacking.", ClaimMethod},
+		{"A process for refining oil.", ClaimMethod},
+		{"The method of claim 1, wherein x.", ClaimMethod},
+		{"A system comprising a processor.", ClaimSystem},
+		{"A system and method for sorting.", ClaimSystem},
+		{"A method and system for sorting.", ClaimMethod},
+		{"A non-transitory computer-readable medium storing instructions.", ClaimMedium},
+		{"One or more computer-readable media having instructions.", ClaimMedium},
+		{"A computer program product comprising code.", ClaimMedium},
+		{"A pharmaceutical composition comprising a compound of formula I.", ClaimComposition},
+		{"An aluminum alloy consisting of Al and Mg.", ClaimComposition},
+		{"A processor comprising memory storing a method.", ClaimApparatus},
+		{"A battery comprising a system.", ClaimApparatus},
+		{"An apparatus having a medium.", ClaimApparatus},
+		{"12. A device; and a method.", ClaimApparatus},
+		{"Apparatus for drying.", ""},
+		{"The device of claim 1.", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ClaimCategory(tt.text); got != tt.want {
+			t.Errorf("ClaimCategory(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package patentxml
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeDocNumber returns a canonical form of a document number, country code first and without kind code,
+// so that references to the same document join regardless of how they were written. For example
+// "US", "D0912345" becomes "USD912345", and "US", "2015/0012345" becomes "US20150012345".
+func NormalizeDocNumber(country, docNumber string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" {
+		country = "US"
+	}
+
+	// Drop separators such as spaces, slashes, commas, dashes and periods
+	var b strings.Builder
+	for _, r := range strings.ToUpper(docNumber) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	number := b.String()
+	if number == "" {
+		return ""
+	}
+
+	// A repeated country prefix, as in "US5123456" or "USD912345", is removed
+	if rest, ok := strings.CutPrefix(number, country); ok {
+		if i := strings.IndexFunc(rest, unicode.IsDigit); i >= 0 && isDigits(rest[i:]) {
+			number = rest
+		}
+	}
+
+	// Split any series prefix (D, RE, PP, H, T ...) from the digits
+	i := strings.IndexFunc(number, unicode.IsDigit)
+	if i < 0 {
+		return country + number
+	}
+	prefix, digits := number[:i], number[i:]
+	if !isDigits(digits) {
+		return country + number
+	}
+
+	// US pre-grant publication numbers are a four digit year followed by a seven digit serial
+	if country == "US" && prefix == "" && len(digits) == 11 && (strings.HasPrefix(digits, "19") || strings.HasPrefix(digits, "20")) {
+		return country + digits
+	}
+
+	digits = strings.TrimLeft(digits, "0")
+	if digits == "" {
+		digits = "0"
+	}
+	return country + prefix + digits
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package patentxml
+
+import "testing"
+
+func TestNormalizeDocNumber(t *testing.T) {
+	tests := []struct {
+		country   string
+		docNumber string
+		want      string
+	}{
+		{"US", "11000000", "US11000000"},
+		{"", "11000000", "US11000000"},
+		{" us ", " 5,123,456 ", "US5123456"},
+
+		// Leading zeros
+		{"US", "05123456", "US5123456"},
+		{"US", "0000000", "US0"},
+
+		// Series prefixes
+		{"US", "D0912345", "USD912345"},
+		{"US", "D 912,345", "USD912345"},
+		{"US", "RE049000", "USRE49000"},
+		{"US", "Re. 49,000", "USRE49000"},
+		{"US", "PP034000", "USPP34000"},
+		{"US", "H0002345", "USH2345"},
+
+		// Pre-grant publications keep the zeros of their seven digit serial
+		{"US", "20150012345", "US20150012345"},
+		{"US", "2015/0012345", "US20150012345"},
+		{"US", "19990012345", "US19990012345"},
+		{"US", "00150012345", "US150012345"},
+		{"JP", "20150012345", "JP20150012345"},
+		{"JP", "02015001234", "JP2015001234"},
+
+		// A repeated country prefix
+		{"US", "US5123456", "US5123456"},
+		{"US", "US20150012345", "US20150012345"},
+		{"EP", "EP1234567", "EP1234567"},
+		{"DE", "US1234567", "DEUS1234567"},
+		{"US", "USD912345", "USD912345"},
+		{"US", "US", "USUS"},
+
+		// Other countries and unusual numbers
+		{"JP", "2020-012345", "JP2020012345"},
+		{"WO", "2019/123456", "WO2019123456"},
+		{"US", "D", "USD"},
+		{"US", "12A34", "US12A34"},
+		{"US", "", ""},
+		{"US", " / ", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeDocNumber(tt.country, tt.docNumber); got != tt.want {
+			t.Errorf("NormalizeDocNumber(%q, %q) = %q, want %q", tt.country, tt.docNumber, got, tt.want)
+		}
+	}
+}
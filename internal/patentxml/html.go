@@ -0,0 +1,215 @@
+package patentxml
+
+import (
+	"encoding/xml"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// htmlElement describes how a USPTO element is rendered in HTML.
+type htmlElement struct {
+	tag   string // HTML tag, empty to render only the contents
+	class string
+	void  bool // Has no contents or closing tag
+}
+
+var htmlElements = map[string]htmlElement{
+	"p":                       {tag: "p"},
+	"b":                       {tag: "b"},
+	"i":                       {tag: "i"},
+	"u":                       {tag: "u"},
+	"sub":                     {tag: "sub"},
+	"sup":                     {tag: "sup"},
+	"pre":                     {tag: "pre"},
+	"ul":                      {tag: "ul"},
+	"ol":                      {tag: "ol"},
+	"li":                      {tag: "li"},
+	"dl":                      {tag: "dl"},
+	"dt":                      {tag: "dt"},
+	"dd":                      {tag: "dd"},
+	"br":                      {tag: "br", void: true},
+	"smallcaps":               {tag: "span", class: "smallcaps"},
+	"o":                       {tag: "span", class: "overline"},
+	"figref":                  {tag: "span", class: "figref"},
+	"description-of-drawings": {tag: "div", class: "description-of-drawings"},
+	"tables":                  {tag: "div", class: "table"},
+	"table":                   {tag: "table"},
+	"thead":                   {tag: "thead"},
+	"tbody":                   {tag: "tbody"},
+	"row":                     {tag: "tr"},
+	"entry":                   {tag: "td"},
+	"colspec":                 {void: true},
+	"img":                     {void: true},
+	"claim":                   {tag: "div", class: "claim"},
+	"claim-text":              {tag: "div", class: "claim-text"},
+}
+
+// HTML converts an inner XML fragment of USPTO markup, such as a description or abstract, to HTML.
+// Paragraphs, headings, lists, tables and inline formatting are mapped to their HTML equivalents, keeping
+// their ids, claim and cross references become links, and other elements are reduced to their text.
+func HTML(content string) string {
+	return renderHTML(content, nil)
+}
+
+// ClaimsHTML converts the contents of each claim of a fragment to HTML, keyed by claim id.
+func ClaimsHTML(content string) map[string]string {
+	claims := map[string]string{}
+	renderHTML(content, claims)
+	return claims
+}
+
+// renderHTML converts a fragment to HTML. If claims is not nil, the HTML of the contents of each top-level
+// claim is stored in it by id instead of being written to the result.
+func renderHTML(content string, claims map[string]string) string {
+	d := newDecoder(strings.NewReader("<root>" + content + "</root>"))
+
+	var out, claim strings.Builder
+	w := &out
+	var closers []string // Closing tags of the open elements, empty for elements rendered without a tag
+	claimID, claimDepth := "", -1
+	inHead := 0
+
+	closeElement := func() {
+		w.WriteString(closers[len(closers)-1])
+		closers = closers[:len(closers)-1]
+		if len(closers) == claimDepth {
+			claims[claimID] = strings.TrimSpace(claim.String())
+			claimDepth = -1
+			w = &out
+		}
+	}
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Keep whatever was converted from a malformed fragment
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if name == "root" {
+				continue
+			}
+			if name == "claim" && claims != nil && claimDepth < 0 {
+				// Only the contents of the claim are stored, the page provides its container
+				claimID, claimDepth = attr(t, "id"), len(closers)
+				claim.Reset()
+				w = &claim
+				closers = append(closers, "")
+				continue
+			}
+			if name == "thead" {
+				inHead++
+			}
+
+			var tag, class, href string
+			switch name {
+			case "heading":
+				level, _ := strconv.Atoi(attr(t, "level"))
+				tag = "h" + strconv.Itoa(min(max(level, 1)+2, 6)) // h1 and h2 are left to the page and its sections
+			case "claim-ref", "crossref":
+				tag = "a"
+				if idref := strings.Fields(strings.ReplaceAll(attr(t, "idref"), ",", " ")); len(idref) > 0 {
+					href = "#" + idref[0]
+				}
+			default:
+				el := htmlElements[name]
+				if el.void {
+					if el.tag != "" {
+						w.WriteString("<" + el.tag + ">")
+					}
+					d.Skip()
+					continue
+				}
+				tag, class = el.tag, el.class
+				if tag == "td" && inHead > 0 {
+					tag = "th"
+				}
+			}
+
+			if tag == "" {
+				closers = append(closers, "")
+				continue
+			}
+			w.WriteString("<" + tag)
+			if id := attr(t, "id"); id != "" && tag != "a" {
+				w.WriteString(` id="` + html.EscapeString(id) + `"`)
+			}
+			if class != "" {
+				w.WriteString(` class="` + class + `"`)
+			}
+			if href != "" {
+				w.WriteString(` href="` + html.EscapeString(href) + `"`)
+			}
+			w.WriteString(">")
+			closers = append(closers, "</"+tag+">")
+
+		case xml.EndElement:
+			if t.Name.Local == "root" || len(closers) == 0 {
+				continue
+			}
+			if t.Name.Local == "thead" {
+				inHead--
+			}
+			closeElement()
+
+		case xml.CharData:
+			w.WriteString(html.EscapeString(string(t)))
+		}
+	}
+
+	// Close the elements a malformed fragment left open, as the result is embedded in pages as is
+	for len(closers) > 0 {
+		closeElement()
+	}
+
+	return strings.TrimSpace(out.String())
+}
+
+// Heading is a heading of a description, as listed in a table of contents.
+type Heading struct {
+	ID    string `json:"id,omitempty"`
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// Headings lists the headings of an inner XML fragment in document order.
+func Headings(content string) []Heading {
+	d := newDecoder(strings.NewReader("<root>" + content + "</root>"))
+
+	var headings []Heading
+	var current *Heading
+	var text strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "heading" {
+				level, _ := strconv.Atoi(attr(t, "level"))
+				current = &Heading{ID: attr(t, "id"), Level: max(level, 1)}
+				text.Reset()
+			}
+		case xml.EndElement:
+			if t.Name.Local == "heading" && current != nil {
+				current.Text = NormalizeSpace(text.String())
+				headings = append(headings, *current)
+				current = nil
+			}
+		case xml.CharData:
+			if current != nil {
+				text.Write(t)
+			}
+		}
+	}
+	return headings
+}
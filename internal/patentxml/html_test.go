@@ -0,0 +1,104 @@
+package patentxml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", ""},
+		{
+			"headings",
+			`<heading id="h-1" level="1">BACKGROUND</heading><heading level="5">Deep</heading><heading>None</heading>`,
+			`<h3 id="h-1">BACKGROUND</h3><h6>Deep</h6><h3>None</h3>`,
+		},
+		{
+			"inline formatting",
+			`<p id="p-1">H<sub>2</sub>O <b>bold</b> <i>it</i> 10<sup>3</sup><br/>next <figref idref="DRAWINGS">FIG. 1</figref> <smallcaps>y</smallcaps> <o>z</o><img id="EMI" file="a.TIF"/></p>`,
+			`<p id="p-1">H<sub>2</sub>O <b>bold</b> <i>it</i> 10<sup>3</sup><br>next <span class="figref">FIG. 1</span> <span class="smallcaps">y</span> <span class="overline">z</span></p>`,
+		},
+
+		// Escaping: the result is embedded in pages as template.HTML, so only the allowlisted elements may
+		// produce markup
+		{"text", `<p>A &amp; B &lt;script&gt;alert(1)&lt;/script&gt; "q" 'a'</p>`, `<p>A &amp; B &lt;script&gt;alert(1)&lt;/script&gt; &#34;q&#34; &#39;a&#39;</p>`},
+		{"unknown elements", `<script>alert(1)</script><style>p{}</style><a href="javascript:x">y</a><iframe src="x"/>`, `alert(1)p{}y`},
+		{"attributes", `<p id='x" onclick="y' style="color:red" onmouseover="z">t</p><b class="evil">b</b>`, `<p id="x&#34; onclick=&#34;y">t</p><b>b</b>`},
+		{"references", `<claim-ref idref="javascript:alert(1)">c</claim-ref><crossref idref="&quot;&gt;&lt;script&gt;">d</crossref><claim-ref>e</claim-ref>`, `<a href="#javascript:alert(1)">c</a><a href="#&#34;&gt;&lt;script&gt;">d</a><a>e</a>`},
+
+		// Tables, lists and claims
+		{
+			"table",
+			`<tables id="TABLE-1"><table><tgroup cols="2"><colspec colname="1"/><thead><row><entry>Sample</entry><entry>Capacity</entry></row></thead><tbody><row><entry>A</entry><entry>100 mAh</entry></row></tbody></tgroup></table></tables>`,
+			`<div id="TABLE-1" class="table"><table><thead><tr><th>Sample</th><th>Capacity</th></tr></thead><tbody><tr><td>A</td><td>100 mAh</td></tr></tbody></table></div>`,
+		},
+		{"lists", `<ul><li>one</li><li>two<ol><li>a</li></ol></li></ul><dl><dt>x</dt><dd>y</dd></dl>`, `<ul><li>one</li><li>two<ol><li>a</li></ol></li></ul><dl><dt>x</dt><dd>y</dd></dl>`},
+		{
+			"claims",
+			`<claim id="CLM-00002" num="00002"><claim-text>2. The battery of <claim-ref idref="CLM-00001, CLM-00003">claims 1 or 3</claim-ref>, wherein:<claim-text>x.</claim-text></claim-text></claim>`,
+			`<div id="CLM-00002" class="claim"><div class="claim-text">2. The battery of <a href="#CLM-00001">claims 1 or 3</a>, wherein:<div class="claim-text">x.</div></div></div>`,
+		},
+
+		// Malformed fragments keep what was converted, with the open elements closed
+		{"unclosed elements", `<p>Text <b>bold`, `<p>Text <b>bold</b></p>`},
+		{"unterminated comment", `<div><p>A <!-- unterminated`, `<p>A </p>`},
+		{"bare less-than", `<table><tbody><row><entry>A & B < C</entry></row></tbody></table><p>lost</p>`, `<table><tbody><tr><td>A &amp; B </td></tr></tbody></table>`},
+	}
+	for _, tt := range tests {
+		if got := HTML(tt.content); got != tt.want {
+			t.Errorf("%s: HTML(%q) =\n%q\nwant\n%q", tt.name, tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestHTMLFixture(t *testing.T) {
+	got := HTML(fixture.Doc(fixture.Grant).Patent.Description.Content)
+	for _, want := range []string{
+		`<h3 id="h-0002">BACKGROUND</h3>`,
+		`<h4 id="h-0004">Description of Related Art</h4>`,
+		`<p id="p-0006"><span class="figref">FIG. 1</span> is a cross section of the battery.</p>`,
+		`<thead><tr><th>Sample</th><th>Capacity</th></tr></thead>`,
+		`<ul><li>first item</li><li>second item</li></ul>`,
+		`H<sub>2</sub>O and 10<sup>3</sup> &lt; x.`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("description HTML does not contain %s", want)
+		}
+	}
+	if strings.Contains(got, "<?") || strings.Contains(got, "colspec") {
+		t.Errorf("description HTML contains source markup: %s", got)
+	}
+}
+
+func TestClaimsHTML(t *testing.T) {
+	got := ClaimsHTML(fixture.Doc(fixture.Grant).Patent.Claims.Content)
+	want := map[string]string{
+		"CLM-00001": `<div class="claim-text">1. A battery comprising:<div class="claim-text">a cathode;</div><div class="claim-text">an anode; and</div><div class="claim-text">a solid electrolyte disposed between the cathode and the anode.</div></div>`,
+		"CLM-00002": `<div class="claim-text">2. The battery of <a href="#CLM-00001">claim 1</a>, wherein the solid electrolyte has a garnet structure.</div>`,
+		"CLM-00003": `<div class="claim-text">3. A method of manufacturing a battery, the method comprising: stacking a cathode, a solid electrolyte and an anode.</div>`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ClaimsHTML = %q, want %q", got, want)
+	}
+
+	// A claim cut short is kept, closed
+	got = ClaimsHTML(`<claim id="CLM-00001"><claim-text>1. A <b>battery`)
+	if want := map[string]string{"CLM-00001": `<div class="claim-text">1. A <b>battery</b></div>`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ClaimsHTML of an unclosed claim = %q, want %q", got, want)
+	}
+}
+
+func TestHeadings(t *testing.T) {
+	got := Headings(`<heading id="h-1" level="1">BACKGROUND</heading><p>x</p><heading level="2">Related <i>Art</i></heading><heading>Plain</heading>`)
+	want := []Heading{{ID: "h-1", Level: 1, Text: "BACKGROUND"}, {Level: 2, Text: "Related Art"}, {Level: 1, Text: "Plain"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Headings = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,200 @@
+package patentxml
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// markdownEscaper escapes the characters of text that Markdown would otherwise read as formatting.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", "&lt;", ">", "&gt;", "|", `\|`,
+)
+
+// lineBreak marks a forced line break within a block until the block's whitespace has been normalized.
+const lineBreak = "\x00"
+
+// markdownList is an open list; items of ordered lists are numbered from 1.
+type markdownList struct {
+	ordered bool
+	items   int
+}
+
+// Markdown converts an inner XML fragment of USPTO markup to GitHub flavored Markdown. Headings, paragraphs,
+// claims, lists, tables, preformatted text and bold and italic text are mapped to their Markdown
+// equivalents; subscripts and superscripts are kept as HTML, and other elements are reduced to their text.
+func Markdown(content string) string {
+	d := newDecoder(strings.NewReader("<root>" + content + "</root>"))
+
+	var blocks []string
+	var block strings.Builder
+	prefix := "" // Prepended to the current block, e.g. "## " or "- "
+	var lists []markdownList
+
+	var rows [][]string
+	var cell *strings.Builder // Receives text while inside a table entry
+	inTable := 0
+	inPre := 0
+
+	out := func() *strings.Builder {
+		if cell != nil {
+			return cell
+		}
+		return &block
+	}
+	flush := func() {
+		text := NormalizeSpace(block.String())
+		text = strings.ReplaceAll(strings.ReplaceAll(text, " "+lineBreak, lineBreak), lineBreak+" ", lineBreak)
+		text = strings.Trim(text, lineBreak)
+		if text != "" {
+			indent := strings.Repeat("   ", max(len(lists)-1, 0))
+			blocks = append(blocks, prefix+strings.ReplaceAll(text, lineBreak, "  \n"+indent))
+		}
+		block.Reset()
+		prefix = ""
+	}
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Keep whatever was converted from a malformed fragment
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p", "claim", "claim-text", "description-of-drawings":
+				if inTable == 0 {
+					flush()
+				}
+			case "heading":
+				flush()
+				level, _ := strconv.Atoi(attr(t, "level"))
+				prefix = strings.Repeat("#", min(max(level, 1)+1, 6)) + " " // # is left to the document title
+			case "ul", "ol":
+				flush()
+				lists = append(lists, markdownList{ordered: t.Name.Local == "ol"})
+			case "li":
+				flush()
+				if len(lists) == 0 {
+					prefix = "- "
+					continue
+				}
+				list := &lists[len(lists)-1]
+				list.items++
+				prefix = strings.Repeat("   ", len(lists)-1) + "- "
+				if list.ordered {
+					prefix = strings.Repeat("   ", len(lists)-1) + strconv.Itoa(list.items) + ". "
+				}
+			case "pre":
+				flush()
+				inPre++
+			case "table":
+				flush()
+				inTable++
+				rows = nil
+			case "row":
+				rows = append(rows, nil)
+			case "entry":
+				cell = &strings.Builder{}
+			case "b":
+				out().WriteString("**")
+			case "i":
+				out().WriteString("*")
+			case "sub", "sup":
+				out().WriteString("<" + t.Name.Local + ">")
+			case "br":
+				out().WriteString(lineBreak)
+			case "img", "colspec":
+				d.Skip()
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p", "claim", "claim-text", "description-of-drawings", "heading", "li":
+				if inTable == 0 {
+					flush()
+				}
+			case "ul", "ol":
+				flush()
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+			case "pre":
+				if inPre > 0 {
+					inPre--
+					if text := strings.Trim(block.String(), "\n"); text != "" {
+						blocks = append(blocks, "```\n"+text+"\n```")
+					}
+					block.Reset()
+				}
+			case "table":
+				if inTable > 0 {
+					inTable--
+					if table := markdownTable(rows); table != "" {
+						blocks = append(blocks, table)
+					}
+					rows = nil
+				}
+			case "entry":
+				if cell != nil && len(rows) > 0 {
+					text := NormalizeSpace(strings.ReplaceAll(cell.String(), lineBreak, " "))
+					rows[len(rows)-1] = append(rows[len(rows)-1], text)
+				}
+				cell = nil
+			case "b":
+				out().WriteString("**")
+			case "i":
+				out().WriteString("*")
+			case "sub", "sup":
+				out().WriteString("</" + t.Name.Local + ">")
+			}
+
+		case xml.CharData:
+			if inPre > 0 {
+				block.Write(t)
+			} else if inTable == 0 || cell != nil {
+				out().WriteString(markdownEscaper.Replace(string(t)))
+			}
+		}
+	}
+	flush()
+
+	return strings.Join(blocks, "\n\n")
+}
+
+// markdownTable renders table rows, using the first row as the header since Markdown tables require one.
+func markdownTable(rows [][]string) string {
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	writeRow := func(row []string) {
+		b.WriteString("|")
+		for i := 0; i < columns; i++ {
+			text := ""
+			if i < len(row) {
+				text = row[i]
+			}
+			b.WriteString(" " + text + " |")
+		}
+		b.WriteString("\n")
+	}
+
+	writeRow(rows[0])
+	b.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,57 @@
+package patentxml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"headings", `<heading level="1">BACKGROUND</heading><heading level="5">Deep</heading><heading>None</heading>`, "## BACKGROUND\n\n###### Deep\n\n## None"},
+		{"paragraphs", `<p>One  line
+continued.</p><p>Two.</p>`, "One line continued.\n\nTwo."},
+		{"escaping", `<p>A *b* _c_ [d](e) |f| \g` + "`h`" + ` &lt;i&gt; &amp;</p>`, `A \*b\* \_c\_ \[d\](e) \|f\| \\g` + "\\`h\\`" + ` &lt;i&gt; &`},
+		{"inline formatting", `<p>H<sub>2</sub>O <b>bold</b> <i>it</i> 10<sup>3</sup><br/>next <figref>FIG. 1</figref></p>`, "H<sub>2</sub>O **bold** *it* 10<sup>3</sup>  \nnext FIG. 1"},
+		{"lists", `<ul><li>one</li><li>two<ol><li>a</li><li>b</li></ol></li></ul><li>loose</li>`, "- one\n\n- two\n\n   1. a\n\n   2. b\n\n- loose"},
+		{
+			"table",
+			`<tables><table><tgroup cols="2"><colspec colname="1"/><thead><row><entry>Sample</entry><entry>A | B</entry></row></thead><tbody><row><entry>A</entry><entry>100 <b>mAh</b></entry></row><row><entry>B</entry></row></tbody></tgroup></table></tables>`,
+			"| Sample | A \\| B |\n| --- | --- |\n| A | 100 **mAh** |\n| B |  |",
+		},
+		{"preformatted", "<pre>  a := 1\n  b *= 2</pre>", "```\n  a := 1\n  b *= 2\n```"},
+		{
+			"claims",
+			`<claim id="CLM-00001"><claim-text>1. A battery comprising:<claim-text>a cathode;</claim-text><claim-text>an anode.</claim-text></claim-text></claim><claim id="CLM-00002"><claim-text>2. The battery of <claim-ref idref="CLM-00001">claim 1</claim-ref>.</claim-text></claim>`,
+			"1. A battery comprising:\n\na cathode;\n\nan anode.\n\n2. The battery of claim 1.",
+		},
+		{"unknown elements", `<p><script>alert(1)</script><img file="a.TIF"/>x</p>`, "alert(1)x"},
+		{"unclosed elements", `<p>Text <i>it`, "Text *it*"},
+		{"unterminated comment", `<p>A</p><p>B <!-- unterminated`, "A\n\nB"},
+	}
+	for _, tt := range tests {
+		if got := Markdown(tt.content); got != tt.want {
+			t.Errorf("%s: Markdown(%q) =\n%q\nwant\n%q", tt.name, tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownFixture(t *testing.T) {
+	got := Markdown(fixture.Doc(fixture.Grant).Patent.Description.Content)
+	for _, want := range []string{
+		"## BACKGROUND\n\n### Technical Field\n\nThe present disclosure relates to batteries.",
+		"| Sample | Capacity |\n| --- | --- |\n| A | 100 mAh |\n| B | 120 mAh |",
+		"- first item\n\n- second item",
+		"The formula is H<sub>2</sub>O and 10<sup>3</sup> &lt; x.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("description Markdown does not contain %q", want)
+		}
+	}
+}
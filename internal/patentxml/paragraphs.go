@@ -0,0 +1,74 @@
+package patentxml
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Paragraph is a top-level paragraph of an inner XML fragment, such as a description.
+type Paragraph struct {
+	ID      string `json:"id,omitempty"`
+	Heading string `json:"heading,omitempty"` // Text of the closest preceding heading, empty before the first
+	Text    string `json:"text"`              // Plain text with whitespace normalized
+}
+
+// Paragraphs lists the paragraphs of a fragment in document order. Nested markup such as tables and lists
+// is flattened into the text of the paragraph containing it; text outside any paragraph is omitted.
+func Paragraphs(content string) []Paragraph {
+	d := newDecoder(strings.NewReader("<root>" + content + "</root>"))
+
+	var paragraphs []Paragraph
+	var current *Paragraph
+	var text strings.Builder
+	heading, inHeading := "", false
+	depth := 0 // Depth of elements open within the current paragraph
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			// Keep the paragraphs read before the end or an error
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if current != nil {
+				depth++
+				if blockElements[t.Name.Local] {
+					text.WriteByte(' ')
+				}
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				current = &Paragraph{ID: attr(t, "id"), Heading: heading}
+				text.Reset()
+				depth = 0
+			case "heading":
+				inHeading = true
+				text.Reset()
+			}
+		case xml.EndElement:
+			if current != nil {
+				if depth > 0 {
+					depth--
+					if blockElements[t.Name.Local] {
+						text.WriteByte(' ')
+					}
+					continue
+				}
+				if current.Text = NormalizeSpace(text.String()); current.Text != "" {
+					paragraphs = append(paragraphs, *current)
+				}
+				current = nil
+			} else if inHeading && t.Name.Local == "heading" {
+				heading = NormalizeSpace(text.String())
+				inHeading = false
+			}
+		case xml.CharData:
+			if current != nil || inHeading {
+				text.Write(t)
+			}
+		}
+	}
+	return paragraphs
+}
@@ -0,0 +1,203 @@
+package patentxml
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Conventional sections of a patent description.
+const (
+	SectionCrossReference     = "cross_reference"
+	SectionGovernmentInterest = "government_interest"
+	SectionField              = "field"
+	SectionBackground         = "background"
+	SectionSummary            = "summary"
+	SectionDrawings           = "drawings" // Brief description of the drawings
+	SectionDetailed           = "detailed_description"
+	SectionOther              = "other" // Content before the first recognized section
+)
+
+// Confidence of a segmentation.
+const (
+	SegmentationHigh   = "high"   // The detailed description and at least two other sections were recognized by their headings
+	SegmentationMedium = "medium" // Some sections were recognized, by heading or by the markers of the bulk data
+	SegmentationLow    = "low"    // No section was recognized; the whole description is the detailed description
+)
+
+// DescriptionSection is a contiguous part of a description. A name may recur, for instance when a
+// background is split into field and related art subsections.
+type DescriptionSection struct {
+	Name    string
+	Heading string // Text of the heading that started the section, if any
+	Content string // Inner XML, including the heading
+}
+
+// Segmentation is a description divided into named sections.
+type Segmentation struct {
+	Sections   []DescriptionSection
+	Confidence string
+	Fallback   bool // No section was recognized and the description was kept whole
+}
+
+// Content returns the inner XML of every section with the given name, in document order.
+func (s *Segmentation) Content(name string) string {
+	var parts []string
+	for _, section := range s.Sections {
+		if section.Name == name {
+			parts = append(parts, section.Content)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// sectionRules classify headings by the phrases they contain, checked in order so that, for example,
+// "Description of Related Art" is a background rather than a detailed description.
+var sectionRules = []struct {
+	name    string
+	phrases []string
+}{
+	{SectionCrossReference, []string{"CROSS-REFERENCE", "CROSS REFERENCE", "RELATED APPLICATION", "PRIORITY CLAIM", "CLAIM OF PRIORITY", "CLAIM FOR PRIORITY", "INCORPORATION BY REFERENCE"}},
+	{SectionGovernmentInterest, []string{"FEDERALLY SPONSORED", "FEDERALLY-SPONSORED", "GOVERNMENT INTEREST", "GOVERNMENT RIGHTS", "GOVERNMENT SUPPORT", "GOVERNMENT LICENSE", "FEDERAL RESEARCH", "FEDERAL FUNDING"}},
+	{SectionDrawings, []string{"DESCRIPTION OF THE DRAWING", "DESCRIPTION OF DRAWING", "DESCRIPTION OF THE FIGURE", "DESCRIPTION OF FIGURE", "DESCRIPTION OF THE SEVERAL VIEWS", "DESCRIPTION OF THE ACCOMPANYING DRAWING"}},
+	{SectionBackground, []string{"BACKGROUND", "RELATED ART", "PRIOR ART", "STATE OF THE ART", "DESCRIPTION OF THE RELATED", "DESCRIPTION OF RELATED"}},
+	{SectionField, []string{"FIELD"}},
+	{SectionSummary, []string{"SUMMARY", "BRIEF DESCRIPTION OF THE INVENTION", "DISCLOSURE OF THE INVENTION", "DISCLOSURE OF INVENTION", "OBJECTS OF THE INVENTION"}},
+	{SectionDetailed, []string{"DETAILED DESCRIPTION", "DESCRIPTION OF EMBODIMENT", "DESCRIPTION OF THE EMBODIMENT", "DESCRIPTION OF THE PREFERRED", "DESCRIPTION OF PREFERRED", "DESCRIPTION OF EXAMPLE", "DESCRIPTION OF ILLUSTRATIVE", "MODE FOR CARRYING OUT", "MODES FOR CARRYING OUT", "BEST MODE", "DETAILED EMBODIMENTS"}},
+}
+
+// markerSections maps the processing instructions that open the parts of USPTO descriptions to sections.
+// The brief summary marker (BRFSUM) is not used, as it spans the field, background and summary.
+var markerSections = map[string]string{
+	"cross-reference-to-related-applications": SectionCrossReference,
+	"relapp":                        SectionCrossReference,
+	"federal-research-statement":    SectionGovernmentInterest,
+	"govint":                        SectionGovernmentInterest,
+	"brief-description-of-drawings": SectionDrawings,
+	"brfdrawings":                   SectionDrawings,
+	"detailed-description":          SectionDetailed,
+	"detdesc":                       SectionDetailed,
+}
+
+// classifyHeading returns the section a heading starts, or "" for other headings such as those of examples.
+func classifyHeading(text string) string {
+	text = strings.ToUpper(NormalizeSpace(text))
+	for _, rule := range sectionRules {
+		for _, phrase := range rule.phrases {
+			if strings.Contains(text, phrase) {
+				return rule.name
+			}
+		}
+	}
+	return ""
+}
+
+// sectionBoundary is where a section starts, as an offset into the description.
+type sectionBoundary struct {
+	offset    int
+	name      string
+	heading   string
+	byHeading bool
+}
+
+// SegmentDescription divides the inner XML of a description into conventional sections, recognized by their
+// headings and by the processing instructions that mark them in the bulk data. Unrecognized headings, such
+// as those of examples, stay within the current section.
+func SegmentDescription(content string) *Segmentation {
+	const wrapper = "<root>"
+	d := newDecoder(strings.NewReader(wrapper + content + "</root>"))
+	offset := func(inputOffset int64) int {
+		return min(max(int(inputOffset)-len(wrapper), 0), len(content))
+	}
+
+	var boundaries []sectionBoundary
+	depth := 0
+	for {
+		start := offset(d.InputOffset())
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth != 2 {
+				continue
+			}
+			switch t.Name.Local {
+			case "heading":
+				var text strings.Builder
+				for level := 1; level > 0; {
+					tok, err := d.Token()
+					if err != nil {
+						break
+					}
+					switch t := tok.(type) {
+					case xml.StartElement:
+						level++
+					case xml.EndElement:
+						level--
+					case xml.CharData:
+						text.Write(t)
+					}
+				}
+				depth--
+				heading := NormalizeSpace(text.String())
+				if name := classifyHeading(heading); name != "" {
+					boundaries = append(boundaries, sectionBoundary{offset: start, name: name, heading: heading, byHeading: true})
+				}
+			case "description-of-drawings":
+				boundaries = append(boundaries, sectionBoundary{offset: start, name: SectionDrawings})
+			}
+		case xml.EndElement:
+			depth--
+		case xml.ProcInst:
+			if depth != 1 || !strings.Contains(string(t.Inst), `end="lead"`) {
+				continue
+			}
+			if name, ok := markerSections[strings.ToLower(t.Target)]; ok {
+				boundaries = append(boundaries, sectionBoundary{offset: start, name: name})
+			}
+		}
+	}
+
+	seg := &Segmentation{}
+	if len(boundaries) == 0 {
+		seg.Sections = []DescriptionSection{{Name: SectionDetailed, Content: strings.TrimSpace(content)}}
+		seg.Confidence, seg.Fallback = SegmentationLow, true
+		return seg
+	}
+
+	if lead := strings.TrimSpace(content[:boundaries[0].offset]); lead != "" {
+		seg.Sections = append(seg.Sections, DescriptionSection{Name: SectionOther, Content: lead})
+	}
+	recognized := map[string]bool{}
+	for i := 0; i < len(boundaries); {
+		b := boundaries[i]
+		heading := b.heading
+		// A marker and the heading that follows it open a single section
+		j := i + 1
+		for ; j < len(boundaries) && boundaries[j].name == b.name; j++ {
+			if heading == "" {
+				heading = boundaries[j].heading
+			}
+			if boundaries[j].byHeading {
+				recognized[b.name] = true
+			}
+		}
+		if b.byHeading {
+			recognized[b.name] = true
+		}
+		end := len(content)
+		if j < len(boundaries) {
+			end = boundaries[j].offset
+		}
+		seg.Sections = append(seg.Sections, DescriptionSection{Name: b.name, Heading: heading, Content: strings.TrimSpace(content[b.offset:end])})
+		i = j
+	}
+
+	seg.Confidence = SegmentationMedium
+	if recognized[SectionDetailed] && len(recognized) >= 3 {
+		seg.Confidence = SegmentationHigh
+	}
+	return seg
+}
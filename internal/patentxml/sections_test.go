@@ -0,0 +1,148 @@
+package patentxml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func TestSegmentDescription(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		want           []DescriptionSection
+		wantConfidence string
+		wantFallback   bool
+	}{
+		{
+			name:           "empty",
+			content:        "",
+			want:           []DescriptionSection{{Name: SectionDetailed}},
+			wantConfidence: SegmentationLow,
+			wantFallback:   true,
+		},
+		{
+			name:           "nonstandard headings only",
+			content:        `<heading>EXAMPLE 1</heading><p>Mix.</p><heading>Comparative Example</heading><p>Stir.</p>`,
+			want:           []DescriptionSection{{Name: SectionDetailed, Content: `<heading>EXAMPLE 1</heading><p>Mix.</p><heading>Comparative Example</heading><p>Stir.</p>`}},
+			wantConfidence: SegmentationLow,
+			wantFallback:   true,
+		},
+		{
+			name:    "related art is background",
+			content: `<heading>FIELD</heading><p>Batteries.</p><heading>Description of Related Art</heading><p>Leaks.</p>`,
+			want: []DescriptionSection{
+				{Name: SectionField, Heading: "FIELD", Content: `<heading>FIELD</heading><p>Batteries.</p>`},
+				{Name: SectionBackground, Heading: "Description of Related Art", Content: `<heading>Description of Related Art</heading><p>Leaks.</p>`},
+			},
+			wantConfidence: SegmentationMedium,
+		},
+		{
+			name: "marker and heading merge",
+			content: `<?detailed-description description="Detailed Description" end="lead"?>` + "\n" +
+				`<heading>DETAILED DESCRIPTION</heading><p>A.</p>` + "\n" +
+				`<?detailed-description description="Detailed Description" end="tail"?>`,
+			want: []DescriptionSection{{
+				Name:    SectionDetailed,
+				Heading: "DETAILED DESCRIPTION",
+				Content: `<?detailed-description description="Detailed Description" end="lead"?>` + "\n" +
+					`<heading>DETAILED DESCRIPTION</heading><p>A.</p>` + "\n" +
+					`<?detailed-description description="Detailed Description" end="tail"?>`,
+			}},
+			wantConfidence: SegmentationMedium,
+		},
+		{
+			name:    "markers without headings",
+			content: `<p>Intro.</p><?GOVINT end="lead"?><p>Funded.</p><?GOVINT end="tail"?><?BRFSUM end="lead"?><p>Summary.</p><description-of-drawings><p>FIG. 1 shows it.</p></description-of-drawings>`,
+			want: []DescriptionSection{
+				{Name: SectionOther, Content: `<p>Intro.</p>`},
+				{Name: SectionGovernmentInterest, Content: `<?GOVINT end="lead"?><p>Funded.</p><?GOVINT end="tail"?><?BRFSUM end="lead"?><p>Summary.</p>`},
+				{Name: SectionDrawings, Content: `<description-of-drawings><p>FIG. 1 shows it.</p></description-of-drawings>`},
+			},
+			wantConfidence: SegmentationMedium,
+		},
+		{
+			name:    "nonstandard headings stay in the section",
+			content: `<heading>BACKGROUND <i>of</i>  the invention</heading><p>Old.</p><heading>SUMMARY</heading><p>New.</p><heading>DETAILED DESCRIPTION</heading><p>A.</p><heading>EXAMPLE 1</heading><p>B.</p>`,
+			want: []DescriptionSection{
+				{Name: SectionBackground, Heading: "BACKGROUND of the invention", Content: `<heading>BACKGROUND <i>of</i>  the invention</heading><p>Old.</p>`},
+				{Name: SectionSummary, Heading: "SUMMARY", Content: `<heading>SUMMARY</heading><p>New.</p>`},
+				{Name: SectionDetailed, Heading: "DETAILED DESCRIPTION", Content: `<heading>DETAILED DESCRIPTION</heading><p>A.</p><heading>EXAMPLE 1</heading><p>B.</p>`},
+			},
+			wantConfidence: SegmentationHigh,
+		},
+		{
+			name:    "adjacent headings of one section",
+			content: `<heading>BACKGROUND</heading><heading>Prior Art</heading><p>Old.</p><heading>DETAILED DESCRIPTION</heading><p>A.</p>`,
+			want: []DescriptionSection{
+				{Name: SectionBackground, Heading: "BACKGROUND", Content: `<heading>BACKGROUND</heading><heading>Prior Art</heading><p>Old.</p>`},
+				{Name: SectionDetailed, Heading: "DETAILED DESCRIPTION", Content: `<heading>DETAILED DESCRIPTION</heading><p>A.</p>`},
+			},
+			wantConfidence: SegmentationMedium,
+		},
+		{
+			name:           "nested heading ignored",
+			content:        `<p>See <heading>SUMMARY</heading> below.</p>`,
+			want:           []DescriptionSection{{Name: SectionDetailed, Content: `<p>See <heading>SUMMARY</heading> below.</p>`}},
+			wantConfidence: SegmentationLow,
+			wantFallback:   true,
+		},
+		{
+			name:    "unclosed element",
+			content: `<heading>SUMMARY</heading><p>New`,
+			want: []DescriptionSection{
+				{Name: SectionSummary, Heading: "SUMMARY", Content: `<heading>SUMMARY</heading><p>New`},
+			},
+			wantConfidence: SegmentationMedium,
+		},
+	}
+	for _, tt := range tests {
+		seg := SegmentDescription(tt.content)
+		if !reflect.DeepEqual(seg.Sections, tt.want) {
+			t.Errorf("%s: sections = %+v\nwant %+v", tt.name, seg.Sections, tt.want)
+		}
+		if seg.Confidence != tt.wantConfidence || seg.Fallback != tt.wantFallback {
+			t.Errorf("%s: confidence %s, fallback %t, want %s, %t", tt.name, seg.Confidence, seg.Fallback, tt.wantConfidence, tt.wantFallback)
+		}
+	}
+}
+
+func TestSegmentDescriptionFixture(t *testing.T) {
+	seg := SegmentDescription(fixture.Doc(fixture.Grant).Patent.Description.Content)
+
+	type section struct{ name, heading string }
+	var got []section
+	for _, s := range seg.Sections {
+		got = append(got, section{s.Name, s.Heading})
+	}
+	want := []section{
+		{SectionCrossReference, "CROSS-REFERENCE TO RELATED APPLICATIONS"},
+		{SectionBackground, "BACKGROUND"},
+		{SectionField, "Technical Field"},
+		{SectionBackground, "Description of Related Art"},
+		{SectionSummary, "SUMMARY"},
+		{SectionDrawings, "BRIEF DESCRIPTION OF THE DRAWINGS"},
+		{SectionDetailed, "DETAILED DESCRIPTION"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sections = %v, want %v", got, want)
+	}
+	if seg.Confidence != SegmentationHigh || seg.Fallback {
+		t.Errorf("confidence %s, fallback %t", seg.Confidence, seg.Fallback)
+	}
+
+	// Both parts of the background are returned, in order, and no content is lost between sections
+	background := seg.Content(SectionBackground)
+	if !strings.HasPrefix(background, `<heading id="h-0002"`) || !strings.Contains(background, "\n"+`<heading id="h-0004"`) || strings.Contains(background, "Technical Field") {
+		t.Errorf("background = %q", background)
+	}
+	var total int
+	for _, s := range seg.Sections {
+		total += len(strings.Join(strings.Fields(s.Content), ""))
+	}
+	if want := len(strings.Join(strings.Fields(fixture.Doc(fixture.Grant).Patent.Description.Content), "")); total != want {
+		t.Errorf("sections hold %d non-space bytes, the description %d", total, want)
+	}
+}
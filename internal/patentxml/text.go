@@ -0,0 +1,58 @@
+package patentxml
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// blockElements are rendered on their own line when converting inner XML to plain text.
+var blockElements = map[string]bool{
+	"p": true, "heading": true, "claim": true, "claim-text": true, "li": true,
+	"row": true, "table": true, "description-of-drawings": true, "br": true,
+}
+
+// PlainText strips the markup from an inner XML fragment, decoding entities and normalizing
+// whitespace. Block level elements such as paragraphs and headings are separated by newlines.
+func PlainText(content string) string {
+	d := newDecoder(strings.NewReader("<root>" + content + "</root>"))
+
+	var lines []string
+	var line strings.Builder
+	breakLine := func() {
+		if text := NormalizeSpace(line.String()); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Fall back to whatever was recovered from a malformed fragment
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if blockElements[t.Name.Local] {
+				breakLine()
+			} else if t.Name.Local == "entry" {
+				// Keep the cells of a table row apart
+				line.WriteString(" ")
+			}
+		case xml.EndElement:
+			if blockElements[t.Name.Local] {
+				breakLine()
+			}
+		case xml.CharData:
+			line.Write(t)
+		}
+	}
+	breakLine()
+
+	return strings.Join(lines, "\n")
+}
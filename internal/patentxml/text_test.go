@@ -0,0 +1,36 @@
+package patentxml
+
+import (
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"blocks", `<heading>SUMMARY</heading><p>One  line
+continued.</p><p>Two<br/>three.</p>`, "SUMMARY\nOne line continued.\nTwo\nthree."},
+		{"entities", `<p>A &amp; B &lt;i&gt; &#x3bc;m &mdash; H<sub>2</sub>O</p>`, "A & B <i> μm — H2O"},
+		{"table", `<table><tgroup><thead><row><entry>Sample</entry><entry>Capacity</entry></row></thead><tbody><row><entry>A</entry><entry>100 mAh</entry></row></tbody></tgroup></table>`, "Sample Capacity\nA 100 mAh"},
+		{"list", `<ul><li>one</li><li>two</li></ul>`, "one\ntwo"},
+		{"claims", `<claim id="CLM-00001"><claim-text>1. A battery comprising:<claim-text>a cathode;</claim-text></claim-text></claim><claim id="CLM-00002"><claim-text>2. The battery of <claim-ref idref="CLM-00001">claim 1</claim-ref>.</claim-text></claim>`, "1. A battery comprising:\na cathode;\n2. The battery of claim 1."},
+		{"unclosed elements", `<p>Text <b>bold`, "Text bold"},
+		{"unterminated comment", `<p>A</p><p>B <!-- unterminated`, "A\nB"},
+		{"bare less-than", `<p>A & B < C</p>`, "A & B"},
+	}
+	for _, tt := range tests {
+		if got := PlainText(tt.content); got != tt.want {
+			t.Errorf("%s: PlainText(%q) = %q, want %q", tt.name, tt.content, got, tt.want)
+		}
+	}
+
+	doc := fixture.Doc(fixture.Grant)
+	if got, want := PlainText(doc.Patent.Abstract.Content), "A solid electrolyte battery includes a cathode & an anode. The electrolyte has a garnet structure."; got != want {
+		t.Errorf("abstract = %q, want %q", got, want)
+	}
+}
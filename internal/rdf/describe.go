@@ -0,0 +1,209 @@
+package rdf
+
+import (
+	_ "embed"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// Vocabulary is the Turtle description of the patent vocabulary.
+//
+//go:embed vocab.ttl
+var Vocabulary []byte
+
+// Input is the content of a document to describe. Title is plain text and Abstract inner XML, as parsed from
+// the bulk data; the remaining bibliographic data is read from Raw, the raw split document.
+type Input struct {
+	Raw            []byte
+	DocumentType   string // "grant" or "application"
+	Title          string
+	Abstract       string
+	NumberOfClaims int
+}
+
+// IRIs mints the IRIs of resources below a base IRI. Documents and applications are identified by their
+// normalized numbers, so the same document has the same IRI in every run and in every document citing it.
+type IRIs struct {
+	Base string // Ends with "/" or "#"
+}
+
+// Document returns the IRI of a patent document from its normalized number, e.g. <base>document/US11000000.
+func (i IRIs) Document(number string) string {
+	return i.Base + "document/" + url.PathEscape(number)
+}
+
+// Application returns the IRI of an application from its normalized number.
+func (i IRIs) Application(number string) string {
+	return i.Base + "application/" + url.PathEscape(number)
+}
+
+// Classification returns the IRI of a CPC or IPC symbol, e.g. <base>cpc/H01M10-052.
+func (i IRIs) Classification(c patentxml.Classification) string {
+	symbol := c.Section + c.Class + c.Subclass + strings.TrimSpace(c.Group) + "-" + strings.TrimSpace(c.Subgroup)
+	return i.Base + url.PathEscape(c.Scheme) + "/" + url.PathEscape(symbol)
+}
+
+// Describe builds the graph of a document: the document, its application and priority applications, its
+// parties, classifications and citations.
+func Describe(in Input, iris IRIs) (*Graph, error) {
+	biblio, err := patentxml.ParseBibliographic(in.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing bibliographic data: %w", err)
+	}
+	pub := biblio.Publication
+	number := patentxml.NormalizeDocNumber(pub.Country, pub.DocNumber)
+	if number == "" {
+		return nil, fmt.Errorf("document has no publication number")
+	}
+
+	g := &Graph{}
+	doc := iris.Document(number)
+	g.Add(doc, RDF+"type", IRI(Vocab+"PatentDocument"))
+	if strings.EqualFold(in.DocumentType, "grant") {
+		g.Add(doc, RDF+"type", IRI(Vocab+"Grant"))
+	} else {
+		g.Add(doc, RDF+"type", IRI(Vocab+"PublishedApplication"))
+	}
+	g.AddString(doc, Schema+"identifier", number+pub.Kind)
+	g.AddString(doc, Vocab+"documentNumber", number)
+	g.AddString(doc, Vocab+"country", strings.ToUpper(pub.Country))
+	g.AddString(doc, Vocab+"kindCode", pub.Kind)
+	g.AddDate(doc, Schema+"datePublished", pub.Date)
+	g.AddText(doc, Schema+"name", patentxml.NormalizeSpace(in.Title))
+	g.AddText(doc, Schema+"abstract", patentxml.PlainText(in.Abstract))
+	g.AddString(doc, Vocab+"applicationType", biblio.ApplicationType)
+	if in.NumberOfClaims > 0 {
+		g.Add(doc, Vocab+"numberOfClaims", Integer(in.NumberOfClaims))
+	}
+
+	app := biblio.Application
+	if appNumber := patentxml.NormalizeDocNumber(app.Country, app.DocNumber); appNumber != "" {
+		appIRI := iris.Application(appNumber)
+		g.Add(doc, Vocab+"application", IRI(appIRI))
+		g.Add(appIRI, RDF+"type", IRI(Vocab+"Application"))
+		g.AddString(appIRI, Vocab+"applicationNumber", appNumber)
+		g.AddString(appIRI, Vocab+"country", strings.ToUpper(app.Country))
+		g.AddDate(appIRI, Vocab+"filingDate", app.Date)
+		g.AddString(appIRI, Vocab+"seriesCode", biblio.SeriesCode)
+	}
+	for _, p := range biblio.PriorityClaims {
+		priorityNumber := patentxml.NormalizeDocNumber(p.Country, p.DocNumber)
+		if priorityNumber == "" {
+			continue
+		}
+		appIRI := iris.Application(priorityNumber)
+		g.Add(doc, Vocab+"priorityClaim", IRI(appIRI))
+		g.Add(appIRI, RDF+"type", IRI(Vocab+"Application"))
+		g.AddString(appIRI, Vocab+"applicationNumber", priorityNumber)
+		g.AddString(appIRI, Vocab+"country", strings.ToUpper(p.Country))
+		g.AddDate(appIRI, Vocab+"filingDate", p.Date)
+	}
+
+	for _, parties := range []struct {
+		role    string
+		parties []patentxml.Party
+	}{
+		{"inventor", biblio.Inventors},
+		{"applicant", biblio.Applicants},
+		{"assignee", biblio.Assignees},
+	} {
+		for i, p := range parties.parties {
+			sequence := p.Sequence
+			if sequence == 0 {
+				sequence = i + 1
+			}
+			party := doc + "/" + parties.role + "/" + strconv.Itoa(sequence)
+			g.Add(doc, Vocab+parties.role, IRI(party))
+			describeParty(g, party, p)
+			g.Add(party, Vocab+"sequence", Integer(sequence))
+		}
+	}
+	for _, e := range biblio.Examiners {
+		examiner := doc + "/examiner/" + url.PathEscape(e.Level)
+		g.Add(doc, Vocab+e.Level+"Examiner", IRI(examiner))
+		g.Add(examiner, RDF+"type", IRI(Schema+"Person"))
+		g.AddString(examiner, Schema+"name", strings.TrimSpace(e.FirstName+" "+e.LastName))
+		g.AddString(examiner, Schema+"givenName", e.FirstName)
+		g.AddString(examiner, Schema+"familyName", e.LastName)
+		g.AddString(examiner, Vocab+"artUnit", e.Department)
+	}
+
+	classes := map[string]bool{}
+	mainIPC := true
+	for _, c := range biblio.Classifications {
+		class := iris.Classification(c)
+		main := c.Main || (c.Scheme == "ipc" && mainIPC)
+		if c.Scheme == "ipc" {
+			mainIPC = false
+		}
+		if main {
+			g.Add(doc, Vocab+"mainClassification", IRI(class))
+		}
+		if classes[class] {
+			continue
+		}
+		classes[class] = true
+		g.Add(doc, Vocab+"classification", IRI(class))
+		if c.Scheme == "cpc" {
+			g.Add(class, RDF+"type", IRI(Vocab+"CPCSymbol"))
+		} else {
+			g.Add(class, RDF+"type", IRI(Vocab+"IPCSymbol"))
+		}
+		g.AddString(class, Vocab+"symbol", strings.Join(strings.Fields(c.Symbol()), " "))
+	}
+
+	for i, c := range biblio.Citations {
+		sequence := c.Sequence
+		if sequence == 0 {
+			sequence = i + 1
+		}
+		citation := doc + "/citation/" + strconv.Itoa(sequence)
+		g.Add(doc, Vocab+"citation", IRI(citation))
+		g.Add(citation, RDF+"type", IRI(Vocab+"Citation"))
+		g.Add(citation, Vocab+"sequence", Integer(sequence))
+		g.AddString(citation, Vocab+"citedBy", c.CitedBy())
+		if !c.Patent {
+			g.AddString(citation, Vocab+"citationText", patentxml.NormalizeSpace(c.Text))
+			continue
+		}
+		citedNumber := patentxml.NormalizeDocNumber(c.Document.Country, c.Document.DocNumber)
+		if citedNumber == "" {
+			continue
+		}
+		cited := iris.Document(citedNumber)
+		g.Add(doc, Schema+"citation", IRI(cited))
+		g.Add(citation, Vocab+"citedDocument", IRI(cited))
+		g.AddString(citation, Vocab+"kindCode", c.Document.Kind)
+		g.Add(cited, RDF+"type", IRI(Vocab+"PatentDocument"))
+		g.AddString(cited, Vocab+"documentNumber", citedNumber)
+	}
+	return g, nil
+}
+
+// describeParty adds a person or organization and its postal address.
+func describeParty(g *Graph, party string, p patentxml.Party) {
+	if p.OrgName != "" {
+		g.Add(party, RDF+"type", IRI(Schema+"Organization"))
+	} else {
+		g.Add(party, RDF+"type", IRI(Schema+"Person"))
+		g.AddString(party, Schema+"givenName", p.FirstName)
+		g.AddString(party, Schema+"familyName", p.LastName)
+	}
+	g.AddString(party, Schema+"name", p.Name())
+
+	a := p.Address
+	if strings.TrimSpace(a.City+a.State+a.Postcode+a.Country) == "" {
+		return
+	}
+	address := party + "/address"
+	g.Add(party, Schema+"address", IRI(address))
+	g.Add(address, RDF+"type", IRI(Schema+"PostalAddress"))
+	g.AddString(address, Schema+"addressLocality", patentxml.NormalizeSpace(a.City))
+	g.AddString(address, Schema+"addressRegion", a.State)
+	g.AddString(address, Schema+"postalCode", a.Postcode)
+	g.AddString(address, Schema+"addressCountry", a.Country)
+}
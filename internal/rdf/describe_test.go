@@ -0,0 +1,97 @@
+package rdf
+
+import (
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func describeFixture(t *testing.T) *Graph {
+	t.Helper()
+	doc := fixture.Doc(fixture.Grant)
+	g, err := Describe(Input{
+		Raw:            doc.RawSplitDoc,
+		DocumentType:   "grant",
+		Title:          doc.Patent.UsBibliographicData.InventionTitle.Text,
+		Abstract:       doc.Patent.Abstract.Content,
+		NumberOfClaims: doc.Patent.UsBibliographicData.NumberOfClaims,
+	}, IRIs{Base: "https://example.org/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestDescribe(t *testing.T) {
+	g := describeFixture(t)
+	doc := "https://example.org/document/US11000000"
+	tests := []Triple{
+		{doc, RDF + "type", IRI(Vocab + "Grant")},
+		{doc, Schema + "identifier", String("US11000000B2")},
+		{doc, Schema + "datePublished", Date("2024-01-02")},
+		{doc, Schema + "name", Text("Solid electrolyte battery & method")},
+		{doc, Vocab + "numberOfClaims", Integer(3)},
+		{doc, Vocab + "application", IRI("https://example.org/application/US17123456")},
+		{"https://example.org/application/US17123456", Vocab + "filingDate", Date("2021-03-15")},
+		{doc, Vocab + "priorityClaim", IRI("https://example.org/application/JP2020012345")},
+		{doc + "/inventor/2", Schema + "familyName", String("Müller")},
+		{doc + "/inventor/2/address", Schema + "addressRegion", String("TX")},
+		{doc + "/assignee/1", RDF + "type", IRI(Schema + "Organization")},
+		{doc + "/examiner/primary", Vocab + "artUnit", String("1700")},
+		{doc, Vocab + "mainClassification", IRI("https://example.org/cpc/H01M10-052")},
+		{"https://example.org/ipc/H01M10-052", RDF + "type", IRI(Vocab + "IPCSymbol")},
+		{doc, Schema + "citation", IRI("https://example.org/document/US5123456")},
+		{doc + "/citation/1", Vocab + "citedBy", String("examiner")},
+		{doc + "/citation/2", Vocab + "citedDocument", IRI("https://example.org/document/US20150012345")},
+		{doc + "/citation/3", Vocab + "citationText", String("Doe, “Lithium things,” J. Batt. 2019.")},
+	}
+	for _, want := range tests {
+		found := false
+		for _, triple := range g.Triples {
+			if triple == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing triple %v", want)
+		}
+	}
+
+	citations := 0
+	for _, triple := range g.Triples {
+		if triple.Subject == doc && triple.Predicate == Schema+"citation" {
+			citations++
+		}
+	}
+	if citations != 2 {
+		t.Errorf("document cites %d patent documents, want 2", citations)
+	}
+}
+
+func TestDescribeErrors(t *testing.T) {
+	if _, err := Describe(Input{}, IRIs{Base: "https://example.org/"}); err == nil {
+		t.Error("Describe without a raw document: no error")
+	}
+	raw := []byte(`<us-patent-grant><us-bibliographic-data-grant></us-bibliographic-data-grant></us-patent-grant>`)
+	if _, err := Describe(Input{Raw: raw}, IRIs{Base: "https://example.org/"}); err == nil {
+		t.Error("Describe without a publication number: no error")
+	}
+}
+
+func TestIRIs(t *testing.T) {
+	iris := IRIs{Base: "https://example.org/"}
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{iris.Document("US11000000"), "https://example.org/document/US11000000"},
+		{iris.Application("US 17/123 456"), "https://example.org/application/US%2017%2F123%20456"},
+		{iris.Document("US<1>"), "https://example.org/document/US%3C1%3E"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("IRI = %s, want %s", tt.got, tt.want)
+		}
+	}
+}
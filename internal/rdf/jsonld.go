@@ -0,0 +1,164 @@
+package rdf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// JSONLDWriter writes graphs to a single JSON-LD document, as a @graph of flattened node objects with a
+// @context declaring the vocabulary prefixes. Properties and types are written as compact IRIs.
+type JSONLDWriter struct {
+	w     *bufio.Writer
+	nodes int
+}
+
+// NewJSONLDWriter writes the start of a JSON-LD document, up to the opening of its @graph.
+func NewJSONLDWriter(w *bufio.Writer) (*JSONLDWriter, error) {
+	prefixes := make([]string, 0, len(Prefixes))
+	for prefix := range Prefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	w.WriteString("{\n  \"@context\": {")
+	for i, prefix := range prefixes {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString("\n    ")
+		writeJSONString(w, prefix)
+		w.WriteString(": ")
+		writeJSONString(w, Prefixes[prefix])
+	}
+	_, err := w.WriteString("\n  },\n  \"@graph\": [")
+	return &JSONLDWriter{w: w}, err
+}
+
+// jsonLDNode is a node object: the properties of a subject, in the order they were first added.
+type jsonLDNode struct {
+	id         string
+	types      []string
+	properties []string
+	values     map[string][]Term
+}
+
+// WriteGraph appends a node object to the @graph for each subject of the graph.
+func (j *JSONLDWriter) WriteGraph(g *Graph) error {
+	var nodes []*jsonLDNode
+	bySubject := map[string]*jsonLDNode{}
+	for _, t := range g.Triples {
+		n, ok := bySubject[t.Subject]
+		if !ok {
+			n = &jsonLDNode{id: t.Subject, values: map[string][]Term{}}
+			bySubject[t.Subject] = n
+			nodes = append(nodes, n)
+		}
+		if t.Predicate == RDF+"type" && t.Object.IsIRI() {
+			n.types = append(n.types, compact(t.Object.IRI))
+			continue
+		}
+		if _, ok := n.values[t.Predicate]; !ok {
+			n.properties = append(n.properties, t.Predicate)
+		}
+		n.values[t.Predicate] = append(n.values[t.Predicate], t.Object)
+	}
+
+	for _, n := range nodes {
+		if j.nodes > 0 {
+			j.w.WriteByte(',')
+		}
+		j.nodes++
+		j.w.WriteString("\n    {\"@id\": ")
+		writeJSONString(j.w, n.id)
+		if len(n.types) > 0 {
+			j.w.WriteString(", \"@type\": ")
+			if len(n.types) == 1 {
+				writeJSONString(j.w, n.types[0])
+			} else {
+				j.w.WriteByte('[')
+				for i, t := range n.types {
+					if i > 0 {
+						j.w.WriteString(", ")
+					}
+					writeJSONString(j.w, t)
+				}
+				j.w.WriteByte(']')
+			}
+		}
+		for _, p := range n.properties {
+			j.w.WriteString(", ")
+			writeJSONString(j.w, compact(p))
+			j.w.WriteString(": ")
+			values := n.values[p]
+			if len(values) > 1 {
+				j.w.WriteByte('[')
+			}
+			for i, v := range values {
+				if i > 0 {
+					j.w.WriteString(", ")
+				}
+				writeJSONLDValue(j.w, v)
+			}
+			if len(values) > 1 {
+				j.w.WriteByte(']')
+			}
+		}
+		if _, err := j.w.WriteString("}"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close writes the end of the document.
+func (j *JSONLDWriter) Close() error {
+	if j.nodes > 0 {
+		j.w.WriteString("\n  ")
+	}
+	_, err := j.w.WriteString("]\n}\n")
+	return err
+}
+
+func writeJSONLDValue(w *bufio.Writer, t Term) {
+	switch {
+	case t.IsIRI():
+		w.WriteString("{\"@id\": ")
+		writeJSONString(w, t.IRI)
+		w.WriteByte('}')
+	case t.Language != "":
+		w.WriteString("{\"@value\": ")
+		writeJSONString(w, t.Value)
+		w.WriteString(", \"@language\": ")
+		writeJSONString(w, t.Language)
+		w.WriteByte('}')
+	case t.Datatype != "":
+		w.WriteString("{\"@value\": ")
+		writeJSONString(w, t.Value)
+		w.WriteString(", \"@type\": ")
+		writeJSONString(w, compact(t.Datatype))
+		w.WriteByte('}')
+	default:
+		writeJSONString(w, t.Value)
+	}
+}
+
+// compact shortens an IRI in a declared namespace to a compact IRI, e.g. "schema:name".
+func compact(iri string) string {
+	for prefix, ns := range Prefixes {
+		if local, ok := strings.CutPrefix(iri, ns); ok && local != "" {
+			return prefix + ":" + local
+		}
+	}
+	return iri
+}
+
+func writeJSONString(w *bufio.Writer, s string) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	w.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+}
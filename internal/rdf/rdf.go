@@ -0,0 +1,159 @@
+// Package rdf builds RDF graphs of patent documents and serializes them as N-Triples or JSON-LD, using
+// schema.org and the patent vocabulary described in vocab.ttl.
+package rdf
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Namespaces of the vocabularies used in the output.
+const (
+	RDF    = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	XSD    = "http://www.w3.org/2001/XMLSchema#"
+	Schema = "http://schema.org/"
+	Vocab  = "https://github.com/diverged/uspto-bulk-data-tool/vocab#"
+)
+
+// Prefixes maps the prefixes used in compact IRIs to their namespaces.
+var Prefixes = map[string]string{
+	"rdf":    RDF,
+	"xsd":    XSD,
+	"schema": Schema,
+	"pat":    Vocab,
+}
+
+// Term is an IRI or a literal. Literals have a datatype IRI, or a language tag, or neither for plain strings.
+type Term struct {
+	IRI      string
+	Value    string
+	Datatype string
+	Language string
+}
+
+// IRI returns an IRI term.
+func IRI(iri string) Term {
+	return Term{IRI: iri}
+}
+
+// String returns a plain string literal.
+func String(value string) Term {
+	return Term{Value: value}
+}
+
+// Text returns an English language literal.
+func Text(value string) Term {
+	return Term{Value: value, Language: "en"}
+}
+
+// Date returns an xsd:date literal from a date in YYYY-MM-DD form.
+func Date(value string) Term {
+	return Term{Value: value, Datatype: XSD + "date"}
+}
+
+// Integer returns an xsd:integer literal.
+func Integer(value int) Term {
+	return Term{Value: fmt.Sprint(value), Datatype: XSD + "integer"}
+}
+
+// Boolean returns an xsd:boolean literal.
+func Boolean(value bool) Term {
+	return Term{Value: fmt.Sprint(value), Datatype: XSD + "boolean"}
+}
+
+// IsIRI reports whether the term is an IRI.
+func (t Term) IsIRI() bool {
+	return t.IRI != ""
+}
+
+// Triple is a statement of a graph. Subjects and predicates are IRIs.
+type Triple struct {
+	Subject   string
+	Predicate string
+	Object    Term
+}
+
+// Graph is a list of triples, kept in the order they were added.
+type Graph struct {
+	Triples []Triple
+}
+
+// Add appends a triple to the graph.
+func (g *Graph) Add(subject, predicate string, object Term) {
+	g.Triples = append(g.Triples, Triple{subject, predicate, object})
+}
+
+// AddString appends a triple with a plain string literal object, unless the value is empty.
+func (g *Graph) AddString(subject, predicate, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		g.Add(subject, predicate, String(value))
+	}
+}
+
+// AddText appends a triple with an English language literal object, unless the value is empty.
+func (g *Graph) AddText(subject, predicate, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		g.Add(subject, predicate, Text(value))
+	}
+}
+
+// AddDate appends a triple with an xsd:date object from a date in YYYYMMDD form, unless the date is not valid.
+func (g *Graph) AddDate(subject, predicate, date string) {
+	if len(date) != 8 || strings.Trim(date, "0123456789") != "" || date == "00000000" {
+		return
+	}
+	g.Add(subject, predicate, Date(date[:4]+"-"+date[4:6]+"-"+date[6:]))
+}
+
+// WriteNTriples writes the triples of the graph in N-Triples form.
+func (g *Graph) WriteNTriples(w *bufio.Writer) error {
+	for _, t := range g.Triples {
+		w.WriteString(ntIRI(t.Subject))
+		w.WriteByte(' ')
+		w.WriteString(ntIRI(t.Predicate))
+		w.WriteByte(' ')
+		if t.Object.IsIRI() {
+			w.WriteString(ntIRI(t.Object.IRI))
+		} else {
+			w.WriteString(ntLiteral(t.Object))
+		}
+		if _, err := w.WriteString(" .\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ntIRI writes an IRI reference, escaping the characters N-Triples does not allow in one as \uXXXX.
+func ntIRI(iri string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range iri {
+		if InvalidIRIChar(r) {
+			fmt.Fprintf(&b, `\u%04X`, r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// InvalidIRIChar reports whether r may not appear in an IRI: a control character, a space or one of <>"{}|^`\.
+func InvalidIRIChar(r rune) bool {
+	return r <= 0x20 || strings.ContainsRune("<>\"{}|^`\\", r)
+}
+
+var ntEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+func ntLiteral(t Term) string {
+	s := `"` + ntEscaper.Replace(t.Value) + `"`
+	switch {
+	case t.Language != "":
+		return s + "@" + t.Language
+	case t.Datatype != "":
+		return s + "^^" + ntIRI(t.Datatype)
+	}
+	return s
+}
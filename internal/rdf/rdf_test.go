@@ -0,0 +1,123 @@
+package rdf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteNTriples(t *testing.T) {
+	g := &Graph{}
+	g.Add("https://example.org/d/1", RDF+"type", IRI(Vocab+"Grant"))
+	g.AddString("https://example.org/d/1", Schema+"name", "A \"quoted\"\ntitle \\ with a backslash")
+	g.AddText("https://example.org/d/1", Schema+"abstract", "Abstract.")
+	g.AddDate("https://example.org/d/1", Schema+"datePublished", "20240102")
+	g.Add("https://example.org/d/1", Vocab+"numberOfClaims", Integer(3))
+	g.Add("https://example.org/d/1", Schema+"citation", IRI("https://example.org/d/a b<c>{d}|e^f`g\\h\"i"))
+	g.AddString("https://example.org/d/1", Vocab+"kindCode", "")
+	g.AddDate("https://example.org/d/1", Vocab+"filingDate", "00000000")
+	g.AddText("https://example.org/d/1", Schema+"description", "  ")
+
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	if err := g.WriteNTriples(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	want := strings.Join([]string{
+		`<https://example.org/d/1> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <https://github.com/diverged/uspto-bulk-data-tool/vocab#Grant> .`,
+		`<https://example.org/d/1> <http://schema.org/name> "A \"quoted\"\ntitle \\ with a backslash" .`,
+		`<https://example.org/d/1> <http://schema.org/abstract> "Abstract."@en .`,
+		`<https://example.org/d/1> <http://schema.org/datePublished> "2024-01-02"^^<http://www.w3.org/2001/XMLSchema#date> .`,
+		`<https://example.org/d/1> <https://github.com/diverged/uspto-bulk-data-tool/vocab#numberOfClaims> "3"^^<http://www.w3.org/2001/XMLSchema#integer> .`,
+		// Characters not allowed in an IRI are escaped
+		`<https://example.org/d/1> <http://schema.org/citation> <https://example.org/d/a\u0020b\u003Cc\u003E\u007Bd\u007D\u007Ce\u005Ef\u0060g\u005Ch\u0022i> .`,
+	}, "\n") + "\n"
+	if b.String() != want {
+		t.Errorf("WriteNTriples =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestWriteJSONLD(t *testing.T) {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	j, err := NewJSONLDWriter(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.WriteGraph(describeFixture(t)); err != nil {
+		t.Fatal(err)
+	}
+	g := &Graph{}
+	g.Add("https://example.org/document/US1", RDF+"type", IRI(Vocab+"PatentDocument"))
+	g.AddString("https://example.org/document/US1", Schema+"name", "<b>\"x\" & y</b>")
+	if err := j.WriteGraph(g); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	var doc struct {
+		Context map[string]string            `json:"@context"`
+		Graph   []map[string]json.RawMessage `json:"@graph"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON-LD: %v\n%s", err, b.String())
+	}
+	for prefix, ns := range Prefixes {
+		if doc.Context[prefix] != ns {
+			t.Errorf("@context %s = %q, want %q", prefix, doc.Context[prefix], ns)
+		}
+	}
+	nodes := map[string]map[string]json.RawMessage{}
+	for _, n := range doc.Graph {
+		var id string
+		json.Unmarshal(n["@id"], &id)
+		nodes[id] = n
+	}
+
+	tests := []struct {
+		id       string
+		property string
+		want     string
+	}{
+		{"https://example.org/document/US11000000", "@type", `["pat:PatentDocument", "pat:Grant"]`},
+		{"https://example.org/document/US11000000", "schema:datePublished", `{"@value": "2024-01-02", "@type": "xsd:date"}`},
+		{"https://example.org/document/US11000000", "schema:name", `{"@value": "Solid electrolyte battery & method", "@language": "en"}`},
+		{"https://example.org/document/US11000000", "pat:application", `{"@id": "https://example.org/application/US17123456"}`},
+		{"https://example.org/document/US11000000", "schema:citation", `[{"@id": "https://example.org/document/US5123456"}, {"@id": "https://example.org/document/US20150012345"}]`},
+		{"https://example.org/document/US11000000/citation/1", "pat:citedBy", `"examiner"`},
+		{"https://example.org/document/US1", "@type", `"pat:PatentDocument"`},
+		{"https://example.org/document/US1", "schema:name", `"<b>\"x\" & y</b>"`},
+	}
+	for _, tt := range tests {
+		n, ok := nodes[tt.id]
+		if !ok {
+			t.Errorf("no node %s", tt.id)
+			continue
+		}
+		if got := string(n[tt.property]); got != tt.want {
+			t.Errorf("%s %s = %s, want %s", tt.id, tt.property, got, tt.want)
+		}
+	}
+}
+
+func TestWriteJSONLDEmpty(t *testing.T) {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	j, err := NewJSONLDWriter(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if !strings.HasSuffix(b.String(), "\"@graph\": []\n}\n") || !json.Valid(b.Bytes()) {
+		t.Errorf("empty JSON-LD document =\n%s", b.String())
+	}
+}
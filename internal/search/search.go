@@ -0,0 +1,96 @@
+// Package search queries the full-text index produced by the "index" output mode.
+package search
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver, registered as "sqlite"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/bibliography"
+)
+
+// Result is a single ranked match from the index.
+type Result struct {
+	DocNumber string
+	KindCode  string
+	PubDate   string
+	Title     string
+	FileName  string
+	Score     float64
+	Snippet   string
+}
+
+// Column weights for bm25 ranking, in the order of the patents_fts columns:
+// doc_number, title, abstract, claims, description.
+const rankQuery = `
+SELECT d.doc_number, d.kind_code, d.pub_date, d.title, d.file_name,
+       bm25(patents_fts, 10.0, 8.0, 4.0, 2.0, 1.0) AS score,
+       snippet(patents_fts, -1, '[', ']', '...', 16)
+FROM patents_fts
+JOIN documents d ON d.id = patents_fts.rowid
+WHERE patents_fts MATCH ?
+ORDER BY score
+LIMIT ?`
+
+// Search runs an FTS5 query against the index at dbPath and returns up to limit results, best first.
+// The query uses FTS5 syntax, so fielded search is written as e.g. `title:widget AND claims:lever`.
+func Search(dbPath, query string, limit int) ([]Result, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("search index not found: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(rankQuery, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying search index: %w", err)
+	}
+	defer rows.Close()
+
+	var results []Result
+	for rows.Next() {
+		var r Result
+		if err := rows.Scan(&r.DocNumber, &r.KindCode, &r.PubDate, &r.Title, &r.FileName, &r.Score, &r.Snippet); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// Entries returns the citation entries of search results, for export to BibTeX or RIS, in the order of the
+// results. Entries are stored by indexes built with indexcitations; the file names of results without one are
+// returned as missing.
+func Entries(dbPath string, results []Result) (entries []*bibliography.Entry, missing []string, err error) {
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	entries = make([]*bibliography.Entry, 0, len(results))
+	for _, r := range results {
+		var data string
+		err := db.QueryRow(`SELECT b.entry FROM bibliography b JOIN documents d ON d.id = b.id WHERE d.file_name = ?`, r.FileName).Scan(&data)
+		if err == sql.ErrNoRows {
+			missing = append(missing, r.FileName)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("querying search index: %w", err)
+		}
+		entry := &bibliography.Entry{}
+		if err := json.Unmarshal([]byte(data), entry); err != nil {
+			return nil, nil, fmt.Errorf("reading the entry of %s: %w", r.FileName, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, missing, nil
+}
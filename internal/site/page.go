@@ -0,0 +1,22 @@
+// Package site generates a static, browsable website from the pages written by the "html" output mode.
+package site
+
+// ManifestSuffix is appended to the base name of a zip file to name the manifest of the HTML pages written
+// for it, e.g. ipg240102.pages.jsonl.
+const ManifestSuffix = ".pages.jsonl"
+
+// Page describes an HTML page written by the "html" output mode. One Page per line is written as JSON
+// to the manifest of each zip file, and read back when generating the site.
+type Page struct {
+	File            string   `json:"file"` // Page file name, relative to the output directory
+	DocumentType    string   `json:"documentType,omitempty"`
+	DocumentNumber  string   `json:"documentNumber"`
+	Kind            string   `json:"kind,omitempty"`
+	Title           string   `json:"title"`
+	PublicationDate string   `json:"publicationDate,omitempty"` // YYYY-MM-DD
+	CPC             []string `json:"cpc,omitempty"`             // CPC symbols, main classification first
+	Assignees       []string `json:"assignees,omitempty"`
+	Inventors       []string `json:"inventors,omitempty"`
+	Abstract        string   `json:"abstract,omitempty"` // Plain text
+	SourceZip       string   `json:"sourceZip,omitempty"`
+}
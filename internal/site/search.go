@@ -0,0 +1,133 @@
+package site
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Documents are split into shards of docsPerShard entries, and terms into shards by their first
+// prefixLength characters, so that a search only downloads the shards of its terms and results.
+const (
+	docsPerShard = 500
+	prefixLength = 2
+)
+
+// stopWords are too common in patent text to be useful search terms.
+var stopWords = map[string]bool{
+	"an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true, "for": true,
+	"from": true, "has": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "which": true, "with": true,
+}
+
+// searchDoc is an entry of a document shard. Short keys keep the shards small.
+type searchDoc struct {
+	Number    string `json:"n"`
+	Title     string `json:"t"`
+	Date      string `json:"d,omitempty"`
+	Assignees string `json:"a,omitempty"`
+	URL       string `json:"u"` // Relative to the search page
+}
+
+// searchMeta is written to search/index.json and read by the search page before any shard.
+type searchMeta struct {
+	Documents    int      `json:"documents"`
+	DocsPerShard int      `json:"docsPerShard"`
+	PrefixLength int      `json:"prefixLength"`
+	TermShards   []string `json:"termShards"` // Prefixes that have a terms-<prefix>.json shard
+}
+
+// tokenize splits text into lowercase alphanumeric terms of at least two characters, without stop words.
+// The search page tokenizes queries the same way.
+func tokenize(text string) []string {
+	var terms []string
+	for _, term := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(term)) >= 2 && !stopWords[term] {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// termPrefix is the shard key of a term.
+func termPrefix(term string) string {
+	r := []rune(term)
+	return string(r[:min(len(r), prefixLength)])
+}
+
+// writeSearchIndex writes the document and term shards for pages, in listing order. A term shard maps
+// each term to the ascending indexes of the documents containing it.
+func writeSearchIndex(dir string, pages []*Page) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	shards := map[string]map[string][]int{}
+	for i, page := range pages {
+		text := []string{page.DocumentNumber, strings.TrimPrefix(page.DocumentNumber, "US"), page.Title, page.Abstract}
+		text = append(text, page.Assignees...)
+		text = append(text, page.Inventors...)
+		for _, symbol := range page.CPC {
+			// Index both the full symbol, e.g. h01m10052, and its subclass, e.g. h01m
+			text = append(text, strings.NewReplacer(" ", "", "/", "").Replace(symbol))
+			if len(symbol) >= 4 {
+				text = append(text, symbol[:4])
+			}
+		}
+
+		seen := map[string]bool{}
+		for _, term := range tokenize(strings.Join(text, " ")) {
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			prefix := termPrefix(term)
+			if shards[prefix] == nil {
+				shards[prefix] = map[string][]int{}
+			}
+			shards[prefix][term] = append(shards[prefix][term], i)
+		}
+	}
+
+	meta := searchMeta{Documents: len(pages), DocsPerShard: docsPerShard, PrefixLength: prefixLength}
+	for prefix, terms := range shards {
+		meta.TermShards = append(meta.TermShards, prefix)
+		if err := writeJSON(filepath.Join(dir, "terms-"+prefix+".json"), terms); err != nil {
+			return err
+		}
+	}
+	sort.Strings(meta.TermShards)
+
+	for start := 0; start < len(pages); start += docsPerShard {
+		end := min(start+docsPerShard, len(pages))
+		docs := make([]searchDoc, 0, end-start)
+		for _, page := range pages[start:end] {
+			docs = append(docs, searchDoc{
+				Number:    page.DocumentNumber,
+				Title:     page.Title,
+				Date:      page.PublicationDate,
+				Assignees: strings.Join(page.Assignees, "; "),
+				URL:       "../docs/" + page.File,
+			})
+		}
+		if err := writeJSON(filepath.Join(dir, fmt.Sprintf("docs-%04d.json", start/docsPerShard)), docs); err != nil {
+			return err
+		}
+	}
+
+	return writeJSON(filepath.Join(dir, "index.json"), meta)
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
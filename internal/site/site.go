@@ -0,0 +1,451 @@
+package site
+
+import (
+	"bufio"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// markerFile identifies a directory created by Generate, which may be replaced when regenerating.
+const markerFile = ".usptgo-site"
+
+// DefaultPageSize is the number of documents per listing page when none is given.
+const DefaultPageSize = 50
+
+// Options configures Generate.
+type Options struct {
+	InputDir  string // Output directory of an "html" run, holding the pages and their manifests
+	OutputDir string // Directory of the generated site
+	Title     string
+	PageSize  int
+}
+
+// Summary counts what Generate wrote.
+type Summary struct {
+	Documents int
+	Missing   int // Pages listed in a manifest whose file does not exist
+	Weeks     int
+	Years     int
+	CPC       int
+	Assignees int
+}
+
+// group is a set of documents listed together, such as the documents of a week.
+type group struct {
+	Key   string
+	Label string
+	Slug  string
+	Pages []*Page
+}
+
+// facet is a way of grouping the documents, with an index page listing its groups.
+type facet struct {
+	Dir    string
+	Title  string
+	groups map[string]*group
+	less   func(a, b *group) bool
+}
+
+func (f *facet) add(key, label string, page *Page) {
+	g, ok := f.groups[key]
+	if !ok {
+		g = &group{Key: key, Label: label}
+		f.groups[key] = g
+	}
+	g.Pages = append(g.Pages, page)
+}
+
+// sorted returns the groups in index order, assigning each a unique URL slug.
+func (f *facet) sorted() []*group {
+	groups := make([]*group, 0, len(f.groups))
+	for _, g := range f.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return f.less(groups[i], groups[j]) })
+
+	used := map[string]int{}
+	for _, g := range groups {
+		slug := slugify(g.Key)
+		if n := used[slug]; n > 0 {
+			used[slug]++
+			slug = fmt.Sprintf("%s-%d", slug, n+1)
+		} else {
+			used[slug] = 1
+		}
+		g.Slug = slug
+	}
+	return groups
+}
+
+// Generate writes a static site listing the pages of opts.InputDir by week, year, CPC subclass and assignee,
+// with a client-side search index. An existing site in opts.OutputDir is replaced; any other non-empty
+// directory is left untouched and an error is returned.
+func Generate(opts Options) (*Summary, error) {
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultPageSize
+	}
+	if opts.Title == "" {
+		opts.Title = "Patent documents"
+	}
+
+	pages, err := readManifests(opts.InputDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareOutputDir(opts.OutputDir); err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{}
+	docsDir := filepath.Join(opts.OutputDir, "docs")
+	if err := os.MkdirAll(docsDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	available := pages[:0]
+	for _, page := range pages {
+		err := copyFile(filepath.Join(opts.InputDir, page.File), filepath.Join(docsDir, page.File))
+		if errors.Is(err, os.ErrNotExist) {
+			summary.Missing++
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("copying %s: %w", page.File, err)
+		}
+		available = append(available, page)
+	}
+	pages = available
+	summary.Documents = len(pages)
+
+	tmpl, err := template.New("").Funcs(templateFuncs).ParseFS(templateFS, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	w := &siteWriter{opts: opts, tmpl: tmpl}
+
+	facets := buildFacets(pages)
+	var home []facetSummary
+	for _, f := range facets {
+		groups := f.sorted()
+		home = append(home, facetSummary{Dir: f.Dir, Title: f.Title, Groups: len(groups)})
+		switch f.Dir {
+		case "weeks":
+			summary.Weeks = len(groups)
+		case "years":
+			summary.Years = len(groups)
+		case "cpc":
+			summary.CPC = len(groups)
+		case "assignees":
+			summary.Assignees = len(groups)
+		}
+
+		if err := w.render(path.Join(f.Dir, "index.html"), "facet.html", map[string]interface{}{
+			"Title": f.Title, "Groups": groups,
+		}); err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			if err := w.renderListing(path.Join(f.Dir, g.Slug), g.Label, f, g.Pages); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	latest := pages
+	if len(latest) > opts.PageSize {
+		latest = latest[:opts.PageSize]
+	}
+	if err := w.render("index.html", "home.html", map[string]interface{}{
+		"Facets": home, "Pages": latest, "Documents": len(pages),
+	}); err != nil {
+		return nil, err
+	}
+	if err := w.render("search/index.html", "search.html", nil); err != nil {
+		return nil, err
+	}
+	if err := writeSearchIndex(filepath.Join(opts.OutputDir, "search"), pages); err != nil {
+		return nil, err
+	}
+
+	return summary, os.WriteFile(filepath.Join(opts.OutputDir, markerFile), []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644)
+}
+
+// readManifests reads the page manifests of a directory, ordered by publication date, newest first. A page
+// listed in several manifests, e.g. after reprocessing a zip, is included once.
+func readManifests(dir string) ([]*Page, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+ManifestSuffix))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no page manifests (*%s) found in %s; run the \"html\" output mode first", ManifestSuffix, dir)
+	}
+	sort.Strings(paths)
+
+	byFile := map[string]*Page{}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			page := &Page{}
+			if err := json.Unmarshal(scanner.Bytes(), page); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: %w", p, line, err)
+			}
+			if page.File == "" || filepath.Base(page.File) != page.File {
+				continue
+			}
+			byFile[page.File] = page
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", p, err)
+		}
+	}
+
+	pages := make([]*Page, 0, len(byFile))
+	for _, page := range byFile {
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].PublicationDate != pages[j].PublicationDate {
+			return pages[i].PublicationDate > pages[j].PublicationDate
+		}
+		return pages[i].DocumentNumber < pages[j].DocumentNumber
+	})
+	return pages, nil
+}
+
+// prepareOutputDir removes a previously generated site, refusing to touch other non-empty directories.
+func prepareOutputDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return os.MkdirAll(dir, os.ModePerm)
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(dir, markerFile)); err != nil {
+		return fmt.Errorf("%s is not empty and was not generated by the site command", dir)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.MkdirAll(dir, os.ModePerm)
+}
+
+// copyFile hard links src to dst, falling back to copying it.
+func copyFile(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func buildFacets(pages []*Page) []*facet {
+	newestFirst := func(a, b *group) bool { return a.Key > b.Key }
+	weeks := &facet{Dir: "weeks", Title: "Weekly issues", groups: map[string]*group{}, less: newestFirst}
+	years := &facet{Dir: "years", Title: "Years", groups: map[string]*group{}, less: newestFirst}
+	cpc := &facet{Dir: "cpc", Title: "CPC classes", groups: map[string]*group{}, less: func(a, b *group) bool { return a.Key < b.Key }}
+	assignees := &facet{Dir: "assignees", Title: "Assignees", groups: map[string]*group{}, less: func(a, b *group) bool {
+		if len(a.Pages) != len(b.Pages) {
+			return len(a.Pages) > len(b.Pages)
+		}
+		return a.Key < b.Key
+	}}
+
+	for _, page := range pages {
+		if date, err := time.Parse("2006-01-02", page.PublicationDate); err == nil {
+			year, week := date.ISOWeek()
+			monday := date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+			key := fmt.Sprintf("%04d-W%02d", year, week)
+			weeks.add(key, fmt.Sprintf("%s (%s – %s)", key, monday.Format("Jan 2"), monday.AddDate(0, 0, 6).Format("Jan 2, 2006")), page)
+			years.add(date.Format("2006"), date.Format("2006"), page)
+		}
+
+		seen := map[string]bool{}
+		for _, symbol := range page.CPC {
+			if len(symbol) < 4 || seen[symbol[:4]] {
+				continue
+			}
+			seen[symbol[:4]] = true
+			cpc.add(symbol[:4], symbol[:4], page)
+		}
+
+		seen = map[string]bool{}
+		for _, name := range page.Assignees {
+			key := strings.Join(strings.Fields(name), " ")
+			if key == "" || seen[strings.ToLower(key)] {
+				continue
+			}
+			seen[strings.ToLower(key)] = true
+			assignees.add(key, key, page)
+		}
+	}
+	return []*facet{weeks, years, cpc, assignees}
+}
+
+// slugify makes a lowercase, URL-safe directory name.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if len(slug) > 80 {
+		slug = strings.TrimSuffix(slug[:80], "-")
+	}
+	if slug == "" {
+		slug = "other"
+	}
+	return slug
+}
+
+var templateFuncs = template.FuncMap{
+	"join":    strings.Join,
+	"snippet": snippet,
+}
+
+// snippet shortens text to about 300 characters at a word boundary.
+func snippet(text string) string {
+	const length = 300
+	r := []rune(text)
+	if len(r) <= length {
+		return text
+	}
+	cut := strings.LastIndexFunc(string(r[:length]), unicode.IsSpace)
+	if cut <= 0 {
+		cut = len(string(r[:length]))
+	}
+	return strings.TrimRight(string(r[:length])[:cut], " ,;:.") + "…"
+}
+
+type facetSummary struct {
+	Dir    string
+	Title  string
+	Groups int
+}
+
+// pageLink is a numbered link of a pagination bar.
+type pageLink struct {
+	Number  int
+	URL     string
+	Current bool
+}
+
+type siteWriter struct {
+	opts Options
+	tmpl *template.Template
+}
+
+// render executes a template into a file of the site. Templates receive the site title and the
+// relative path of the site root along with data.
+func (w *siteWriter) render(name, templateName string, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["SiteTitle"] = w.opts.Title
+	data["Root"] = strings.Repeat("../", strings.Count(name, "/"))
+
+	fullPath := filepath.Join(w.opts.OutputDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(fullPath)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := w.tmpl.ExecuteTemplate(bw, templateName, data); err != nil {
+		f.Close()
+		return fmt.Errorf("rendering %s: %w", name, err)
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// renderListing writes the paginated listing of a group: index.html, page-2.html, ...
+func (w *siteWriter) renderListing(dir, title string, f *facet, pages []*Page) error {
+	count := (len(pages) + w.opts.PageSize - 1) / w.opts.PageSize
+	fileName := func(n int) string {
+		if n == 1 {
+			return "index.html"
+		}
+		return "page-" + strconv.Itoa(n) + ".html"
+	}
+
+	for n := 1; n <= count; n++ {
+		links := make([]pageLink, count)
+		for i := range links {
+			links[i] = pageLink{Number: i + 1, URL: fileName(i + 1), Current: i+1 == n}
+		}
+		end := min(n*w.opts.PageSize, len(pages))
+		data := map[string]interface{}{
+			"Title":      title,
+			"FacetDir":   f.Dir,
+			"FacetTitle": f.Title,
+			"Pages":      pages[(n-1)*w.opts.PageSize : end],
+			"Start":      (n-1)*w.opts.PageSize + 1,
+			"End":        end,
+			"Total":      len(pages),
+		}
+		if count > 1 {
+			data["Pagination"] = links
+		}
+		if n > 1 {
+			data["Prev"] = fileName(n - 1)
+		}
+		if n < count {
+			data["Next"] = fileName(n + 1)
+		}
+		if err := w.render(path.Join(dir, fileName(n)), "list.html", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
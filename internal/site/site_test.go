@@ -0,0 +1,219 @@
+package site
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"H01M", "h01m"},
+		{"2024-W01", "2024-w01"},
+		{"Acme Battery Co., Ltd.", "acme-battery-co-ltd"},
+		{"  --Acme--  ", "acme"},
+		{"Müller GmbH", "m-ller-gmbh"},
+		{"株式会社", "other"},
+		{"", "other"},
+		{strings.Repeat("ab ", 40), strings.TrimSuffix(strings.Repeat("ab-", 27), "-")},
+	}
+	for _, tt := range tests {
+		if got := slugify(tt.s); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("word ", 70) // 350 characters
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"A short abstract.", "A short abstract."},
+		{strings.Repeat("a", 300), strings.Repeat("a", 300)},
+		{long, strings.TrimSpace(strings.Repeat("word ", 60)) + "…"},
+		{strings.Repeat("word, ", 60), strings.TrimSuffix(strings.Repeat("word, ", 50), ", ") + "…"},
+		{strings.Repeat("é", 301), strings.Repeat("é", 300) + "…"},
+	}
+	for _, tt := range tests {
+		if got := snippet(tt.text); got != tt.want {
+			t.Errorf("snippet(%.20q...) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// testPages are listed newest first, as readManifests returns them.
+func testPages() []*Page {
+	return []*Page{
+		{File: "US11000002.html", DocumentNumber: "US11000002", Title: "Cell", PublicationDate: "2024-01-09", CPC: []string{"H01M 50/00"}, Assignees: []string{"Beta Corp"}},
+		{File: "US11000000.html", DocumentNumber: "US11000000", Title: "Battery", PublicationDate: "2024-01-02", CPC: []string{"H01M 10/052", "H01M 4/00", "Y02E 60/10"}, Assignees: []string{"Acme Battery Co., Ltd.", "ACME  Battery Co., Ltd."}},
+		{File: "US11000001.html", DocumentNumber: "US11000001", Title: "Anode", PublicationDate: "2024-01-02", CPC: []string{"H01M 4/00"}, Assignees: []string{"ACME Battery Co., Ltd.", "Beta Corp"}},
+		{File: "US10999999.html", DocumentNumber: "US10999999", Title: "Electrode", PublicationDate: "2023-12-26", CPC: []string{"H0"}, Assignees: []string{" "}},
+		{File: "US10999998.html", DocumentNumber: "US10999998", Title: "Undated"},
+	}
+}
+
+func TestBuildFacets(t *testing.T) {
+	facets := buildFacets(testPages())
+	// Each group as "key=slug:documents", in index order
+	want := map[string][]string{
+		"weeks": {
+			"2024-W02=2024-w02:US11000002",
+			"2024-W01=2024-w01:US11000000,US11000001",
+			"2023-W52=2023-w52:US10999999",
+		},
+		"years": {
+			"2024=2024:US11000002,US11000000,US11000001",
+			"2023=2023:US10999999",
+		},
+		"cpc": {
+			"H01M=h01m:US11000002,US11000000,US11000001",
+			"Y02E=y02e:US11000000",
+		},
+		// Names differing in case only are listed apart, with distinct slugs
+		"assignees": {
+			"Beta Corp=beta-corp:US11000002,US11000001",
+			"ACME Battery Co., Ltd.=acme-battery-co-ltd:US11000001",
+			"Acme Battery Co., Ltd.=acme-battery-co-ltd-2:US11000000",
+		},
+	}
+	if len(facets) != len(want) {
+		t.Fatalf("got %d facets, want %d", len(facets), len(want))
+	}
+	for _, f := range facets {
+		var got []string
+		for _, g := range f.sorted() {
+			var numbers []string
+			for _, p := range g.Pages {
+				numbers = append(numbers, p.DocumentNumber)
+			}
+			got = append(got, g.Key+"="+g.Slug+":"+strings.Join(numbers, ","))
+		}
+		if strings.Join(got, "\n") != strings.Join(want[f.Dir], "\n") {
+			t.Errorf("facet %s =\n%s\nwant\n%s", f.Dir, strings.Join(got, "\n"), strings.Join(want[f.Dir], "\n"))
+		}
+	}
+
+	weeks := facets[0].sorted()
+	if label := weeks[1].Label; label != "2024-W01 (Jan 1 – Jan 7, 2024)" {
+		t.Errorf("week label = %q", label)
+	}
+	if label := weeks[2].Label; label != "2023-W52 (Dec 25 – Dec 31, 2023)" {
+		t.Errorf("week label = %q", label)
+	}
+}
+
+// writeInput writes the pages of testPages and their manifest to a new input directory, leaving out the
+// files of the pages named in missing.
+func writeInput(t *testing.T, missing ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	var manifest []byte
+	for _, page := range testPages() {
+		line, err := json.Marshal(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest = append(append(manifest, line...), '\n')
+		if strings.Contains(strings.Join(missing, " "), page.File) {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, page.File), []byte("<html>"+page.Title+"</html>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ipg240102"+ManifestSuffix), manifest, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	opts := Options{InputDir: writeInput(t, "US10999998.html"), OutputDir: filepath.Join(t.TempDir(), "site"), PageSize: 2}
+	summary, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Summary{Documents: 4, Missing: 1, Weeks: 3, Years: 2, CPC: 2, Assignees: 3}); *summary != want {
+		t.Errorf("summary = %+v, want %+v", *summary, want)
+	}
+
+	for _, name := range []string{
+		".usptgo-site",
+		"index.html",
+		"docs/US11000000.html",
+		"weeks/index.html",
+		"weeks/2024-w01/index.html",
+		"years/2024/index.html",
+		"years/2024/page-2.html",
+		"cpc/h01m/page-2.html",
+		"assignees/acme-battery-co-ltd-2/index.html",
+		"search/index.html",
+		"search/index.json",
+	} {
+		if _, err := os.Stat(filepath.Join(opts.OutputDir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s not written: %v", name, err)
+		}
+	}
+	for _, name := range []string{"docs/US10999998.html", "years/2024/page-3.html", "weeks/2024-w01/page-2.html"} {
+		if _, err := os.Stat(filepath.Join(opts.OutputDir, filepath.FromSlash(name))); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s exists (%v)", name, err)
+		}
+	}
+
+	// The second listing page of 2024 holds the third document and links back to the first
+	data, err := os.ReadFile(filepath.Join(opts.OutputDir, "years", "2024", "page-2.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{"Documents 3–3 of 3", "US11000001", `<a href="index.html">‹ Previous</a>`, "<strong>2</strong>"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("years/2024/page-2.html does not contain %q", want)
+		}
+	}
+	if strings.Contains(page, "US11000002") || strings.Contains(page, "Next ›") {
+		t.Errorf("years/2024/page-2.html lists the documents of the first page or a next page")
+	}
+	data, err = os.ReadFile(filepath.Join(opts.OutputDir, "weeks", "2024-w01", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `class="pages"`) {
+		t.Error("a listing of a single page has a pagination bar")
+	}
+
+	// A site is regenerated in place
+	if _, err := Generate(opts); err != nil {
+		t.Errorf("regenerating the site: %v", err)
+	}
+}
+
+func TestGenerateRefusesOtherDirectories(t *testing.T) {
+	input := writeInput(t)
+	output := t.TempDir()
+	if err := os.WriteFile(filepath.Join(output, "notes.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Generate(Options{InputDir: input, OutputDir: output}); err == nil || !strings.Contains(err.Error(), "not generated by the site command") {
+		t.Errorf("Generate into a directory with other files: %v, want a refusal", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(output, "notes.txt")); err != nil || string(data) != "keep" {
+		t.Errorf("existing file changed: %q, %v", data, err)
+	}
+
+	// An empty directory is used as is
+	if _, err := Generate(Options{InputDir: input, OutputDir: t.TempDir()}); err != nil {
+		t.Errorf("Generate into an empty directory: %v", err)
+	}
+	if _, err := Generate(Options{InputDir: t.TempDir(), OutputDir: t.TempDir()}); err == nil || !strings.Contains(err.Error(), "no page manifests") {
+		t.Errorf("Generate without manifests: %v", err)
+	}
+}
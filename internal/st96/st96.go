@@ -0,0 +1,523 @@
+// Package st96 converts USPTO grant and application XML to WIPO ST.96 patent publication XML, checks the
+// structure of the result against a bundled schema and reports the source elements the conversion does not map.
+package st96
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// Namespaces and version of the ST.96 schemas the output follows.
+const (
+	PatentNamespace = "http://www.wipo.int/standards/XMLSchema/ST96/Patent"
+	CommonNamespace = "http://www.wipo.int/standards/XMLSchema/ST96/Common"
+	Version         = "V6_0"
+)
+
+// Input is the content of a document to convert. Title, Abstract and Claims are inner XML as parsed from the
+// bulk data; the remaining bibliographic data is read from Raw, the raw split document. The source tags name
+// the elements the fields are parsed from, for Unmapped.
+type Input struct {
+	Raw      []byte
+	Title    string `source:"bibliographic-data/invention-title"`
+	Abstract string `source:"abstract"`
+	Claims   string `source:"claims/claim"`
+}
+
+// PatentPublication is the root element of an ST.96 patent publication. Element names carry their namespace
+// prefix, declared on the root, so that the output uses the conventional pat: and com: prefixes.
+type PatentPublication struct {
+	XMLName       xml.Name          `xml:"pat:PatentPublication"`
+	PatNamespace  string            `xml:"xmlns:pat,attr"`
+	ComNamespace  string            `xml:"xmlns:com,attr"`
+	Version       string            `xml:"com:st96Version,attr"`
+	Bibliographic BibliographicData `xml:"pat:BibliographicData"`
+	Abstract      *Abstract         `xml:"pat:Abstract,omitempty"`
+	Claims        *Claims           `xml:"pat:Claims,omitempty"`
+}
+
+type BibliographicData struct {
+	Publication     PublicationIdentification `xml:"pat:PatentPublicationIdentification"`
+	Application     ApplicationIdentification `xml:"pat:ApplicationIdentification"`
+	PriorityClaims  *PriorityClaimBag         `xml:"pat:PriorityClaimBag,omitempty"`
+	Classifications *ClassificationBag        `xml:"pat:PatentClassificationBag,omitempty"`
+	InventionTitle  InventionTitle            `xml:"pat:InventionTitle"`
+	Parties         *PartyBag                 `xml:"pat:PartyBag,omitempty"`
+	Citations       *ReferenceCitationBag     `xml:"pat:ReferenceCitationBag,omitempty"`
+	ClaimTotal      int                       `xml:"pat:ClaimTotalQuantity,omitempty"`
+}
+
+type PublicationIdentification struct {
+	Office          string `xml:"com:IPOfficeCode"`
+	Number          string `xml:"pat:PublicationNumber"`
+	Kind            string `xml:"com:PatentDocumentKindCode,omitempty"`
+	PublicationDate string `xml:"com:PublicationDate,omitempty"`
+}
+
+type ApplicationNumber struct {
+	Text string `xml:"com:ApplicationNumberText"`
+}
+
+type ApplicationIdentification struct {
+	Office     string            `xml:"com:IPOfficeCode"`
+	Number     ApplicationNumber `xml:"com:ApplicationNumber"`
+	FilingDate string            `xml:"pat:FilingDate,omitempty"`
+}
+
+type PriorityClaimBag struct {
+	Claims []PriorityClaim `xml:"pat:PriorityClaim"`
+}
+
+type PriorityClaim struct {
+	Sequence   int               `xml:"com:sequenceNumber,attr"`
+	Office     string            `xml:"com:IPOfficeCode"`
+	Number     ApplicationNumber `xml:"com:ApplicationNumber"`
+	FilingDate string            `xml:"pat:FilingDate,omitempty"`
+}
+
+type ClassificationBag struct {
+	IPCR *IPCRClassificationBag `xml:"pat:IPCRClassificationBag,omitempty"`
+	CPC  *CPCClassificationBag  `xml:"pat:CPCClassificationBag,omitempty"`
+}
+
+type IPCRClassificationBag struct {
+	Classifications []Classification `xml:"pat:IPCRClassification"`
+}
+
+type CPCClassificationBag struct {
+	Main    *CPCClassifications `xml:"pat:MainCPC,omitempty"`
+	Further *CPCClassifications `xml:"pat:FurtherCPC,omitempty"`
+}
+
+type CPCClassifications struct {
+	Classifications []Classification `xml:"pat:CPCClassification"`
+}
+
+type Classification struct {
+	Section        string `xml:"pat:Section"`
+	Class          string `xml:"pat:Class"`
+	Subclass       string `xml:"pat:Subclass"`
+	MainGroup      string `xml:"pat:MainGroup"`
+	Subgroup       string `xml:"pat:Subgroup"`
+	SymbolPosition string `xml:"pat:SymbolPositionCode"`                // "F" for the first symbol, "L" for later ones
+	Value          string `xml:"pat:ClassificationValueCode,omitempty"` // "I" inventive or "A" additional
+}
+
+type InventionTitle struct {
+	Language string `xml:"com:languageCode,attr"`
+	Text     string `xml:",chardata"`
+}
+
+type PartyBag struct {
+	Applicants *ApplicantBag `xml:"pat:ApplicantBag,omitempty"`
+	Inventors  *InventorBag  `xml:"pat:InventorBag,omitempty"`
+	Assignees  *AssigneeBag  `xml:"pat:AssigneeBag,omitempty"`
+	Examiners  *ExaminerBag  `xml:"pat:ExaminerBag,omitempty"`
+}
+
+type ApplicantBag struct {
+	Applicants []Party `xml:"pat:Applicant"`
+}
+
+type InventorBag struct {
+	Inventors []Party `xml:"pat:Inventor"`
+}
+
+type AssigneeBag struct {
+	Assignees []Party `xml:"pat:Assignee"`
+}
+
+type Party struct {
+	Sequence int     `xml:"com:sequenceNumber,attr"`
+	Contact  Contact `xml:"com:Contact"`
+}
+
+type Contact struct {
+	Name    Name              `xml:"com:Name"`
+	Address *PostalAddressBag `xml:"com:PostalAddressBag,omitempty"`
+}
+
+type Name struct {
+	Person *PersonName `xml:"com:PersonName,omitempty"`
+	Entity string      `xml:"com:EntityName,omitempty"`
+}
+
+type PersonName struct {
+	FirstName string `xml:"com:FirstName,omitempty"`
+	LastName  string `xml:"com:LastName"`
+}
+
+type PostalAddressBag struct {
+	Address PostalAddress `xml:"com:PostalAddress"`
+}
+
+type PostalAddress struct {
+	Structured StructuredAddress `xml:"com:PostalStructuredAddress"`
+}
+
+type StructuredAddress struct {
+	City       string `xml:"com:CityName,omitempty"`
+	Region     string `xml:"com:GeographicRegionName,omitempty"`
+	PostalCode string `xml:"com:PostalCode,omitempty"`
+	Country    string `xml:"com:CountryCode,omitempty"`
+}
+
+type ExaminerBag struct {
+	Primary   *Examiner  `xml:"pat:PrimaryExaminer,omitempty"`
+	Assistant []Examiner `xml:"pat:AssistantExaminer"`
+}
+
+type Examiner struct {
+	Name    PersonName `xml:"com:PersonName"`
+	ArtUnit string     `xml:"pat:ArtUnitNumber,omitempty"`
+}
+
+type ReferenceCitationBag struct {
+	Citations []ReferenceCitation `xml:"pat:ReferenceCitation"`
+}
+
+type ReferenceCitation struct {
+	Sequence int             `xml:"com:sequenceNumber,attr"`
+	Patent   *PatentCitation `xml:"pat:PatentCitation,omitempty"`
+	NPL      *NPLCitation    `xml:"pat:NPLCitation,omitempty"`
+	CitedBy  string          `xml:"pat:CitedByCategory,omitempty"` // e.g. "examiner" or "applicant"
+}
+
+type PatentCitation struct {
+	Office string `xml:"com:IPOfficeCode"`
+	Number string `xml:"pat:PatentNumber"`
+	Kind   string `xml:"com:PatentDocumentKindCode,omitempty"`
+	Name   string `xml:"com:EntityName,omitempty"`
+	Date   string `xml:"com:PatentDocumentDate,omitempty"`
+}
+
+type NPLCitation struct {
+	Text string `xml:"com:NPLCitationText"`
+}
+
+type Abstract struct {
+	Language   string   `xml:"com:languageCode,attr"`
+	Paragraphs []string `xml:"com:P"`
+}
+
+type Claims struct {
+	Language string  `xml:"com:languageCode,attr"`
+	Claims   []Claim `xml:"pat:Claim"`
+}
+
+type Claim struct {
+	ID     string    `xml:"com:id,attr,omitempty"`
+	Number int       `xml:"pat:ClaimNumber"`
+	Text   ClaimText `xml:"pat:ClaimText"`
+}
+
+// ClaimText is mixed content: claim text with pat:ClaimReference elements in place of claim-ref.
+type ClaimText struct {
+	Content string `xml:",innerxml"`
+}
+
+// Convert maps a document to an ST.96 patent publication.
+func Convert(in Input) (*PatentPublication, error) {
+	biblio, err := patentxml.ParseBibliographic(in.Raw)
+	if err != nil {
+		return nil, err
+	}
+	return convert(biblio, in)
+}
+
+// convert maps parsed bibliographic data and the content of Input to a publication. Unmapped finds the
+// mapped source elements by running it on synthetic data, so all mapping of source data happens here.
+func convert(biblio *patentxml.Bibliographic, in Input) (*PatentPublication, error) {
+	pub := &PatentPublication{
+		PatNamespace: PatentNamespace,
+		ComNamespace: CommonNamespace,
+		Version:      Version,
+	}
+	bib := &pub.Bibliographic
+	bib.Publication = PublicationIdentification{
+		Office:          office(biblio.Publication.Country),
+		Number:          strings.TrimPrefix(patentxml.NormalizeDocNumber(biblio.Publication.Country, biblio.Publication.DocNumber), office(biblio.Publication.Country)),
+		Kind:            biblio.Publication.Kind,
+		PublicationDate: isoDate(biblio.Publication.Date),
+	}
+	bib.Application = ApplicationIdentification{
+		Office:     office(biblio.Application.Country),
+		Number:     ApplicationNumber{Text: strings.TrimSpace(biblio.Application.DocNumber)},
+		FilingDate: isoDate(biblio.Application.Date),
+	}
+	bib.InventionTitle = InventionTitle{Language: "en", Text: patentxml.PlainText(in.Title)}
+
+	if len(biblio.PriorityClaims) > 0 {
+		bag := &PriorityClaimBag{}
+		for i, p := range biblio.PriorityClaims {
+			bag.Claims = append(bag.Claims, PriorityClaim{
+				Sequence:   sequence(p.Sequence, i),
+				Office:     office(p.Country),
+				Number:     ApplicationNumber{Text: p.DocNumber},
+				FilingDate: isoDate(p.Date),
+			})
+		}
+		bib.PriorityClaims = bag
+	}
+
+	bib.Classifications = classifications(biblio.Classifications)
+	bib.Parties = parties(biblio)
+
+	if len(biblio.Citations) > 0 {
+		bag := &ReferenceCitationBag{}
+		for i, c := range biblio.Citations {
+			citation := ReferenceCitation{Sequence: sequence(c.Sequence, i), CitedBy: c.CitedBy()}
+			if c.Patent {
+				citation.Patent = &PatentCitation{
+					Office: office(c.Document.Country),
+					Number: strings.TrimSpace(c.Document.DocNumber),
+					Kind:   c.Document.Kind,
+					Name:   c.Document.Name,
+					Date:   isoDate(c.Document.Date),
+				}
+			} else {
+				citation.NPL = &NPLCitation{Text: c.Text}
+			}
+			bag.Citations = append(bag.Citations, citation)
+		}
+		bib.Citations = bag
+	}
+
+	if paragraphs := patentxml.Paragraphs(in.Abstract); len(paragraphs) > 0 {
+		pub.Abstract = &Abstract{Language: "en"}
+		for _, p := range paragraphs {
+			pub.Abstract.Paragraphs = append(pub.Abstract.Paragraphs, p.Text)
+		}
+	} else if text := patentxml.PlainText(in.Abstract); text != "" {
+		pub.Abstract = &Abstract{Language: "en", Paragraphs: []string{text}}
+	}
+
+	claims, err := convertClaims(in.Claims)
+	if len(claims) > 0 {
+		pub.Claims = &Claims{Language: "en", Claims: claims}
+		bib.ClaimTotal = len(claims)
+	}
+	return pub, err
+}
+
+// Marshal renders a publication as an indented XML document.
+func Marshal(pub *PatentPublication) ([]byte, error) {
+	data, err := xml.MarshalIndent(pub, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+func classifications(classes []patentxml.Classification) *ClassificationBag {
+	bag := &ClassificationBag{}
+	for _, c := range classes {
+		class := Classification{
+			Section:        c.Section,
+			Class:          c.Class,
+			Subclass:       c.Subclass,
+			MainGroup:      strings.TrimSpace(c.Group),
+			Subgroup:       c.Subgroup,
+			SymbolPosition: "L",
+			Value:          c.Value,
+		}
+		if c.Main {
+			class.SymbolPosition = "F"
+		}
+		switch {
+		case c.Scheme == "ipc":
+			if bag.IPCR == nil {
+				bag.IPCR = &IPCRClassificationBag{}
+			}
+			bag.IPCR.Classifications = append(bag.IPCR.Classifications, class)
+		case c.Scheme == "cpc":
+			if bag.CPC == nil {
+				bag.CPC = &CPCClassificationBag{}
+			}
+			target := &bag.CPC.Further
+			if c.Main {
+				target = &bag.CPC.Main
+			}
+			if *target == nil {
+				*target = &CPCClassifications{}
+			}
+			(*target).Classifications = append((*target).Classifications, class)
+		}
+	}
+	if bag.IPCR == nil && bag.CPC == nil {
+		return nil
+	}
+	return bag
+}
+
+func parties(biblio *patentxml.Bibliographic) *PartyBag {
+	bag := &PartyBag{}
+	for i, p := range biblio.Applicants {
+		if bag.Applicants == nil {
+			bag.Applicants = &ApplicantBag{}
+		}
+		bag.Applicants.Applicants = append(bag.Applicants.Applicants, party(p, i))
+	}
+	for i, p := range biblio.Inventors {
+		if bag.Inventors == nil {
+			bag.Inventors = &InventorBag{}
+		}
+		bag.Inventors.Inventors = append(bag.Inventors.Inventors, party(p, i))
+	}
+	for i, p := range biblio.Assignees {
+		if bag.Assignees == nil {
+			bag.Assignees = &AssigneeBag{}
+		}
+		bag.Assignees.Assignees = append(bag.Assignees.Assignees, party(p, i))
+	}
+	for _, e := range biblio.Examiners {
+		if bag.Examiners == nil {
+			bag.Examiners = &ExaminerBag{}
+		}
+		examiner := Examiner{Name: PersonName{FirstName: e.FirstName, LastName: e.LastName}, ArtUnit: e.Department}
+		if e.Level == "primary" && bag.Examiners.Primary == nil {
+			bag.Examiners.Primary = &examiner
+		} else {
+			bag.Examiners.Assistant = append(bag.Examiners.Assistant, examiner)
+		}
+	}
+	if *bag == (PartyBag{}) {
+		return nil
+	}
+	return bag
+}
+
+func party(p patentxml.Party, index int) Party {
+	out := Party{Sequence: sequence(p.Sequence, index)}
+	if p.OrgName != "" {
+		out.Contact.Name.Entity = p.OrgName
+	} else {
+		out.Contact.Name.Person = &PersonName{FirstName: p.FirstName, LastName: p.LastName}
+	}
+	if p.Address != (patentxml.Address{}) {
+		out.Contact.Address = &PostalAddressBag{Address: PostalAddress{Structured: StructuredAddress{
+			City:       p.Address.City,
+			Region:     p.Address.State,
+			PostalCode: p.Address.Postcode,
+			Country:    p.Address.Country,
+		}}}
+	}
+	return out
+}
+
+// convertClaims maps the claims of a document, keeping claim references as pat:ClaimReference elements.
+// Claims read before a malformed claim are returned along with the error.
+func convertClaims(content string) ([]Claim, error) {
+	d := xml.NewDecoder(strings.NewReader("<claims>" + content + "</claims>"))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+
+	var claims []Claim
+	var current *Claim
+	var text strings.Builder
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return claims, nil
+			}
+			return claims, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if current == nil {
+				if t.Name.Local == "claim" {
+					current = &Claim{ID: attr(t, "id")}
+					current.Number, _ = strconv.Atoi(strings.TrimLeft(attr(t, "num"), "0"))
+					text.Reset()
+					depth = 0
+				}
+				continue
+			}
+			depth++
+			switch t.Name.Local {
+			case "claim-ref":
+				text.WriteString(`<pat:ClaimReference com:idrefs="`)
+				xml.EscapeText(&text, []byte(attr(t, "idref")))
+				text.WriteString(`">`)
+			case "claim-text", "br":
+				text.WriteByte(' ')
+			}
+		case xml.EndElement:
+			if current == nil {
+				continue
+			}
+			if depth == 0 {
+				if current.Number == 0 {
+					current.Number = len(claims) + 1
+				}
+				current.Text.Content = stripClaimNumber(collapseSpace(text.String()), current.Number)
+				claims = append(claims, *current)
+				current = nil
+				continue
+			}
+			depth--
+			if t.Name.Local == "claim-ref" {
+				text.WriteString("</pat:ClaimReference>")
+			}
+		case xml.CharData:
+			if current != nil {
+				xml.EscapeText(&text, t)
+			}
+		}
+	}
+}
+
+// collapseSpace normalizes the whitespace of escaped inner XML, in which newlines are escaped as "&#xA;".
+func collapseSpace(s string) string {
+	s = strings.NewReplacer("&#xA;", " ", "&#x9;", " ", "&#xD;", " ").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// stripClaimNumber removes the leading "1. " of a claim text, which ST.96 holds in pat:ClaimNumber.
+func stripClaimNumber(text string, number int) string {
+	prefix := strconv.Itoa(number) + "."
+	if rest, ok := strings.CutPrefix(text, prefix); ok {
+		return strings.TrimSpace(rest)
+	}
+	return text
+}
+
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// office returns the office code of a country, US when none is given.
+func office(country string) string {
+	if country = strings.ToUpper(strings.TrimSpace(country)); country != "" {
+		return country
+	}
+	return "US"
+}
+
+// isoDate converts a YYYYMMDD date to the YYYY-MM-DD form of ST.96, leaving other values unchanged.
+func isoDate(date string) string {
+	date = strings.TrimSpace(date)
+	if len(date) != 8 {
+		return date
+	}
+	return date[:4] + "-" + date[4:6] + "-" + date[6:]
+}
+
+// sequence returns a source sequence number, or the 1-based position when the source has none.
+func sequence(value, index int) int {
+	if value > 0 {
+		return value
+	}
+	return index + 1
+}
@@ -0,0 +1,142 @@
+package st96
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/fixture"
+)
+
+func fixtureInput(name string) Input {
+	doc := fixture.Doc(name)
+	return Input{
+		Raw:      doc.RawSplitDoc,
+		Title:    doc.Patent.UsBibliographicData.InventionTitle.Text,
+		Abstract: doc.Patent.Abstract.Content,
+		Claims:   doc.Patent.Claims.Content,
+	}
+}
+
+func TestConvert(t *testing.T) {
+	pub, err := Convert(fixtureInput(fixture.Grant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bib := pub.Bibliographic
+	if got := bib.Publication; got != (PublicationIdentification{Office: "US", Number: "11000000", Kind: "B2", PublicationDate: "2024-01-02"}) {
+		t.Errorf("publication = %+v", got)
+	}
+	if got := bib.Application; got.Number.Text != "17123456" || got.FilingDate != "2021-03-15" {
+		t.Errorf("application = %+v", got)
+	}
+	if bib.PriorityClaims == nil || len(bib.PriorityClaims.Claims) != 1 || bib.PriorityClaims.Claims[0].Office != "JP" {
+		t.Errorf("priority claims = %+v", bib.PriorityClaims)
+	}
+	if c := bib.Classifications; c == nil || c.IPCR == nil || c.CPC == nil || c.CPC.Main == nil || c.CPC.Further == nil ||
+		c.CPC.Main.Classifications[0].SymbolPosition != "F" || c.CPC.Further.Classifications[0].SymbolPosition != "L" {
+		t.Errorf("classifications = %+v", c)
+	}
+	if bib.InventionTitle.Text != "Solid electrolyte battery & method" || bib.InventionTitle.Language != "en" {
+		t.Errorf("invention title = %+v", bib.InventionTitle)
+	}
+	parties := bib.Parties
+	if parties == nil || len(parties.Inventors.Inventors) != 2 || parties.Inventors.Inventors[1].Contact.Name.Person.LastName != "Müller" ||
+		parties.Applicants.Applicants[0].Contact.Name.Entity != "Acme Battery Co., Ltd." || parties.Examiners.Primary.ArtUnit != "1700" {
+		t.Errorf("parties = %+v", parties)
+	}
+	if c := bib.Citations; c == nil || len(c.Citations) != 3 || c.Citations[0].CitedBy != "examiner" || c.Citations[2].NPL == nil {
+		t.Errorf("citations = %+v", c)
+	}
+	if bib.ClaimTotal != 3 || pub.Claims == nil || len(pub.Claims.Claims) != 3 {
+		t.Fatalf("claims = %+v, total %d", pub.Claims, bib.ClaimTotal)
+	}
+	if got := pub.Claims.Claims[1].Text.Content; !strings.Contains(got, `<pat:ClaimReference com:idrefs="CLM-00001">claim 1</pat:ClaimReference>`) || strings.HasPrefix(got, "2.") {
+		t.Errorf("claim 2 text = %q", got)
+	}
+	if pub.Abstract == nil || len(pub.Abstract.Paragraphs) != 1 {
+		t.Errorf("abstract = %+v", pub.Abstract)
+	}
+}
+
+func TestConvertMalformedClaims(t *testing.T) {
+	in := fixtureInput(fixture.Grant)
+	in.Claims = in.Claims[:strings.Index(in.Claims, "wherein")] + "<!-- unterminated"
+	pub, err := Convert(in)
+	if err == nil {
+		t.Error("Convert with malformed claims returned no error")
+	}
+	if pub == nil || pub.Claims == nil || len(pub.Claims.Claims) != 1 || pub.Bibliographic.Parties == nil {
+		t.Errorf("Convert with malformed claims = %+v, want the first claim and the bibliographic data", pub)
+	}
+
+	if pub, err := Convert(Input{}); pub != nil || err == nil {
+		t.Errorf("Convert without a raw document = %v, %v", pub, err)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	pub, err := Convert(fixtureInput(fixture.Grant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(xml.Header+`<pat:PatentPublication xmlns:pat="`+PatentNamespace+`" xmlns:com="`)) {
+		t.Errorf("document starts with %q", data[:min(len(data), 200)])
+	}
+	for _, want := range []string{
+		`<pat:InventionTitle com:languageCode="en">Solid electrolyte battery &amp; method</pat:InventionTitle>`,
+		`<com:ApplicationNumberText>17123456</com:ApplicationNumberText>`,
+		`<pat:PriorityClaim com:sequenceNumber="1">`,
+		`<com:LastName>Müller</com:LastName>`,
+		`<com:NPLCitationText>Doe, “Lithium things,” J. Batt. 2019.</com:NPLCitationText>`,
+		`<pat:ClaimText>The battery of <pat:ClaimReference com:idrefs="CLM-00001">claim 1</pat:ClaimReference>, wherein`,
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("document does not contain %s", want)
+		}
+	}
+
+	// The output has the structure the converter is meant to produce, in namespace-aware form
+	if errs := loadStructure(t).check(data); len(errs) > 0 {
+		t.Errorf("structure errors: %v", errs)
+	}
+}
+
+func TestStructureCheck(t *testing.T) {
+	pub, err := Convert(fixtureInput(fixture.Grant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := loadStructure(t)
+
+	// Each change to valid output is caught
+	tests := []struct {
+		name, old, new, want string
+	}{
+		{"missing element", "<pat:PublicationNumber>11000000</pat:PublicationNumber>", "", "missing pat:PublicationNumber"},
+		{"invalid date", "<com:PublicationDate>2024-01-02</com:PublicationDate>", "<com:PublicationDate>20240102</com:PublicationDate>", "not a valid date"},
+		{"missing attribute", `<pat:Claims com:languageCode="en">`, "<pat:Claims>", "missing attribute com:languageCode"},
+		{"undescribed element", "<pat:ClaimNumber>1</pat:ClaimNumber>", "<pat:ClaimNumber>1</pat:ClaimNumber><pat:Extra/>", "unexpected element pat:Extra"},
+		{"not well-formed", "</pat:PatentPublication>", "", "not well-formed"},
+	}
+	for _, tt := range tests {
+		changed := strings.Replace(string(data), tt.old, tt.new, 1)
+		errs := s.check([]byte(changed))
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err.Error(), tt.want)
+		}
+		if !found {
+			t.Errorf("%s: errors %v, want %q", tt.name, errs, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package st96
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The ST.96 output is not validated against the WIPO XSDs, which are not bundled and would need an XSD
+// processor. testdata/patent-publication.json instead describes the subset of ST.96 the conversion is meant to
+// produce: the child sequence of each element with optional, repeated and alternative children, required
+// attributes, and the form of simple values. Checking the output against it catches regressions in the
+// converter; it is written from the same reading of the standard, so it cannot show conformance.
+//
+//go:embed testdata/patent-publication.json
+var structureJSON []byte
+
+// structure describes the element structure of ST.96 documents.
+type structure struct {
+	Name       string                       `json:"name"`
+	Version    string                       `json:"version"`
+	Namespaces map[string]string            `json:"namespaces"` // Prefix to namespace URI
+	Root       string                       `json:"root"`
+	Elements   map[string]*elementStructure `json:"elements"`
+}
+
+// elementStructure is the content model of an element, named with its namespace prefix as in "pat:Claim".
+type elementStructure struct {
+	Attributes []string       `json:"attributes,omitempty"` // Required attributes
+	Sequence   []sequenceItem `json:"sequence,omitempty"`   // Child elements, in order
+	Text       bool           `json:"text,omitempty"`       // Non-empty text content without child elements
+	Pattern    string         `json:"pattern,omitempty"`    // "date" or "integer" for text content
+	Mixed      []string       `json:"mixed,omitempty"`      // Text interleaved with any number of these elements
+}
+
+// sequenceItem is an element, or a choice of elements, in a sequence. Items occur once unless optional or repeated.
+type sequenceItem struct {
+	Element  string   `json:"element,omitempty"`
+	Choice   []string `json:"choice,omitempty"`
+	Optional bool     `json:"optional,omitempty"`
+	Repeated bool     `json:"repeated,omitempty"`
+}
+
+func (s sequenceItem) matches(name string) bool {
+	if s.Element != "" {
+		return s.Element == name
+	}
+	for _, c := range s.Choice {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s sequenceItem) String() string {
+	if s.Element != "" {
+		return s.Element
+	}
+	return strings.Join(s.Choice, " or ")
+}
+
+func loadStructure(t *testing.T) *structure {
+	t.Helper()
+	s := &structure{}
+	if err := json.Unmarshal(structureJSON, s); err != nil {
+		t.Fatalf("reading %s: %v", "testdata/patent-publication.json", err)
+	}
+	return s
+}
+
+var valuePatterns = map[string]*regexp.Regexp{
+	"date":    regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`),
+	"integer": regexp.MustCompile(`^\d+$`),
+}
+
+// node is an element of a document being checked.
+type node struct {
+	name     string
+	attrs    map[string]bool
+	children []*node
+	text     strings.Builder
+}
+
+// check checks an XML document against the structure, returning every violation found, each prefixed with
+// the path of the element at fault. A document that is not well-formed returns a single error.
+func (s *structure) check(data []byte) []error {
+	prefixes := make(map[string]string, len(s.Namespaces))
+	for prefix, uri := range s.Namespaces {
+		prefixes[uri] = prefix
+	}
+	qualify := func(name xml.Name) string {
+		if prefix, ok := prefixes[name.Space]; ok {
+			return prefix + ":" + name.Local
+		}
+		if name.Space != "" {
+			return "{" + name.Space + "}" + name.Local
+		}
+		return name.Local
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var root *node
+	var stack []*node
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return []error{fmt.Errorf("not well-formed: %w", err)}
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: qualify(t.Name), attrs: map[string]bool{}}
+			for _, a := range t.Attr {
+				if a.Name.Space != "xmlns" && a.Name.Local != "xmlns" {
+					n.attrs[qualify(a.Name)] = true
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+	if root == nil {
+		return []error{fmt.Errorf("no root element")}
+	}
+	if root.name != s.Root {
+		return []error{fmt.Errorf("root element is %s, expected %s", root.name, s.Root)}
+	}
+	var errs []error
+	s.checkElement(root, "/"+root.name, &errs)
+	return errs
+}
+
+func (s *structure) checkElement(n *node, path string, errs *[]error) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	def, ok := s.Elements[n.name]
+	if !ok {
+		fail("element not described")
+		return
+	}
+	for _, a := range def.Attributes {
+		if !n.attrs[a] {
+			fail("missing attribute %s", a)
+		}
+	}
+
+	switch {
+	case def.Text:
+		if len(n.children) > 0 {
+			fail("unexpected element %s in text content", n.children[0].name)
+		}
+		text := strings.TrimSpace(n.text.String())
+		if text == "" {
+			fail("empty value")
+		} else if re, ok := valuePatterns[def.Pattern]; ok && !re.MatchString(text) {
+			fail("value %q is not a valid %s", text, def.Pattern)
+		}
+		return
+	case def.Mixed != nil:
+		for _, child := range n.children {
+			allowed := false
+			for _, name := range def.Mixed {
+				allowed = allowed || child.name == name
+			}
+			if !allowed {
+				fail("unexpected element %s", child.name)
+				continue
+			}
+			s.checkElement(child, path+"/"+child.name, errs)
+		}
+		return
+	}
+
+	if strings.TrimSpace(n.text.String()) != "" {
+		fail("unexpected text content")
+	}
+	i := 0
+	for _, item := range def.Sequence {
+		count := 0
+		for i < len(n.children) && item.matches(n.children[i].name) && (count == 0 || item.Repeated) {
+			s.checkElement(n.children[i], path+"/"+n.children[i].name, errs)
+			i++
+			count++
+		}
+		if count == 0 && !item.Optional {
+			fail("missing %s", item)
+		}
+	}
+	for ; i < len(n.children); i++ {
+		fail("unexpected element %s", n.children[i].name)
+	}
+}
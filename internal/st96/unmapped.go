@@ -0,0 +1,208 @@
+package st96
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+// bibliographicPlaceholder stands for the bibliographic data element of grants and applications in mapped paths.
+const bibliographicPlaceholder = "bibliographic-data"
+
+// mappedPaths are the source elements the conversion maps, as paths below the document element, in which "*"
+// stands for any element name. An element is mapped if it is listed, lies below a listed element, or contains
+// one. The list is built from the converter itself: the bibliographic elements that fill a Bibliographic field
+// convert reads, and the elements named by the source tags of Input.
+var mappedPaths = sync.OnceValue(func() [][]string {
+	converted := convertedFields()
+	var paths [][]string
+	for path, field := range patentxml.SourceFields() {
+		if converted[field] {
+			paths = append(paths, strings.Split(bibliographicPlaceholder+"/"+path, "/"))
+		}
+	}
+	t := reflect.TypeOf(Input{})
+	for i := 0; i < t.NumField(); i++ {
+		if source := t.Field(i).Tag.Get("source"); source != "" {
+			paths = append(paths, strings.Split(source, "/"))
+		}
+	}
+	return paths
+})
+
+// convertedFields returns the Bibliographic fields that convert maps, as dotted paths such as
+// "Inventors.Address.City". A field is converted if changing its value alone changes the output, which is
+// tried on synthetic data with every other field either empty or set, and every flag either false or true.
+func convertedFields() map[string]bool {
+	var fields []string
+	leafFields(reflect.TypeOf(patentxml.Bibliographic{}), "", &fields)
+
+	converted := map[string]bool{}
+	for _, set := range []bool{false, true} {
+		for _, flags := range []bool{false, true} {
+			base := probeOutput(synthetic(set, flags, ""))
+			for _, field := range fields {
+				if !converted[field] && probeOutput(synthetic(set, flags, field)) != base {
+					converted[field] = true
+				}
+			}
+		}
+	}
+	return converted
+}
+
+func leafFields(t reflect.Type, prefix string, fields *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := f.Type
+		if ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			leafFields(ft, prefix+f.Name+".", fields)
+		} else {
+			*fields = append(*fields, prefix+f.Name)
+		}
+	}
+}
+
+// synthetic builds bibliographic data with one element in each list. Fields are empty, or set to a sample value
+// if set is true; flags are all false or all true. The changed field, if any, has a different value.
+func synthetic(set, flags bool, changed string) *patentxml.Bibliographic {
+	b := &patentxml.Bibliographic{}
+	fillSynthetic(reflect.ValueOf(b).Elem(), "", set, flags, changed)
+	return b
+}
+
+func fillSynthetic(v reflect.Value, path string, set, flags bool, changed string) {
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			fillSynthetic(v.Field(i), strings.TrimPrefix(path+"."+v.Type().Field(i).Name, "."), set, flags, changed)
+		}
+		return
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct {
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillSynthetic(v.Index(0), path, set, flags, changed)
+		return
+	}
+
+	// The value is 0 for empty, 1 for set and 2 for set to a different value
+	value := 0
+	if set {
+		value = 1
+	}
+	if path == changed {
+		value++
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(flags != (path == changed))
+	case reflect.Int:
+		v.SetInt(int64(value))
+	case reflect.String:
+		v.SetString(sampleValue(path, value))
+	case reflect.Slice:
+		if value > 0 {
+			v.Set(reflect.Append(reflect.MakeSlice(v.Type(), 0, 1), reflect.ValueOf(value).Convert(v.Type().Elem())))
+		}
+	}
+}
+
+// sampleValue returns a synthetic value in the form the conversion expects of the field, empty for 0.
+func sampleValue(path string, value int) string {
+	if value == 0 {
+		return ""
+	}
+	samples := []string{"alpha", "beta"}
+	name := path[strings.LastIndex(path, ".")+1:]
+	switch {
+	case strings.HasSuffix(name, "Date"):
+		samples = []string{"20200101", "20210202"}
+	case strings.HasSuffix(name, "Country"):
+		samples = []string{"JP", "DE"}
+	case name == "Scheme":
+		samples = []string{"cpc", "ipc"}
+	case name == "Level":
+		samples = []string{"primary", "assistant"}
+	}
+	return samples[value-1]
+}
+
+func probeOutput(biblio *patentxml.Bibliographic) string {
+	pub, _ := convert(biblio, Input{})
+	data, _ := Marshal(pub)
+	return string(data)
+}
+
+// isMapped reports whether an element, given as the names of its path, is mapped.
+func isMapped(path []string) bool {
+	for _, mapped := range mappedPaths() {
+		n := min(len(path), len(mapped))
+		if matchPath(path[:n], mapped[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(path, pattern []string) bool {
+	for i := range path {
+		if pattern[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Unmapped lists the elements of a raw grant or application that the conversion does not map, as paths below
+// the document element, with the number of times each occurs. The descendants of an unmapped element are not
+// listed. Attributes are not considered.
+func Unmapped(raw []byte) (map[string]int, error) {
+	d := xml.NewDecoder(bytes.NewReader(raw))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+
+	unmapped := map[string]int{}
+	var path []string // Element names below the document element
+	depth := 0        // Depth including the document element
+	skip := 0         // Depth of the unmapped element being skipped, 0 if none
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return unmapped, nil
+		}
+		if err != nil {
+			return unmapped, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 || skip > 0 {
+				continue
+			}
+			path = append(path, t.Name.Local)
+			key := append([]string{}, path...)
+			if strings.HasPrefix(key[0], "us-bibliographic-data-") {
+				key[0] = bibliographicPlaceholder
+			}
+			if !isMapped(key) {
+				unmapped[strings.Join(path, "/")]++
+				skip = depth
+			}
+		case xml.EndElement:
+			if depth > 1 && (skip == 0 || skip == depth) {
+				path = path[:len(path)-1]
+				if skip == depth {
+					skip = 0
+				}
+			}
+			depth--
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package st96
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/patentxml"
+)
+
+func TestSourceFieldsNameBibliographicFields(t *testing.T) {
+	var fields []string
+	leafFields(reflect.TypeOf(patentxml.Bibliographic{}), "", &fields)
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f] = true
+	}
+	for path, field := range patentxml.SourceFields() {
+		if !known[field] {
+			t.Errorf("source element %s fills unknown field %q", path, field)
+		}
+	}
+}
+
+func TestConvertedFields(t *testing.T) {
+	converted := convertedFields()
+	for _, field := range []string{
+		"Publication.DocNumber", "Publication.Date", "Application.Country", "Classifications.Main",
+		"Classifications.Section", "Inventors.FirstName", "Assignees.Address.City", "Citations.Document.Name",
+		"Citations.Text", "Citations.Category", "PriorityClaims.Date", "Examiners.Department",
+	} {
+		if !converted[field] {
+			t.Errorf("%s is not found converted", field)
+		}
+	}
+	for _, field := range []string{"SeriesCode", "ExemplaryClaims", "Classifications.Version", "Assignees.Role", "RelatedDocuments.Document.DocNumber"} {
+		if converted[field] {
+			t.Errorf("%s is found converted", field)
+		}
+	}
+}
+
+const unmappedGrant = `<?xml version="1.0" encoding="UTF-8"?>
+<us-patent-grant>
+<us-bibliographic-data-grant>
+<publication-reference><document-id><country>US</country><doc-number>11000000</doc-number><kind>B2</kind><date>20240102</date></document-id></publication-reference>
+<us-application-series-code>17</us-application-series-code>
+<invention-title id="title">Battery</invention-title>
+<us-related-documents><continuation><relation><parent-doc><document-id><doc-number>16000000</doc-number></document-id></parent-doc></relation></continuation></us-related-documents>
+<us-parties><inventors><inventor sequence="001"><addressbook><last-name>Doe</last-name><first-name>Jane</first-name></addressbook><residence><country>US</country></residence></inventor></inventors></us-parties>
+</us-bibliographic-data-grant>
+<abstract><p>An abstract.</p></abstract>
+<claims><claim id="CLM-1" num="1"><claim-text>A battery.</claim-text></claim></claims>
+</us-patent-grant>`
+
+func TestUnmapped(t *testing.T) {
+	got, err := Unmapped([]byte(unmappedGrant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{
+		"us-bibliographic-data-grant/us-application-series-code":              1,
+		"us-bibliographic-data-grant/us-related-documents":                    1,
+		"us-bibliographic-data-grant/us-parties/inventors/inventor/residence": 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		var paths []string
+		for path := range got {
+			paths = append(paths, path)
+		}
+		t.Errorf("Unmapped = %s, want %v", strings.Join(paths, ", "), want)
+	}
+}
@@ -0,0 +1,57 @@
+// Package arrowstream exposes parsed USPTO bulk data documents as Apache Arrow record batches, so that Go
+// programs can process them column by column in memory instead of reading Parquet or Arrow files back
+// from disk.
+//
+// The columns are those of the tool's Parquet output: Schema "v1" has flat string and integer columns,
+// and "v2" adds nested lists of parties, classifications, citations, priority claims, related documents
+// and claims, with dates as Arrow date32 values.
+package arrowstream
+
+import (
+	"context"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/diverged/uspt-go/types"
+	"go.uber.org/zap"
+
+	"github.com/diverged/uspto-bulk-data-tool/internal/outputhandler"
+)
+
+// Options configures the conversion. The zero value produces v1 batches of DefaultBatchSize rows.
+type Options struct {
+	SchemaVersion string // "v1" (default) or "v2"
+	TextFormat    string // Rendering of the abstract, description and claims: "innerxml" (default), "plain", "markdown" or "html"
+	// DescriptionSections fills the v2 desc_* columns with the conventional sections of the description
+	DescriptionSections bool
+	BatchSize           int              // Rows per record batch
+	Allocator           memory.Allocator // Defaults to memory.DefaultAllocator
+	Errors              chan<- error     // Receives documents with fields that could not be extracted, if not nil
+	Logger              *zap.Logger      // Defaults to a no-op logger
+}
+
+// DefaultBatchSize is the number of rows per record batch when Options.BatchSize is not set.
+const DefaultBatchSize = outputhandler.DefaultArrowBatchSize
+
+// Schema returns the Arrow schema of the record batches of a schema version.
+func Schema(schemaVersion string) *arrow.Schema {
+	return outputhandler.ArrowSchema(schemaVersion)
+}
+
+// Records converts the documents received from docs, such as those parsed by uspt-go, to record
+// batches. The returned channel is closed after docs is closed and the final, possibly smaller, batch has
+// been sent. Each record must be released by the caller.
+//
+// A consumer that stops reading before the channel is closed must cancel ctx. The channel is then closed
+// without sending further records, and the documents still sent on docs are discarded.
+func Records(ctx context.Context, docs <-chan *types.USPTGoDoc, opts Options) <-chan array.Record {
+	log := opts.Logger
+	if log == nil {
+		log = zap.NewNop()
+	}
+	return outputhandler.ArrowRecords(ctx, docs, opts.SchemaVersion, outputhandler.RowOptions{
+		TextFormat:          opts.TextFormat,
+		DescriptionSections: opts.DescriptionSections,
+	}, opts.BatchSize, opts.Allocator, opts.Errors, log)
+}
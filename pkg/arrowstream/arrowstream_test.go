@@ -0,0 +1,83 @@
+package arrowstream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/diverged/uspt-go/types"
+)
+
+// sendDocs sends n documents on an unbuffered channel, closing done once all of them have been received.
+func sendDocs(n int) (<-chan *types.USPTGoDoc, <-chan struct{}) {
+	docs := make(chan *types.USPTGoDoc)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(docs)
+		for i := 0; i < n; i++ {
+			doc := &types.USPTGoDoc{}
+			doc.Patent.MetaFileName = fmt.Sprintf("US%08d-20240102.XML", 11000000+i)
+			doc.Patent.MetaDatePubl = "20240102"
+			doc.USPTGoMetadata.DocumentType = "grant"
+			docs <- doc
+		}
+	}()
+	return docs, done
+}
+
+func TestRecords(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	docs, _ := sendDocs(5)
+
+	var rows []int64
+	for record := range Records(context.Background(), docs, Options{BatchSize: 2, Allocator: mem}) {
+		if !record.Schema().Equal(Schema("v1")) {
+			t.Errorf("record schema = %s", record.Schema())
+		}
+		rows = append(rows, record.NumRows())
+		record.Release()
+	}
+	if fmt.Sprint(rows) != "[2 2 1]" {
+		t.Errorf("batches of %v rows, want [2 2 1]", rows)
+	}
+	mem.AssertSize(t, 0)
+}
+
+func TestRecordsCancel(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	docs, sent := sendDocs(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	records := Records(ctx, docs, Options{BatchSize: 2, Allocator: mem})
+	record, ok := <-records
+	if !ok {
+		t.Fatal("no record before cancellation")
+	}
+	record.Release()
+	cancel()
+
+	// The channel is closed although docs is still open, and the remaining documents are discarded
+	timeout := time.After(10 * time.Second)
+	for closed := false; !closed; {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				closed = true
+				break
+			}
+			record.Release()
+		case <-timeout:
+			t.Fatal("records channel not closed after cancellation")
+		}
+	}
+	select {
+	case <-sent:
+	case <-timeout:
+		t.Fatal("document sender blocked after cancellation")
+	}
+	mem.AssertSize(t, 0)
+}